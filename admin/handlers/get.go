@@ -117,6 +117,17 @@ func (h *HandlersAdmin) CarvesDownloadHandler(w http.ResponseWriter, r *http.Req
 		log.Println("error getting carve")
 		return
 	}
+	carve, err := h.Carves.GetBySession(carveSession)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting carve - %v", err)
+		return
+	}
+	// Encrypted carves are decrypted on the fly and never stored in plain text
+	if carve.Encrypted() {
+		h.carveDecryptDownload(w, r, carveSession, ctx[sessions.CtxUser])
+		return
+	}
 	// Prepare file to download
 	result, err := h.Carves.Archive(carveSession, carvedFilesFolder)
 	if err != nil {
@@ -143,3 +154,68 @@ func (h *HandlersAdmin) CarvesDownloadHandler(w http.ResponseWriter, r *http.Req
 	fileReader, _ = os.Open(result.File)
 	_, _ = io.Copy(w, fileReader)
 }
+
+// Helper to decrypt and stream an encrypted carve, every download is audited
+func (h *HandlersAdmin) carveDecryptDownload(w http.ResponseWriter, r *http.Request, sessionid, username string) {
+	result, err := h.Carves.DecryptedArchive(sessionid)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error preparing encrypted carve - %v", err)
+		return
+	}
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Encrypted carve download")
+	}
+	h.Inc(metricAdminOK)
+	// Send response
+	w.Header().Set("Content-Description", "File Carve Download")
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "attachment; filename="+result.File)
+	w.Header().Set("Content-Transfer-Encoding", "binary")
+	w.Header().Set("Connection", "Keep-Alive")
+	w.Header().Set("Expires", "0")
+	w.Header().Set("Cache-Control", "must-revalidate, post-check=0, pre-check=0")
+	w.Header().Set("Pragma", "public")
+	w.Header().Set("Content-Length", strconv.FormatInt(result.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	if err := h.Carves.Decrypt(sessionid, username, r.Header.Get("X-Real-IP"), w); err != nil {
+		log.Printf("error decrypting carve - %v", err)
+	}
+}
+
+// PackExportHandler for GET requests to export packs in the osquery format
+func (h *HandlersAdmin) PackExportHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.AdminLevel, users.NoEnvironment) {
+		log.Printf("%s has insuficient permissions", ctx[sessions.CtxUser])
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Extract pack to export
+	packName, ok := vars["name"]
+	if !ok {
+		h.Inc(metricAdminErr)
+		log.Println("error getting pack")
+		return
+	}
+	exported, err := h.Packs.Export(packName)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error exporting pack - %v", err)
+		return
+	}
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Pack export")
+	}
+	h.Inc(metricAdminOK)
+	// Send response
+	w.Header().Set("Content-Type", utils.JSONApplicationUTF8)
+	w.Header().Set("Content-Disposition", "attachment; filename="+packName+".conf")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(exported)
+}
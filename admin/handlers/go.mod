@@ -7,10 +7,12 @@ require (
 	github.com/jinzhu/gorm v1.9.16
 	github.com/jmpsec/osctrl/admin/sessions v0.2.2
 	github.com/jmpsec/osctrl/carves v0.2.2
+	github.com/jmpsec/osctrl/configs v0.2.2
 	github.com/jmpsec/osctrl/environments v0.2.2
 	github.com/jmpsec/osctrl/logging v0.2.2
 	github.com/jmpsec/osctrl/metrics v0.2.2
 	github.com/jmpsec/osctrl/nodes v0.2.2
+	github.com/jmpsec/osctrl/packs v0.2.2
 	github.com/jmpsec/osctrl/queries v0.2.2
 	github.com/jmpsec/osctrl/settings v0.2.2
 	github.com/jmpsec/osctrl/tags v0.0.0-20200527045717-0e3b5d71cf19
@@ -21,6 +23,8 @@ require (
 
 replace github.com/jmpsec/osctrl/carves => ../../carves
 
+replace github.com/jmpsec/osctrl/configs => ../../configs
+
 replace github.com/jmpsec/osctrl/settings => ../../settings
 
 replace github.com/jmpsec/osctrl/environments => ../../environments
@@ -42,3 +46,5 @@ replace github.com/jmpsec/osctrl/logging => ../../logging
 replace github.com/jmpsec/osctrl/tls/handlers => ./tls/handlers
 
 replace github.com/jmpsec/osctrl/admin/sessions => ../sessions
+
+replace github.com/jmpsec/osctrl/packs => ../../packs
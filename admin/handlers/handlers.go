@@ -4,10 +4,12 @@ import (
 	"github.com/jinzhu/gorm"
 	"github.com/jmpsec/osctrl/admin/sessions"
 	"github.com/jmpsec/osctrl/carves"
+	"github.com/jmpsec/osctrl/configs"
 	"github.com/jmpsec/osctrl/environments"
 	"github.com/jmpsec/osctrl/logging"
 	"github.com/jmpsec/osctrl/metrics"
 	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/packs"
 	"github.com/jmpsec/osctrl/queries"
 	"github.com/jmpsec/osctrl/settings"
 	"github.com/jmpsec/osctrl/tags"
@@ -44,12 +46,15 @@ type HandlersAdmin struct {
 	Nodes          *nodes.NodeManager
 	Queries        *queries.Queries
 	Carves         *carves.Carves
+	Packs          *packs.Packs
+	Configs        *configs.Configs
 	Settings       *settings.Settings
 	Metrics        *metrics.Metrics
 	LoggerDB       *logging.LoggerDB
 	Sessions       *sessions.SessionManager
 	ServiceVersion string
 	OsqueryTables  []types.OsqueryTable
+	OsquerySchema  []queries.TableSchema
 	AdminConfig    *types.JSONConfigurationService
 }
 
@@ -103,6 +108,18 @@ func WithCarves(carves *carves.Carves) HandlersOption {
 	}
 }
 
+func WithPacks(packs *packs.Packs) HandlersOption {
+	return func(h *HandlersAdmin) {
+		h.Packs = packs
+	}
+}
+
+func WithConfigs(configs *configs.Configs) HandlersOption {
+	return func(h *HandlersAdmin) {
+		h.Configs = configs
+	}
+}
+
 func WithMetrics(metrics *metrics.Metrics) HandlersOption {
 	return func(h *HandlersAdmin) {
 		h.Metrics = metrics
@@ -133,6 +150,12 @@ func WithOsqueryTables(tables []types.OsqueryTable) HandlersOption {
 	}
 }
 
+func WithOsquerySchema(schema []queries.TableSchema) HandlersOption {
+	return func(h *HandlersAdmin) {
+		h.OsquerySchema = schema
+	}
+}
+
 func WithAdminConfig(config *types.JSONConfigurationService) HandlersOption {
 	return func(h *HandlersAdmin) {
 		h.AdminConfig = config
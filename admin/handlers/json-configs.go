@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jmpsec/osctrl/admin/sessions"
+	"github.com/jmpsec/osctrl/settings"
+	"github.com/jmpsec/osctrl/users"
+	"github.com/jmpsec/osctrl/utils"
+)
+
+// JSONEffectiveConfigHandler for the effective configuration of a node in JSON
+func (h *HandlersAdmin) JSONEffectiveConfigHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricJSONReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	envVar, ok := vars["environment"]
+	if !ok || !h.Envs.Exists(envVar) {
+		adminErrorResponse(w, "error getting environment", http.StatusInternalServerError, nil)
+		h.Inc(metricJSONErr)
+		return
+	}
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.EnvLevel, envVar) {
+		adminErrorResponse(w, fmt.Sprintf("%s has insuficient permissions", ctx[sessions.CtxUser]), http.StatusForbidden, nil)
+		h.Inc(metricJSONErr)
+		return
+	}
+	// Extract UUID
+	uuidVar, ok := vars["uuid"]
+	if !ok {
+		adminErrorResponse(w, "error getting uuid", http.StatusInternalServerError, nil)
+		h.Inc(metricJSONErr)
+		return
+	}
+	node, err := h.Nodes.GetByUUIDEnv(uuidVar, envVar)
+	if err != nil {
+		adminErrorResponse(w, "error getting node", http.StatusNotFound, err)
+		h.Inc(metricJSONErr)
+		return
+	}
+	effective, err := h.Configs.Effective(node)
+	if err != nil {
+		adminErrorResponse(w, "error composing configuration", http.StatusInternalServerError, err)
+		h.Inc(metricJSONErr)
+		return
+	}
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Printf("DebugService: Effective configuration for %s", uuidVar)
+	}
+	// Serve JSON
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, effective)
+	h.Inc(metricJSONOK)
+}
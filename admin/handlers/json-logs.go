@@ -4,9 +4,11 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/jmpsec/osctrl/admin/sessions"
+	"github.com/jmpsec/osctrl/logging"
 	"github.com/jmpsec/osctrl/settings"
 	"github.com/jmpsec/osctrl/users"
 	"github.com/jmpsec/osctrl/utils"
@@ -38,11 +40,21 @@ type LogJSON struct {
 	Second  string        `json:"second"`
 }
 
-// ReturnedQueryLogs to return a JSON with query logs
+// ReturnedQueryLogs to return a JSON with query logs, paginated when it is requested by the table
 type ReturnedQueryLogs struct {
-	Data []QueryLogJSON `json:"data"`
+	Draw            int            `json:"draw"`
+	RecordsTotal    int            `json:"recordsTotal"`
+	RecordsFiltered int            `json:"recordsFiltered"`
+	Data            []QueryLogJSON `json:"data"`
 }
 
+const (
+	// Default number of query logs per page
+	defaultQueryLogsPage = 100
+	// Maximum number of query logs per page
+	maxQueryLogsPage = 1000
+)
+
 // QueryLogJSON to be used to populate JSON data for a query log
 type QueryLogJSON struct {
 	Created CreationTimes `json:"created"`
@@ -177,8 +189,27 @@ func (h *HandlersAdmin) JSONQueryLogsHandler(w http.ResponseWriter, r *http.Requ
 		h.Inc(metricJSONErr)
 		return
 	}
-	// Get logs
-	queryLogs, err := h.LoggerDB.QueryLogs(name)
+	// Get logs, one page at a time if the table is requesting pages
+	var queryLogs []logging.OsqueryQueryData
+	var total int
+	var err error
+	draw, paginated := queryLogsPagination(r)
+	if paginated {
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		length, _ := strconv.Atoi(r.URL.Query().Get("length"))
+		if start < 0 {
+			start = 0
+		}
+		if length <= 0 {
+			length = defaultQueryLogsPage
+		}
+		if length > maxQueryLogsPage {
+			length = maxQueryLogsPage
+		}
+		queryLogs, total, err = h.LoggerDB.QueryLogsPage(name, start, length, true)
+	} else {
+		queryLogs, err = h.LoggerDB.QueryLogs(name)
+	}
 	if err != nil {
 		log.Printf("error getting logs %v", err)
 		h.Inc(metricJSONErr)
@@ -200,7 +231,189 @@ func (h *HandlersAdmin) JSONQueryLogsHandler(w http.ResponseWriter, r *http.Requ
 	returned := ReturnedQueryLogs{
 		Data: queryLogJSON,
 	}
+	if paginated {
+		returned.Draw = draw
+		returned.RecordsTotal = total
+		returned.RecordsFiltered = total
+	}
 	// Serialize and serve JSON
 	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, returned)
 	h.Inc(metricJSONOK)
 }
+
+// QueryStreamHandler for GET requests to stream the results of an on-demand query with Server-Sent Events
+func (h *HandlersAdmin) QueryStreamHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), false)
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.QueryLevel, users.NoEnvironment) {
+		log.Printf("%s has insuficient permissions", ctx[sessions.CtxUser])
+		h.Inc(metricAdminErr)
+		return
+	}
+	vars := mux.Vars(r)
+	// Extract query name
+	name, ok := vars["name"]
+	if !ok {
+		log.Println("error getting name")
+		h.Inc(metricAdminErr)
+		return
+	}
+	if _, err := h.Queries.Get(name); err != nil {
+		adminErrorResponse(w, "query not found", http.StatusNotFound, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	if err := logging.StreamSupported(h.Settings); err != nil {
+		adminErrorResponse(w, "results can not be streamed", http.StatusNotImplemented, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	sse, err := utils.NewSSEWriter(w)
+	if err != nil {
+		adminErrorResponse(w, "error streaming results", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Streams end when the query is finished or the client goes away
+	err = h.LoggerDB.StreamQueryLogs(r.Context(), name, streamLastID(r), h.Queries, h.Nodes, func(e logging.StreamEvent) error {
+		return sse.Send(e.ID, e.Event, e.Data)
+	})
+	if err != nil {
+		log.Printf("error streaming results for %s - %v", name, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Query stream finished")
+	}
+	h.Inc(metricAdminOK)
+}
+
+// QueryExportHandler for GET requests to download the results of an on-demand query as CSV, NDJSON or XLSX
+func (h *HandlersAdmin) QueryExportHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), false)
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.QueryLevel, users.NoEnvironment) {
+		log.Printf("%s has insuficient permissions", ctx[sessions.CtxUser])
+		h.Inc(metricAdminErr)
+		return
+	}
+	vars := mux.Vars(r)
+	// Extract query name and format
+	name, ok := vars["name"]
+	if !ok {
+		log.Println("error getting name")
+		h.Inc(metricAdminErr)
+		return
+	}
+	format := vars["format"]
+	if !logging.ValidExportFormat(format) {
+		log.Printf("invalid export format %s", format)
+		h.Inc(metricAdminErr)
+		return
+	}
+	if _, err := h.Queries.Get(name); err != nil {
+		log.Printf("query %s does not exist", name)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Results are streamed, errors after this point can only be logged
+	w.Header().Set(utils.ContentType, logging.ExportContentTypes[format])
+	w.Header().Set("Content-Disposition", "attachment; filename="+logging.ExportFilename(name, format))
+	if err := h.LoggerDB.ExportQueryLogs(name, format, h.Nodes, w); err != nil {
+		log.Printf("error exporting results of %s - %v", name, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Printf("DebugService: Results of %s exported as %s", name, format)
+	}
+	h.Inc(metricAdminOK)
+}
+
+// JSONQueryAggregateHandler for JSON aggregated query results, grouping by the columns in the group
+// parameter and keeping the rows that satisfy every filter parameter
+func (h *HandlersAdmin) JSONQueryAggregateHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricJSONReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), false)
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.QueryLevel, users.NoEnvironment) {
+		log.Printf("%s has insuficient permissions", ctx[sessions.CtxUser])
+		h.Inc(metricJSONErr)
+		return
+	}
+	vars := mux.Vars(r)
+	// Extract query name
+	name, ok := vars["name"]
+	if !ok {
+		log.Println("error getting name")
+		h.Inc(metricJSONErr)
+		return
+	}
+	if _, err := h.Queries.Get(name); err != nil {
+		adminErrorResponse(w, "query not found", http.StatusNotFound, err)
+		h.Inc(metricJSONErr)
+		return
+	}
+	// Prepare aggregation from parameters
+	params := r.URL.Query()
+	request := logging.AggregateRequest{
+		LeastFrequent: params.Get("least") == "true",
+	}
+	for _, g := range strings.Split(params.Get("group"), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			request.GroupBy = append(request.GroupBy, g)
+		}
+	}
+	for _, f := range params["filter"] {
+		if f == "" {
+			continue
+		}
+		filter, err := logging.ParseAggregateFilter(f)
+		if err != nil {
+			adminErrorResponse(w, err.Error(), http.StatusBadRequest, err)
+			h.Inc(metricJSONErr)
+			return
+		}
+		request.Filters = append(request.Filters, filter)
+	}
+	if l := params.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil {
+			adminErrorResponse(w, "invalid limit", http.StatusBadRequest, err)
+			h.Inc(metricJSONErr)
+			return
+		}
+		request.Limit = limit
+	}
+	result, err := h.LoggerDB.AggregateQueryLogs(name, request, h.Nodes)
+	if err != nil {
+		adminErrorResponse(w, err.Error(), http.StatusBadRequest, err)
+		h.Inc(metricJSONErr)
+		return
+	}
+	// Serialize and serve JSON
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, result)
+	h.Inc(metricJSONOK)
+}
+
+// Helper to get the draw counter sent by tables requesting query logs one page at a time
+func queryLogsPagination(r *http.Request) (int, bool) {
+	draw := r.URL.Query().Get("draw")
+	if draw == "" {
+		return 0, false
+	}
+	d, err := strconv.Atoi(draw)
+	if err != nil {
+		return 0, false
+	}
+	return d, true
+}
@@ -50,6 +50,30 @@ type QueryTarget struct {
 	Value string `json:"value"`
 }
 
+// QueryPreview to return the nodes targeted by a query before running it
+type QueryPreview struct {
+	Count int                `json:"count"`
+	Nodes []QueryPreviewNode `json:"nodes"`
+}
+
+// QueryPreviewNode to be returned with the preview of a query
+type QueryPreviewNode struct {
+	UUID        string `json:"uuid"`
+	Hostname    string `json:"hostname"`
+	Platform    string `json:"platform"`
+	Environment string `json:"environment"`
+}
+
+// SavedQueryJSON to be used to populate the query run page with a saved query
+type SavedQueryJSON struct {
+	Name        string                        `json:"name"`
+	Description string                        `json:"description"`
+	Query       string                        `json:"query"`
+	Tags        []string                      `json:"tags"`
+	Version     int                           `json:"version"`
+	Parameters  []queries.SavedQueryParameter `json:"parameters"`
+}
+
 // Handler for JSON queries by target
 func (h *HandlersAdmin) JSONQueryHandler(w http.ResponseWriter, r *http.Request) {
 	h.Inc(metricJSONReq)
@@ -83,6 +107,17 @@ func (h *HandlersAdmin) JSONQueryHandler(w http.ResponseWriter, r *http.Request)
 		h.Inc(metricJSONErr)
 		return
 	}
+	// Retrieve execution stats for all those queries
+	var names []string
+	for _, q := range qs {
+		names = append(names, q.Name)
+	}
+	summaries, err := h.Queries.ExecutionSummaries(names)
+	if err != nil {
+		log.Printf("error getting execution stats %v", err)
+		h.Inc(metricJSONErr)
+		return
+	}
 	// Prepare data to be returned
 	qJSON := []QueryJSON{}
 	for _, q := range qs {
@@ -95,6 +130,18 @@ func (h *HandlersAdmin) JSONQueryHandler(w http.ResponseWriter, r *http.Request)
 		progress["expected"] = q.Expected
 		progress["executions"] = q.Executions
 		progress["errors"] = q.Errors
+		if q.Discovery != "" {
+			progress["skipped"] = q.Skipped
+		}
+		if summary := summaries[q.Name]; summary.Reported > 0 {
+			progress["wall_time_p95"] = int(summary.WallTimeP95)
+			progress["memory_p95"] = int(summary.MemoryP95)
+		}
+		if q.Expired {
+			status = queries.StatusExpired
+			noAnswers, _ := h.Queries.GetNoAnswers(q.Name)
+			progress["noanswer"] = len(noAnswers)
+		}
 		data := make(QueryData)
 		data["query"] = q.Query
 		data["name"] = q.Name
@@ -131,3 +178,53 @@ func (h *HandlersAdmin) JSONQueryHandler(w http.ResponseWriter, r *http.Request)
 	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, returned)
 	h.Inc(metricJSONOK)
 }
+
+// JSONSavedQueryHandler for JSON saved queries by name
+func (h *HandlersAdmin) JSONSavedQueryHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricJSONReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), false)
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.QueryLevel, users.NoEnvironment) {
+		log.Printf("%s has insuficient permissions", ctx[sessions.CtxUser])
+		h.Inc(metricJSONErr)
+		return
+	}
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		log.Println("error getting name")
+		h.Inc(metricJSONErr)
+		return
+	}
+	saved, err := h.Queries.GetSaved(name)
+	if err != nil {
+		log.Printf("error getting saved query %v", err)
+		h.Inc(metricJSONErr)
+		return
+	}
+	if !queries.CanAccessSaved(saved, ctx[sessions.CtxUser], h.Users.IsAdmin(ctx[sessions.CtxUser])) {
+		log.Printf("%s can not access saved query %s", ctx[sessions.CtxUser], name)
+		h.Inc(metricJSONErr)
+		return
+	}
+	params, err := h.Queries.GetSavedParameters(name)
+	if err != nil {
+		log.Printf("error getting saved query parameters %v", err)
+		h.Inc(metricJSONErr)
+		return
+	}
+	returned := SavedQueryJSON{
+		Name:        saved.Name,
+		Description: saved.Description,
+		Query:       saved.Query,
+		Tags:        queries.SplitTags(saved.Tags),
+		Version:     saved.Version,
+		Parameters:  params,
+	}
+	// Serve JSON
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, returned)
+	h.Inc(metricJSONOK)
+}
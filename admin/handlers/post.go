@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/jmpsec/osctrl/admin/sessions"
+	"github.com/jmpsec/osctrl/carves"
+	"github.com/jmpsec/osctrl/configs"
 	"github.com/jmpsec/osctrl/environments"
 	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/packs"
 	"github.com/jmpsec/osctrl/queries"
 	"github.com/jmpsec/osctrl/settings"
 	"github.com/jmpsec/osctrl/users"
@@ -120,16 +124,70 @@ func (h *HandlersAdmin) QueryRunPOSTHandler(w http.ResponseWriter, r *http.Reque
 		h.Inc(metricAdminErr)
 		return
 	}
-	// FIXME check validity of query
+	// Saved queries are launched with their parameters filled in
+	if q.SavedQuery != "" {
+		saved, err := h.Queries.GetSaved(q.SavedQuery)
+		if err != nil || !queries.CanAccessSaved(saved, ctx[sessions.CtxUser], h.Users.IsAdmin(ctx[sessions.CtxUser])) {
+			adminErrorResponse(w, "error getting saved query", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		if q.Query, err = h.Queries.RenderSaved(saved.Name, q.Parameters); err != nil {
+			adminErrorResponse(w, "invalid parameters: "+err.Error(), http.StatusInternalServerError, nil)
+			h.Inc(metricAdminErr)
+			return
+		}
+	}
 	// Query can not be empty
 	if q.Query == "" {
 		adminErrorResponse(w, "query can not be empty", http.StatusInternalServerError, nil)
 		h.Inc(metricAdminErr)
 		return
 	}
+	// Check query against the osquery schema, warnings do not stop the query
+	if lint := queries.Lint(q.Query, h.OsquerySchema, q.Platforms); !lint.Valid {
+		adminErrorResponse(w, "invalid query: "+strings.Join(lint.Errors, ", "), http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	if q.Discovery != "" {
+		if lint := queries.Lint(q.Discovery, h.OsquerySchema, q.Platforms); !lint.Valid {
+			adminErrorResponse(w, "invalid discovery query: "+strings.Join(lint.Errors, ", "), http.StatusInternalServerError, nil)
+			h.Inc(metricAdminErr)
+			return
+		}
+	}
+	// Targets matched against node attributes, only existing tags are used
+	var tagList []string
+	for _, t := range q.Tags {
+		if h.Tags.Exists(t) {
+			tagList = append(tagList, t)
+		}
+	}
+	matchTargets, err := queries.BuildTargets(tagList, q.Hostnames, q.CIDRs, q.OsqueryVersion, q.PlatformVersion, q.TargetExpression)
+	if err != nil {
+		adminErrorResponse(w, "invalid query targets", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Scheduled queries are materialized later, following the schedule
+	if q.Schedule != "" {
+		h.scheduleQuery(w, ctx[sessions.CtxUser], q, matchTargets)
+		return
+	}
 	// FIXME check if query is carve and user has permissions to carve
 	// Prepare and create new query
 	newQuery := newQueryReady(ctx[sessions.CtxUser], q.Query)
+	newQuery.Expiration = h.queryExpiration(q.ExpirationHours)
+	newQuery.SavedQuery = q.SavedQuery
+	newQuery.Discovery = q.Discovery
+	newQuery.MaxRows = q.MaxRows
+	newQuery.MaxBytes = q.MaxBytes
+	// Queries stay pending until the approval policy is checked against the targeted nodes
+	policy := h.approvalPolicy()
+	if policy.Enabled() {
+		newQuery.Approval = queries.ApprovalPending
+	}
 	if err := h.Queries.Create(newQuery); err != nil {
 		adminErrorResponse(w, "error creating query", http.StatusInternalServerError, err)
 		h.Inc(metricAdminErr)
@@ -206,6 +264,31 @@ func (h *HandlersAdmin) QueryRunPOSTHandler(w http.ResponseWriter, r *http.Reque
 			}
 		}
 	}
+	// Create tag, hostname pattern, CIDR and version targets
+	if len(matchTargets) > 0 {
+		for _, t := range matchTargets {
+			if err := h.Queries.CreateTarget(newQuery.Name, t.Type, t.Value); err != nil {
+				adminErrorResponse(w, "error creating query "+t.Type+" target", http.StatusInternalServerError, err)
+				h.Inc(metricAdminErr)
+				return
+			}
+		}
+		nodes, err := h.Nodes.Gets("active", h.Settings.InactiveHours())
+		if err != nil {
+			adminErrorResponse(w, "error getting nodes", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		matched, err := h.Queries.MatchingNodes(matchTargets, nodes)
+		if err != nil {
+			adminErrorResponse(w, "error matching nodes", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		for _, n := range matched {
+			expected = append(expected, n.UUID)
+		}
+	}
 	// Remove duplicates from expected
 	expectedClear := removeStringDuplicates(expected)
 	// Update value for expected
@@ -214,14 +297,452 @@ func (h *HandlersAdmin) QueryRunPOSTHandler(w http.ResponseWriter, r *http.Reque
 		h.Inc(metricAdminErr)
 		return
 	}
+	// Track the delivery of the query to each targeted node
+	if err := h.Queries.InitStatuses(newQuery.Name, h.Nodes, h.Settings.InactiveHours()); err != nil {
+		adminErrorResponse(w, "error initializing node statuses", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	pending, reason, err := h.checkApproval(newQuery.Name, policy)
+	if err != nil {
+		adminErrorResponse(w, "error checking approval", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
 	// Serialize and send response
 	if h.Settings.DebugService(settings.ServiceAdmin) {
 		log.Println("DebugService: Query run response sent")
 	}
+	if pending {
+		adminOKResponse(w, "query pending approval: "+reason)
+		h.Inc(metricAdminOK)
+		return
+	}
+	adminOKResponse(w, "OK")
+	h.Inc(metricAdminOK)
+}
+
+// Helper to create a scheduled query with its targets from a query request
+func (h *HandlersAdmin) scheduleQuery(w http.ResponseWriter, user string, q DistributedQueryRequest, matchTargets []queries.DistributedQueryTarget) {
+	if !queries.ValidScheduleName(q.ScheduleName) {
+		adminErrorResponse(w, "invalid schedule name", http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	if _, err := h.Queries.GetSchedule(q.ScheduleName); err == nil {
+		adminErrorResponse(w, "schedule already exists", http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	if _, err := queries.ParseCron(q.Schedule); err != nil {
+		adminErrorResponse(w, "invalid schedule", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	newSchedule := queries.ScheduledQuery{
+		Name:            q.ScheduleName,
+		Creator:         user,
+		Query:           q.Query,
+		Schedule:        q.Schedule,
+		ExpirationHours: q.ExpirationHours,
+	}
+	if err := h.Queries.CreateSchedule(newSchedule); err != nil {
+		adminErrorResponse(w, "error creating schedule", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Targets are resolved to nodes on every run
+	targets := h.requestTargets(q, matchTargets)
+	for _, t := range targets {
+		if err := h.Queries.CreateScheduleTarget(newSchedule.Name, t.Type, t.Value); err != nil {
+			adminErrorResponse(w, "error creating schedule target", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+	}
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Query schedule response sent")
+	}
 	adminOKResponse(w, "OK")
 	h.Inc(metricAdminOK)
 }
 
+// Helper to collect all the valid targets of a query request
+func (h *HandlersAdmin) requestTargets(q DistributedQueryRequest, matchTargets []queries.DistributedQueryTarget) []queries.DistributedQueryTarget {
+	var targets []queries.DistributedQueryTarget
+	for _, e := range q.Environments {
+		if (e != "") && h.Envs.Exists(e) {
+			targets = append(targets, queries.DistributedQueryTarget{Type: queries.QueryTargetEnvironment, Value: e})
+		}
+	}
+	platforms, _ := h.Nodes.GetAllPlatforms()
+	for _, p := range q.Platforms {
+		if (p != "") && checkValidPlatform(platforms, p) {
+			targets = append(targets, queries.DistributedQueryTarget{Type: queries.QueryTargetPlatform, Value: p})
+		}
+	}
+	for _, u := range q.UUIDs {
+		if (u != "") && h.Nodes.CheckByUUID(u) {
+			targets = append(targets, queries.DistributedQueryTarget{Type: queries.QueryTargetUUID, Value: u})
+		}
+	}
+	for _, _h := range q.Hosts {
+		if (_h != "") && h.Nodes.CheckByHost(_h) {
+			targets = append(targets, queries.DistributedQueryTarget{Type: queries.QueryTargetLocalname, Value: _h})
+		}
+	}
+	return append(targets, matchTargets...)
+}
+
+// Helper to get the active nodes targeted by a query request
+func (h *HandlersAdmin) targetedNodes(q DistributedQueryRequest) ([]nodes.OsqueryNode, error) {
+	var tagList []string
+	for _, t := range q.Tags {
+		if h.Tags.Exists(t) {
+			tagList = append(tagList, t)
+		}
+	}
+	matchTargets, err := queries.BuildTargets(tagList, q.Hostnames, q.CIDRs, q.OsqueryVersion, q.PlatformVersion, q.TargetExpression)
+	if err != nil {
+		return nil, err
+	}
+	active, err := h.Nodes.Gets("active", h.Settings.InactiveHours())
+	if err != nil {
+		return nil, err
+	}
+	return h.Queries.MatchingNodes(h.requestTargets(q, matchTargets), active)
+}
+
+// QueryLintPOSTHandler for POST requests to check a query against the osquery schema before running it
+func (h *HandlersAdmin) QueryLintPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), true)
+	var q DistributedQueryRequest
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions for query
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.QueryLevel, users.NoEnvironment) {
+		adminErrorResponse(w, fmt.Sprintf("%s has insuficient permissions", ctx[sessions.CtxUser]), http.StatusForbidden, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Parse request JSON body
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Decoding POST body")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		adminErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Check CSRF Token
+	if !sessions.CheckCSRFToken(ctx[sessions.CtxCSRF], q.CSRFToken) {
+		adminErrorResponse(w, "invalid CSRF token", http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Platforms of the targeted nodes, to warn about tables not available on them
+	platforms := q.Platforms
+	matched, err := h.targetedNodes(q)
+	if err != nil {
+		adminErrorResponse(w, "error matching query targets", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	for _, n := range matched {
+		platforms = append(platforms, n.Platform)
+	}
+	lint := queries.Lint(q.Query, h.OsquerySchema, removeStringDuplicates(platforms))
+	// Serialize and send response
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Query lint response sent")
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, lint)
+	h.Inc(metricAdminOK)
+}
+
+// QueryPreviewPOSTHandler for POST requests to preview the nodes targeted by a query before running it
+func (h *HandlersAdmin) QueryPreviewPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), true)
+	var q DistributedQueryRequest
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions for query
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.QueryLevel, users.NoEnvironment) {
+		adminErrorResponse(w, fmt.Sprintf("%s has insuficient permissions", ctx[sessions.CtxUser]), http.StatusForbidden, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Parse request JSON body
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Decoding POST body")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		adminErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Check CSRF Token
+	if !sessions.CheckCSRFToken(ctx[sessions.CtxCSRF], q.CSRFToken) {
+		adminErrorResponse(w, "invalid CSRF token", http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Match the targets with the active nodes
+	matched, err := h.targetedNodes(q)
+	if err != nil {
+		adminErrorResponse(w, "error matching query targets", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	preview := QueryPreview{Count: len(matched), Nodes: []QueryPreviewNode{}}
+	for _, n := range matched {
+		preview.Nodes = append(preview.Nodes, QueryPreviewNode{
+			UUID:        n.UUID,
+			Hostname:    n.Hostname,
+			Platform:    n.Platform,
+			Environment: n.Environment,
+		})
+	}
+	// Serialize and send response
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Query preview response sent")
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, preview)
+	h.Inc(metricAdminOK)
+}
+
+// ScheduleActionsPOSTHandler for POST requests to pause, resume and delete scheduled queries
+func (h *HandlersAdmin) ScheduleActionsPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), true)
+	var q DistributedQueryActionRequest
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions for query
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.QueryLevel, users.NoEnvironment) {
+		adminErrorResponse(w, fmt.Sprintf("%s has insuficient permissions", ctx[sessions.CtxUser]), http.StatusForbidden, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Parse request JSON body
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Decoding POST body")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		adminErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Check CSRF Token
+	if !sessions.CheckCSRFToken(ctx[sessions.CtxCSRF], q.CSRFToken) {
+		adminErrorResponse(w, "invalid CSRF token", http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	switch q.Action {
+	case "pause":
+		for _, n := range q.Names {
+			if err := h.Queries.PauseSchedule(n); err != nil {
+				adminErrorResponse(w, "error pausing schedule", http.StatusInternalServerError, err)
+				h.Inc(metricAdminErr)
+				return
+			}
+		}
+		adminOKResponse(w, "schedules paused successfully")
+	case "resume":
+		for _, n := range q.Names {
+			if err := h.Queries.ResumeSchedule(n); err != nil {
+				adminErrorResponse(w, "error resuming schedule", http.StatusInternalServerError, err)
+				h.Inc(metricAdminErr)
+				return
+			}
+		}
+		adminOKResponse(w, "schedules resumed successfully")
+	case "delete":
+		for _, n := range q.Names {
+			if err := h.Queries.DeleteSchedule(n); err != nil {
+				adminErrorResponse(w, "error deleting schedule", http.StatusInternalServerError, err)
+				h.Inc(metricAdminErr)
+				return
+			}
+		}
+		adminOKResponse(w, "schedules deleted successfully")
+	}
+	// Serialize and send response
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Schedule actions response sent")
+	}
+	h.Inc(metricAdminOK)
+}
+
+// ApprovalActionsPOSTHandler for POST requests to approve or reject pending queries and carves
+func (h *HandlersAdmin) ApprovalActionsPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), true)
+	var a ApprovalActionRequest
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Parse request JSON body
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Decoding POST body")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		adminErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Check CSRF Token
+	if !sessions.CheckCSRFToken(ctx[sessions.CtxCSRF], a.CSRFToken) {
+		adminErrorResponse(w, "invalid CSRF token", http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	query, err := h.Queries.Get(a.Name)
+	if err != nil {
+		adminErrorResponse(w, "error getting query", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Check permissions, carves need carve permissions to be reviewed
+	level := users.QueryLevel
+	if query.Type == queries.CarveQueryType {
+		level = users.CarveLevel
+	}
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], level, users.NoEnvironment) {
+		adminErrorResponse(w, fmt.Sprintf("%s has insuficient permissions", ctx[sessions.CtxUser]), http.StatusForbidden, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	switch a.Action {
+	case "approve":
+		if err := h.Queries.Approve(a.Name, ctx[sessions.CtxUser], a.Comment); err != nil {
+			adminErrorResponse(w, "error approving query: "+err.Error(), http.StatusInternalServerError, nil)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, "query approved successfully")
+	case "reject":
+		if err := h.Queries.Reject(a.Name, ctx[sessions.CtxUser], a.Comment); err != nil {
+			adminErrorResponse(w, "error rejecting query: "+err.Error(), http.StatusInternalServerError, nil)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, "query rejected successfully")
+	default:
+		adminErrorResponse(w, "invalid action", http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Serialize and send response
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Approval action response sent")
+	}
+	h.Inc(metricAdminOK)
+}
+
+// SavedQueryActionsPOSTHandler for POST requests to save, delete, restore and import saved queries
+func (h *HandlersAdmin) SavedQueryActionsPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), true)
+	var q SavedQueryRequest
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions for query
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.QueryLevel, users.NoEnvironment) {
+		adminErrorResponse(w, fmt.Sprintf("%s has insuficient permissions", ctx[sessions.CtxUser]), http.StatusForbidden, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Parse request JSON body
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Decoding POST body")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		adminErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Check CSRF Token
+	if !sessions.CheckCSRFToken(ctx[sessions.CtxCSRF], q.CSRFToken) {
+		adminErrorResponse(w, "invalid CSRF token", http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	user := ctx[sessions.CtxUser]
+	isAdmin := h.Users.IsAdmin(user)
+	// Only owners and administrators can change existing saved queries
+	if q.Action != "import" && h.Queries.ExistsSaved(q.Name) {
+		saved, err := h.Queries.GetSaved(q.Name)
+		if err != nil || !queries.CanEditSaved(saved, user, isAdmin) {
+			adminErrorResponse(w, fmt.Sprintf("%s can not change saved query %s", user, q.Name), http.StatusForbidden, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+	}
+	switch q.Action {
+	case "save":
+		saved := queries.SavedQuery{
+			Name:        q.Name,
+			Description: q.Description,
+			Query:       q.Query,
+			Tags:        strings.Join(queries.SplitTags(q.Tags), ","),
+			Owner:       user,
+			Shared:      q.Shared,
+		}
+		if err := h.Queries.SaveQuery(saved, q.Parameters, user); err != nil {
+			adminErrorResponse(w, "error saving query: "+err.Error(), http.StatusInternalServerError, nil)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, "query saved successfully")
+	case "delete":
+		if err := h.Queries.DeleteSaved(q.Name); err != nil {
+			adminErrorResponse(w, "error deleting saved query", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, "saved query deleted successfully")
+	case "restore":
+		if err := h.Queries.RestoreSaved(q.Name, q.Version, user); err != nil {
+			adminErrorResponse(w, "error restoring saved query", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, "saved query restored successfully")
+	case "import":
+		pack, err := base64.StdEncoding.DecodeString(q.PackB64)
+		if err != nil {
+			adminErrorResponse(w, "error decoding pack", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		// Replacing is limited to saved queries that can be changed by the user
+		if q.Replace && !isAdmin {
+			adminErrorResponse(w, "only administrators can replace saved queries", http.StatusForbidden, nil)
+			h.Inc(metricAdminErr)
+			return
+		}
+		imported, err := h.Queries.ImportPack(q.Pack, pack, user, q.Shared, q.Replace)
+		if err != nil {
+			adminErrorResponse(w, "error importing pack: "+err.Error(), http.StatusInternalServerError, nil)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, fmt.Sprintf("%d queries imported successfully", len(imported)))
+	default:
+		adminErrorResponse(w, "invalid action", http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Serialize and send response
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Saved query actions response sent")
+	}
+	h.Inc(metricAdminOK)
+}
+
 // CarvesRunPOSTHandler for POST requests to run file carves
 func (h *HandlersAdmin) CarvesRunPOSTHandler(w http.ResponseWriter, r *http.Request) {
 	h.Inc(metricAdminReq)
@@ -257,7 +778,7 @@ func (h *HandlersAdmin) CarvesRunPOSTHandler(w http.ResponseWriter, r *http.Requ
 		h.Inc(metricAdminErr)
 		return
 	}
-	query := generateCarveQuery(c.Path, false)
+	query := carves.GenerateQuery(c.Path, false)
 	// Prepare and create new carve
 	carveName := generateCarveName()
 	newQuery := queries.DistributedQuery{
@@ -271,6 +792,12 @@ func (h *HandlersAdmin) CarvesRunPOSTHandler(w http.ResponseWriter, r *http.Requ
 		Deleted:    false,
 		Type:       queries.CarveQueryType,
 		Path:       c.Path,
+		Expiration: h.queryExpiration(c.ExpirationHours),
+	}
+	// Carves stay pending until the approval policy is checked against the targeted nodes
+	policy := h.approvalPolicy()
+	if policy.Enabled() {
+		newQuery.Approval = queries.ApprovalPending
 	}
 	if err := h.Queries.Create(newQuery); err != nil {
 		adminErrorResponse(w, "error creating carve", http.StatusInternalServerError, err)
@@ -279,6 +806,8 @@ func (h *HandlersAdmin) CarvesRunPOSTHandler(w http.ResponseWriter, r *http.Requ
 	}
 	// Temporary list of UUIDs to calculate Expected
 	var expected []string
+	// Temporary list of environments to check carve quotas
+	var targetEnvs []string
 	// Create environment target
 	if len(c.Environments) > 0 {
 		for _, e := range c.Environments {
@@ -297,6 +826,7 @@ func (h *HandlersAdmin) CarvesRunPOSTHandler(w http.ResponseWriter, r *http.Requ
 				for _, n := range nodes {
 					expected = append(expected, n.UUID)
 				}
+				targetEnvs = append(targetEnvs, e)
 			}
 		}
 	}
@@ -318,6 +848,7 @@ func (h *HandlersAdmin) CarvesRunPOSTHandler(w http.ResponseWriter, r *http.Requ
 				}
 				for _, n := range nodes {
 					expected = append(expected, n.UUID)
+					targetEnvs = append(targetEnvs, n.Environment)
 				}
 			}
 		}
@@ -332,6 +863,9 @@ func (h *HandlersAdmin) CarvesRunPOSTHandler(w http.ResponseWriter, r *http.Requ
 					return
 				}
 				expected = append(expected, u)
+				if n, err := h.Nodes.GetByUUID(u); err == nil {
+					targetEnvs = append(targetEnvs, n.Environment)
+				}
 			}
 		}
 	}
@@ -355,10 +889,34 @@ func (h *HandlersAdmin) CarvesRunPOSTHandler(w http.ResponseWriter, r *http.Requ
 		h.Inc(metricAdminErr)
 		return
 	}
+	// Track the delivery of the query to each targeted node
+	if err := h.Queries.InitStatuses(carveName, h.Nodes, h.Settings.InactiveHours()); err != nil {
+		adminErrorResponse(w, "error initializing node statuses", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	pending, reason, err := h.checkApproval(carveName, policy)
+	if err != nil {
+		adminErrorResponse(w, "error checking approval", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Warn about carve quotas that may reject this carve
+	warnings := h.Carves.QuotaWarnings(removeStringDuplicates(targetEnvs), ctx[sessions.CtxUser], len(expectedClear))
 	// Serialize and send response
 	if h.Settings.DebugService(settings.ServiceAdmin) {
 		log.Println("DebugService: Carve run response sent")
 	}
+	if pending {
+		adminOKResponse(w, "carve pending approval: "+strings.Join(append([]string{reason}, warnings...), "; "))
+		h.Inc(metricAdminOK)
+		return
+	}
+	if len(warnings) > 0 {
+		adminOKResponse(w, "carve created with warnings: "+strings.Join(warnings, "; "))
+		h.Inc(metricAdminOK)
+		return
+	}
 	adminOKResponse(w, "OK")
 	h.Inc(metricAdminOK)
 }
@@ -530,8 +1088,15 @@ func (h *HandlersAdmin) ConfPOSTHandler(w http.ResponseWriter, r *http.Request)
 		h.Inc(metricAdminErr)
 		return
 	}
+	// Validate configuration before saving it
+	validation := configs.Validate(string(configuration), h.tableNames())
+	if !validation.Valid {
+		adminErrorResponse(w, "invalid configuration: "+strings.Join(validation.Errors, "; "), http.StatusBadRequest, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
 	// Update configuration
-	if err := h.Envs.UpdateConfiguration(environmentVar, string(configuration)); err != nil {
+	if err := h.Envs.SaveConfiguration(environmentVar, string(configuration), ctx[sessions.CtxUser], c.Comment); err != nil {
 		adminErrorResponse(w, "error saving configuration", http.StatusInternalServerError, err)
 		h.Inc(metricAdminErr)
 		return
@@ -540,7 +1105,96 @@ func (h *HandlersAdmin) ConfPOSTHandler(w http.ResponseWriter, r *http.Request)
 	if h.Settings.DebugService(settings.ServiceAdmin) {
 		log.Println("DebugService: Configuration response sent")
 	}
-	adminOKResponse(w, "configuration saved successfully")
+	if len(validation.Warnings) > 0 {
+		adminOKResponse(w, "configuration saved with warnings: "+strings.Join(validation.Warnings, "; "))
+	} else {
+		adminOKResponse(w, "configuration saved successfully")
+	}
+	h.Inc(metricAdminOK)
+}
+
+// ConfOverlaysPOSTHandler for POST requests for configuration overlays
+func (h *HandlersAdmin) ConfOverlaysPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), true)
+	vars := mux.Vars(r)
+	// Extract environment and verify
+	environmentVar, ok := vars["environment"]
+	if !ok || !h.Envs.Exists(environmentVar) {
+		adminErrorResponse(w, "error getting environment", http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	var o ConfigOverlayRequest
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.EnvLevel, environmentVar) {
+		adminErrorResponse(w, fmt.Sprintf("%s has insuficient permissions", ctx[sessions.CtxUser]), http.StatusForbidden, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Parse request JSON body
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Decoding POST body")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+		adminErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Check CSRF Token
+	if !sessions.CheckCSRFToken(ctx[sessions.CtxCSRF], o.CSRFToken) {
+		adminErrorResponse(w, "invalid CSRF token", http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Decode received configuration
+	configuration, err := base64.StdEncoding.DecodeString(o.ConfigurationB64)
+	if err != nil {
+		adminErrorResponse(w, "error decoding configuration", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	switch o.Action {
+	case "add":
+		overlay := configs.ConfigOverlay{
+			Name:          o.Name,
+			Environment:   environmentVar,
+			Scope:         o.Scope,
+			Target:        o.Target,
+			Priority:      o.Priority,
+			Configuration: string(configuration),
+		}
+		if err := h.Configs.CreateOverlay(overlay); err != nil {
+			adminErrorResponse(w, "error creating overlay", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, "overlay added successfully")
+	case "edit":
+		if err := h.Configs.UpdateOverlay(environmentVar, o.Name, string(configuration), o.Priority); err != nil {
+			adminErrorResponse(w, "error updating overlay", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, "overlay updated successfully")
+	case "remove":
+		if err := h.Configs.DeleteOverlay(environmentVar, o.Name); err != nil {
+			adminErrorResponse(w, "error removing overlay", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, "overlay removed successfully")
+	default:
+		adminErrorResponse(w, "invalid action", http.StatusInternalServerError, fmt.Errorf("unknown action %s", o.Action))
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Serialize and send response
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Overlays response sent")
+	}
 	h.Inc(metricAdminOK)
 }
 
@@ -580,7 +1234,7 @@ func (h *HandlersAdmin) IntervalsPOSTHandler(w http.ResponseWriter, r *http.Requ
 		h.Inc(metricAdminErr)
 		return
 	}
-	if err := h.Envs.UpdateIntervals(environmentVar, c.ConfigInterval, c.LogInterval, c.QueryInterval); err != nil {
+	if err := h.Envs.SaveIntervals(environmentVar, c.ConfigInterval, c.LogInterval, c.QueryInterval, ctx[sessions.CtxUser], c.Comment); err != nil {
 		adminErrorResponse(w, "error updating intervals", http.StatusInternalServerError, err)
 		h.Inc(metricAdminErr)
 		return
@@ -593,7 +1247,7 @@ func (h *HandlersAdmin) IntervalsPOSTHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	// Update flags in the newly created environment
-	if err := h.Envs.UpdateFlags(environmentVar, flags); err != nil {
+	if err := h.Envs.SaveFlags(environmentVar, flags, ctx[sessions.CtxUser], "flags re-generated after intervals change"); err != nil {
 		adminErrorResponse(w, "error updating flags", http.StatusInternalServerError, err)
 		h.Inc(metricAdminErr)
 		return
@@ -606,6 +1260,55 @@ func (h *HandlersAdmin) IntervalsPOSTHandler(w http.ResponseWriter, r *http.Requ
 	h.Inc(metricAdminOK)
 }
 
+// ConfRollbackPOSTHandler for POST requests to rollback to a previous version
+func (h *HandlersAdmin) ConfRollbackPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), true)
+	vars := mux.Vars(r)
+	// Extract environment and verify
+	environmentVar, ok := vars["environment"]
+	if !ok || !h.Envs.Exists(environmentVar) {
+		adminErrorResponse(w, "error getting environment", http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	var rb RollbackRequest
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.EnvLevel, environmentVar) {
+		adminErrorResponse(w, fmt.Sprintf("%s has insuficient permissions", ctx[sessions.CtxUser]), http.StatusForbidden, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Parse request JSON body
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Decoding POST body")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&rb); err != nil {
+		adminErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Check CSRF Token
+	if !sessions.CheckCSRFToken(ctx[sessions.CtxCSRF], rb.CSRFToken) {
+		adminErrorResponse(w, "invalid CSRF token", http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	if err := h.Envs.Rollback(environmentVar, rb.Version, ctx[sessions.CtxUser]); err != nil {
+		adminErrorResponse(w, "error in rollback", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Serialize and send response
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Rollback response sent")
+	}
+	adminOKResponse(w, fmt.Sprintf("rollback to version %d completed", rb.Version))
+	h.Inc(metricAdminOK)
+}
+
 // ExpirationPOSTHandler for POST requests for expiring enroll links
 func (h *HandlersAdmin) ExpirationPOSTHandler(w http.ResponseWriter, r *http.Request) {
 	h.Inc(metricAdminReq)
@@ -1202,6 +1905,119 @@ func (h *HandlersAdmin) TagsPOSTHandler(w http.ResponseWriter, r *http.Request)
 	h.Inc(metricAdminOK)
 }
 
+// PacksPOSTHandler for POST request for /packs
+func (h *HandlersAdmin) PacksPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), true)
+	var p PacksRequest
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.AdminLevel, users.NoEnvironment) {
+		adminErrorResponse(w, fmt.Sprintf("%s has insuficient permissions", ctx[sessions.CtxUser]), http.StatusForbidden, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Parse request JSON body
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Decoding POST body")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		adminErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Check CSRF Token
+	if !sessions.CheckCSRFToken(ctx[sessions.CtxCSRF], p.CSRFToken) {
+		adminErrorResponse(w, "invalid CSRF token", http.StatusInternalServerError, nil)
+		h.Inc(metricAdminErr)
+		return
+	}
+	switch p.Action {
+	case "import":
+		content, err := base64.StdEncoding.DecodeString(p.ContentB64)
+		if err != nil {
+			adminErrorResponse(w, "error decoding pack", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		if err := h.Packs.Import(p.Name, p.Description, content, p.Replace); err != nil {
+			adminErrorResponse(w, "error importing pack", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, "pack imported successfully")
+	case "remove":
+		if err := h.Packs.Delete(p.Name); err != nil {
+			adminErrorResponse(w, "error removing pack", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, "pack removed successfully")
+	case "set_query":
+		query, err := base64.StdEncoding.DecodeString(p.Query.QueryB64)
+		if err != nil {
+			adminErrorResponse(w, "error decoding query", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		packQuery := packs.PackQuery{
+			Pack:        p.Name,
+			Name:        p.Query.Name,
+			Query:       string(query),
+			Interval:    p.Query.Interval,
+			Platform:    p.Query.Platform,
+			Version:     p.Query.Version,
+			Snapshot:    p.Query.Snapshot,
+			Removed:     p.Query.Removed,
+			Shard:       p.Query.Shard,
+			Description: p.Query.Description,
+			Value:       p.Query.Value,
+		}
+		if err := h.Packs.SetQuery(packQuery); err != nil {
+			adminErrorResponse(w, "error saving query", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, "query saved successfully")
+	case "remove_query":
+		if err := h.Packs.DeleteQuery(p.Name, p.Query.Name); err != nil {
+			adminErrorResponse(w, "error removing query", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, "query removed successfully")
+	case "add_target":
+		if (p.TargetType == packs.PackTargetEnvironment && !h.Envs.Exists(p.TargetValue)) || (p.TargetType == packs.PackTargetTag && !h.Tags.Exists(p.TargetValue)) {
+			adminErrorResponse(w, "error adding target", http.StatusInternalServerError, fmt.Errorf("%s %s does not exist", p.TargetType, p.TargetValue))
+			h.Inc(metricAdminErr)
+			return
+		}
+		if err := h.Packs.AddTarget(p.Name, p.TargetType, p.TargetValue); err != nil {
+			adminErrorResponse(w, "error adding target", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, "target added successfully")
+	case "remove_target":
+		if err := h.Packs.RemoveTarget(p.Name, p.TargetType, p.TargetValue); err != nil {
+			adminErrorResponse(w, "error removing target", http.StatusInternalServerError, err)
+			h.Inc(metricAdminErr)
+			return
+		}
+		adminOKResponse(w, "target removed successfully")
+	default:
+		adminErrorResponse(w, "invalid action", http.StatusInternalServerError, fmt.Errorf("unknown action %s", p.Action))
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Serialize and send response
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Packs response sent")
+	}
+	h.Inc(metricAdminOK)
+}
+
 // TagNodesPOSTHandler for POST request for /tags/nodes
 func (h *HandlersAdmin) TagNodesPOSTHandler(w http.ResponseWriter, r *http.Request) {
 	h.Inc(metricAdminReq)
@@ -5,11 +5,15 @@ import (
 	"net/http"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jmpsec/osctrl/admin/sessions"
 	"github.com/jmpsec/osctrl/carves"
+	"github.com/jmpsec/osctrl/configs"
 	"github.com/jmpsec/osctrl/environments"
+	"github.com/jmpsec/osctrl/packs"
+	"github.com/jmpsec/osctrl/queries"
 	"github.com/jmpsec/osctrl/settings"
 	"github.com/jmpsec/osctrl/users"
 	"github.com/jmpsec/osctrl/utils"
@@ -311,6 +315,20 @@ func (h *HandlersAdmin) QueryRunGETHandler(w http.ResponseWriter, r *http.Reques
 		uuids = append(uuids, n.UUID)
 		hosts = append(hosts, n.Localname)
 	}
+	// Get all tags
+	tags, err := h.Tags.All()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting tags: %v", err)
+		return
+	}
+	// Get saved queries that can be launched by this user
+	saved, err := h.Queries.GetAllSaved(ctx[sessions.CtxUser], h.Users.IsAdmin(ctx[sessions.CtxUser]))
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting saved queries: %v", err)
+		return
+	}
 	// Prepare template data
 	templateData := QueryRunTemplateData{
 		Title:         "Query osquery Nodes",
@@ -319,6 +337,8 @@ func (h *HandlersAdmin) QueryRunGETHandler(w http.ResponseWriter, r *http.Reques
 		Platforms:     platforms,
 		UUIDs:         uuids,
 		Hosts:         hosts,
+		Tags:          tags,
+		Saved:         saved,
 		Tables:        h.OsqueryTables,
 		TablesVersion: osqueryTablesVersion,
 	}
@@ -386,6 +406,233 @@ func (h *HandlersAdmin) QueryListGETHandler(w http.ResponseWriter, r *http.Reque
 	h.Inc(metricAdminOK)
 }
 
+// QuerySchedulesGETHandler for GET requests to list scheduled queries and the runs of one of them
+func (h *HandlersAdmin) QuerySchedulesGETHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.QueryLevel, users.NoEnvironment) {
+		log.Printf("%s has insuficient permissions", ctx[sessions.CtxUser])
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Prepare template
+	tempateFiles := NewTemplateFiles(templatesFilesFolder, "queries-schedules.html").filepaths
+	t, err := template.ParseFiles(tempateFiles...)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting query schedules template: %v", err)
+		return
+	}
+	// Get all environments
+	envAll, err := h.Envs.All()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting environments %v", err)
+		return
+	}
+	// Get all platforms
+	platforms, err := h.Nodes.GetAllPlatforms()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting platforms: %v", err)
+		return
+	}
+	schedules, err := h.Queries.GetSchedules()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting schedules: %v", err)
+		return
+	}
+	// Run history of the selected schedule, if any
+	var runs []queries.DistributedQuery
+	nameVar := vars["name"]
+	if nameVar != "" {
+		runs, err = h.Queries.GetRuns(nameVar)
+		if err != nil {
+			h.Inc(metricAdminErr)
+			log.Printf("error getting runs: %v", err)
+			return
+		}
+	}
+	// Prepare template data
+	templateData := QuerySchedulesTemplateData{
+		Title:        "Scheduled queries",
+		Metadata:     h.TemplateMetadata(ctx, h.ServiceVersion),
+		Environments: envAll,
+		Platforms:    platforms,
+		Schedules:    schedules,
+		Selected:     nameVar,
+		Runs:         runs,
+	}
+	if err := t.Execute(w, templateData); err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("template error %v", err)
+		return
+	}
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Query schedules template served")
+	}
+	h.Inc(metricAdminOK)
+}
+
+// QueryApprovalsGETHandler for GET requests to list queries and carves pending approval
+func (h *HandlersAdmin) QueryApprovalsGETHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), false)
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions, queries and carves can be pending approval
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.QueryLevel, users.NoEnvironment) && !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.CarveLevel, users.NoEnvironment) {
+		log.Printf("%s has insuficient permissions", ctx[sessions.CtxUser])
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Prepare template
+	tempateFiles := NewTemplateFiles(templatesFilesFolder, "queries-approvals.html").filepaths
+	t, err := template.ParseFiles(tempateFiles...)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting query approvals template: %v", err)
+		return
+	}
+	// Get all environments
+	envAll, err := h.Envs.All()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting environments %v", err)
+		return
+	}
+	// Get all platforms
+	platforms, err := h.Nodes.GetAllPlatforms()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting platforms: %v", err)
+		return
+	}
+	pending, err := h.Queries.GetPending()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting pending queries: %v", err)
+		return
+	}
+	// Approval history with the reason for each pending query
+	approvals := make(map[string][]queries.DistributedQueryApproval)
+	for _, q := range pending {
+		approvals[q.Name], err = h.Queries.GetApprovals(q.Name)
+		if err != nil {
+			h.Inc(metricAdminErr)
+			log.Printf("error getting approvals: %v", err)
+			return
+		}
+	}
+	// Prepare template data
+	templateData := QueryApprovalsTemplateData{
+		Title:        "Pending approvals",
+		Metadata:     h.TemplateMetadata(ctx, h.ServiceVersion),
+		Environments: envAll,
+		Platforms:    platforms,
+		Pending:      pending,
+		Approvals:    approvals,
+	}
+	if err := t.Execute(w, templateData); err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("template error %v", err)
+		return
+	}
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Query approvals template served")
+	}
+	h.Inc(metricAdminOK)
+}
+
+// SavedQueriesGETHandler for GET requests to list saved queries and the details of one of them
+func (h *HandlersAdmin) SavedQueriesGETHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.QueryLevel, users.NoEnvironment) {
+		log.Printf("%s has insuficient permissions", ctx[sessions.CtxUser])
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Prepare template
+	tempateFiles := NewTemplateFiles(templatesFilesFolder, "queries-saved.html").filepaths
+	t, err := template.ParseFiles(tempateFiles...)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting saved queries template: %v", err)
+		return
+	}
+	// Get all environments
+	envAll, err := h.Envs.All()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting environments %v", err)
+		return
+	}
+	// Get all platforms
+	platforms, err := h.Nodes.GetAllPlatforms()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting platforms: %v", err)
+		return
+	}
+	isAdmin := h.Users.IsAdmin(ctx[sessions.CtxUser])
+	saved, err := h.Queries.GetAllSaved(ctx[sessions.CtxUser], isAdmin)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting saved queries: %v", err)
+		return
+	}
+	// Prepare template data
+	templateData := SavedQueriesTemplateData{
+		Title:        "Saved queries",
+		Metadata:     h.TemplateMetadata(ctx, h.ServiceVersion),
+		Environments: envAll,
+		Platforms:    platforms,
+		Saved:        saved,
+		CanEdit:      true,
+	}
+	// Parameters and history of the selected saved query, if any
+	nameVar := vars["name"]
+	if nameVar != "" {
+		selected, err := h.Queries.GetSaved(nameVar)
+		if err != nil || !queries.CanAccessSaved(selected, ctx[sessions.CtxUser], isAdmin) {
+			h.Inc(metricAdminErr)
+			log.Printf("error getting saved query %s: %v", nameVar, err)
+			return
+		}
+		templateData.Selected = selected
+		templateData.CanEdit = queries.CanEditSaved(selected, ctx[sessions.CtxUser], isAdmin)
+		if templateData.Parameters, err = h.Queries.GetSavedParameters(nameVar); err != nil {
+			h.Inc(metricAdminErr)
+			log.Printf("error getting saved query parameters: %v", err)
+			return
+		}
+		if templateData.Versions, err = h.Queries.GetSavedVersions(nameVar); err != nil {
+			h.Inc(metricAdminErr)
+			log.Printf("error getting saved query versions: %v", err)
+			return
+		}
+	}
+	if err := t.Execute(w, templateData); err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("template error %v", err)
+		return
+	}
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Saved queries template served")
+	}
+	h.Inc(metricAdminOK)
+}
+
 // CarvesRunGETHandler for GET requests to run file carves
 func (h *HandlersAdmin) CarvesRunGETHandler(w http.ResponseWriter, r *http.Request) {
 	h.Inc(metricAdminReq)
@@ -434,6 +681,19 @@ func (h *HandlersAdmin) CarvesRunGETHandler(w http.ResponseWriter, r *http.Reque
 		uuids = append(uuids, n.UUID)
 		hosts = append(hosts, n.Localname)
 	}
+	// Get carve quotas that apply to this user
+	var quotas []carves.CarveQuota
+	allQuotas, err := h.Carves.GetQuotas()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting carve quotas: %v", err)
+		return
+	}
+	for _, q := range allQuotas {
+		if q.Scope == carves.QuotaEnvironment || (q.Scope == carves.QuotaUser && q.Name == ctx[sessions.CtxUser]) {
+			quotas = append(quotas, q)
+		}
+	}
 	// Prepare template data
 	templateData := CarvesRunTemplateData{
 		Title:         "Query osquery Nodes",
@@ -444,6 +704,7 @@ func (h *HandlersAdmin) CarvesRunGETHandler(w http.ResponseWriter, r *http.Reque
 		Hosts:         hosts,
 		Tables:        h.OsqueryTables,
 		TablesVersion: osqueryTablesVersion,
+		Quotas:        quotas,
 	}
 	if err := t.Execute(w, templateData); err != nil {
 		h.Inc(metricAdminErr)
@@ -532,6 +793,8 @@ func (h *HandlersAdmin) QueryLogsHandler(w http.ResponseWriter, r *http.Request)
 	// Custom functions to handle formatting
 	funcMap := template.FuncMap{
 		"queryResultLink": h.queryResultLink,
+		"milliseconds":    utils.MillisecondsDuration,
+		"bytesSize":       utils.BytesSize,
 	}
 	// Prepare template
 	tempateFiles := NewTemplateFiles(templatesFilesFolder, "queries-logs.html").filepaths
@@ -569,14 +832,155 @@ func (h *HandlersAdmin) QueryLogsHandler(w http.ResponseWriter, r *http.Request)
 		log.Printf("error getting targets %v", err)
 		return
 	}
+	// Get nodes that did not answer, if the query expired
+	noAnswers, err := h.Queries.GetNoAnswers(name)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting nodes without answer %v", err)
+		return
+	}
+	// Get the status of the query for each targeted node
+	statuses, err := h.Queries.GetStatuses(name)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting node statuses %v", err)
+		return
+	}
+	// Get the executions of the query with the stats reported by each node
+	executions, err := h.Queries.GetExecutions(name)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting query executions %v", err)
+		return
+	}
+	nodeExecutions := make(map[string]queries.DistributedQueryExecution)
+	for _, e := range executions {
+		nodeExecutions[e.UUID] = e
+	}
 	// Prepare template data
 	templateData := QueryLogsTemplateData{
-		Title:        "Query logs " + query.Name,
+		Title:          "Query logs " + query.Name,
+		Metadata:       h.TemplateMetadata(ctx, h.ServiceVersion),
+		Environments:   envAll,
+		Platforms:      platforms,
+		Query:          query,
+		QueryTargets:   targets,
+		NoAnswers:      noAnswers,
+		NodeStatuses:   statuses,
+		StatusCounts:   queries.StatusCounts(statuses),
+		Executions:     queries.SummarizeExecutions(executions),
+		NodeExecutions: nodeExecutions,
+	}
+	if err := t.Execute(w, templateData); err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("template error %v", err)
+		return
+	}
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Query logs template served")
+	}
+	h.Inc(metricAdminOK)
+}
+
+// QueryDiffHandler for GET requests to compare the results of a query with another run of the
+// same SQL, or the results of two nodes for the query
+func (h *HandlersAdmin) QueryDiffHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), false)
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.QueryLevel, users.NoEnvironment) {
+		log.Printf("%s has insuficient permissions", ctx[sessions.CtxUser])
+		h.Inc(metricAdminErr)
+		return
+	}
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		h.Inc(metricAdminErr)
+		log.Println("error getting name")
+		return
+	}
+	// Prepare template
+	tempateFiles := NewTemplateFiles(templatesFilesFolder, "queries-diff.html").filepaths
+	t, err := template.ParseFiles(tempateFiles...)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting query diff template: %v", err)
+		return
+	}
+	// Get all environments
+	envAll, err := h.Envs.All()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting environments %v", err)
+		return
+	}
+	// Get all platforms
+	platforms, err := h.Nodes.GetAllPlatforms()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting platforms: %v", err)
+		return
+	}
+	// Get query by name
+	query, err := h.Queries.Get(name)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting query %v", err)
+		return
+	}
+	// Other runs of the same SQL and nodes of this one can be compared
+	runs, err := h.Queries.GetSameQuery(query)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting query runs %v", err)
+		return
+	}
+	statuses, err := h.Queries.GetStatuses(name)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting node statuses %v", err)
+		return
+	}
+	params := r.URL.Query()
+	templateData := QueryDiffTemplateData{
+		Title:        "Query diff " + query.Name,
 		Metadata:     h.TemplateMetadata(ctx, h.ServiceVersion),
 		Environments: envAll,
 		Platforms:    platforms,
 		Query:        query,
-		QueryTargets: targets,
+		Runs:         runs,
+		NodeStatuses: statuses,
+		Target:       params.Get("target"),
+		BaseNode:     params.Get("base_node"),
+		TargetNode:   params.Get("target_node"),
+		Keys:         params.Get("keys"),
+	}
+	var keys []string
+	for _, k := range strings.Split(templateData.Keys, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	if templateData.Target != "" {
+		target, err := h.Queries.Get(templateData.Target)
+		if err != nil {
+			templateData.Error = "query " + templateData.Target + " not found"
+		} else if diff, err := h.LoggerDB.DiffQueryRuns(query, target, keys, h.Nodes); err != nil {
+			templateData.Error = err.Error()
+		} else {
+			templateData.RunsDiff = &diff
+		}
+	} else if templateData.BaseNode != "" && templateData.TargetNode != "" {
+		diff, err := h.LoggerDB.DiffQueryNodes(name, templateData.BaseNode, templateData.TargetNode, keys, h.Nodes)
+		if err != nil {
+			templateData.Error = err.Error()
+		} else {
+			templateData.NodesDiff = &diff
+		}
 	}
 	if err := t.Execute(w, templateData); err != nil {
 		h.Inc(metricAdminErr)
@@ -584,7 +988,7 @@ func (h *HandlersAdmin) QueryLogsHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	if h.Settings.DebugService(settings.ServiceAdmin) {
-		log.Println("DebugService: Query logs template served")
+		log.Println("DebugService: Query diff template served")
 	}
 	h.Inc(metricAdminOK)
 }
@@ -664,6 +1068,20 @@ func (h *HandlersAdmin) CarvesDetailsHandler(w http.ResponseWriter, r *http.Requ
 		}
 		blocks[c.SessionID] = bs
 	}
+	// Get audit entries for encrypted carves
+	audits := make(map[string][]carves.CarveAudit)
+	for _, c := range queryCarves {
+		if !c.Encrypted() {
+			continue
+		}
+		as, err := h.Carves.GetAudit(c.SessionID)
+		if err != nil {
+			h.Inc(metricAdminErr)
+			log.Printf("error getting carve audit %v", err)
+			break
+		}
+		audits[c.SessionID] = as
+	}
 	// Prepare template data
 	templateData := CarvesDetailsTemplateData{
 		Title:        "Carve details " + query.Name,
@@ -674,6 +1092,7 @@ func (h *HandlersAdmin) CarvesDetailsHandler(w http.ResponseWriter, r *http.Requ
 		QueryTargets: targets,
 		Carves:       queryCarves,
 		CarveBlocks:  blocks,
+		CarveAudits:  audits,
 	}
 	if err := t.Execute(w, templateData); err != nil {
 		h.Inc(metricAdminErr)
@@ -741,6 +1160,20 @@ func (h *HandlersAdmin) ConfGETHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("error getting environment %v", err)
 		return
 	}
+	// Get overlays for this environment
+	overlays, err := h.Configs.GetOverlays(envVar)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting overlays %v", err)
+		return
+	}
+	// Get packs assigned to this environment
+	envPacks, err := h.Packs.GetByTarget(packs.PackTargetEnvironment, envVar)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting packs %v", err)
+		return
+	}
 	// Prepare template data
 	templateData := ConfTemplateData{
 		Title:        envVar + " Configuration",
@@ -748,6 +1181,8 @@ func (h *HandlersAdmin) ConfGETHandler(w http.ResponseWriter, r *http.Request) {
 		Environment:  env,
 		Environments: envAll,
 		Platforms:    platforms,
+		Overlays:     overlays,
+		Packs:        envPacks,
 	}
 	if err := t.Execute(w, templateData); err != nil {
 		h.Inc(metricAdminErr)
@@ -760,6 +1195,203 @@ func (h *HandlersAdmin) ConfGETHandler(w http.ResponseWriter, r *http.Request) {
 	h.Inc(metricAdminOK)
 }
 
+// ConfHistoryGETHandler for GET requests for /conf/{environment}/history
+func (h *HandlersAdmin) ConfHistoryGETHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	envVar, ok := vars["environment"]
+	if !ok {
+		h.Inc(metricAdminErr)
+		log.Println("environment is missing")
+		return
+	}
+	// Check if environment is valid
+	if !h.Envs.Exists(envVar) {
+		h.Inc(metricAdminErr)
+		log.Printf("error unknown environment (%s)", envVar)
+		return
+	}
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.EnvLevel, envVar) {
+		log.Printf("%s has insuficient permissions", ctx[sessions.CtxUser])
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Prepare template
+	tempateFiles := NewTemplateFiles(templatesFilesFolder, "conf-history.html").filepaths
+	t, err := template.ParseFiles(tempateFiles...)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting conf history template: %v", err)
+		return
+	}
+	// Get stats for all environments
+	envAll, err := h.Envs.All()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting environments %v", err)
+		return
+	}
+	// Get stats for all platforms
+	platforms, err := h.Nodes.GetAllPlatforms()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting platforms: %v", err)
+		return
+	}
+	env, err := h.Envs.Get(envVar)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting environment %v", err)
+		return
+	}
+	// Get all versions for this environment
+	versions, err := h.Envs.GetVersions(envVar, "")
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting versions %v", err)
+		return
+	}
+	// Prepare template data
+	templateData := ConfHistoryTemplateData{
+		Title:        envVar + " Configuration History",
+		Metadata:     h.TemplateMetadata(ctx, h.ServiceVersion),
+		Environment:  env,
+		Environments: envAll,
+		Platforms:    platforms,
+		Versions:     versions,
+	}
+	// Compare two versions if requested
+	fromVar := r.URL.Query().Get("from")
+	toVar := r.URL.Query().Get("to")
+	if fromVar != "" && toVar != "" {
+		from, err := h.Envs.GetVersion(envVar, uint(stringToInteger(fromVar)))
+		if err != nil {
+			h.Inc(metricAdminErr)
+			log.Printf("error getting version %s %v", fromVar, err)
+			return
+		}
+		to, err := h.Envs.GetVersion(envVar, uint(stringToInteger(toVar)))
+		if err != nil {
+			h.Inc(metricAdminErr)
+			log.Printf("error getting version %s %v", toVar, err)
+			return
+		}
+		templateData.From = from
+		templateData.To = to
+		templateData.Diff = environments.DiffVersions(from, to)
+	}
+	if err := t.Execute(w, templateData); err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("template error %v", err)
+		return
+	}
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Conf history template served")
+	}
+	h.Inc(metricAdminOK)
+}
+
+// ConfDriftGETHandler for GET requests for /conf/{environment}/drift
+func (h *HandlersAdmin) ConfDriftGETHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	envVar, ok := vars["environment"]
+	if !ok {
+		h.Inc(metricAdminErr)
+		log.Println("environment is missing")
+		return
+	}
+	// Check if environment is valid
+	if !h.Envs.Exists(envVar) {
+		h.Inc(metricAdminErr)
+		log.Printf("error unknown environment (%s)", envVar)
+		return
+	}
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.EnvLevel, envVar) {
+		log.Printf("%s has insuficient permissions", ctx[sessions.CtxUser])
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Extract optional status filter
+	statusVar := r.URL.Query().Get("status")
+	if statusVar != "" && !configs.ValidDriftStatus(statusVar) {
+		h.Inc(metricAdminErr)
+		log.Printf("error invalid drift status (%s)", statusVar)
+		return
+	}
+	// Prepare template
+	tempateFiles := NewTemplateFiles(templatesFilesFolder, "conf-drift.html").filepaths
+	t, err := template.ParseFiles(tempateFiles...)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting conf drift template: %v", err)
+		return
+	}
+	// Get stats for all environments
+	envAll, err := h.Envs.All()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting environments %v", err)
+		return
+	}
+	// Get stats for all platforms
+	platforms, err := h.Nodes.GetAllPlatforms()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting platforms: %v", err)
+		return
+	}
+	env, err := h.Envs.Get(envVar)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting environment %v", err)
+		return
+	}
+	// Only active nodes are expected to be in sync
+	nodes, err := h.Nodes.GetByEnv(envVar, "active", h.Settings.InactiveHours())
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting nodes %v", err)
+		return
+	}
+	grace := h.Settings.DriftGraceMinutes()
+	drifts, err := h.Configs.DriftNodes(nodes, time.Duration(grace)*time.Minute, statusVar)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting drift %v", err)
+		return
+	}
+	// Prepare template data
+	templateData := ConfDriftTemplateData{
+		Title:        envVar + " Configuration Drift",
+		Metadata:     h.TemplateMetadata(ctx, h.ServiceVersion),
+		Environment:  env,
+		Environments: envAll,
+		Platforms:    platforms,
+		Drifts:       drifts,
+		GraceMinutes: grace,
+	}
+	if err := t.Execute(w, templateData); err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("template error %v", err)
+		return
+	}
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Conf drift template served")
+	}
+	h.Inc(metricAdminOK)
+}
+
 // EnrollGETHandler for GET requests for /enroll
 func (h *HandlersAdmin) EnrollGETHandler(w http.ResponseWriter, r *http.Request) {
 	h.Inc(metricAdminReq)
@@ -1202,3 +1834,92 @@ func (h *HandlersAdmin) TagsGETHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	h.Inc(metricAdminOK)
 }
+
+// PacksGETHandler for GET requests for /packs
+func (h *HandlersAdmin) PacksGETHandler(w http.ResponseWriter, r *http.Request) {
+	h.Inc(metricAdminReq)
+	utils.DebugHTTPDump(r, h.Settings.DebugHTTP(settings.ServiceAdmin), false)
+	// Get context data
+	ctx := r.Context().Value(sessions.ContextKey("session")).(sessions.ContextValue)
+	// Check permissions
+	if !h.Users.CheckPermissions(ctx[sessions.CtxUser], users.AdminLevel, users.NoEnvironment) {
+		log.Printf("%s has insuficient permissions", ctx[sessions.CtxUser])
+		h.Inc(metricAdminErr)
+		return
+	}
+	// Custom functions to handle formatting
+	funcMap := template.FuncMap{
+		"pastFutureTimes": utils.PastFutureTimes,
+		"inFutureTime":    utils.InFutureTime,
+	}
+	// Prepare template
+	tempateFiles := NewTemplateFiles(templatesFilesFolder, "packs.html").filepaths
+	t, err := template.New("packs.html").Funcs(funcMap).ParseFiles(tempateFiles...)
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting packs template: %v", err)
+		return
+	}
+	// Get stats for all environments
+	envAll, err := h.Envs.All()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting environments %v", err)
+		return
+	}
+	// Get stats for all platforms
+	platforms, err := h.Nodes.GetAllPlatforms()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting platforms: %v", err)
+		return
+	}
+	// Get current tags
+	tags, err := h.Tags.All()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting tags: %v", err)
+		return
+	}
+	// Get current packs with queries and targets
+	allPacks, err := h.Packs.All()
+	if err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("error getting packs: %v", err)
+		return
+	}
+	var packsData []PackData
+	for _, p := range allPacks {
+		queries, err := h.Packs.GetQueries(p.Name)
+		if err != nil {
+			h.Inc(metricAdminErr)
+			log.Printf("error getting pack queries: %v", err)
+			return
+		}
+		targets, err := h.Packs.GetTargets(p.Name)
+		if err != nil {
+			h.Inc(metricAdminErr)
+			log.Printf("error getting pack targets: %v", err)
+			return
+		}
+		packsData = append(packsData, PackData{Pack: p, Queries: queries, Targets: targets})
+	}
+	// Prepare template data
+	templateData := PacksTemplateData{
+		Title:        "Manage packs",
+		Metadata:     h.TemplateMetadata(ctx, h.ServiceVersion),
+		Environments: envAll,
+		Platforms:    platforms,
+		Packs:        packsData,
+		Tags:         tags,
+	}
+	if err := t.Execute(w, templateData); err != nil {
+		h.Inc(metricAdminErr)
+		log.Printf("template error %v", err)
+		return
+	}
+	if h.Settings.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Packs template served")
+	}
+	h.Inc(metricAdminOK)
+}
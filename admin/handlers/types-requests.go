@@ -1,5 +1,7 @@
 package handlers
 
+import "github.com/jmpsec/osctrl/queries"
+
 // LoginRequest to receive login credentials
 type LoginRequest struct {
 	Username string `json:"username"`
@@ -13,22 +15,61 @@ type LogoutRequest struct {
 
 // DistributedQueryRequest to receive query requests
 type DistributedQueryRequest struct {
-	CSRFToken    string   `json:"csrftoken"`
-	Environments []string `json:"environment_list"`
-	Platforms    []string `json:"platform_list"`
-	UUIDs        []string `json:"uuid_list"`
-	Hosts        []string `json:"host_list"`
-	Query        string   `json:"query"`
+	CSRFToken        string            `json:"csrftoken"`
+	Environments     []string          `json:"environment_list"`
+	Platforms        []string          `json:"platform_list"`
+	UUIDs            []string          `json:"uuid_list"`
+	Hosts            []string          `json:"host_list"`
+	Tags             []string          `json:"tag_list"`
+	Hostnames        []string          `json:"hostname_list"`
+	CIDRs            []string          `json:"cidr_list"`
+	OsqueryVersion   string            `json:"osquery_version"`
+	PlatformVersion  string            `json:"platform_version"`
+	TargetExpression string            `json:"target_expression"`
+	Query            string            `json:"query"`
+	Discovery        string            `json:"discovery"`
+	SavedQuery       string            `json:"saved_query"`
+	Parameters       map[string]string `json:"parameters"`
+	ScheduleName     string            `json:"schedule_name"`
+	Schedule         string            `json:"schedule"`
+	ExpirationHours  int64             `json:"expiration_hours"`
+	MaxRows          int               `json:"max_rows"`
+	MaxBytes         int               `json:"max_bytes"`
+}
+
+// SavedQueryRequest to receive changes to saved queries
+type SavedQueryRequest struct {
+	CSRFToken   string                        `json:"csrftoken"`
+	Action      string                        `json:"action"`
+	Name        string                        `json:"name"`
+	Description string                        `json:"description"`
+	Query       string                        `json:"query"`
+	Tags        string                        `json:"tags"`
+	Shared      bool                          `json:"shared"`
+	Parameters  []queries.SavedQueryParameter `json:"parameters"`
+	Version     int                           `json:"version"`
+	Pack        string                        `json:"pack"`
+	PackB64     string                        `json:"pack_content"`
+	Replace     bool                          `json:"replace"`
+}
+
+// ApprovalActionRequest to receive approvals and rejections of pending queries and carves
+type ApprovalActionRequest struct {
+	CSRFToken string `json:"csrftoken"`
+	Action    string `json:"action"`
+	Name      string `json:"name"`
+	Comment   string `json:"comment"`
 }
 
 // DistributedCarveRequest to receive carve requests
 type DistributedCarveRequest struct {
-	CSRFToken    string   `json:"csrftoken"`
-	Environments []string `json:"environment_list"`
-	Platforms    []string `json:"platform_list"`
-	UUIDs        []string `json:"uuid_list"`
-	Hosts        []string `json:"host_list"`
-	Path         string   `json:"path"`
+	CSRFToken       string   `json:"csrftoken"`
+	Environments    []string `json:"environment_list"`
+	Platforms       []string `json:"platform_list"`
+	UUIDs           []string `json:"uuid_list"`
+	Hosts           []string `json:"host_list"`
+	Path            string   `json:"path"`
+	ExpirationHours int64    `json:"expiration_hours"`
 }
 
 // DistributedQueryActionRequest to receive query requests
@@ -66,6 +107,18 @@ type SettingsRequest struct {
 type ConfigurationRequest struct {
 	CSRFToken        string `json:"csrftoken"`
 	ConfigurationB64 string `json:"configuration"`
+	Comment          string `json:"comment"`
+}
+
+// ConfigOverlayRequest to receive changes to configuration overlays
+type ConfigOverlayRequest struct {
+	CSRFToken        string `json:"csrftoken"`
+	Action           string `json:"action"`
+	Name             string `json:"name"`
+	Scope            string `json:"scope"`
+	Target           string `json:"target"`
+	Priority         int    `json:"priority"`
+	ConfigurationB64 string `json:"configuration"`
 }
 
 // EnrollRequest to receive changes to enroll certificates
@@ -80,6 +133,13 @@ type IntervalsRequest struct {
 	ConfigInterval int    `json:"config"`
 	LogInterval    int    `json:"log"`
 	QueryInterval  int    `json:"query"`
+	Comment        string `json:"comment"`
+}
+
+// RollbackRequest to receive a version to rollback to
+type RollbackRequest struct {
+	CSRFToken string `json:"csrftoken"`
+	Version   uint   `json:"version"`
 }
 
 // ExpirationRequest to receive expiration changes to enroll/remove nodes
@@ -122,6 +182,33 @@ type TagsRequest struct {
 	Icon        string `json:"icon"`
 }
 
+// PacksRequest to receive pack action requests
+type PacksRequest struct {
+	CSRFToken   string           `json:"csrftoken"`
+	Action      string           `json:"action"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	ContentB64  string           `json:"content"`
+	Replace     bool             `json:"replace"`
+	TargetType  string           `json:"target_type"`
+	TargetValue string           `json:"target_value"`
+	Query       PackQueryRequest `json:"query"`
+}
+
+// PackQueryRequest to receive a query for a pack
+type PackQueryRequest struct {
+	Name        string `json:"name"`
+	QueryB64    string `json:"query"`
+	Interval    int    `json:"interval"`
+	Platform    string `json:"platform"`
+	Version     string `json:"version"`
+	Snapshot    bool   `json:"snapshot"`
+	Removed     bool   `json:"removed"`
+	Shard       int    `json:"shard"`
+	Description string `json:"description"`
+	Value       string `json:"value"`
+}
+
 // TagNodesRequest to receive a tag for nodes
 type TagNodesRequest struct {
 	CSRFToken  string   `json:"csrftoken"`
@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"github.com/jmpsec/osctrl/carves"
+	"github.com/jmpsec/osctrl/configs"
 	"github.com/jmpsec/osctrl/environments"
+	"github.com/jmpsec/osctrl/logging"
 	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/packs"
 	"github.com/jmpsec/osctrl/queries"
 	"github.com/jmpsec/osctrl/settings"
 	"github.com/jmpsec/osctrl/tags"
@@ -49,6 +52,66 @@ type ConfTemplateData struct {
 	Environment  environments.TLSEnvironment
 	Environments []environments.TLSEnvironment
 	Platforms    []string
+	Overlays     []configs.ConfigOverlay
+	Packs        []packs.OsqueryPack
+	Metadata     TemplateMetadata
+}
+
+// ConfHistoryTemplateData for passing data to the conf history template
+type ConfHistoryTemplateData struct {
+	Title        string
+	Environment  environments.TLSEnvironment
+	Environments []environments.TLSEnvironment
+	Platforms    []string
+	Versions     []environments.EnvironmentVersion
+	From         environments.EnvironmentVersion
+	To           environments.EnvironmentVersion
+	Diff         []environments.DiffLine
+	Metadata     TemplateMetadata
+}
+
+// QuerySchedulesTemplateData for passing data to the query schedules template
+type QuerySchedulesTemplateData struct {
+	Title        string
+	Environments []environments.TLSEnvironment
+	Platforms    []string
+	Schedules    []queries.ScheduledQuery
+	Selected     string
+	Runs         []queries.DistributedQuery
+	Metadata     TemplateMetadata
+}
+
+// SavedQueriesTemplateData for passing data to the saved queries template
+type SavedQueriesTemplateData struct {
+	Title        string
+	Environments []environments.TLSEnvironment
+	Platforms    []string
+	Saved        []queries.SavedQuery
+	Selected     queries.SavedQuery
+	Parameters   []queries.SavedQueryParameter
+	Versions     []queries.SavedQueryVersion
+	CanEdit      bool
+	Metadata     TemplateMetadata
+}
+
+// QueryApprovalsTemplateData for passing data to the query approvals template
+type QueryApprovalsTemplateData struct {
+	Title        string
+	Environments []environments.TLSEnvironment
+	Platforms    []string
+	Pending      []queries.DistributedQuery
+	Approvals    map[string][]queries.DistributedQueryApproval
+	Metadata     TemplateMetadata
+}
+
+// ConfDriftTemplateData for passing data to the conf drift template
+type ConfDriftTemplateData struct {
+	Title        string
+	Environment  environments.TLSEnvironment
+	Environments []environments.TLSEnvironment
+	Platforms    []string
+	Drifts       []configs.NodeDrift
+	GraceMinutes int64
 	Metadata     TemplateMetadata
 }
 
@@ -79,13 +142,25 @@ type QueryRunTemplateData struct {
 	Platforms     []string
 	UUIDs         []string
 	Hosts         []string
+	Tags          []tags.AdminTag
+	Saved         []queries.SavedQuery
 	Tables        []types.OsqueryTable
 	TablesVersion string
 	Metadata      TemplateMetadata
 }
 
 // CarvesRunTemplateData for passing data to the carves run template
-type CarvesRunTemplateData QueryRunTemplateData
+type CarvesRunTemplateData struct {
+	Title         string
+	Environments  []environments.TLSEnvironment
+	Platforms     []string
+	UUIDs         []string
+	Hosts         []string
+	Tables        []types.OsqueryTable
+	TablesVersion string
+	Quotas        []carves.CarveQuota
+	Metadata      TemplateMetadata
+}
 
 // GenericTableTemplateData for passing data to a table template
 type GenericTableTemplateData struct {
@@ -111,16 +186,40 @@ type CarvesDetailsTemplateData struct {
 	QueryTargets []queries.DistributedQueryTarget
 	Carves       []carves.CarvedFile
 	CarveBlocks  map[string][]carves.CarvedBlock
+	CarveAudits  map[string][]carves.CarveAudit
 	Metadata     TemplateMetadata
 }
 
 // QueryLogsTemplateData for passing data to the query template
 type QueryLogsTemplateData struct {
+	Title          string
+	Environments   []environments.TLSEnvironment
+	Platforms      []string
+	Query          queries.DistributedQuery
+	QueryTargets   []queries.DistributedQueryTarget
+	NoAnswers      []queries.DistributedQueryNoAnswer
+	NodeStatuses   []queries.DistributedQueryStatus
+	StatusCounts   map[string]int
+	Executions     queries.ExecutionSummary
+	NodeExecutions map[string]queries.DistributedQueryExecution
+	Metadata       TemplateMetadata
+}
+
+// QueryDiffTemplateData for passing data to the query diff template
+type QueryDiffTemplateData struct {
 	Title        string
 	Environments []environments.TLSEnvironment
 	Platforms    []string
 	Query        queries.DistributedQuery
-	QueryTargets []queries.DistributedQueryTarget
+	Runs         []queries.DistributedQuery
+	NodeStatuses []queries.DistributedQueryStatus
+	Target       string
+	BaseNode     string
+	TargetNode   string
+	Keys         string
+	RunsDiff     *logging.RunsDiff
+	NodesDiff    *logging.NodesDiff
+	Error        string
 	Metadata     TemplateMetadata
 }
 
@@ -161,6 +260,23 @@ type TagsTemplateData struct {
 	Metadata     TemplateMetadata
 }
 
+// PackData to show a pack with its queries and targets
+type PackData struct {
+	Pack    packs.OsqueryPack
+	Queries []packs.PackQuery
+	Targets []packs.PackTarget
+}
+
+// PacksTemplateData for passing data to the packs template
+type PacksTemplateData struct {
+	Title        string
+	Environments []environments.TLSEnvironment
+	Platforms    []string
+	Packs        []PackData
+	Tags         []tags.AdminTag
+	Metadata     TemplateMetadata
+}
+
 // NodeTemplateData for passing data to the query template
 type NodeTemplateData struct {
 	Title        string
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jmpsec/osctrl/queries"
 	"github.com/jmpsec/osctrl/settings"
@@ -63,14 +64,6 @@ func randomForNames() string {
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
-// Helper to generate the carve query
-func generateCarveQuery(file string, glob bool) string {
-	if glob {
-		return "SELECT * FROM carves WHERE carve=1 AND path LIKE '" + file + "';"
-	}
-	return "SELECT * FROM carves WHERE carve=1 AND path = '" + file + "';"
-}
-
 // Helper to determine if a query may be a carve
 func newQueryReady(user, query string) queries.DistributedQuery {
 	if strings.Contains(query, "carve(") || strings.Contains(query, "carve=1") {
@@ -100,6 +93,52 @@ func newQueryReady(user, query string) queries.DistributedQuery {
 	}
 }
 
+// Helper to calculate the expiration of a new query, using the default from settings if hours are not set
+func (h *HandlersAdmin) queryExpiration(hours int64) time.Time {
+	return queries.ExpirationTime(queries.QueryExpirationHours(hours, h.Settings.QueryExpiration()))
+}
+
+// Helper to prepare the approval policy for queries and carves from settings
+func (h *HandlersAdmin) approvalPolicy() queries.ApprovalPolicy {
+	return queries.NewApprovalPolicy(h.Settings.ApprovalCarves(), h.Settings.ApprovalNodes(), h.Settings.ApprovalEnvironments())
+}
+
+// Helper to apply the approval policy to a new query, approvers are notified if it stays pending
+func (h *HandlersAdmin) checkApproval(name string, policy queries.ApprovalPolicy) (bool, string, error) {
+	if !policy.Enabled() {
+		return false, "", nil
+	}
+	pending, reason, err := h.Queries.CheckApproval(name, policy, h.Nodes, h.Settings.InactiveHours())
+	if err != nil || !pending {
+		return pending, reason, err
+	}
+	if url := h.Settings.ApprovalWebhook(); url != "" {
+		query, err := h.Queries.Get(name)
+		if err != nil {
+			return pending, reason, err
+		}
+		go func() {
+			if err := queries.NotifyApproval(url, query, reason); err != nil {
+				log.Printf("error notifying approval for %s - %v", name, err)
+			}
+		}()
+	}
+	return pending, reason, nil
+}
+
+// Helper to get the last result received by a stream client, to resume after reconnecting
+func streamLastID(r *http.Request) uint {
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("last")
+	}
+	v, err := strconv.ParseUint(last, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint(v)
+}
+
 // Helper to convert a string into integer
 func stringToInteger(s string) int64 {
 	v, err := strconv.ParseInt(s, 10, 64)
@@ -197,3 +236,12 @@ func (h *HandlersAdmin) statusLogsLink(uuid string) string {
 func (h *HandlersAdmin) resultLogsLink(uuid string) string {
 	return strings.Replace(h.Settings.ResultLogsLink(), "{{UUID}}", removeBackslash(uuid), 1)
 }
+
+// Helper to get the names of all known osquery tables
+func (h *HandlersAdmin) tableNames() []string {
+	names := make([]string, len(h.OsqueryTables))
+	for i, t := range h.OsqueryTables {
+		names[i] = t.Name
+	}
+	return names
+}
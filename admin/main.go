@@ -15,10 +15,12 @@ import (
 	"github.com/jmpsec/osctrl/admin/sessions"
 	"github.com/jmpsec/osctrl/backend"
 	"github.com/jmpsec/osctrl/carves"
+	"github.com/jmpsec/osctrl/configs"
 	"github.com/jmpsec/osctrl/environments"
 	"github.com/jmpsec/osctrl/logging"
 	"github.com/jmpsec/osctrl/metrics"
 	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/packs"
 	"github.com/jmpsec/osctrl/queries"
 	"github.com/jmpsec/osctrl/settings"
 	"github.com/jmpsec/osctrl/tags"
@@ -77,8 +79,14 @@ const (
 	defaultRefresh int = 300
 	// Default hours to classify nodes as inactive
 	defaultInactive int = -72
+	// Default minutes for nodes to apply a new configuration
+	defaultDriftGrace int = 30
+	// Default hours for on-demand queries to expire
+	defaultQueryExpiration int = 24
 	// Hourly interval to cleanup logs
 	hourlyInterval int = 60
+	// Interval in seconds to check for due scheduled queries and expired queries
+	scheduleInterval int = 60
 )
 
 // osquery
@@ -103,12 +111,15 @@ var (
 	nodesmgr    *nodes.NodeManager
 	queriesmgr  *queries.Queries
 	carvesmgr   *carves.Carves
+	packsmgr    *packs.Packs
+	configsmgr  *configs.Configs
 	sessionsmgr *sessions.SessionManager
 	envs        *environments.Environment
 	adminUsers  *users.UserManager
 	tagsmgr     *tags.TagManager
 	// FIXME this is nasty and should not be a global but here we are
 	osqueryTables []types.OsqueryTable
+	osquerySchema []queries.TableSchema
 	adminMetrics  *metrics.Metrics
 	handlersAdmin *ahandlers.HandlersAdmin
 	loggerDB      *logging.LoggerDB
@@ -119,6 +130,7 @@ var (
 	versionFlag *bool
 	configFlag  *string
 	dbFlag      *string
+	carvesFlag  *string
 	samlFlag    *string
 	headersFlag *string
 	jwtFlag     *string
@@ -191,6 +203,7 @@ func init() {
 	versionFlag = flag.Bool("v", false, "Displays the binary version.")
 	configFlag = flag.String("c", configurationFile, "Service configuration JSON file to use.")
 	dbFlag = flag.String("D", dbConfigurationFile, "DB configuration JSON file to use.")
+	carvesFlag = flag.String("K", "", "Master keys file to encrypt carves at rest. It can also be provided with "+carves.EnvCarvesKeys+".")
 	samlFlag = flag.String("S", samlConfigurationFile, "SAML configuration JSON file to use.")
 	headersFlag = flag.String("H", headersConfigurationFile, "Headers configuration JSON file to use.")
 	jwtFlag = flag.String("J", jwtConfigurationFile, "JWT configuration JSON file to use.")
@@ -211,6 +224,11 @@ func init() {
 	if err != nil {
 		log.Fatalf("Error loading osquery tables %s", err)
 	}
+	// Load osquery schema to check queries
+	osquerySchema, err = queries.LoadSchema(osqueryTablesFile)
+	if err != nil {
+		log.Fatalf("Error loading osquery schema %s", err)
+	}
 	// Load configuration for SAML if enabled
 	if adminConfig.Auth == settings.AuthSAML {
 		samlConfig, err = loadSAML(*samlFlag)
@@ -274,9 +292,21 @@ func main() {
 	// Initialize nodes
 	nodesmgr = nodes.CreateNodes(db)
 	// Initialize queries
-	queriesmgr = queries.CreateQueries(db)
+	queriesmgr = queries.CreateQueries(db, tagsmgr)
 	// Initialize carves
 	carvesmgr = carves.CreateFileCarves(db)
+	carvesKeys, err := carves.LoadKeyRing(*carvesFlag)
+	if err != nil {
+		log.Fatalf("Failed to load carves master keys - %v", err)
+	}
+	if carvesKeys != nil {
+		log.Printf("Carves encrypted at rest with master key %s", carvesKeys.Active)
+		carvesmgr.EnableEncryption(carvesKeys)
+	}
+	// Initialize packs
+	packsmgr = packs.CreatePacks(db)
+	// Initialize configurations
+	configsmgr = configs.CreateConfigs(db, envs, nodesmgr, packsmgr, tagsmgr)
 	// Initialize sessions
 	sessionsmgr = sessions.CreateSessionManager(db, projectName)
 	// Initialize service settings
@@ -371,6 +401,54 @@ func main() {
 		}
 	}()
 
+	// Materializing runs of scheduled queries
+	go func() {
+		for {
+			if settingsmgr.DebugService(settings.ServiceAdmin) {
+				log.Println("DebugService: Running due scheduled queries")
+			}
+			policy := queries.NewApprovalPolicy(settingsmgr.ApprovalCarves(), settingsmgr.ApprovalNodes(), settingsmgr.ApprovalEnvironments())
+			runs, err := queriesmgr.RunDueSchedules(nodesmgr, policy, settingsmgr.InactiveHours(), settingsmgr.QueryExpiration())
+			if err != nil {
+				log.Printf("error running scheduled queries - %v", err)
+			}
+			for _, q := range runs {
+				log.Printf("Scheduled query %s materialized as %s", q.Schedule, q.Name)
+				if q.Approved() {
+					continue
+				}
+				// Runs pending approval are notified like any other query, with the recorded reason
+				if url := settingsmgr.ApprovalWebhook(); url != "" {
+					reason := "scheduled run of " + q.Schedule
+					if approvals, err := queriesmgr.GetApprovals(q.Name); err == nil && len(approvals) > 0 {
+						reason = approvals[len(approvals)-1].Comment
+					}
+					if err := queries.NotifyApproval(url, q, reason); err != nil {
+						log.Printf("error notifying approval for %s - %v", q.Name, err)
+					}
+				}
+			}
+			time.Sleep(time.Duration(scheduleInterval) * time.Second)
+		}
+	}()
+
+	// Expiring stale on-demand queries
+	go func() {
+		for {
+			if settingsmgr.DebugService(settings.ServiceAdmin) {
+				log.Println("DebugService: Expiring on-demand queries")
+			}
+			expired, err := queriesmgr.ExpireQueries()
+			if err != nil {
+				log.Printf("error expiring queries - %v", err)
+			}
+			for _, q := range expired {
+				log.Printf("Query %s expired with %d/%d executions", q.Name, q.Executions+q.Errors+q.Skipped, q.Expected)
+			}
+			time.Sleep(time.Duration(scheduleInterval) * time.Second)
+		}
+	}()
+
 	// Initialize Admin handlers before router
 	handlersAdmin = ahandlers.CreateHandlersAdmin(
 		ahandlers.WithDB(db),
@@ -380,12 +458,15 @@ func main() {
 		ahandlers.WithNodes(nodesmgr),
 		ahandlers.WithQueries(queriesmgr),
 		ahandlers.WithCarves(carvesmgr),
+		ahandlers.WithPacks(packsmgr),
+		ahandlers.WithConfigs(configsmgr),
 		ahandlers.WithSettings(settingsmgr),
 		ahandlers.WithMetrics(adminMetrics),
 		ahandlers.WithLoggerDB(loggerDB),
 		ahandlers.WithSessions(sessionsmgr),
 		ahandlers.WithVersion(serviceVersion),
 		ahandlers.WithOsqueryTables(osqueryTables),
+		ahandlers.WithOsquerySchema(osquerySchema),
 		ahandlers.WithAdminConfig(&adminConfig),
 	)
 
@@ -430,6 +511,8 @@ func main() {
 	routerAdmin.Handle("/json/logs/{type}/{environment}/{uuid}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.JSONLogsHandler))).Methods("GET")
 	// Admin: JSON data for query logs
 	routerAdmin.Handle("/json/query/{name}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.JSONQueryLogsHandler))).Methods("GET")
+	// Admin: JSON data for aggregated query results
+	routerAdmin.Handle("/json/aggregate/{name}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.JSONQueryAggregateHandler))).Methods("GET")
 	// Admin: JSON data for sidebar stats
 	routerAdmin.Handle("/json/stats/{target}/{name}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.JSONStatsHandler))).Methods("GET")
 	// Admin: JSON data for tags
@@ -451,13 +534,33 @@ func main() {
 	routerAdmin.Handle("/query/run", handlerAuthCheck(http.HandlerFunc(handlersAdmin.QueryRunGETHandler))).Methods("GET")
 	routerAdmin.Handle("/query/run", handlerAuthCheck(http.HandlerFunc(handlersAdmin.QueryRunPOSTHandler))).Methods("POST")
 	// Admin: list queries
+	routerAdmin.Handle("/query/lint", handlerAuthCheck(http.HandlerFunc(handlersAdmin.QueryLintPOSTHandler))).Methods("POST")
+	routerAdmin.Handle("/query/preview", handlerAuthCheck(http.HandlerFunc(handlersAdmin.QueryPreviewPOSTHandler))).Methods("POST")
 	routerAdmin.Handle("/query/list", handlerAuthCheck(http.HandlerFunc(handlersAdmin.QueryListGETHandler))).Methods("GET")
+	// Admin: saved queries
+	routerAdmin.Handle("/query/saved", handlerAuthCheck(http.HandlerFunc(handlersAdmin.SavedQueriesGETHandler))).Methods("GET")
+	routerAdmin.Handle("/query/saved/{name}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.SavedQueriesGETHandler))).Methods("GET")
+	routerAdmin.Handle("/query/saved/json/{name}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.JSONSavedQueryHandler))).Methods("GET")
+	routerAdmin.Handle("/query/saved/actions", handlerAuthCheck(http.HandlerFunc(handlersAdmin.SavedQueryActionsPOSTHandler))).Methods("POST")
+	// Admin: queries and carves pending approval
+	routerAdmin.Handle("/query/approvals", handlerAuthCheck(http.HandlerFunc(handlersAdmin.QueryApprovalsGETHandler))).Methods("GET")
+	routerAdmin.Handle("/query/approvals/actions", handlerAuthCheck(http.HandlerFunc(handlersAdmin.ApprovalActionsPOSTHandler))).Methods("POST")
+	// Admin: scheduled queries
+	routerAdmin.Handle("/query/schedules", handlerAuthCheck(http.HandlerFunc(handlersAdmin.QuerySchedulesGETHandler))).Methods("GET")
+	routerAdmin.Handle("/query/schedules/{name}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.QuerySchedulesGETHandler))).Methods("GET")
+	routerAdmin.Handle("/query/schedules/actions", handlerAuthCheck(http.HandlerFunc(handlersAdmin.ScheduleActionsPOSTHandler))).Methods("POST")
 	// Admin: query actions
 	routerAdmin.Handle("/query/actions", handlerAuthCheck(http.HandlerFunc(handlersAdmin.QueryActionsPOSTHandler))).Methods("POST")
 	// Admin: query JSON
 	routerAdmin.Handle("/query/json/{target}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.JSONQueryHandler))).Methods("GET")
 	// Admin: query logs
 	routerAdmin.Handle("/query/logs/{name}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.QueryLogsHandler))).Methods("GET")
+	// Admin: query results as they arrive
+	routerAdmin.Handle("/query/stream/{name}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.QueryStreamHandler))).Methods("GET")
+	// Admin: diff query results
+	routerAdmin.Handle("/query/diff/{name}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.QueryDiffHandler))).Methods("GET")
+	// Admin: export query results
+	routerAdmin.Handle("/query/export/{name}/{format}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.QueryExportHandler))).Methods("GET")
 	// Admin: carve files
 	routerAdmin.Handle("/carves/run", handlerAuthCheck(http.HandlerFunc(handlersAdmin.CarvesRunGETHandler))).Methods("GET")
 	routerAdmin.Handle("/carves/run", handlerAuthCheck(http.HandlerFunc(handlersAdmin.CarvesRunPOSTHandler))).Methods("POST")
@@ -474,6 +577,11 @@ func main() {
 	// Admin: nodes configuration
 	routerAdmin.Handle("/conf/{environment}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.ConfGETHandler))).Methods("GET")
 	routerAdmin.Handle("/conf/{environment}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.ConfPOSTHandler))).Methods("POST")
+	routerAdmin.Handle("/conf/{environment}/history", handlerAuthCheck(http.HandlerFunc(handlersAdmin.ConfHistoryGETHandler))).Methods("GET")
+	routerAdmin.Handle("/conf/{environment}/drift", handlerAuthCheck(http.HandlerFunc(handlersAdmin.ConfDriftGETHandler))).Methods("GET")
+	routerAdmin.Handle("/conf/{environment}/rollback", handlerAuthCheck(http.HandlerFunc(handlersAdmin.ConfRollbackPOSTHandler))).Methods("POST")
+	routerAdmin.Handle("/conf/{environment}/overlays", handlerAuthCheck(http.HandlerFunc(handlersAdmin.ConfOverlaysPOSTHandler))).Methods("POST")
+	routerAdmin.Handle("/conf/{environment}/effective/{uuid}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.JSONEffectiveConfigHandler))).Methods("GET")
 	routerAdmin.Handle("/intervals/{environment}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.IntervalsPOSTHandler))).Methods("POST")
 	// Admin: nodes enroll
 	routerAdmin.Handle("/enroll/{environment}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.EnrollGETHandler))).Methods("GET")
@@ -494,6 +602,10 @@ func main() {
 	routerAdmin.Handle("/tags", handlerAuthCheck(http.HandlerFunc(handlersAdmin.TagsGETHandler))).Methods("GET")
 	routerAdmin.Handle("/tags", handlerAuthCheck(http.HandlerFunc(handlersAdmin.TagsPOSTHandler))).Methods("POST")
 	routerAdmin.Handle("/tags/nodes", handlerAuthCheck(http.HandlerFunc(handlersAdmin.TagNodesPOSTHandler))).Methods("POST")
+	// Admin: manage packs
+	routerAdmin.Handle("/packs", handlerAuthCheck(http.HandlerFunc(handlersAdmin.PacksGETHandler))).Methods("GET")
+	routerAdmin.Handle("/packs", handlerAuthCheck(http.HandlerFunc(handlersAdmin.PacksPOSTHandler))).Methods("POST")
+	routerAdmin.Handle("/packs/{name}/export", handlerAuthCheck(http.HandlerFunc(handlersAdmin.PackExportHandler))).Methods("GET")
 	// Admin: manage tokens
 	routerAdmin.Handle("/tokens/{username}", handlerAuthCheck(http.HandlerFunc(handlersAdmin.TokensGETHandler))).Methods("GET")
 	routerAdmin.Handle("/tokens/{username}/refresh", handlerAuthCheck(http.HandlerFunc(handlersAdmin.TokensPOSTHandler))).Methods("POST")
@@ -96,6 +96,42 @@ func loadingSettings(mgr *settings.Settings) error {
 			return fmt.Errorf("Failed to add %s to configuration: %v", settings.InactiveHours, err)
 		}
 	}
+	// Check if service settings for configuration drift grace period is ready
+	if !mgr.IsValue(settings.ServiceAdmin, settings.DriftGraceMinutes) {
+		if err := mgr.NewIntegerValue(settings.ServiceAdmin, settings.DriftGraceMinutes, int64(defaultDriftGrace)); err != nil {
+			return fmt.Errorf("Failed to add %s to configuration: %v", settings.DriftGraceMinutes, err)
+		}
+	}
+	// Check if service settings for default query expiration is ready
+	if !mgr.IsValue(settings.ServiceAdmin, settings.QueryExpiration) {
+		if err := mgr.NewIntegerValue(settings.ServiceAdmin, settings.QueryExpiration, int64(defaultQueryExpiration)); err != nil {
+			return fmt.Errorf("Failed to add %s to configuration: %v", settings.QueryExpiration, err)
+		}
+	}
+	// Check if service settings for approval of carves is ready
+	if !mgr.IsValue(settings.ServiceAdmin, settings.ApprovalCarves) {
+		if err := mgr.NewBooleanValue(settings.ServiceAdmin, settings.ApprovalCarves, false); err != nil {
+			return fmt.Errorf("Failed to add %s to configuration: %v", settings.ApprovalCarves, err)
+		}
+	}
+	// Check if service settings for approval of queries by number of nodes is ready
+	if !mgr.IsValue(settings.ServiceAdmin, settings.ApprovalNodes) {
+		if err := mgr.NewIntegerValue(settings.ServiceAdmin, settings.ApprovalNodes, 0); err != nil {
+			return fmt.Errorf("Failed to add %s to configuration: %v", settings.ApprovalNodes, err)
+		}
+	}
+	// Check if service settings for approval of queries by environment is ready
+	if !mgr.IsValue(settings.ServiceAdmin, settings.ApprovalEnvironments) {
+		if err := mgr.NewStringValue(settings.ServiceAdmin, settings.ApprovalEnvironments, ""); err != nil {
+			return fmt.Errorf("Failed to add %s to configuration: %v", settings.ApprovalEnvironments, err)
+		}
+	}
+	// Check if service settings for approval notifications is ready
+	if !mgr.IsValue(settings.ServiceAdmin, settings.ApprovalWebhook) {
+		if err := mgr.NewStringValue(settings.ServiceAdmin, settings.ApprovalWebhook, ""); err != nil {
+			return fmt.Errorf("Failed to add %s to configuration: %v", settings.ApprovalWebhook, err)
+		}
+	}
 	if err := loadingLoggingSettings(mgr); err != nil {
 		return fmt.Errorf("Failed to load logging settings: %v", err)
 	}
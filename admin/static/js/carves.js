@@ -48,7 +48,18 @@ function sendCarve() {
     path: _path,
     repeat: _repeat
   };
-  sendPostRequest(data, _url, '/carves/list', false);
+  sendPostRequest(data, _url, '', false, function (data) {
+    // Show quota warnings before moving to the list of carves
+    if (data.message !== 'OK') {
+      $("#successModalMessage").text(data.message);
+      $('#successModal').on('hidden.bs.modal', function () {
+        window.location.replace('/carves/list');
+      });
+      $("#successModal").modal();
+      return;
+    }
+    window.location.replace('/carves/list');
+  });
 }
 
 function clearCarve() {
@@ -8,6 +8,7 @@ function saveConfiguration() {
   var data = {
     csrftoken: _csrftoken,
     configuration: btoa(_configuration),
+    comment: $("#conf_comment").val(),
   };
   sendPostRequest(data, _url, '', true);
   $('#configuration_header').removeClass("bg-changed");
@@ -26,11 +27,82 @@ function saveIntervals() {
     config: parseInt(_config),
     log: parseInt(_log),
     query: parseInt(_query),
+    comment: $("#conf_comment").val(),
   };
   sendPostRequest(data, _url, '', true);
   $('#intervals_header').removeClass("bg-changed");
 }
 
+function addOverlay() {
+  var _csrftoken = $("#csrftoken").val();
+  var _name = $("#overlay_name").val();
+  var _scope = $("#overlay_scope").val();
+  var _target = $("#overlay_target").val();
+  var _priority = $("#overlay_priority").val();
+  var _configuration = $("#overlay_conf").val();
+
+  var _url = window.location.pathname + '/overlays';
+
+  var data = {
+    csrftoken: _csrftoken,
+    action: 'add',
+    name: _name,
+    scope: _scope,
+    target: _target,
+    priority: parseInt(_priority),
+    configuration: btoa(_configuration),
+  };
+  sendPostRequest(data, _url, window.location.pathname, false);
+}
+
+function removeOverlay(_name) {
+  var _csrftoken = $("#csrftoken").val();
+
+  var _url = window.location.pathname + '/overlays';
+
+  var data = {
+    csrftoken: _csrftoken,
+    action: 'remove',
+    name: _name,
+  };
+  sendPostRequest(data, _url, window.location.pathname, false);
+}
+
+function previewConfiguration() {
+  var _uuid = $("#preview_uuid").val();
+
+  var _url = window.location.pathname + '/effective/' + _uuid;
+
+  sendGetRequest(_url, false, function (data) {
+    $("#preview_sources").text('Sources: ' + data.sources.join(', '));
+    $("#preview_conf").text(JSON.stringify(JSON.parse(data.configuration), null, 2));
+  });
+}
+
+function compareVersions() {
+  var _from = $("input[name='version_from']:checked").val();
+  var _to = $("input[name='version_to']:checked").val();
+  if (_from && _to) {
+    window.location = window.location.pathname + '?from=' + _from + '&to=' + _to;
+  }
+}
+
+function confirmRollback(_version) {
+  var modal_message = 'Are you sure you want to rollback to version ' + _version + '?';
+  $("#confirmModalMessage").text(modal_message);
+  $('#confirm_action').click(function () {
+    $('#confirmModal').modal('hide');
+    var _csrftoken = $("#csrftoken").val();
+    var _url = window.location.pathname.replace(/\/history$/, '/rollback');
+    var data = {
+      csrftoken: _csrftoken,
+      version: _version,
+    };
+    sendPostRequest(data, _url, window.location.pathname, false);
+  });
+  $("#confirmModal").modal();
+}
+
 function changeIntervalValue(range_input, range_output) {
   range_output.value = range_input.value;
   $('#intervals_header').addClass("bg-changed");
@@ -0,0 +1,122 @@
+function importPack() {
+  $("#pack_name").val('');
+  $("#pack_description").val('');
+  $("#pack_content").val('');
+  $("#importPackModal").modal();
+}
+
+function confirmImportPack() {
+  var _csrftoken = $("#csrftoken").val();
+  var _url = window.location.pathname;
+  var data = {
+    csrftoken: _csrftoken,
+    action: 'import',
+    name: $("#pack_name").val(),
+    description: $("#pack_description").val(),
+    content: btoa($("#pack_content").val()),
+    replace: $("#pack_replace").is(':checked'),
+  };
+  sendPostRequest(data, _url, _url, false);
+}
+
+function confirmDeletePack(_pack) {
+  var modal_message = 'Are you sure you want to delete the pack ' + _pack + '?';
+  $("#confirmModalMessage").text(modal_message);
+  $('#confirm_action').click(function () {
+    $('#confirmModal').modal('hide');
+    deletePack(_pack);
+  });
+  $("#confirmModal").modal();
+}
+
+function deletePack(_pack) {
+  var _csrftoken = $("#csrftoken").val();
+  var _url = window.location.pathname;
+  var data = {
+    csrftoken: _csrftoken,
+    action: 'remove',
+    name: _pack,
+  };
+  sendPostRequest(data, _url, _url, false);
+}
+
+function addPackQuery(_pack) {
+  $("#modal_title_query").text('Add query to pack ' + _pack);
+  $("#query_pack").val(_pack);
+  $("#packQueryModal").modal();
+}
+
+function confirmPackQuery() {
+  var _csrftoken = $("#csrftoken").val();
+  var _url = window.location.pathname;
+  var data = {
+    csrftoken: _csrftoken,
+    action: 'set_query',
+    name: $("#query_pack").val(),
+    query: {
+      name: $("#query_name").val(),
+      query: btoa($("#query_sql").val()),
+      interval: parseInt($("#query_interval").val()),
+      platform: $("#query_platform").val(),
+      version: $("#query_version").val(),
+      snapshot: $("#query_snapshot").is(':checked'),
+      removed: $("#query_removed").is(':checked'),
+      shard: parseInt($("#query_shard").val()),
+      description: $("#query_description").val(),
+    },
+  };
+  sendPostRequest(data, _url, _url, false);
+}
+
+function confirmDeletePackQuery(_pack, _query) {
+  var modal_message = 'Are you sure you want to delete the query ' + _query + ' from ' + _pack + '?';
+  $("#confirmModalMessage").text(modal_message);
+  $('#confirm_action').click(function () {
+    $('#confirmModal').modal('hide');
+    var _csrftoken = $("#csrftoken").val();
+    var _url = window.location.pathname;
+    var data = {
+      csrftoken: _csrftoken,
+      action: 'remove_query',
+      name: _pack,
+      query: {
+        name: _query,
+      },
+    };
+    sendPostRequest(data, _url, _url, false);
+  });
+  $("#confirmModal").modal();
+}
+
+function addPackTarget(_pack) {
+  $("#modal_title_target").text('Assign pack ' + _pack);
+  $("#target_pack").val(_pack);
+  $("#packTargetModal").modal();
+}
+
+function confirmPackTarget() {
+  var _csrftoken = $("#csrftoken").val();
+  var _url = window.location.pathname;
+  var _target = $("#target_value").val().split(':');
+  var data = {
+    csrftoken: _csrftoken,
+    action: 'add_target',
+    name: $("#target_pack").val(),
+    target_type: _target[0],
+    target_value: _target.slice(1).join(':'),
+  };
+  sendPostRequest(data, _url, _url, false);
+}
+
+function removePackTarget(_pack, _type, _value) {
+  var _csrftoken = $("#csrftoken").val();
+  var _url = window.location.pathname;
+  var data = {
+    csrftoken: _csrftoken,
+    action: 'remove_target',
+    name: _pack,
+    target_type: _type,
+    target_value: _value,
+  };
+  sendPostRequest(data, _url, _url, false);
+}
@@ -1,37 +1,108 @@
-function sendQuery() {
-  var _csrftoken = $("#csrftoken").val();
-  var _env_list = $("#target_env").val();
-  var _platform_list = $("#target_platform").val();
-  var _uuid_list = $("#target_uuids").val();
-  var _host_list = $("#target_hosts").val();
-  var _repeat = $('#target_repeat').prop('checked') ? 1 : 0;
-  var editor = $('.CodeMirror')[0].CodeMirror;
-  var _query = editor.getValue();
-
-  // Making sure targets are specified
-  if (_env_list.length === 0 && _platform_list.length === 0 && _uuid_list.length === 0 && _host_list.length === 0) {
-    $("#warningModalMessage").text("No targets have been specified");
-    $("#warningModal").modal();
-    return;
-  }
+function queryTargets() {
+  var targets = {
+    environment_list: $("#target_env").val(),
+    platform_list: $("#target_platform").val(),
+    uuid_list: $("#target_uuids").val(),
+    host_list: $("#target_hosts").val(),
+    tag_list: $("#target_tags").val(),
+    hostname_list: $("#target_hostnames").val(),
+    cidr_list: $("#target_cidrs").val(),
+    osquery_version: $("#target_osquery_version").val(),
+    platform_version: $("#target_platform_version").val(),
+    target_expression: $("#target_expression").val()
+  };
   // Check if all environments have been selected
-  if (_env_list.includes("all_environments_99")) {
-    _env_list = [];
+  if (targets.environment_list.includes("all_environments_99")) {
+    targets.environment_list = [];
     $('#target_env option').each(function () {
       if ($(this).val() !== "" && $(this).val() !== "all_environments_99") {
-        _env_list.push($(this).val());
+        targets.environment_list.push($(this).val());
       }
     });
   }
   // Check if all platforms have been selected
-  if (_platform_list.includes("all_platforms_99")) {
-    _platform_list = [];
+  if (targets.platform_list.includes("all_platforms_99")) {
+    targets.platform_list = [];
     $('#target_platform option').each(function () {
       if ($(this).val() !== "" && $(this).val() !== "all_platforms_99") {
-        _platform_list.push($(this).val());
+        targets.platform_list.push($(this).val());
       }
     });
   }
+  return targets;
+}
+
+function noQueryTargets(targets) {
+  return targets.environment_list.length === 0 && targets.platform_list.length === 0 &&
+    targets.uuid_list.length === 0 && targets.host_list.length === 0 && targets.tag_list.length === 0 &&
+    targets.hostname_list.length === 0 && targets.cidr_list.length === 0 &&
+    targets.osquery_version === "" && targets.platform_version === "" && targets.target_expression === "";
+}
+
+function previewQuery() {
+  var data = queryTargets();
+  // Making sure targets are specified
+  if (noQueryTargets(data)) {
+    $("#warningModalMessage").text("No targets have been specified");
+    $("#warningModal").modal();
+    return;
+  }
+  data.csrftoken = $("#csrftoken").val();
+  sendPostRequest(data, '/query/preview', '', false, function (preview) {
+    $("#preview_count").text(preview.count + " active node(s) targeted");
+    var tbody = $("#preview_nodes tbody");
+    tbody.empty();
+    $.each(preview.nodes, function (i, n) {
+      var row = $("<tr>");
+      row.append($("<td>").append($("<a>").attr("href", "/node/" + n.uuid).text(n.hostname)));
+      row.append($("<td>").text(n.platform));
+      row.append($("<td>").text(n.environment));
+      tbody.append(row);
+    });
+    $("#preview_result").show();
+  });
+}
+
+function lintQuery() {
+  var editor = $('.CodeMirror')[0].CodeMirror;
+  var data = queryTargets();
+  data.csrftoken = $("#csrftoken").val();
+  data.query = editor.getValue();
+  sendPostRequest(data, '/query/lint', '', false, function (lint) {
+    var messages = $("#lint_messages");
+    messages.empty();
+    $.each(lint.errors || [], function (i, e) {
+      messages.append($("<li>").addClass("text-danger").append($("<i>").addClass("fas fa-times-circle")).append(document.createTextNode(" " + e)));
+    });
+    $.each(lint.warnings || [], function (i, w) {
+      messages.append($("<li>").addClass("text-warning").append($("<i>").addClass("fas fa-exclamation-triangle")).append(document.createTextNode(" " + w)));
+    });
+    if (lint.valid && (lint.warnings || []).length === 0) {
+      messages.append($("<li>").addClass("text-success").append($("<i>").addClass("fas fa-check-circle")).append(document.createTextNode(" Query looks good")));
+    }
+    $("#lint_result").show();
+  });
+}
+
+function sendQuery() {
+  var _csrftoken = $("#csrftoken").val();
+  var _targets = queryTargets();
+  var _repeat = $('#target_repeat').prop('checked') ? 1 : 0;
+  var _schedule = $("#schedule").val();
+  var _schedule_name = $("#schedule_name").val();
+  var _expiration_hours = parseInt($("#expiration_hours").val()) || 0;
+  var _discovery = ($("#discovery").val() || "").trim();
+  var _max_rows = parseInt($("#max_rows").val()) || 0;
+  var _max_bytes = (parseInt($("#max_mb").val()) || 0) * 1024 * 1024;
+  var editor = $('.CodeMirror')[0].CodeMirror;
+  var _query = editor.getValue();
+
+  // Making sure targets are specified
+  if (noQueryTargets(_targets)) {
+    $("#warningModalMessage").text("No targets have been specified");
+    $("#warningModal").modal();
+    return;
+  }
   // Making sure query isn't empty
   console.log(_query);
   if (_query === "") {
@@ -44,28 +115,85 @@ function sendQuery() {
     _query = _query + ';';
   }
   var _url = '/query/run';
-  var data = {
+  var data = $.extend(_targets, {
     csrftoken: _csrftoken,
-    environment_list: _env_list,
-    platform_list: _platform_list,
-    uuid_list: _uuid_list,
-    host_list: _host_list,
     query: _query,
-    repeat: _repeat
-  };
+    discovery: _discovery,
+    saved_query: $("#saved_query").val() || "",
+    parameters: savedParameters(),
+    repeat: _repeat,
+    schedule: _schedule,
+    schedule_name: _schedule_name,
+    expiration_hours: _expiration_hours,
+    max_rows: _max_rows,
+    max_bytes: _max_bytes
+  });
+  // Scheduled queries run later, following the schedule
+  if (_schedule !== "") {
+    if (_schedule_name === "") {
+      $("#warningModalMessage").text("Scheduled queries need a name");
+      $("#warningModal").modal();
+      return;
+    }
+    sendPostRequest(data, _url, '/query/schedules', false);
+    return;
+  }
   sendPostRequest(data, _url, '/query/list', false);
 }
 
 function clearQuery() {
+  clearSavedQuery();
   var editor = $('.CodeMirror')[0].CodeMirror;
   editor.setValue("");
 }
 
 function setQuery(query) {
+  clearSavedQuery();
   var editor = $('.CodeMirror')[0].CodeMirror;
   editor.setValue(query);
 }
 
+function clearSavedQuery() {
+  $("#saved_query").val("");
+  $("#saved_parameters").empty().hide();
+  $("#saved_query_description").text("parameters are filled in when the query is launched");
+  $('.CodeMirror')[0].CodeMirror.setOption("readOnly", false);
+}
+
+function selectSavedQuery() {
+  var _name = $("#saved_query").val();
+  if (_name === "") {
+    clearQuery();
+    return;
+  }
+  $.getJSON('/query/saved/json/' + encodeURIComponent(_name), function (saved) {
+    var editor = $('.CodeMirror')[0].CodeMirror;
+    editor.setValue(saved.query);
+    // The saved query is rendered by the server, so it can not be changed here
+    editor.setOption("readOnly", true);
+    $("#saved_query_description").text(saved.description);
+    var params = $("#saved_parameters");
+    params.empty();
+    $.each(saved.parameters || [], function (i, p) {
+      var field = $("<div>").addClass("col-sm-12 col-md-6 col-lg-6 col-xl-6");
+      field.append($("<label>").text(p.name + " (" + p.type + "):"));
+      field.append($("<input>").addClass("form-control saved-parameter").attr("type", "text")
+        .attr("data-parameter", p.name).attr("placeholder", p.default).val(p.default));
+      field.append($("<small>").addClass("text-muted").text(p.description));
+      params.append(field);
+    });
+    params.toggle((saved.parameters || []).length > 0);
+  });
+}
+
+function savedParameters() {
+  var _params = {};
+  $(".saved-parameter").each(function () {
+    _params[$(this).attr("data-parameter")] = $(this).val();
+  });
+  return _params;
+}
+
 $("#query").keyup(function (event) {
   if (event.keyCode === 13) {
     $("#query_button").click();
@@ -110,3 +238,217 @@ function queryResultLink(link, query) {
   var external_link = '<a href="' + link + '" _target="_blank"><i class="fas fa-external-link-alt"></i></a>';
   return '<span class="query-link"><a href="/query/logs/' + query + '">' + query + '</a> - ' + external_link + '</span> ';
 }
+
+function formatMilliseconds(ms) {
+  if (ms < 1000) {
+    return ms + 'ms';
+  }
+  return (ms / 1000).toFixed(1) + 's';
+}
+
+function formatBytes(bytes) {
+  var units = ['B', 'KB', 'MB', 'GB', 'TB'];
+  var i = 0;
+  while (bytes >= 1024 && i < units.length - 1) {
+    bytes /= 1024;
+    i++;
+  }
+  return (i === 0 ? bytes : bytes.toFixed(1)) + ' ' + units[i];
+}
+
+function actionSchedules(_action, _names) {
+  var _csrftoken = $("#csrftoken").val();
+
+  var _url = '/query/schedules/actions';
+  var data = {
+    csrftoken: _csrftoken,
+    names: _names,
+    action: _action
+  };
+  sendPostRequest(data, _url, '/query/schedules', false);
+}
+
+function confirmDeleteSchedule(_name) {
+  var modal_message = 'Are you sure you want to delete schedule ' + _name + '?';
+  $("#confirmModalMessage").text(modal_message);
+  $('#confirm_action').click(function () {
+    $('#confirmModal').modal('hide');
+    actionSchedules('delete', [_name]);
+  });
+  $("#confirmModal").modal();
+}
+
+function actionApproval(_action, _name, _comment_id) {
+  var _csrftoken = $("#csrftoken").val();
+  var _comment = $("#" + _comment_id).val();
+
+  var _url = '/query/approvals/actions';
+  var data = {
+    csrftoken: _csrftoken,
+    action: _action,
+    name: _name,
+    comment: _comment
+  };
+  sendPostRequest(data, _url, '/query/approvals', false);
+}
+
+function saveSavedQuery() {
+  var editor = $('#saved_sql').data('CodeMirrorInstance');
+  var _params = [];
+  $("#parameters_table tbody tr").each(function () {
+    var _name = $(this).find(".param-name").val();
+    if (_name !== "") {
+      _params.push({
+        name: _name,
+        type: $(this).find(".param-type").val(),
+        default: $(this).find(".param-default").val(),
+        description: $(this).find(".param-description").val()
+      });
+    }
+  });
+  var _name = $("#saved_name").val();
+  var data = {
+    csrftoken: $("#csrftoken").val(),
+    action: 'save',
+    name: _name,
+    description: $("#saved_description").val(),
+    query: editor.getValue(),
+    tags: $("#saved_tags").val(),
+    shared: $("#saved_shared").prop('checked'),
+    parameters: _params
+  };
+  sendPostRequest(data, '/query/saved/actions', '/query/saved/' + encodeURIComponent(_name), false);
+}
+
+function addSavedParameter() {
+  var row = $("#parameters_table tbody tr.param-template").clone();
+  row.removeClass("param-template d-none");
+  $("#parameters_table tbody").append(row);
+}
+
+function actionSavedQuery(_action, _name, _version, _redir) {
+  var data = {
+    csrftoken: $("#csrftoken").val(),
+    action: _action,
+    name: _name,
+    version: _version
+  };
+  sendPostRequest(data, '/query/saved/actions', _redir, false);
+}
+
+function confirmDeleteSavedQuery(_name) {
+  var modal_message = 'Are you sure you want to delete saved query ' + _name + ' and its history?';
+  $("#confirmModalMessage").text(modal_message);
+  $('#confirm_action').click(function () {
+    $('#confirmModal').modal('hide');
+    actionSavedQuery('delete', _name, 0, '/query/saved');
+  });
+  $("#confirmModal").modal();
+}
+
+function importSavedQueries() {
+  var editor = $('#import_content').data('CodeMirrorInstance');
+  var data = {
+    csrftoken: $("#csrftoken").val(),
+    action: 'import',
+    pack: $("#import_pack").val(),
+    pack_content: btoa(editor.getValue()),
+    shared: $("#import_shared").prop('checked'),
+    replace: $("#import_replace").prop('checked')
+  };
+  sendPostRequest(data, '/query/saved/actions', '/query/saved', false);
+}
+
+function aggregateResults(_name) {
+  var _params = {
+    group: $("#aggregate_group").val(),
+    filter: $("#aggregate_filters").val().split("\n").filter(function(f) { return f.trim() !== ""; }),
+    least: $("#aggregate_least").is(':checked'),
+    limit: $("#aggregate_limit").val()
+  };
+  var _url = '/json/aggregate/' + encodeURIComponent(_name) + '?' + $.param(_params, true);
+  $.ajax({
+    url: _url,
+    dataType: 'json',
+    type: 'GET',
+    success: function (data) {
+      var _columns = $("#aggregate_columns");
+      _columns.empty();
+      $.each(data.columns, function(i, c) {
+        _columns.append($('<option>').attr('value', c));
+      });
+      $("#aggregate_summary").text(data.rows + ' rows from ' + data.nodes + ' nodes in ' + data.groups + ' groups');
+      var _head = $("#aggregate_table thead");
+      var _body = $("#aggregate_table tbody");
+      _head.empty();
+      _body.empty();
+      if (!data.group_by) {
+        return;
+      }
+      var _hrow = $('<tr>');
+      $.each(data.group_by, function(i, g) {
+        _hrow.append($('<th>').text(g));
+      });
+      _hrow.append($('<th>').text('Rows'));
+      _hrow.append($('<th>').text('Nodes'));
+      _head.append(_hrow);
+      $.each(data.buckets, function(i, b) {
+        var _row = $('<tr>');
+        $.each(b.values, function(j, v) {
+          _row.append($('<td>').text(v));
+        });
+        _row.append($('<td>').text(b.count));
+        _row.append($('<td>').text(b.nodes));
+        _body.append(_row);
+      });
+    },
+    error: function (jqXhr, textStatus, errorThrown) {
+      var _serverJSON = $.parseJSON(jqXhr.responseText);
+      $("#errorModalMessageClient").text('Client: ' + errorThrown);
+      $("#errorModalMessageServer").text('Server: ' + _serverJSON.message);
+      $("#errorModal").modal();
+    }
+  });
+}
+
+function streamResults(_name, _table) {
+  if (!window.EventSource) {
+    return false;
+  }
+  var _reload = null;
+  var source = new EventSource('/query/stream/' + _name);
+  source.addEventListener('open', function () {
+    $("#stream_status").removeClass("badge-secondary").addClass("badge-success").text("live").show();
+  });
+  source.addEventListener('result', function () {
+    // Many results can arrive at once, so the table is reloaded at most every two seconds
+    if (_reload === null) {
+      _reload = setTimeout(function () {
+        _reload = null;
+        _table.ajax.reload(null, false);
+      }, 2000);
+    }
+  });
+  source.addEventListener('progress', function (e) {
+    var progress = JSON.parse(e.data);
+    $("#progress_expected").text(progress.expected);
+    $("#progress_executions").text(progress.executions);
+    $("#progress_errors").text(progress.errors);
+    $("#progress_skipped").text(progress.skipped);
+  });
+  source.addEventListener('done', function () {
+    source.close();
+    _table.ajax.reload(null, false);
+    $("#stream_status").removeClass("badge-success").addClass("badge-secondary").text("finished").show();
+  });
+  source.addEventListener('error', function (e) {
+    // Results that can not be parsed are sent as error events with data, connection errors have none
+    if (e.data) {
+      var failed = JSON.parse(e.data);
+      console.log("invalid results from " + failed.uuid + ": " + failed.error);
+      return;
+    }
+    $("#stream_status").removeClass("badge-success").addClass("badge-secondary").text("reconnecting").show();
+  });
+  return true;
+}
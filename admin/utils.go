@@ -44,21 +44,6 @@ func resultLogsLink(uuid string) string {
 	return strings.Replace(settingsmgr.ResultLogsLink(), "{{UUID}}", removeBackslash(uuid), 1)
 }
 
-// Helper to calculate the osquery config_hash and skip sending a blob that won't change anything
-// https://github.com/facebook/osquery/blob/master/osquery/config/config.cpp#L911
-// osquery calculates the SHA1 of the configuration blob, then the SHA1 hash of that
-/*
-func generateOsqueryConfigHash(config string) string {
-	firstHasher := sha1.New()
-	secondHasher := sha1.New()
-	// Get SHA1 of configuration blob
-	_, _ = firstHasher.Write([]byte(config))
-	// Get SHA1 of the first hash
-	_, _ = secondHasher.Write([]byte(hex.EncodeToString(firstHasher.Sum(nil))))
-	return hex.EncodeToString(secondHasher.Sum(nil))
-}
-*/
-
 // Helper to convert from settings values to JSON configuration
 func toJSONConfigurationService(values []settings.SettingValue) types.JSONConfigurationService {
 	var cfg types.JSONConfigurationService
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/jmpsec/osctrl/logging"
+	"github.com/jmpsec/osctrl/settings"
+	"github.com/jmpsec/osctrl/users"
+	"github.com/jmpsec/osctrl/utils"
+)
+
+const (
+	metricAPIAnalysisReq = "analysis-req"
+	metricAPIAnalysisErr = "analysis-err"
+	metricAPIAnalysisOK  = "analysis-ok"
+)
+
+// POST Handler to run read-only SQL over the results of on-demand and scheduled queries
+func apiAnalysisHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIAnalysisReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIAnalysisErr)
+		return
+	}
+	var a logging.AnalysisRequest
+	// Parse request JSON body
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		apiErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		incMetric(metricAPIAnalysisErr)
+		return
+	}
+	// On-demand queries must exist, scheduled results are loaded by name
+	for _, s := range a.Sources {
+		if s.Type != logging.AnalysisSourceQuery {
+			continue
+		}
+		if _, err := queriesmgr.Get(s.Name); err != nil {
+			apiErrorResponse(w, "query not found: "+s.Name, http.StatusNotFound, err)
+			incMetric(metricAPIAnalysisErr)
+			return
+		}
+	}
+	result, err := logging.AnalyzeResults(r.Context(), db, nodesmgr, a)
+	if err != nil {
+		apiErrorResponse(w, "error running analysis: "+err.Error(), http.StatusBadRequest, nil)
+		incMetric(metricAPIAnalysisErr)
+		return
+	}
+	// Serialize and serve JSON
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Analysis returned %d rows", len(result.Rows))
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, result)
+	incMetric(metricAPIAnalysisOK)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jmpsec/osctrl/queries"
+	"github.com/jmpsec/osctrl/settings"
+	"github.com/jmpsec/osctrl/users"
+	"github.com/jmpsec/osctrl/utils"
+)
+
+const (
+	metricAPIApprovalsReq = "approvals-req"
+	metricAPIApprovalsErr = "approvals-err"
+	metricAPIApprovalsOK  = "approvals-ok"
+)
+
+// Helper to get the access level needed to review a query, carves need carve permissions
+func approvalLevel(query queries.DistributedQuery) users.AccessLevel {
+	if query.Type == queries.CarveQueryType {
+		return users.CarveLevel
+	}
+	return users.QueryLevel
+}
+
+// GET Handler to return all queries and carves pending approval in JSON
+func apiApprovalsHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIApprovalsReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) && !apiUsers.CheckPermissions(ctx[ctxUser], users.CarveLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIApprovalsErr)
+		return
+	}
+	pending, err := queriesmgr.GetPending()
+	if err != nil {
+		apiErrorResponse(w, "error getting pending queries", http.StatusInternalServerError, err)
+		incMetric(metricAPIApprovalsErr)
+		return
+	}
+	response := []ApiApprovalResponse{}
+	for _, q := range pending {
+		approvals, err := queriesmgr.GetApprovals(q.Name)
+		if err != nil {
+			apiErrorResponse(w, "error getting approvals", http.StatusInternalServerError, err)
+			incMetric(metricAPIApprovalsErr)
+			return
+		}
+		response = append(response, ApiApprovalResponse{Query: q, Approvals: approvals})
+	}
+	// Serialize and serve JSON
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, response)
+	incMetric(metricAPIApprovalsOK)
+}
+
+// GET Handler to return the approval history of a query or carve in JSON
+func apiApprovalHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIApprovalsReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPIApprovalsErr)
+		return
+	}
+	query, err := queriesmgr.Get(name)
+	if err != nil {
+		apiErrorResponse(w, "query not found", http.StatusNotFound, err)
+		incMetric(metricAPIApprovalsErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], approvalLevel(query), users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIApprovalsErr)
+		return
+	}
+	approvals, err := queriesmgr.GetApprovals(name)
+	if err != nil {
+		apiErrorResponse(w, "error getting approvals", http.StatusInternalServerError, err)
+		incMetric(metricAPIApprovalsErr)
+		return
+	}
+	// Serialize and serve JSON
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, ApiApprovalResponse{Query: query, Approvals: approvals})
+	incMetric(metricAPIApprovalsOK)
+}
+
+// POST Handler to approve or reject a query or carve pending approval
+func apiApprovalActionHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIApprovalsReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), true)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPIApprovalsErr)
+		return
+	}
+	query, err := queriesmgr.Get(name)
+	if err != nil {
+		apiErrorResponse(w, "query not found", http.StatusNotFound, err)
+		incMetric(metricAPIApprovalsErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], approvalLevel(query), users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIApprovalsErr)
+		return
+	}
+	var a ApiApprovalRequest
+	// Parse request JSON body
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		apiErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		incMetric(metricAPIApprovalsErr)
+		return
+	}
+	var approval string
+	switch vars["action"] {
+	case "approve":
+		approval = queries.ApprovalApproved
+		err = queriesmgr.Approve(name, ctx[ctxUser], a.Comment)
+	case "reject":
+		approval = queries.ApprovalRejected
+		err = queriesmgr.Reject(name, ctx[ctxUser], a.Comment)
+	default:
+		apiErrorResponse(w, "invalid action", http.StatusBadRequest, nil)
+		incMetric(metricAPIApprovalsErr)
+		return
+	}
+	if err != nil {
+		apiErrorResponse(w, "error with approval: "+err.Error(), http.StatusBadRequest, nil)
+		incMetric(metricAPIApprovalsErr)
+		return
+	}
+	// Return query name and approval as serialized response
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, ApiQueriesResponse{Name: name, Approval: approval})
+	incMetric(metricAPIApprovalsOK)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/jmpsec/osctrl/carves"
+	"github.com/jmpsec/osctrl/queries"
+	"github.com/jmpsec/osctrl/settings"
+	"github.com/jmpsec/osctrl/users"
+	"github.com/jmpsec/osctrl/utils"
+)
+
+const (
+	metricAPICarvesReq = "carves-req"
+	metricAPICarvesErr = "carves-err"
+	metricAPICarvesOK  = "carves-ok"
+)
+
+// POST Handler to run a carve
+func apiCarvesRunHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPICarvesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.CarveLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPICarvesErr)
+		return
+	}
+	var c DistributedCarveRequest
+	// Parse request JSON body
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		apiErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		incMetric(metricAPICarvesErr)
+		return
+	}
+	// Path can not be empty
+	if c.Path == "" {
+		apiErrorResponse(w, "path can not be empty", http.StatusInternalServerError, nil)
+		incMetric(metricAPICarvesErr)
+		return
+	}
+	// Prepare and create new carve
+	carveName := generateCarveName()
+	newQuery := queries.DistributedQuery{
+		Query:      carves.GenerateQuery(c.Path, false),
+		Name:       carveName,
+		Creator:    ctx[ctxUser],
+		Expected:   0,
+		Executions: 0,
+		Active:     true,
+		Completed:  false,
+		Deleted:    false,
+		Hidden:     true,
+		Type:       queries.CarveQueryType,
+		Path:       c.Path,
+		Expiration: queryExpiration(c.ExpirationHours),
+	}
+	// Carves stay pending until the approval policy is checked against the targeted nodes
+	policy := approvalPolicy()
+	if policy.Enabled() {
+		newQuery.Approval = queries.ApprovalPending
+	}
+	if err := queriesmgr.Create(newQuery); err != nil {
+		apiErrorResponse(w, "error creating carve", http.StatusInternalServerError, err)
+		incMetric(metricAPICarvesErr)
+		return
+	}
+	// Temporary list of UUIDs to calculate Expected
+	var expected []string
+	// Temporary list of environments to check carve quotas
+	var targetEnvs []string
+	// Create environment target
+	for _, e := range c.Environments {
+		if (e != "") && envs.Exists(e) {
+			if err := queriesmgr.CreateTarget(carveName, queries.QueryTargetEnvironment, e); err != nil {
+				apiErrorResponse(w, "error creating carve environment target", http.StatusInternalServerError, err)
+				incMetric(metricAPICarvesErr)
+				return
+			}
+			nodes, err := nodesmgr.GetByEnv(e, "active", settingsmgr.InactiveHours())
+			if err != nil {
+				apiErrorResponse(w, "error getting nodes by environment", http.StatusInternalServerError, err)
+				incMetric(metricAPICarvesErr)
+				return
+			}
+			for _, n := range nodes {
+				expected = append(expected, n.UUID)
+			}
+			targetEnvs = append(targetEnvs, e)
+		}
+	}
+	// Create platform target
+	for _, p := range c.Platforms {
+		if (p != "") && checkValidPlatform(p) {
+			if err := queriesmgr.CreateTarget(carveName, queries.QueryTargetPlatform, p); err != nil {
+				apiErrorResponse(w, "error creating carve platform target", http.StatusInternalServerError, err)
+				incMetric(metricAPICarvesErr)
+				return
+			}
+			nodes, err := nodesmgr.GetByPlatform(p, "active", settingsmgr.InactiveHours())
+			if err != nil {
+				apiErrorResponse(w, "error getting nodes by platform", http.StatusInternalServerError, err)
+				incMetric(metricAPICarvesErr)
+				return
+			}
+			for _, n := range nodes {
+				expected = append(expected, n.UUID)
+				targetEnvs = append(targetEnvs, n.Environment)
+			}
+		}
+	}
+	// Create UUIDs target
+	for _, u := range c.UUIDs {
+		if (u != "") && nodesmgr.CheckByUUID(u) {
+			if err := queriesmgr.CreateTarget(carveName, queries.QueryTargetUUID, u); err != nil {
+				apiErrorResponse(w, "error creating carve UUID target", http.StatusInternalServerError, err)
+				incMetric(metricAPICarvesErr)
+				return
+			}
+			expected = append(expected, u)
+			if n, err := nodesmgr.GetByUUID(u); err == nil {
+				targetEnvs = append(targetEnvs, n.Environment)
+			}
+		}
+	}
+	// Create hostnames target
+	for _, h := range c.Hosts {
+		if (h != "") && nodesmgr.CheckByHost(h) {
+			if err := queriesmgr.CreateTarget(carveName, queries.QueryTargetLocalname, h); err != nil {
+				apiErrorResponse(w, "error creating carve hostname target", http.StatusInternalServerError, err)
+				incMetric(metricAPICarvesErr)
+				return
+			}
+			expected = append(expected, h)
+		}
+	}
+	// Remove duplicates from expected
+	expectedClear := removeStringDuplicates(expected)
+	// Update value for expected
+	if err := queriesmgr.SetExpected(carveName, len(expectedClear)); err != nil {
+		apiErrorResponse(w, "error setting expected", http.StatusInternalServerError, err)
+		incMetric(metricAPICarvesErr)
+		return
+	}
+	// Track the delivery of the query to each targeted node
+	if err := queriesmgr.InitStatuses(carveName, nodesmgr, settingsmgr.InactiveHours()); err != nil {
+		apiErrorResponse(w, "error initializing node statuses", http.StatusInternalServerError, err)
+		incMetric(metricAPICarvesErr)
+		return
+	}
+	pending, reason, err := checkApproval(carveName, policy)
+	if err != nil {
+		apiErrorResponse(w, "error checking approval", http.StatusInternalServerError, err)
+		incMetric(metricAPICarvesErr)
+		return
+	}
+	// Warn about carve quotas that may reject this carve
+	warnings := filecarves.QuotaWarnings(removeStringDuplicates(targetEnvs), ctx[ctxUser], len(expectedClear))
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Created carve %s with %d warnings", carveName, len(warnings))
+	}
+	response := ApiCarvesResponse{Name: carveName, Expected: len(expectedClear), Warnings: warnings}
+	if pending {
+		response.Approval = queries.ApprovalPending
+		response.Reason = reason
+	}
+	// Return carve name and warnings as serialized response
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, response)
+	incMetric(metricAPICarvesOK)
+}
+
+// GET Handler to return carve quotas in JSON
+func apiCarveQuotasHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPICarvesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.CarveLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPICarvesErr)
+		return
+	}
+	// Get quotas
+	quotas, err := filecarves.GetQuotas()
+	if err != nil {
+		apiErrorResponse(w, "error getting carve quotas", http.StatusInternalServerError, err)
+		incMetric(metricAPICarvesErr)
+		return
+	}
+	// Serialize and serve JSON
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, quotas)
+	incMetric(metricAPICarvesOK)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jmpsec/osctrl/configs"
+	"github.com/jmpsec/osctrl/environments"
+	"github.com/jmpsec/osctrl/settings"
+	"github.com/jmpsec/osctrl/users"
+	"github.com/jmpsec/osctrl/utils"
+)
+
+const (
+	metricAPIConfigsReq = "configs-req"
+	metricAPIConfigsErr = "configs-err"
+	metricAPIConfigsOK  = "configs-ok"
+)
+
+// POST Handler to validate an osquery configuration for one environment
+func apiConfigValidateHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIConfigsReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	environment, ok := vars["environment"]
+	if !ok || !envs.Exists(environment) {
+		apiErrorResponse(w, "error getting environment", http.StatusInternalServerError, nil)
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.EnvLevel, environment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	// The body is the configuration to validate
+	configuration, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		apiErrorResponse(w, "error reading POST body", http.StatusInternalServerError, err)
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	validation := configs.Validate(string(configuration), osqueryTables)
+	// Serialize and serve JSON
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Validated configuration for %s", environment)
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, validation)
+	incMetric(metricAPIConfigsOK)
+}
+
+// GET Handler to return the configuration history of one environment as JSON
+func apiConfigHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIConfigsReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	environment, ok := vars["environment"]
+	if !ok || !envs.Exists(environment) {
+		apiErrorResponse(w, "error getting environment", http.StatusInternalServerError, nil)
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.EnvLevel, environment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	// Get versions, optionally by type
+	versions, err := envs.GetVersions(environment, r.URL.Query().Get("type"))
+	if err != nil {
+		apiErrorResponse(w, "error getting versions", http.StatusInternalServerError, err)
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	// Serialize and serve JSON
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Returned history for %s", environment)
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, versions)
+	incMetric(metricAPIConfigsOK)
+}
+
+// GET Handler to return one version of the configuration of one environment as JSON
+func apiConfigVersionHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIConfigsReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	environment, ok := vars["environment"]
+	if !ok || !envs.Exists(environment) {
+		apiErrorResponse(w, "error getting environment", http.StatusInternalServerError, nil)
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.EnvLevel, environment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	// Extract version
+	id, err := strconv.ParseUint(vars["version"], 10, 32)
+	if err != nil {
+		apiErrorResponse(w, "error getting version", http.StatusInternalServerError, err)
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	version, err := envs.GetVersion(environment, uint(id))
+	if err != nil {
+		apiErrorResponse(w, "version not found", http.StatusNotFound, err)
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	// Serialize and serve JSON
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, version)
+	incMetric(metricAPIConfigsOK)
+}
+
+// GET Handler to return the difference between two versions of one environment as JSON
+func apiConfigDiffHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIConfigsReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	environment, ok := vars["environment"]
+	if !ok || !envs.Exists(environment) {
+		apiErrorResponse(w, "error getting environment", http.StatusInternalServerError, nil)
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.EnvLevel, environment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	// Extract both versions to compare
+	var versions []environments.EnvironmentVersion
+	for _, param := range []string{"from", "to"} {
+		id, err := strconv.ParseUint(r.URL.Query().Get(param), 10, 32)
+		if err != nil {
+			apiErrorResponse(w, "error getting version "+param, http.StatusInternalServerError, err)
+			incMetric(metricAPIConfigsErr)
+			return
+		}
+		version, err := envs.GetVersion(environment, uint(id))
+		if err != nil {
+			apiErrorResponse(w, "version not found", http.StatusNotFound, err)
+			incMetric(metricAPIConfigsErr)
+			return
+		}
+		versions = append(versions, version)
+	}
+	// Serialize and serve JSON
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, environments.DiffVersions(versions[0], versions[1]))
+	incMetric(metricAPIConfigsOK)
+}
+
+// GET Handler to return the configuration drift of the active nodes of one environment as JSON
+func apiConfigDriftHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIConfigsReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	environment, ok := vars["environment"]
+	if !ok || !envs.Exists(environment) {
+		apiErrorResponse(w, "error getting environment", http.StatusInternalServerError, nil)
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.EnvLevel, environment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	// Optionally filter by status
+	status := r.URL.Query().Get("status")
+	if status != "" && !configs.ValidDriftStatus(status) {
+		apiErrorResponse(w, "invalid drift status", http.StatusBadRequest, nil)
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	nodes, err := nodesmgr.GetByEnv(environment, "active", settingsmgr.InactiveHours())
+	if err != nil {
+		apiErrorResponse(w, "error getting nodes", http.StatusInternalServerError, err)
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	drifts, err := configsmgr.DriftNodes(nodes, time.Duration(settingsmgr.DriftGraceMinutes())*time.Minute, status)
+	if err != nil {
+		apiErrorResponse(w, "error getting drift", http.StatusInternalServerError, err)
+		incMetric(metricAPIConfigsErr)
+		return
+	}
+	// Serialize and serve JSON
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Returned drift for %s", environment)
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, drifts)
+	incMetric(metricAPIConfigsOK)
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/jmpsec/osctrl/environments"
 	"github.com/jmpsec/osctrl/settings"
 	"github.com/jmpsec/osctrl/users"
 	"github.com/jmpsec/osctrl/utils"
@@ -80,3 +81,44 @@ func apiEnvironmentsHandler(w http.ResponseWriter, r *http.Request) {
 	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, envAll)
 	incMetric(metricAPIEnvsOK)
 }
+
+// GET Handler to return the flags file of one environment for a platform
+func apiEnvironmentFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIEnvsReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	environment, ok := vars["environment"]
+	if !ok {
+		apiErrorResponse(w, "error getting environment", http.StatusInternalServerError, nil)
+		incMetric(metricAPIEnvsErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.EnvLevel, environment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIEnvsErr)
+		return
+	}
+	// Get environment by name
+	env, err := envs.Get(environment)
+	if err != nil {
+		apiErrorResponse(w, "environment not found", http.StatusNotFound, err)
+		incMetric(metricAPIEnvsErr)
+		return
+	}
+	// Generate flags for the requested platform
+	flags, err := environments.GenerateFlagsPlatform(env, vars["platform"], projectName+"-"+env.Name)
+	if err != nil {
+		apiErrorResponse(w, "error generating flags", http.StatusBadRequest, err)
+		incMetric(metricAPIEnvsErr)
+		return
+	}
+	// Serve flags as text
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Returned %s flags for %s", vars["platform"], environment)
+	}
+	utils.HTTPResponse(w, utils.TextPlainUTF8, http.StatusOK, []byte(flags))
+	incMetric(metricAPIEnvsOK)
+}
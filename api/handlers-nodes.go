@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/jmpsec/osctrl/configs"
 	"github.com/jmpsec/osctrl/settings"
 	"github.com/jmpsec/osctrl/users"
 	"github.com/jmpsec/osctrl/utils"
@@ -74,6 +76,23 @@ func apiNodesHandler(w http.ResponseWriter, r *http.Request) {
 		incMetric(metricAPINodesErr)
 		return
 	}
+	// Only keep out of sync nodes if requested
+	if r.URL.Query().Get("drift") == configs.DriftOutOfSync {
+		drifted := nodes[:0]
+		grace := time.Duration(settingsmgr.DriftGraceMinutes()) * time.Minute
+		for _, n := range nodes {
+			d, err := configsmgr.Drift(n, grace)
+			if err != nil {
+				apiErrorResponse(w, "error getting drift", http.StatusInternalServerError, err)
+				incMetric(metricAPINodesErr)
+				return
+			}
+			if d.Status == configs.DriftOutOfSync {
+				drifted = append(drifted, n)
+			}
+		}
+		nodes = drifted
+	}
 	if len(nodes) == 0 {
 		apiErrorResponse(w, "no nodes", http.StatusNotFound, nil)
 		incMetric(metricAPINodesErr)
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jmpsec/osctrl/packs"
+	"github.com/jmpsec/osctrl/settings"
+	"github.com/jmpsec/osctrl/users"
+	"github.com/jmpsec/osctrl/utils"
+)
+
+const (
+	metricAPIPacksReq = "packs-req"
+	metricAPIPacksErr = "packs-err"
+	metricAPIPacksOK  = "packs-ok"
+)
+
+// GET Handler for multiple JSON packs
+func apiPacksHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIPacksReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.AdminLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	// Get packs
+	allPacks, err := packsmgr.All()
+	if err != nil {
+		apiErrorResponse(w, "error getting packs", http.StatusInternalServerError, err)
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	// Serialize and serve JSON
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Println("DebugService: Returned packs")
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, allPacks)
+	incMetric(metricAPIPacksOK)
+}
+
+// GET Handler to export one pack in the osquery pack JSON format
+func apiPackHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIPacksReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.AdminLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	// Get pack content
+	content, err := packsmgr.Content(name)
+	if err != nil {
+		apiErrorResponse(w, "error getting pack", http.StatusNotFound, err)
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	// Serialize and serve JSON
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Returned pack %s", name)
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, content)
+	incMetric(metricAPIPacksOK)
+}
+
+// POST Handler to import one pack in the osquery pack JSON format
+func apiPackImportHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIPacksReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.AdminLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	var p ApiPackRequest
+	// Parse request JSON body
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		apiErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	if err := packsmgr.Import(name, p.Description, p.Pack, p.Replace); err != nil {
+		apiErrorResponse(w, "error importing pack", http.StatusInternalServerError, err)
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	// Return pack name as serialized response
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Imported pack %s", name)
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, ApiPacksResponse{Name: name})
+	incMetric(metricAPIPacksOK)
+}
+
+// POST Handler to delete one pack
+func apiPackDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIPacksReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.AdminLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	if err := packsmgr.Delete(name); err != nil {
+		apiErrorResponse(w, "error deleting pack", http.StatusInternalServerError, err)
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	// Return pack name as serialized response
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, ApiPacksResponse{Name: name})
+	incMetric(metricAPIPacksOK)
+}
+
+// POST Handler to assign or unassign one pack to environments and tags
+func apiPackTargetsHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIPacksReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.AdminLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	var t ApiPackTargetRequest
+	// Parse request JSON body
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		apiErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	switch t.Action {
+	case "add":
+		if (t.Type == packs.PackTargetEnvironment && !envs.Exists(t.Value)) || (t.Type == packs.PackTargetTag && !tagsmgr.Exists(t.Value)) {
+			apiErrorResponse(w, "error adding target", http.StatusInternalServerError, fmt.Errorf("%s %s does not exist", t.Type, t.Value))
+			incMetric(metricAPIPacksErr)
+			return
+		}
+		if err := packsmgr.AddTarget(name, t.Type, t.Value); err != nil {
+			apiErrorResponse(w, "error adding target", http.StatusInternalServerError, err)
+			incMetric(metricAPIPacksErr)
+			return
+		}
+	case "remove":
+		if err := packsmgr.RemoveTarget(name, t.Type, t.Value); err != nil {
+			apiErrorResponse(w, "error removing target", http.StatusInternalServerError, err)
+			incMetric(metricAPIPacksErr)
+			return
+		}
+	default:
+		apiErrorResponse(w, "invalid action", http.StatusInternalServerError, fmt.Errorf("unknown action %s", t.Action))
+		incMetric(metricAPIPacksErr)
+		return
+	}
+	// Return pack name as serialized response
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, ApiPacksResponse{Name: name})
+	incMetric(metricAPIPacksOK)
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/jmpsec/osctrl/logging"
 	"github.com/jmpsec/osctrl/queries"
 	"github.com/jmpsec/osctrl/settings"
 	"github.com/jmpsec/osctrl/users"
@@ -75,13 +78,46 @@ func apiQueriesRunHandler(w http.ResponseWriter, r *http.Request) {
 		incMetric(metricAPIQueriesErr)
 		return
 	}
-	// FIXME check validity of query
+	// Saved queries are launched with their parameters filled in
+	if q.SavedQuery != "" {
+		saved, err := queriesmgr.GetSaved(q.SavedQuery)
+		if err != nil || !queries.CanAccessSaved(saved, ctx[ctxUser], apiUsers.IsAdmin(ctx[ctxUser])) {
+			apiErrorResponse(w, "saved query not found", http.StatusNotFound, err)
+			incMetric(metricAPIQueriesErr)
+			return
+		}
+		if q.Query, err = queriesmgr.RenderSaved(saved.Name, q.Parameters); err != nil {
+			apiErrorResponse(w, "invalid parameters: "+err.Error(), http.StatusBadRequest, nil)
+			incMetric(metricAPIQueriesErr)
+			return
+		}
+	}
 	// Query can not be empty
 	if q.Query == "" {
 		apiErrorResponse(w, "query can not be empty", http.StatusInternalServerError, nil)
 		incMetric(metricAPIQueriesErr)
 		return
 	}
+	// Check query against the osquery schema, warnings do not stop the query
+	if lint := queries.Lint(q.Query, osquerySchema, q.Platforms); !lint.Valid {
+		apiErrorResponse(w, "invalid query: "+strings.Join(lint.Errors, ", "), http.StatusBadRequest, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	if q.Discovery != "" {
+		if lint := queries.Lint(q.Discovery, osquerySchema, q.Platforms); !lint.Valid {
+			apiErrorResponse(w, "invalid discovery query: "+strings.Join(lint.Errors, ", "), http.StatusBadRequest, nil)
+			incMetric(metricAPIQueriesErr)
+			return
+		}
+	}
+	// Targets matched against node attributes
+	extraTargets, err := matchTargets(q.Tags, q.Hostnames, q.CIDRs, q.OsqueryVersion, q.PlatformVersion, q.TargetExpression)
+	if err != nil {
+		apiErrorResponse(w, "invalid query targets", http.StatusBadRequest, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
 	// Prepare and create new query
 	queryName := generateQueryName()
 	newQuery := queries.DistributedQuery{
@@ -95,6 +131,16 @@ func apiQueriesRunHandler(w http.ResponseWriter, r *http.Request) {
 		Deleted:    false,
 		Hidden:     true,
 		Type:       queries.StandardQueryType,
+		SavedQuery: q.SavedQuery,
+		Discovery:  q.Discovery,
+		Expiration: queryExpiration(q.ExpirationHours),
+		MaxRows:    q.MaxRows,
+		MaxBytes:   q.MaxBytes,
+	}
+	// Queries stay pending until the approval policy is checked against the targeted nodes
+	policy := approvalPolicy()
+	if policy.Enabled() {
+		newQuery.Approval = queries.ApprovalPending
 	}
 	if err := queriesmgr.Create(newQuery); err != nil {
 		apiErrorResponse(w, "error creating query", http.StatusInternalServerError, err)
@@ -171,6 +217,31 @@ func apiQueriesRunHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
+	// Create tag, hostname pattern, CIDR and version targets
+	if len(extraTargets) > 0 {
+		for _, t := range extraTargets {
+			if err := queriesmgr.CreateTarget(queryName, t.Type, t.Value); err != nil {
+				apiErrorResponse(w, "error creating query "+t.Type+" target", http.StatusInternalServerError, err)
+				incMetric(metricAPIQueriesErr)
+				return
+			}
+		}
+		nodes, err := nodesmgr.Gets("active", settingsmgr.InactiveHours())
+		if err != nil {
+			apiErrorResponse(w, "error getting nodes", http.StatusInternalServerError, err)
+			incMetric(metricAPIQueriesErr)
+			return
+		}
+		matched, err := queriesmgr.MatchingNodes(extraTargets, nodes)
+		if err != nil {
+			apiErrorResponse(w, "error matching nodes", http.StatusInternalServerError, err)
+			incMetric(metricAPIQueriesErr)
+			return
+		}
+		for _, n := range matched {
+			expected = append(expected, n.UUID)
+		}
+	}
 	// Remove duplicates from expected
 	expectedClear := removeStringDuplicates(expected)
 	// Update value for expected
@@ -179,8 +250,25 @@ func apiQueriesRunHandler(w http.ResponseWriter, r *http.Request) {
 		incMetric(metricAPIQueriesErr)
 		return
 	}
+	// Track the delivery of the query to each targeted node
+	if err := queriesmgr.InitStatuses(queryName, nodesmgr, settingsmgr.InactiveHours()); err != nil {
+		apiErrorResponse(w, "error initializing node statuses", http.StatusInternalServerError, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	response := ApiQueriesResponse{Name: newQuery.Name}
+	pending, reason, err := checkApproval(queryName, policy)
+	if err != nil {
+		apiErrorResponse(w, "error checking approval", http.StatusInternalServerError, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	if pending {
+		response.Approval = queries.ApprovalPending
+		response.Reason = reason
+	}
 	// Return query name as serialized response
-	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, ApiQueriesResponse{Name: newQuery.Name})
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, response)
 	incMetric(metricAPIQueriesOK)
 }
 
@@ -259,11 +347,36 @@ func apiQueryResultsHandler(w http.ResponseWriter, r *http.Request) {
 		incMetric(metricAPIEnvsErr)
 		return
 	}
+	// Get one page of results if it is requested
+	if r.URL.Query().Get("page") != "" || r.URL.Query().Get("size") != "" {
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		size, err := strconv.Atoi(r.URL.Query().Get("size"))
+		if err != nil || size < 1 || size > maxQueryLogsPage {
+			apiErrorResponse(w, fmt.Sprintf("size must be between 1 and %d", maxQueryLogsPage), http.StatusBadRequest, err)
+			incMetric(metricAPIQueriesErr)
+			return
+		}
+		queryLogs, err := mysqlQueryLogsPage(name, page, size)
+		if err != nil {
+			apiErrorResponse(w, "error getting query", http.StatusInternalServerError, err)
+			incMetric(metricAPIQueriesErr)
+			return
+		}
+		// Serialize and serve JSON
+		utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, queryLogs)
+		incMetric(metricAPIQueriesOK)
+		return
+	}
 	// Get query by name
 	queryLogs, err := mysqlQueryLogs(name)
 	if err != nil {
 		if err.Error() == "record not found" {
 			apiErrorResponse(w, "query not found", http.StatusNotFound, err)
+		} else if err == errTooManyQueryLogs {
+			apiErrorResponse(w, err.Error(), http.StatusBadRequest, err)
 		} else {
 			apiErrorResponse(w, "error getting query", http.StatusInternalServerError, err)
 		}
@@ -274,3 +387,438 @@ func apiQueryResultsHandler(w http.ResponseWriter, r *http.Request) {
 	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, queryLogs)
 	incMetric(metricAPIQueriesOK)
 }
+
+// GET Handler to download the results of a query as CSV, NDJSON or XLSX
+func apiQueryExportHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIQueriesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name and format
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	format := vars["format"]
+	if !logging.ValidExportFormat(format) {
+		apiErrorResponse(w, "invalid export format "+format, http.StatusBadRequest, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	if _, err := queriesmgr.Get(name); err != nil {
+		apiErrorResponse(w, "query not found", http.StatusNotFound, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Results are streamed, errors after this point can only be logged
+	w.Header().Set(utils.ContentType, logging.ExportContentTypes[format])
+	w.Header().Set("Content-Disposition", "attachment; filename="+logging.ExportFilename(name, format))
+	if err := logging.ExportQueryResults(db, nodesmgr, name, format, w); err != nil {
+		log.Printf("error exporting results of %s - %v", name, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Results of %s exported as %s", name, format)
+	}
+	incMetric(metricAPIQueriesOK)
+}
+
+// GET Handler to stream the results of a query with Server-Sent Events as nodes answer
+func apiQueryStreamHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIQueriesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	if _, err := queriesmgr.Get(name); err != nil {
+		apiErrorResponse(w, "query not found", http.StatusNotFound, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	if err := logging.StreamSupported(settingsmgr); err != nil {
+		apiErrorResponse(w, "results can not be streamed", http.StatusNotImplemented, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	sse, err := utils.NewSSEWriter(w)
+	if err != nil {
+		apiErrorResponse(w, "error streaming results", http.StatusInternalServerError, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Streams end when the query is finished or the client goes away
+	err = logging.StreamQueryResults(r.Context(), db, queriesmgr, nodesmgr, name, streamLastID(r), logging.DefaultStreamInterval, func(e logging.StreamEvent) error {
+		return sse.Send(e.ID, e.Event, e.Data)
+	})
+	if err != nil {
+		log.Printf("error streaming results for %s - %v", name, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	incMetric(metricAPIQueriesOK)
+}
+
+// POST Handler to aggregate the results of a query across nodes in JSON
+func apiQueryAggregateHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIQueriesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	if _, err := queriesmgr.Get(name); err != nil {
+		apiErrorResponse(w, "query not found", http.StatusNotFound, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	var a logging.AggregateRequest
+	// Parse request JSON body
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		apiErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	result, err := logging.AggregateQueryResults(db, nodesmgr, name, a)
+	if err != nil {
+		apiErrorResponse(w, "error aggregating results: "+err.Error(), http.StatusBadRequest, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Serialize and serve JSON
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Aggregated results of %s", name)
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, result)
+	incMetric(metricAPIQueriesOK)
+}
+
+// GET Handler to return the differences per node between two runs of the same SQL in JSON
+func apiQueryDiffHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIQueriesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract names of both runs
+	baseName, ok := vars["base"]
+	if !ok {
+		apiErrorResponse(w, "error getting base", http.StatusInternalServerError, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	targetName, ok := vars["target"]
+	if !ok {
+		apiErrorResponse(w, "error getting target", http.StatusInternalServerError, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	base, err := queriesmgr.Get(baseName)
+	if err != nil {
+		apiErrorResponse(w, "query not found", http.StatusNotFound, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	target, err := queriesmgr.Get(targetName)
+	if err != nil {
+		apiErrorResponse(w, "query not found", http.StatusNotFound, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	diff, err := logging.DiffQueryRuns(db, nodesmgr, base, target, diffKeys(r))
+	if err != nil {
+		apiErrorResponse(w, "error comparing results: "+err.Error(), http.StatusBadRequest, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Serialize and serve JSON
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, diff)
+	incMetric(metricAPIQueriesOK)
+}
+
+// GET Handler to return the differences between the results of two nodes for a query in JSON
+func apiQueryDiffNodesHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIQueriesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name and both nodes
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	base, ok := vars["base"]
+	if !ok {
+		apiErrorResponse(w, "error getting base", http.StatusInternalServerError, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	target, ok := vars["target"]
+	if !ok {
+		apiErrorResponse(w, "error getting target", http.StatusInternalServerError, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	if _, err := queriesmgr.Get(name); err != nil {
+		apiErrorResponse(w, "query not found", http.StatusNotFound, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	diff, err := logging.DiffQueryNodes(db, nodesmgr, name, strings.ToUpper(base), strings.ToUpper(target), diffKeys(r))
+	if err != nil {
+		apiErrorResponse(w, "error comparing results: "+err.Error(), http.StatusBadRequest, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Serialize and serve JSON
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, diff)
+	incMetric(metricAPIQueriesOK)
+}
+
+// Helper to get the key columns to compare rows, separated by commas in the keys parameter
+func diffKeys(r *http.Request) []string {
+	var keys []string
+	for _, k := range strings.Split(r.URL.Query().Get("keys"), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// GET Handler to return the targeted nodes that never answered an expired query in JSON
+func apiQueryNoAnswersHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIQueriesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	if _, err := queriesmgr.Get(name); err != nil {
+		apiErrorResponse(w, "query not found", http.StatusNotFound, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	noAnswers, err := queriesmgr.GetNoAnswers(name)
+	if err != nil {
+		apiErrorResponse(w, "error getting nodes without answer", http.StatusInternalServerError, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Serialize and serve JSON
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, noAnswers)
+	incMetric(metricAPIQueriesOK)
+}
+
+// GET Handler to return the delivery status of a query for each targeted node in JSON
+func apiQueryStatusHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIQueriesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	if _, err := queriesmgr.Get(name); err != nil {
+		apiErrorResponse(w, "query not found", http.StatusNotFound, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	statuses, err := queriesmgr.GetStatuses(name)
+	if err != nil {
+		apiErrorResponse(w, "error getting node statuses", http.StatusInternalServerError, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	response := ApiQueryStatusResponse{
+		Counts: queries.StatusCounts(statuses),
+		Nodes:  statuses,
+	}
+	// Serialize and serve JSON
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, response)
+	incMetric(metricAPIQueriesOK)
+}
+
+// GET Handler to return the execution stats reported by nodes for a query, aggregated and per node
+func apiQueryStatsHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIQueriesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	if _, err := queriesmgr.Get(name); err != nil {
+		apiErrorResponse(w, "query not found", http.StatusNotFound, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	executions, err := queriesmgr.GetExecutions(name)
+	if err != nil {
+		apiErrorResponse(w, "error getting query executions", http.StatusInternalServerError, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	response := ApiQueryStatsResponse{
+		Summary: queries.SummarizeExecutions(executions),
+		Nodes:   executions,
+	}
+	// Serialize and serve JSON
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, response)
+	incMetric(metricAPIQueriesOK)
+}
+
+// POST Handler to preview the nodes targeted by a query before running it
+func apiQueryPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIQueriesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	var q DistributedQueryRequest
+	// Parse request JSON body
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		apiErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Match the targets with the active nodes
+	matched, err := targetedNodes(q)
+	if err != nil {
+		apiErrorResponse(w, "error matching query targets", http.StatusBadRequest, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	preview := ApiQueryPreviewResponse{Count: len(matched), Nodes: []ApiQueryPreviewNode{}}
+	for _, n := range matched {
+		preview.Nodes = append(preview.Nodes, ApiQueryPreviewNode{
+			UUID:        n.UUID,
+			Hostname:    n.Hostname,
+			Platform:    n.Platform,
+			Environment: n.Environment,
+		})
+	}
+	// Serialize and serve JSON
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Returned preview of %d nodes", preview.Count)
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, preview)
+	incMetric(metricAPIQueriesOK)
+}
+
+// POST Handler to check a query against the osquery schema before running it
+func apiQueryLintHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPIQueriesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	var q DistributedQueryRequest
+	// Parse request JSON body
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		apiErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	// Platforms of the targeted nodes, to warn about tables not available on them
+	platforms := q.Platforms
+	matched, err := targetedNodes(q)
+	if err != nil {
+		apiErrorResponse(w, "error matching query targets", http.StatusBadRequest, err)
+		incMetric(metricAPIQueriesErr)
+		return
+	}
+	for _, n := range matched {
+		platforms = append(platforms, n.Platform)
+	}
+	lint := queries.Lint(q.Query, osquerySchema, removeStringDuplicates(platforms))
+	// Serialize and serve JSON
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Returned lint with %d errors and %d warnings", len(lint.Errors), len(lint.Warnings))
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, lint)
+	incMetric(metricAPIQueriesOK)
+}
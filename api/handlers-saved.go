@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jmpsec/osctrl/queries"
+	"github.com/jmpsec/osctrl/settings"
+	"github.com/jmpsec/osctrl/users"
+	"github.com/jmpsec/osctrl/utils"
+)
+
+const (
+	metricAPISavedReq = "saved-req"
+	metricAPISavedErr = "saved-err"
+	metricAPISavedOK  = "saved-ok"
+)
+
+// GET Handler to return all saved queries that the user can access in JSON
+func apiSavedQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPISavedReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPISavedErr)
+		return
+	}
+	saved, err := queriesmgr.GetAllSaved(ctx[ctxUser], apiUsers.IsAdmin(ctx[ctxUser]))
+	if err != nil {
+		apiErrorResponse(w, "error getting saved queries", http.StatusInternalServerError, err)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	// Serialize and serve JSON
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Println("DebugService: Returned saved queries")
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, saved)
+	incMetric(metricAPISavedOK)
+}
+
+// GET Handler to return one saved query with its parameters and version history in JSON
+func apiSavedQueryHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPISavedReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPISavedErr)
+		return
+	}
+	saved, err := queriesmgr.GetSaved(name)
+	if err != nil || !queries.CanAccessSaved(saved, ctx[ctxUser], apiUsers.IsAdmin(ctx[ctxUser])) {
+		apiErrorResponse(w, "saved query not found", http.StatusNotFound, err)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	params, err := queriesmgr.GetSavedParameters(name)
+	if err != nil {
+		apiErrorResponse(w, "error getting saved query parameters", http.StatusInternalServerError, err)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	versions, err := queriesmgr.GetSavedVersions(name)
+	if err != nil {
+		apiErrorResponse(w, "error getting saved query versions", http.StatusInternalServerError, err)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	// Serialize and serve JSON
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Returned saved query %s", name)
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, ApiSavedQueryResponse{Saved: saved, Parameters: params, Versions: versions})
+	incMetric(metricAPISavedOK)
+}
+
+// POST Handler to create or update a saved query, keeping the previous version in the history
+func apiSavedQuerySaveHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPISavedReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPISavedErr)
+		return
+	}
+	if !canEditSaved(name, ctx[ctxUser]) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to change saved query %s by user %s", name, ctx[ctxUser]))
+		incMetric(metricAPISavedErr)
+		return
+	}
+	var s ApiSavedQueryRequest
+	// Parse request JSON body
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		apiErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	saved := queries.SavedQuery{
+		Name:        name,
+		Description: s.Description,
+		Query:       s.Query,
+		Tags:        strings.Join(s.Tags, ","),
+		Owner:       ctx[ctxUser],
+		Shared:      s.Shared,
+	}
+	if err := queriesmgr.SaveQuery(saved, s.Parameters, ctx[ctxUser]); err != nil {
+		apiErrorResponse(w, "error saving query: "+err.Error(), http.StatusBadRequest, nil)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	// Return saved query name as serialized response
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Saved query %s", name)
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, ApiSavedResponse{Name: name})
+	incMetric(metricAPISavedOK)
+}
+
+// POST Handler to delete a saved query and its history
+func apiSavedQueryDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPISavedReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) || !canEditSaved(name, ctx[ctxUser]) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to delete saved query %s by user %s", name, ctx[ctxUser]))
+		incMetric(metricAPISavedErr)
+		return
+	}
+	if err := queriesmgr.DeleteSaved(name); err != nil {
+		apiErrorResponse(w, "error deleting saved query", http.StatusInternalServerError, err)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	// Return saved query name as serialized response
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, ApiSavedResponse{Name: name})
+	incMetric(metricAPISavedOK)
+}
+
+// POST Handler to restore an old version of a saved query
+func apiSavedQueryRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPISavedReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) || !canEditSaved(name, ctx[ctxUser]) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to restore saved query %s by user %s", name, ctx[ctxUser]))
+		incMetric(metricAPISavedErr)
+		return
+	}
+	var s ApiSavedRestoreRequest
+	// Parse request JSON body
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		apiErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	if err := queriesmgr.RestoreSaved(name, s.Version, ctx[ctxUser]); err != nil {
+		apiErrorResponse(w, "error restoring saved query", http.StatusInternalServerError, err)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	// Return saved query name as serialized response
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, ApiSavedResponse{Name: name})
+	incMetric(metricAPISavedOK)
+}
+
+// POST Handler to import the queries of a pack in the osquery pack JSON format as saved queries
+func apiSavedQueriesImportHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPISavedReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract pack name
+	pack, ok := vars["pack"]
+	if !ok {
+		apiErrorResponse(w, "error getting pack", http.StatusInternalServerError, nil)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPISavedErr)
+		return
+	}
+	var s ApiSavedImportRequest
+	// Parse request JSON body
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		apiErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	// Replacing is limited to administrators, saved queries may belong to other users
+	if s.Replace && !apiUsers.IsAdmin(ctx[ctxUser]) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to replace saved queries by user %s", ctx[ctxUser]))
+		incMetric(metricAPISavedErr)
+		return
+	}
+	imported, err := queriesmgr.ImportPack(pack, s.Pack, ctx[ctxUser], s.Shared, s.Replace)
+	if err != nil {
+		apiErrorResponse(w, "error importing pack: "+err.Error(), http.StatusBadRequest, nil)
+		incMetric(metricAPISavedErr)
+		return
+	}
+	// Serialize and serve JSON
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Imported %d saved queries from %s", len(imported), pack)
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, ApiSavedImportResponse{Imported: imported})
+	incMetric(metricAPISavedOK)
+}
+
+// Helper to check if a user can change a saved query, new saved queries can be created by anyone
+func canEditSaved(name, username string) bool {
+	saved, err := queriesmgr.GetSaved(name)
+	if err != nil {
+		return !queriesmgr.ExistsSaved(name)
+	}
+	return queries.CanEditSaved(saved, username, apiUsers.IsAdmin(username))
+}
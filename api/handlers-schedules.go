@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jmpsec/osctrl/queries"
+	"github.com/jmpsec/osctrl/settings"
+	"github.com/jmpsec/osctrl/users"
+	"github.com/jmpsec/osctrl/utils"
+)
+
+const (
+	metricAPISchedulesReq = "schedules-req"
+	metricAPISchedulesErr = "schedules-err"
+	metricAPISchedulesOK  = "schedules-ok"
+)
+
+// GET Handler to return all scheduled queries in JSON
+func apiSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPISchedulesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	schedules, err := queriesmgr.GetSchedules()
+	if err != nil {
+		apiErrorResponse(w, "error getting schedules", http.StatusInternalServerError, err)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	// Serialize and serve JSON
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Println("DebugService: Returned schedules")
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, schedules)
+	incMetric(metricAPISchedulesOK)
+}
+
+// GET Handler to return one scheduled query with its targets and run history in JSON
+func apiScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPISchedulesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	schedule, err := queriesmgr.GetSchedule(name)
+	if err != nil {
+		apiErrorResponse(w, "schedule not found", http.StatusNotFound, err)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	targets, err := queriesmgr.GetScheduleTargets(name)
+	if err != nil {
+		apiErrorResponse(w, "error getting schedule targets", http.StatusInternalServerError, err)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	runs, err := queriesmgr.GetRuns(name)
+	if err != nil {
+		apiErrorResponse(w, "error getting schedule runs", http.StatusInternalServerError, err)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	// Serialize and serve JSON
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Returned schedule %s", name)
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, ApiScheduleResponse{Schedule: schedule, Targets: targets, Runs: runs})
+	incMetric(metricAPISchedulesOK)
+}
+
+// POST Handler to create a scheduled query
+func apiScheduleCreateHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPISchedulesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	var s ApiScheduleRequest
+	// Parse request JSON body
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		apiErrorResponse(w, "error parsing POST body", http.StatusInternalServerError, err)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	if s.Query == "" {
+		apiErrorResponse(w, "query can not be empty", http.StatusInternalServerError, nil)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	if lint := queries.Lint(s.Query, osquerySchema, s.Platforms); !lint.Valid {
+		apiErrorResponse(w, "invalid query: "+strings.Join(lint.Errors, ", "), http.StatusBadRequest, nil)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	extraTargets, err := matchTargets(s.Tags, s.Hostnames, s.CIDRs, s.OsqueryVersion, s.PlatformVersion, s.TargetExpression)
+	if err != nil {
+		apiErrorResponse(w, "invalid schedule targets", http.StatusBadRequest, err)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	if _, err := queriesmgr.GetSchedule(name); err == nil {
+		apiErrorResponse(w, "schedule already exists", http.StatusInternalServerError, nil)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	newSchedule := queries.ScheduledQuery{
+		Name:            name,
+		Creator:         ctx[ctxUser],
+		Query:           s.Query,
+		Schedule:        s.Schedule,
+		ExpirationHours: s.ExpirationHours,
+	}
+	if err := queriesmgr.CreateSchedule(newSchedule); err != nil {
+		apiErrorResponse(w, "error creating schedule", http.StatusInternalServerError, err)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	// Targets are resolved to nodes on every run
+	var targets []queries.ScheduledQueryTarget
+	for _, e := range s.Environments {
+		if (e != "") && envs.Exists(e) {
+			targets = append(targets, queries.ScheduledQueryTarget{Type: queries.QueryTargetEnvironment, Value: e})
+		}
+	}
+	for _, p := range s.Platforms {
+		if p != "" {
+			targets = append(targets, queries.ScheduledQueryTarget{Type: queries.QueryTargetPlatform, Value: p})
+		}
+	}
+	for _, u := range s.UUIDs {
+		if (u != "") && nodesmgr.CheckByUUID(u) {
+			targets = append(targets, queries.ScheduledQueryTarget{Type: queries.QueryTargetUUID, Value: u})
+		}
+	}
+	for _, h := range s.Hosts {
+		if (h != "") && nodesmgr.CheckByHost(h) {
+			targets = append(targets, queries.ScheduledQueryTarget{Type: queries.QueryTargetLocalname, Value: h})
+		}
+	}
+	for _, t := range extraTargets {
+		targets = append(targets, queries.ScheduledQueryTarget{Type: t.Type, Value: t.Value})
+	}
+	for _, t := range targets {
+		if err := queriesmgr.CreateScheduleTarget(name, t.Type, t.Value); err != nil {
+			apiErrorResponse(w, "error creating schedule target", http.StatusInternalServerError, err)
+			incMetric(metricAPISchedulesErr)
+			return
+		}
+	}
+	// Return schedule name as serialized response
+	if settingsmgr.DebugService(settings.ServiceAPI) {
+		log.Printf("DebugService: Created schedule %s", name)
+	}
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, ApiSchedulesResponse{Name: name})
+	incMetric(metricAPISchedulesOK)
+}
+
+// POST Handler to pause, resume or delete a scheduled query
+func apiScheduleActionHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAPISchedulesReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAPI), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		apiErrorResponse(w, "error getting name", http.StatusInternalServerError, nil)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	// Get context data and check access
+	ctx := r.Context().Value(contextKey(contextAPI)).(contextValue)
+	if !apiUsers.CheckPermissions(ctx[ctxUser], users.QueryLevel, users.NoEnvironment) {
+		apiErrorResponse(w, "no access", http.StatusForbidden, fmt.Errorf("attempt to use API by user %s", ctx[ctxUser]))
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	var err error
+	switch vars["action"] {
+	case "pause":
+		err = queriesmgr.PauseSchedule(name)
+	case "resume":
+		err = queriesmgr.ResumeSchedule(name)
+	case "delete":
+		err = queriesmgr.DeleteSchedule(name)
+	default:
+		apiErrorResponse(w, "invalid action", http.StatusBadRequest, nil)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	if err != nil {
+		apiErrorResponse(w, "error with schedule action", http.StatusInternalServerError, err)
+		incMetric(metricAPISchedulesErr)
+		return
+	}
+	// Return schedule name as serialized response
+	utils.HTTPResponse(w, utils.JSONApplicationUTF8, http.StatusOK, ApiSchedulesResponse{Name: name})
+	incMetric(metricAPISchedulesOK)
+}
@@ -9,9 +9,11 @@ import (
 
 	"github.com/jmpsec/osctrl/backend"
 	"github.com/jmpsec/osctrl/carves"
+	"github.com/jmpsec/osctrl/configs"
 	"github.com/jmpsec/osctrl/environments"
 	"github.com/jmpsec/osctrl/metrics"
 	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/packs"
 	"github.com/jmpsec/osctrl/queries"
 	"github.com/jmpsec/osctrl/settings"
 	"github.com/jmpsec/osctrl/tags"
@@ -61,6 +63,8 @@ const (
 	apiQueriesPath string = "/queries"
 	// API all queries path
 	apiAllQueriesPath string = "/all-queries"
+	// API scheduled queries path
+	apiSchedulesPath string = "/schedules"
 	// API carves path
 	apiCarvesPath string = "/carves"
 	// API platforms path
@@ -69,6 +73,14 @@ const (
 	apiEnvironmentsPath string = "/environments"
 	// API tags path
 	apiTagsPath string = "/tags"
+	// API packs path
+	apiPacksPath string = "/packs"
+	// API saved queries path
+	apiSavedPath string = "/saved-queries"
+	// API analysis path
+	apiAnalysisPath string = "/analysis"
+	// API approvals path
+	apiApprovalsPath string = "/approvals"
 )
 
 var (
@@ -90,7 +102,13 @@ var (
 	nodesmgr    *nodes.NodeManager
 	queriesmgr  *queries.Queries
 	filecarves  *carves.Carves
-	_metrics    *metrics.Metrics
+	packsmgr    *packs.Packs
+	configsmgr  *configs.Configs
+	// Names of osquery tables to validate configurations
+	osqueryTables []string
+	// Schema of osquery tables to check queries
+	osquerySchema []queries.TableSchema
+	_metrics      *metrics.Metrics
 )
 
 // Variables for flags
@@ -99,6 +117,7 @@ var (
 	configFlag  *string
 	dbFlag      *string
 	jwtFlag     *string
+	tablesFlag  *string
 )
 
 // Valid values for auth and logging in configuration
@@ -148,6 +167,7 @@ func init() {
 	configFlag = flag.String("c", configurationFile, "Service configuration JSON file to use.")
 	dbFlag = flag.String("D", dbConfigurationFile, "DB configuration JSON file to use.")
 	jwtFlag = flag.String("J", jwtConfigurationFile, "JWT configuration JSON file to use.")
+	tablesFlag = flag.String("T", "", "JSON file with osquery tables to validate configurations and queries.")
 	// Parse all flags
 	flag.Parse()
 	if *versionFlag {
@@ -160,6 +180,17 @@ func init() {
 	if err != nil {
 		log.Fatalf("Error loading %s - %s", *configFlag, err)
 	}
+	// Load osquery tables to validate configurations and check queries, if provided
+	if *tablesFlag != "" {
+		osqueryTables, err = configs.LoadTables(*tablesFlag)
+		if err != nil {
+			log.Fatalf("Error loading %s - %s", *tablesFlag, err)
+		}
+		osquerySchema, err = queries.LoadSchema(*tablesFlag)
+		if err != nil {
+			log.Fatalf("Error loading %s - %s", *tablesFlag, err)
+		}
+	}
 	// Load JWT configuration
 	// Load configuration for JWT if enabled
 	if apiConfig.Auth == settings.AuthJWT {
@@ -209,9 +240,13 @@ func main() {
 	// Initialize nodes
 	nodesmgr = nodes.CreateNodes(db)
 	// Initialize queries
-	queriesmgr = queries.CreateQueries(db)
+	queriesmgr = queries.CreateQueries(db, tagsmgr)
 	// Initialize carves
 	filecarves = carves.CreateFileCarves(db)
+	// Initialize packs
+	packsmgr = packs.CreatePacks(db)
+	// Initialize configurations
+	configsmgr = configs.CreateConfigs(db, envs, nodesmgr, packsmgr, tagsmgr)
 	// Initialize service settings
 	log.Println("Loading service settings")
 	loadingSettings()
@@ -278,23 +313,103 @@ func main() {
 	routerAPI.Handle(_apiPath(apiQueriesPath)+"/", handlerAuthCheck(http.HandlerFunc(apiHiddenQueriesShowHandler))).Methods("GET")
 	routerAPI.Handle(_apiPath(apiQueriesPath), handlerAuthCheck(http.HandlerFunc(apiQueriesRunHandler))).Methods("POST")
 	routerAPI.Handle(_apiPath(apiQueriesPath)+"/", handlerAuthCheck(http.HandlerFunc(apiQueriesRunHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/lint", handlerAuthCheck(http.HandlerFunc(apiQueryLintHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/lint/", handlerAuthCheck(http.HandlerFunc(apiQueryLintHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/preview", handlerAuthCheck(http.HandlerFunc(apiQueryPreviewHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/preview/", handlerAuthCheck(http.HandlerFunc(apiQueryPreviewHandler))).Methods("POST")
 	routerAPI.Handle(_apiPath(apiQueriesPath)+"/{name}", handlerAuthCheck(http.HandlerFunc(apiQueryShowHandler))).Methods("GET")
 	routerAPI.Handle(_apiPath(apiQueriesPath)+"/{name}/", handlerAuthCheck(http.HandlerFunc(apiQueryShowHandler))).Methods("GET")
 	routerAPI.Handle(_apiPath(apiQueriesPath)+"/results/{name}", handlerAuthCheck(http.HandlerFunc(apiQueryResultsHandler))).Methods("GET")
 	routerAPI.Handle(_apiPath(apiQueriesPath)+"/results/{name}/", handlerAuthCheck(http.HandlerFunc(apiQueryResultsHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/export/{name}/{format}", handlerAuthCheck(http.HandlerFunc(apiQueryExportHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/export/{name}/{format}/", handlerAuthCheck(http.HandlerFunc(apiQueryExportHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/stream/{name}", handlerAuthCheck(http.HandlerFunc(apiQueryStreamHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/stream/{name}/", handlerAuthCheck(http.HandlerFunc(apiQueryStreamHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/aggregate/{name}", handlerAuthCheck(http.HandlerFunc(apiQueryAggregateHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/aggregate/{name}/", handlerAuthCheck(http.HandlerFunc(apiQueryAggregateHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/diff/{base}/{target}", handlerAuthCheck(http.HandlerFunc(apiQueryDiffHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/diff/{base}/{target}/", handlerAuthCheck(http.HandlerFunc(apiQueryDiffHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/diff-nodes/{name}/{base}/{target}", handlerAuthCheck(http.HandlerFunc(apiQueryDiffNodesHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/diff-nodes/{name}/{base}/{target}/", handlerAuthCheck(http.HandlerFunc(apiQueryDiffNodesHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/noanswer/{name}", handlerAuthCheck(http.HandlerFunc(apiQueryNoAnswersHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/noanswer/{name}/", handlerAuthCheck(http.HandlerFunc(apiQueryNoAnswersHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/status/{name}", handlerAuthCheck(http.HandlerFunc(apiQueryStatusHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/status/{name}/", handlerAuthCheck(http.HandlerFunc(apiQueryStatusHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/stats/{name}", handlerAuthCheck(http.HandlerFunc(apiQueryStatsHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiQueriesPath)+"/stats/{name}/", handlerAuthCheck(http.HandlerFunc(apiQueryStatsHandler))).Methods("GET")
 	routerAPI.Handle(_apiPath(apiAllQueriesPath), handlerAuthCheck(http.HandlerFunc(apiAllQueriesShowHandler))).Methods("GET")
 	routerAPI.Handle(_apiPath(apiAllQueriesPath)+"/", handlerAuthCheck(http.HandlerFunc(apiAllQueriesShowHandler))).Methods("GET")
+	// API: scheduled queries
+	routerAPI.Handle(_apiPath(apiSchedulesPath), handlerAuthCheck(http.HandlerFunc(apiSchedulesHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiSchedulesPath)+"/", handlerAuthCheck(http.HandlerFunc(apiSchedulesHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiSchedulesPath)+"/{name}", handlerAuthCheck(http.HandlerFunc(apiScheduleHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiSchedulesPath)+"/{name}/", handlerAuthCheck(http.HandlerFunc(apiScheduleHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiSchedulesPath)+"/{name}", handlerAuthCheck(http.HandlerFunc(apiScheduleCreateHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiSchedulesPath)+"/{name}/", handlerAuthCheck(http.HandlerFunc(apiScheduleCreateHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiSchedulesPath)+"/{name}/{action}", handlerAuthCheck(http.HandlerFunc(apiScheduleActionHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiSchedulesPath)+"/{name}/{action}/", handlerAuthCheck(http.HandlerFunc(apiScheduleActionHandler))).Methods("POST")
+	// API: carves
+	routerAPI.Handle(_apiPath(apiCarvesPath), handlerAuthCheck(http.HandlerFunc(apiCarvesRunHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiCarvesPath)+"/", handlerAuthCheck(http.HandlerFunc(apiCarvesRunHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiCarvesPath)+"/quotas", handlerAuthCheck(http.HandlerFunc(apiCarveQuotasHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiCarvesPath)+"/quotas/", handlerAuthCheck(http.HandlerFunc(apiCarveQuotasHandler))).Methods("GET")
+	// API: approvals
+	routerAPI.Handle(_apiPath(apiApprovalsPath), handlerAuthCheck(http.HandlerFunc(apiApprovalsHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiApprovalsPath)+"/", handlerAuthCheck(http.HandlerFunc(apiApprovalsHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiApprovalsPath)+"/{name}", handlerAuthCheck(http.HandlerFunc(apiApprovalHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiApprovalsPath)+"/{name}/", handlerAuthCheck(http.HandlerFunc(apiApprovalHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiApprovalsPath)+"/{name}/{action}", handlerAuthCheck(http.HandlerFunc(apiApprovalActionHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiApprovalsPath)+"/{name}/{action}/", handlerAuthCheck(http.HandlerFunc(apiApprovalActionHandler))).Methods("POST")
 	// API: platforms
 	routerAPI.Handle(_apiPath(apiPlatformsPath), handlerAuthCheck(http.HandlerFunc(apiPlatformsHandler))).Methods("GET")
 	routerAPI.Handle(_apiPath(apiPlatformsPath)+"/", handlerAuthCheck(http.HandlerFunc(apiPlatformsHandler))).Methods("GET")
 	// API: environments
 	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/{environment}", handlerAuthCheck(http.HandlerFunc(apiEnvironmentHandler))).Methods("GET")
 	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/{environment}/", handlerAuthCheck(http.HandlerFunc(apiEnvironmentHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/{environment}/validate", handlerAuthCheck(http.HandlerFunc(apiConfigValidateHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/{environment}/validate/", handlerAuthCheck(http.HandlerFunc(apiConfigValidateHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/{environment}/history", handlerAuthCheck(http.HandlerFunc(apiConfigHistoryHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/{environment}/history/", handlerAuthCheck(http.HandlerFunc(apiConfigHistoryHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/{environment}/history/{version}", handlerAuthCheck(http.HandlerFunc(apiConfigVersionHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/{environment}/history/{version}/", handlerAuthCheck(http.HandlerFunc(apiConfigVersionHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/{environment}/diff", handlerAuthCheck(http.HandlerFunc(apiConfigDiffHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/{environment}/diff/", handlerAuthCheck(http.HandlerFunc(apiConfigDiffHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/{environment}/flags/{platform}", handlerAuthCheck(http.HandlerFunc(apiEnvironmentFlagsHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/{environment}/flags/{platform}/", handlerAuthCheck(http.HandlerFunc(apiEnvironmentFlagsHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/{environment}/drift", handlerAuthCheck(http.HandlerFunc(apiConfigDriftHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/{environment}/drift/", handlerAuthCheck(http.HandlerFunc(apiConfigDriftHandler))).Methods("GET")
 	routerAPI.Handle(_apiPath(apiEnvironmentsPath), handlerAuthCheck(http.HandlerFunc(apiEnvironmentsHandler))).Methods("GET")
 	routerAPI.Handle(_apiPath(apiEnvironmentsPath)+"/", handlerAuthCheck(http.HandlerFunc(apiEnvironmentsHandler))).Methods("GET")
 	// API: tags
 	routerAPI.Handle(_apiPath(apiTagsPath), handlerAuthCheck(http.HandlerFunc(apiTagsHandler))).Methods("GET")
 	routerAPI.Handle(_apiPath(apiTagsPath)+"/", handlerAuthCheck(http.HandlerFunc(apiTagsHandler))).Methods("GET")
+	// API: packs
+	routerAPI.Handle(_apiPath(apiPacksPath), handlerAuthCheck(http.HandlerFunc(apiPacksHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiPacksPath)+"/", handlerAuthCheck(http.HandlerFunc(apiPacksHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiPacksPath)+"/{name}", handlerAuthCheck(http.HandlerFunc(apiPackHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiPacksPath)+"/{name}/", handlerAuthCheck(http.HandlerFunc(apiPackHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiPacksPath)+"/{name}", handlerAuthCheck(http.HandlerFunc(apiPackImportHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiPacksPath)+"/{name}/", handlerAuthCheck(http.HandlerFunc(apiPackImportHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiPacksPath)+"/{name}/delete", handlerAuthCheck(http.HandlerFunc(apiPackDeleteHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiPacksPath)+"/{name}/delete/", handlerAuthCheck(http.HandlerFunc(apiPackDeleteHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiPacksPath)+"/{name}/targets", handlerAuthCheck(http.HandlerFunc(apiPackTargetsHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiPacksPath)+"/{name}/targets/", handlerAuthCheck(http.HandlerFunc(apiPackTargetsHandler))).Methods("POST")
+	// API: saved queries
+	routerAPI.Handle(_apiPath(apiSavedPath), handlerAuthCheck(http.HandlerFunc(apiSavedQueriesHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiSavedPath)+"/", handlerAuthCheck(http.HandlerFunc(apiSavedQueriesHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiSavedPath)+"/import/{pack}", handlerAuthCheck(http.HandlerFunc(apiSavedQueriesImportHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiSavedPath)+"/import/{pack}/", handlerAuthCheck(http.HandlerFunc(apiSavedQueriesImportHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiSavedPath)+"/{name}", handlerAuthCheck(http.HandlerFunc(apiSavedQueryHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiSavedPath)+"/{name}/", handlerAuthCheck(http.HandlerFunc(apiSavedQueryHandler))).Methods("GET")
+	routerAPI.Handle(_apiPath(apiSavedPath)+"/{name}", handlerAuthCheck(http.HandlerFunc(apiSavedQuerySaveHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiSavedPath)+"/{name}/", handlerAuthCheck(http.HandlerFunc(apiSavedQuerySaveHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiSavedPath)+"/{name}/delete", handlerAuthCheck(http.HandlerFunc(apiSavedQueryDeleteHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiSavedPath)+"/{name}/delete/", handlerAuthCheck(http.HandlerFunc(apiSavedQueryDeleteHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiSavedPath)+"/{name}/restore", handlerAuthCheck(http.HandlerFunc(apiSavedQueryRestoreHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiSavedPath)+"/{name}/restore/", handlerAuthCheck(http.HandlerFunc(apiSavedQueryRestoreHandler))).Methods("POST")
+	// API: analysis
+	routerAPI.Handle(_apiPath(apiAnalysisPath), handlerAuthCheck(http.HandlerFunc(apiAnalysisHandler))).Methods("POST")
+	routerAPI.Handle(_apiPath(apiAnalysisPath)+"/", handlerAuthCheck(http.HandlerFunc(apiAnalysisHandler))).Methods("POST")
 
 	// Launch HTTP server for TLS endpoint
 	serviceListener := apiConfig.Listener + ":" + apiConfig.Port
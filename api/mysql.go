@@ -2,10 +2,23 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/logging"
 )
 
+const (
+	// Maximum number of stored results to return for a query without pagination
+	maxQueryLogs = 1000
+	// Maximum number of stored results to return in one page
+	maxQueryLogsPage = 1000
+)
+
+// Error returned when a query has too many results stored to return them without pagination
+var errTooManyQueryLogs = errors.New("too many results, use page and size")
+
 // OsqueryQueryData to log query data to database
 type OsqueryQueryData struct {
 	gorm.Model
@@ -19,15 +32,63 @@ type OsqueryQueryData struct {
 // APIQueryData to return query results from API
 type APIQueryData map[string]json.RawMessage
 
-// Function to retrieve the query log by name
+// APIQueryResult to return one stored result of a query from API
+type APIQueryResult struct {
+	ID      uint            `json:"id"`
+	UUID    string          `json:"uuid"`
+	Created time.Time       `json:"created"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// APIQueryResultsPage to return one page of query results from API
+type APIQueryResultsPage struct {
+	Page    int              `json:"page"`
+	Size    int              `json:"size"`
+	Total   int              `json:"total"`
+	Results []APIQueryResult `json:"results"`
+}
+
+// Function to retrieve the query log by name, with the chunks of each node put together
 func mysqlQueryLogs(name string) (APIQueryData, error) {
 	var logs []OsqueryQueryData
 	data := make(APIQueryData)
-	if err := db.Where("name = ?", name).Find(&logs).Error; err != nil {
+	var total int
+	if err := db.Model(&OsqueryQueryData{}).Where("name = ?", name).Count(&total).Error; err != nil {
+		return data, err
+	}
+	if total > maxQueryLogs {
+		return data, errTooManyQueryLogs
+	}
+	if err := db.Where("name = ?", name).Order("id asc").Find(&logs).Error; err != nil {
 		return data, err
 	}
+	chunks := make(map[string][]json.RawMessage)
 	for _, l := range logs {
-		data[l.UUID] = l.Data
+		chunks[l.UUID] = append(chunks[l.UUID], l.Data)
+	}
+	for uuid, c := range chunks {
+		data[uuid] = logging.MergeChunks(c)
 	}
 	return data, nil
 }
+
+// Function to retrieve one page of the query log by name, pages start at 1
+func mysqlQueryLogsPage(name string, page, size int) (APIQueryResultsPage, error) {
+	var logs []OsqueryQueryData
+	result := APIQueryResultsPage{Page: page, Size: size, Results: []APIQueryResult{}}
+	if err := db.Model(&OsqueryQueryData{}).Where("name = ?", name).Count(&result.Total).Error; err != nil {
+		return result, err
+	}
+	if err := db.Where("name = ?", name).Order("id asc").Offset((page - 1) * size).Limit(size).Find(&logs).Error; err != nil {
+		return result, err
+	}
+	for _, l := range logs {
+		result.Results = append(result.Results, APIQueryResult{
+			ID:      l.ID,
+			UUID:    l.UUID,
+			Created: l.CreatedAt,
+			Data:    l.Data,
+		})
+	}
+	return result, nil
+}
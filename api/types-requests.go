@@ -1,12 +1,57 @@
 package main
 
+import (
+	"encoding/json"
+
+	"github.com/jmpsec/osctrl/queries"
+)
+
 // DistributedQueryRequest to receive query requests
 type DistributedQueryRequest struct {
-	Environments []string `json:"environment_list"`
-	Platforms    []string `json:"platform_list"`
-	UUIDs        []string `json:"uuid_list"`
-	Hosts        []string `json:"host_list"`
-	Query        string   `json:"query"`
+	Environments     []string          `json:"environment_list"`
+	Platforms        []string          `json:"platform_list"`
+	UUIDs            []string          `json:"uuid_list"`
+	Hosts            []string          `json:"host_list"`
+	Tags             []string          `json:"tag_list"`
+	Hostnames        []string          `json:"hostname_list"`
+	CIDRs            []string          `json:"cidr_list"`
+	OsqueryVersion   string            `json:"osquery_version"`
+	PlatformVersion  string            `json:"platform_version"`
+	TargetExpression string            `json:"target_expression"`
+	Query            string            `json:"query"`
+	Discovery        string            `json:"discovery"`
+	SavedQuery       string            `json:"saved_query"`
+	Parameters       map[string]string `json:"parameters"`
+	ExpirationHours  int64             `json:"expiration_hours"`
+	MaxRows          int               `json:"max_rows"`
+	MaxBytes         int               `json:"max_bytes"`
+}
+
+// ApiScheduleRequest to receive scheduled query requests
+type ApiScheduleRequest struct {
+	Environments     []string `json:"environment_list"`
+	Platforms        []string `json:"platform_list"`
+	UUIDs            []string `json:"uuid_list"`
+	Hosts            []string `json:"host_list"`
+	Tags             []string `json:"tag_list"`
+	Hostnames        []string `json:"hostname_list"`
+	CIDRs            []string `json:"cidr_list"`
+	OsqueryVersion   string   `json:"osquery_version"`
+	PlatformVersion  string   `json:"platform_version"`
+	TargetExpression string   `json:"target_expression"`
+	Query            string   `json:"query"`
+	Schedule         string   `json:"schedule"`
+	ExpirationHours  int64    `json:"expiration_hours"`
+}
+
+// DistributedCarveRequest to receive carve requests
+type DistributedCarveRequest struct {
+	Environments    []string `json:"environment_list"`
+	Platforms       []string `json:"platform_list"`
+	UUIDs           []string `json:"uuid_list"`
+	Hosts           []string `json:"host_list"`
+	Path            string   `json:"path"`
+	ExpirationHours int64    `json:"expiration_hours"`
 }
 
 // ApiErrorResponse to be returned to API requests with the error message
@@ -16,5 +61,122 @@ type ApiErrorResponse struct {
 
 // ApiQueriesResponse to be returned to API requests for queries
 type ApiQueriesResponse struct {
-	Name string `json:"query_name"`
+	Name     string `json:"query_name"`
+	Approval string `json:"approval,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ApiQueryStatusResponse to be returned with the delivery status of a query for each node
+type ApiQueryStatusResponse struct {
+	Counts map[string]int                   `json:"counts"`
+	Nodes  []queries.DistributedQueryStatus `json:"nodes"`
+}
+
+// ApiQueryStatsResponse to be returned with the execution stats of a query, aggregated and per node
+type ApiQueryStatsResponse struct {
+	Summary queries.ExecutionSummary            `json:"summary"`
+	Nodes   []queries.DistributedQueryExecution `json:"nodes"`
+}
+
+// ApiQueryPreviewResponse to be returned with the nodes targeted by a query before running it
+type ApiQueryPreviewResponse struct {
+	Count int                   `json:"count"`
+	Nodes []ApiQueryPreviewNode `json:"nodes"`
+}
+
+// ApiQueryPreviewNode to be returned with the preview of a query
+type ApiQueryPreviewNode struct {
+	UUID        string `json:"uuid"`
+	Hostname    string `json:"hostname"`
+	Platform    string `json:"platform"`
+	Environment string `json:"environment"`
+}
+
+// ApiSchedulesResponse to be returned to API requests for scheduled queries
+type ApiSchedulesResponse struct {
+	Name string `json:"schedule_name"`
+}
+
+// ApiScheduleResponse to be returned with a scheduled query, its targets and runs
+type ApiScheduleResponse struct {
+	Schedule queries.ScheduledQuery         `json:"schedule"`
+	Targets  []queries.ScheduledQueryTarget `json:"targets"`
+	Runs     []queries.DistributedQuery     `json:"runs"`
+}
+
+// ApiCarvesResponse to be returned to API requests for carves
+type ApiCarvesResponse struct {
+	Name     string   `json:"carve_name"`
+	Expected int      `json:"expected"`
+	Warnings []string `json:"warnings,omitempty"`
+	Approval string   `json:"approval,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// ApiApprovalRequest to receive the comment to approve or reject a query or carve
+type ApiApprovalRequest struct {
+	Comment string `json:"comment"`
+}
+
+// ApiApprovalResponse to be returned with a query or carve and its approval history
+type ApiApprovalResponse struct {
+	Query     queries.DistributedQuery           `json:"query"`
+	Approvals []queries.DistributedQueryApproval `json:"approvals"`
+}
+
+// ApiPackRequest to receive packs in the osquery pack JSON format
+type ApiPackRequest struct {
+	Description string          `json:"description"`
+	Replace     bool            `json:"replace"`
+	Pack        json.RawMessage `json:"pack"`
+}
+
+// ApiPackTargetRequest to receive pack target assignments
+type ApiPackTargetRequest struct {
+	Action string `json:"action"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+}
+
+// ApiPacksResponse to be returned to API requests for packs
+type ApiPacksResponse struct {
+	Name string `json:"pack_name"`
+}
+
+// ApiSavedQueryRequest to receive saved queries
+type ApiSavedQueryRequest struct {
+	Description string                        `json:"description"`
+	Query       string                        `json:"query"`
+	Tags        []string                      `json:"tags"`
+	Shared      bool                          `json:"shared"`
+	Parameters  []queries.SavedQueryParameter `json:"parameters"`
+}
+
+// ApiSavedRestoreRequest to receive the version of a saved query to restore
+type ApiSavedRestoreRequest struct {
+	Version int `json:"version"`
+}
+
+// ApiSavedImportRequest to receive packs in the osquery pack JSON format to import as saved queries
+type ApiSavedImportRequest struct {
+	Shared  bool            `json:"shared"`
+	Replace bool            `json:"replace"`
+	Pack    json.RawMessage `json:"pack"`
+}
+
+// ApiSavedResponse to be returned to API requests for saved queries
+type ApiSavedResponse struct {
+	Name string `json:"saved_name"`
+}
+
+// ApiSavedQueryResponse to be returned with a saved query, its parameters and versions
+type ApiSavedQueryResponse struct {
+	Saved      queries.SavedQuery            `json:"saved"`
+	Parameters []queries.SavedQueryParameter `json:"parameters"`
+	Versions   []queries.SavedQueryVersion   `json:"versions"`
+}
+
+// ApiSavedImportResponse to be returned with the names of the imported saved queries
+type ApiSavedImportResponse struct {
+	Imported []string `json:"imported"`
 }
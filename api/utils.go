@@ -9,8 +9,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/jmpsec/osctrl/environments"
+	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/queries"
 	"github.com/jmpsec/osctrl/settings"
 	"github.com/jmpsec/osctrl/utils"
 )
@@ -111,6 +115,96 @@ func generateCarveName() string {
 	return "carve_" + randomForNames()
 }
 
+// Helper to calculate the expiration of a new query, using the default from settings if hours are not set
+func queryExpiration(hours int64) time.Time {
+	return queries.ExpirationTime(queries.QueryExpirationHours(hours, settingsmgr.QueryExpiration()))
+}
+
+// Helper to get the last result received by a stream client, to resume after reconnecting
+func streamLastID(r *http.Request) uint {
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("last")
+	}
+	v, err := strconv.ParseUint(last, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint(v)
+}
+
+// Helper to prepare the approval policy for queries and carves from settings
+func approvalPolicy() queries.ApprovalPolicy {
+	return queries.NewApprovalPolicy(settingsmgr.ApprovalCarves(), settingsmgr.ApprovalNodes(), settingsmgr.ApprovalEnvironments())
+}
+
+// Helper to apply the approval policy to a new query, approvers are notified if it stays pending
+func checkApproval(name string, policy queries.ApprovalPolicy) (bool, string, error) {
+	if !policy.Enabled() {
+		return false, "", nil
+	}
+	pending, reason, err := queriesmgr.CheckApproval(name, policy, nodesmgr, settingsmgr.InactiveHours())
+	if err != nil || !pending {
+		return pending, reason, err
+	}
+	if url := settingsmgr.ApprovalWebhook(); url != "" {
+		query, err := queriesmgr.Get(name)
+		if err != nil {
+			return pending, reason, err
+		}
+		go func() {
+			if err := queries.NotifyApproval(url, query, reason); err != nil {
+				log.Printf("error notifying approval for %s - %v", name, err)
+			}
+		}()
+	}
+	return pending, reason, nil
+}
+
+// Helper to prepare targets matched against node attributes and expressions, only existing tags are used
+func matchTargets(tagList, hostnames, cidrs []string, osqueryVersion, platformVersion, expression string) ([]queries.DistributedQueryTarget, error) {
+	var existing []string
+	for _, t := range tagList {
+		if tagsmgr.Exists(t) {
+			existing = append(existing, t)
+		}
+	}
+	return queries.BuildTargets(existing, hostnames, cidrs, osqueryVersion, platformVersion, expression)
+}
+
+// Helper to get the active nodes targeted by a query request
+func targetedNodes(q DistributedQueryRequest) ([]nodes.OsqueryNode, error) {
+	targets, err := matchTargets(q.Tags, q.Hostnames, q.CIDRs, q.OsqueryVersion, q.PlatformVersion, q.TargetExpression)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range q.Environments {
+		if (e != "") && envs.Exists(e) {
+			targets = append(targets, queries.DistributedQueryTarget{Type: queries.QueryTargetEnvironment, Value: e})
+		}
+	}
+	for _, p := range q.Platforms {
+		if (p != "") && checkValidPlatform(p) {
+			targets = append(targets, queries.DistributedQueryTarget{Type: queries.QueryTargetPlatform, Value: p})
+		}
+	}
+	for _, u := range q.UUIDs {
+		if u != "" {
+			targets = append(targets, queries.DistributedQueryTarget{Type: queries.QueryTargetUUID, Value: u})
+		}
+	}
+	for _, h := range q.Hosts {
+		if h != "" {
+			targets = append(targets, queries.DistributedQueryTarget{Type: queries.QueryTargetLocalname, Value: h})
+		}
+	}
+	active, err := nodesmgr.Gets("active", settingsmgr.InactiveHours())
+	if err != nil {
+		return nil, err
+	}
+	return queriesmgr.MatchingNodes(targets, active)
+}
+
 // Helper to generate a random MD5 to be used with queries/carves
 func randomForNames() string {
 	b := make([]byte, 32)
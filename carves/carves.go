@@ -50,12 +50,15 @@ type CarvedFile struct {
 	SessionID       string
 	UUID            string `gorm:"index"`
 	Environment     string
+	Creator         string `gorm:"index"`
 	CarveSize       int
 	BlockSize       int
 	TotalBlocks     int
 	CompletedBlocks int
 	Status          string
 	CompletedAt     time.Time
+	KeyID           string
+	EncryptedKey    string
 }
 
 // CarvedBlock to store each block from a carve
@@ -77,7 +80,18 @@ type CarveResult struct {
 
 // Carves to handle file carves from nodes
 type Carves struct {
-	DB *gorm.DB
+	DB   *gorm.DB
+	Keys *KeyRing
+}
+
+// GenerateQuery to generate the query to carve a file, or files with a LIKE pattern when glob is set.
+// Quotes in the path are escaped, so the path is always one SQL string
+func GenerateQuery(path string, glob bool) string {
+	path = "'" + strings.ReplaceAll(path, "'", "''") + "'"
+	if glob {
+		return "SELECT * FROM carves WHERE carve=1 AND path LIKE " + path + ";"
+	}
+	return "SELECT * FROM carves WHERE carve=1 AND path = " + path + ";"
 }
 
 // CreateFileCarves to initialize the carves struct and tables
@@ -92,11 +106,28 @@ func CreateFileCarves(backend *gorm.DB) *Carves {
 	if err := backend.AutoMigrate(CarvedBlock{}).Error; err != nil {
 		log.Fatalf("Failed to AutoMigrate table (carved_blocks): %v", err)
 	}
+	// table carve_quotas
+	if err := backend.AutoMigrate(CarveQuota{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (carve_quotas): %v", err)
+	}
+	// table carve_audits
+	if err := backend.AutoMigrate(CarveAudit{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (carve_audits): %v", err)
+	}
 	return c
 }
 
 // CreateCarve to create a new carved file for a node
 func (c *Carves) CreateCarve(carve CarvedFile) error {
+	// Generate data key if carves are encrypted at rest
+	if c.Keys != nil {
+		_, wrapped, err := c.Keys.NewDataKey(carve.SessionID)
+		if err != nil {
+			return err
+		}
+		carve.KeyID = c.Keys.Active
+		carve.EncryptedKey = wrapped
+	}
 	if c.DB.NewRecord(carve) {
 		return c.DB.Create(&carve).Error // can be nil or err
 	}
@@ -112,8 +143,33 @@ func (c *Carves) CheckCarve(sessionid, requestid string) bool {
 	return (carve.RequestID == strings.TrimSpace(requestid))
 }
 
-// CreateBlock to create a new block for a carve
+// CreateBlock to create a new block for a carve, blocks must be within what the node announced
+// when the carve was initialized. The size of the block is the size of the decoded data
 func (c *Carves) CreateBlock(block CarvedBlock) error {
+	carve, err := c.GetBySession(block.SessionID)
+	if err != nil {
+		return fmt.Errorf("getCarveBySessionID %v", err)
+	}
+	if block.BlockID < 0 || block.BlockID >= carve.TotalBlocks {
+		return fmt.Errorf("block %d is out of the %d blocks of carve %s", block.BlockID, carve.TotalBlocks, block.SessionID)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(block.Data)
+	if err != nil {
+		return fmt.Errorf("DecodeString %v", err)
+	}
+	if len(decoded) > carve.BlockSize {
+		return fmt.Errorf("block %d of %d bytes is over the block size of %d", block.BlockID, len(decoded), carve.BlockSize)
+	}
+	block.Size = len(decoded)
+	if carve.Encrypted() {
+		dataKey, err := c.dataKey(carve)
+		if err != nil {
+			return err
+		}
+		if block.Data, err = EncryptBlock(dataKey, block.SessionID, block.BlockID, block.Data); err != nil {
+			return err
+		}
+	}
 	if c.DB.NewRecord(block) {
 		return c.DB.Create(&block).Error // can be nil or err
 	}
@@ -261,6 +317,14 @@ func (c *Carves) Archive(sessionid, path string) (*CarveResult, error) {
 		res.File += "/"
 	}
 	res.File += sessionid + ".tar"
+	// Encrypted carves are never written to disk in plain text
+	carve, err := c.GetBySession(sessionid)
+	if err != nil {
+		return res, fmt.Errorf("getCarveBySessionID %v", err)
+	}
+	if carve.Encrypted() {
+		return res, fmt.Errorf("carve %s is encrypted", sessionid)
+	}
 	// If file already exists, no need to re-generate it from blocks
 	_f, err := os.Stat(res.File)
 	if err == nil {
@@ -0,0 +1,13 @@
+package carves
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateQuery(t *testing.T) {
+	assert.Equal(t, "SELECT * FROM carves WHERE carve=1 AND path = '/etc/hosts';", GenerateQuery("/etc/hosts", false))
+	assert.Equal(t, "SELECT * FROM carves WHERE carve=1 AND path LIKE '/tmp/%';", GenerateQuery("/tmp/%", true))
+	assert.Equal(t, "SELECT * FROM carves WHERE carve=1 AND path = '/tmp/it''s'' OR ''1''=''1';", GenerateQuery("/tmp/it's' OR '1'='1", false))
+}
@@ -0,0 +1,356 @@
+package carves
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Envelope encryption for carved files: every carve gets a random data key
+// that encrypts all its blocks, and the data key is stored wrapped with a
+// master key. Master keys never touch the DB.
+
+const (
+	// EnvCarvesKeys to provide master keys using an environment variable
+	EnvCarvesKeys string = "OSCTRL_CARVES_KEYS"
+	// DataKeySize for the size of master and data keys (AES-256)
+	DataKeySize int = 32
+	// AuditDecrypt for audit entries of decrypted carves
+	AuditDecrypt string = "decrypt"
+	// AuditRewrap for audit entries of carves with the data key wrapped again
+	AuditRewrap string = "rewrap"
+	// AES-GCM adds the nonce and the tag to every encrypted block
+	gcmOverhead int64 = 12 + 16
+)
+
+// KeyRing to hold master keys by ID, the active key wraps new data keys
+type KeyRing struct {
+	Active string
+	Keys   map[string][]byte
+}
+
+// CarveAudit to keep track of every access to encrypted carves
+type CarveAudit struct {
+	gorm.Model
+	SessionID string `gorm:"index"`
+	CarveID   string
+	Username  string
+	Address   string
+	Action    string
+	KeyID     string
+}
+
+// ParseKeyRing to parse master keys in the format id:base64key, separated by
+// new lines or commas. The first key is the active key.
+func ParseKeyRing(raw string) (*KeyRing, error) {
+	ring := &KeyRing{Keys: make(map[string][]byte)}
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == '\n' || r == ','
+	})
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		if f == "" || strings.HasPrefix(f, "#") {
+			continue
+		}
+		parts := strings.SplitN(f, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid master key format, expected id:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("decoding master key %s - %v", parts[0], err)
+		}
+		if len(key) != DataKeySize {
+			return nil, fmt.Errorf("master key %s must be %d bytes", parts[0], DataKeySize)
+		}
+		if _, ok := ring.Keys[parts[0]]; ok {
+			return nil, fmt.Errorf("duplicated master key %s", parts[0])
+		}
+		ring.Keys[parts[0]] = key
+		if ring.Active == "" {
+			ring.Active = parts[0]
+		}
+	}
+	if ring.Active == "" {
+		return nil, fmt.Errorf("no master keys found")
+	}
+	return ring, nil
+}
+
+// LoadKeyRing to load master keys from a file or from the environment variable.
+// It returns nil without error if no keys are provided, meaning no encryption.
+func LoadKeyRing(file string) (*KeyRing, error) {
+	if file != "" {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s - %v", file, err)
+		}
+		return ParseKeyRing(string(content))
+	}
+	if raw := os.Getenv(EnvCarvesKeys); raw != "" {
+		return ParseKeyRing(raw)
+	}
+	return nil, nil
+}
+
+// Helper to encrypt using AES-GCM, the nonce is prepended to the ciphertext
+func sealGCM(key, plaintext, additional []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// Helper to decrypt using AES-GCM, the nonce is expected before the ciphertext
+func openGCM(key, ciphertext, additional []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce := ciphertext[:gcm.NonceSize()]
+	return gcm.Open(nil, nonce, ciphertext[gcm.NonceSize():], additional)
+}
+
+// NewDataKey to generate a random data key wrapped with the active master key
+func (k *KeyRing) NewDataKey(sessionid string) ([]byte, string, error) {
+	dataKey := make([]byte, DataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, "", fmt.Errorf("generating data key - %v", err)
+	}
+	wrapped, err := k.Wrap(dataKey, k.Active, sessionid)
+	if err != nil {
+		return nil, "", err
+	}
+	return dataKey, wrapped, nil
+}
+
+// Wrap to encrypt a data key with a master key, bound to the carve session
+func (k *KeyRing) Wrap(dataKey []byte, keyid, sessionid string) (string, error) {
+	master, ok := k.Keys[keyid]
+	if !ok {
+		return "", fmt.Errorf("unknown master key %s", keyid)
+	}
+	wrapped, err := sealGCM(master, dataKey, []byte(keyid+":"+sessionid))
+	if err != nil {
+		return "", fmt.Errorf("wrapping data key - %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+// Unwrap to decrypt a data key with a master key
+func (k *KeyRing) Unwrap(wrapped, keyid, sessionid string) ([]byte, error) {
+	master, ok := k.Keys[keyid]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %s", keyid)
+	}
+	raw, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("decoding data key - %v", err)
+	}
+	dataKey, err := openGCM(master, raw, []byte(keyid+":"+sessionid))
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key - %v", err)
+	}
+	return dataKey, nil
+}
+
+// Helper to generate the additional data for a block, so blocks can not be swapped
+func blockAdditional(sessionid string, blockid int) []byte {
+	return []byte(fmt.Sprintf("%s:%d", sessionid, blockid))
+}
+
+// EncryptBlock to encrypt the base64 data of a block with the data key
+func EncryptBlock(dataKey []byte, sessionid string, blockid int, data string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("decoding block - %v", err)
+	}
+	sealed, err := sealGCM(dataKey, raw, blockAdditional(sessionid, blockid))
+	if err != nil {
+		return "", fmt.Errorf("encrypting block - %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptBlock to decrypt the data of a block, returning the raw content
+func DecryptBlock(dataKey []byte, sessionid string, blockid int, data string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding block - %v", err)
+	}
+	raw, err := openGCM(dataKey, sealed, blockAdditional(sessionid, blockid))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting block - %v", err)
+	}
+	return raw, nil
+}
+
+// Encrypted to check if a carve is encrypted at rest
+func (carve CarvedFile) Encrypted() bool {
+	return carve.KeyID != ""
+}
+
+// EnableEncryption to encrypt all new carves with the provided master keys
+func (c *Carves) EnableEncryption(keys *KeyRing) {
+	c.Keys = keys
+}
+
+// dataKey to retrieve the unwrapped data key for a carve
+func (c *Carves) dataKey(carve CarvedFile) ([]byte, error) {
+	if c.Keys == nil {
+		return nil, fmt.Errorf("carve %s is encrypted and no master keys are loaded", carve.SessionID)
+	}
+	return c.Keys.Unwrap(carve.EncryptedKey, carve.KeyID, carve.SessionID)
+}
+
+// Audit to record an access to an encrypted carve
+func (c *Carves) Audit(carve CarvedFile, username, address, action string) error {
+	entry := CarveAudit{
+		SessionID: carve.SessionID,
+		CarveID:   carve.CarveID,
+		Username:  username,
+		Address:   address,
+		Action:    action,
+		KeyID:     carve.KeyID,
+	}
+	if c.DB.NewRecord(entry) {
+		if err := c.DB.Create(&entry).Error; err != nil {
+			return fmt.Errorf("Create CarveAudit %v", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("db.NewRecord did not return true")
+}
+
+// GetAudit to retrieve all the audit entries for a carve session
+func (c *Carves) GetAudit(sessionid string) ([]CarveAudit, error) {
+	var entries []CarveAudit
+	if err := c.DB.Where("session_id = ?", sessionid).Order("created_at").Find(&entries).Error; err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
+
+// DecryptedArchive to get the name and size of the decrypted file for an encrypted carve
+func (c *Carves) DecryptedArchive(sessionid string) (*CarveResult, error) {
+	carve, err := c.GetBySession(sessionid)
+	if err != nil {
+		return nil, fmt.Errorf("getCarveBySessionID %v", err)
+	}
+	if !carve.Encrypted() {
+		return nil, fmt.Errorf("carve %s is not encrypted", sessionid)
+	}
+	blocks, err := c.GetBlocks(sessionid)
+	if err != nil {
+		return nil, fmt.Errorf("Getting blocks - %v", err)
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no blocks for carve %s", sessionid)
+	}
+	dataKey, err := c.dataKey(carve)
+	if err != nil {
+		return nil, err
+	}
+	res := &CarveResult{File: sessionid + ".tar"}
+	first, err := DecryptBlock(dataKey, sessionid, blocks[0].BlockID, blocks[0].Data)
+	if err != nil {
+		return nil, err
+	}
+	if blocks[0].BlockID == 0 && bytes.HasPrefix(first, CompressionHeader) {
+		res.File += ".zst"
+	}
+	for _, b := range blocks {
+		// DecodedLen does not account for padding
+		decoded := base64.StdEncoding.DecodedLen(len(b.Data)) - strings.Count(b.Data, "=")
+		res.Size += int64(decoded) - gcmOverhead
+	}
+	return res, nil
+}
+
+// Decrypt to write the decrypted content of an encrypted carve, with an audit entry
+func (c *Carves) Decrypt(sessionid, username, address string, w io.Writer) error {
+	carve, err := c.GetBySession(sessionid)
+	if err != nil {
+		return fmt.Errorf("getCarveBySessionID %v", err)
+	}
+	dataKey, err := c.dataKey(carve)
+	if err != nil {
+		return err
+	}
+	blocks, err := c.GetBlocks(sessionid)
+	if err != nil {
+		return fmt.Errorf("Getting blocks - %v", err)
+	}
+	if err := c.Audit(carve, username, address, AuditDecrypt); err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		raw, err := DecryptBlock(dataKey, sessionid, b.BlockID, b.Data)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(raw); err != nil {
+			return fmt.Errorf("Writing decrypted data - %v", err)
+		}
+	}
+	return nil
+}
+
+// RotateKeys to wrap again all data keys not wrapped with the active master key
+func (c *Carves) RotateKeys(username string) (int, error) {
+	if c.Keys == nil {
+		return 0, fmt.Errorf("no master keys are loaded")
+	}
+	var carves []CarvedFile
+	if err := c.DB.Where("key_id <> '' AND key_id <> ?", c.Keys.Active).Find(&carves).Error; err != nil {
+		return 0, err
+	}
+	rotated := 0
+	for _, carve := range carves {
+		dataKey, err := c.dataKey(carve)
+		if err != nil {
+			return rotated, err
+		}
+		wrapped, err := c.Keys.Wrap(dataKey, c.Keys.Active, carve.SessionID)
+		if err != nil {
+			return rotated, err
+		}
+		updates := map[string]interface{}{
+			"key_id":        c.Keys.Active,
+			"encrypted_key": wrapped,
+		}
+		if err := c.DB.Model(&carve).Updates(updates).Error; err != nil {
+			return rotated, fmt.Errorf("Updates %v", err)
+		}
+		if err := c.Audit(carve, username, "", AuditRewrap); err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
@@ -0,0 +1,61 @@
+package carves
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testKey(b byte) string {
+	key := make([]byte, DataKeySize)
+	for i := range key {
+		key[i] = b
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func TestParseKeyRing(t *testing.T) {
+	ring, err := ParseKeyRing("k2:" + testKey(2) + "\n# old key\nk1:" + testKey(1) + "\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "k2", ring.Active)
+	assert.Equal(t, 2, len(ring.Keys))
+	ring, err = ParseKeyRing("k1:" + testKey(1) + ",k2:" + testKey(2))
+	assert.NoError(t, err)
+	assert.Equal(t, "k1", ring.Active)
+	_, err = ParseKeyRing("")
+	assert.Error(t, err)
+	_, err = ParseKeyRing("k1:" + base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(t, err)
+	_, err = ParseKeyRing("k1:" + testKey(1) + "\nk1:" + testKey(2))
+	assert.Error(t, err)
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	ring, err := ParseKeyRing("k2:" + testKey(2) + "\nk1:" + testKey(1))
+	assert.NoError(t, err)
+	dataKey, wrapped, err := ring.NewDataKey("session")
+	assert.NoError(t, err)
+	unwrapped, err := ring.Unwrap(wrapped, "k2", "session")
+	assert.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+	// Data keys are bound to the master key and the session
+	_, err = ring.Unwrap(wrapped, "k1", "session")
+	assert.Error(t, err)
+	_, err = ring.Unwrap(wrapped, "k2", "other")
+	assert.Error(t, err)
+}
+
+func TestEncryptDecryptBlock(t *testing.T) {
+	dataKey := make([]byte, DataKeySize)
+	data := base64.StdEncoding.EncodeToString([]byte("carved content"))
+	encrypted, err := EncryptBlock(dataKey, "session", 3, data)
+	assert.NoError(t, err)
+	assert.NotEqual(t, data, encrypted)
+	raw, err := DecryptBlock(dataKey, "session", 3, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("carved content"), raw)
+	// Blocks can not be moved to a different position
+	_, err = DecryptBlock(dataKey, "session", 4, encrypted)
+	assert.Error(t, err)
+}
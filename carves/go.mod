@@ -2,4 +2,8 @@ module github.com/jmpsec/osctrl/carves
 
 go 1.14
 
-require github.com/jinzhu/gorm v1.9.8
+require (
+	github.com/jinzhu/gorm v1.9.8
+	github.com/mattn/go-sqlite3 v2.0.1+incompatible // indirect
+	github.com/stretchr/testify v1.5.1
+)
@@ -0,0 +1,232 @@
+package carves
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// QuotaEnvironment for limits applied to all carves in one environment
+	QuotaEnvironment string = "environment"
+	// QuotaUser for limits applied to all carves requested by one user
+	QuotaUser string = "user"
+)
+
+// CarveQuota to keep limits for carves, a zero value means no limit
+type CarveQuota struct {
+	gorm.Model
+	Scope         string `gorm:"index"`
+	Name          string `gorm:"index"`
+	MaxCarveSize  int
+	MaxConcurrent int
+	MaxStorage    int64
+}
+
+// CarveUsage to summarize the usage of carves for a quota
+type CarveUsage struct {
+	Active  int
+	Storage int64
+}
+
+// QuotaError to be returned when a carve goes over a limit
+type QuotaError struct {
+	Scope   string
+	Name    string
+	Message string
+}
+
+// Error to implement the error interface
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("carve quota exceeded for %s %s: %s", e.Scope, e.Name, e.Message)
+}
+
+// ValidQuotaScope to check if a quota scope is valid
+func ValidQuotaScope(scope string) bool {
+	return scope == QuotaEnvironment || scope == QuotaUser
+}
+
+// GetQuota to retrieve the quota for a scope and name
+func (c *Carves) GetQuota(scope, name string) (CarveQuota, error) {
+	var quota CarveQuota
+	if err := c.DB.Where("scope = ? AND name = ?", scope, name).First(&quota).Error; err != nil {
+		return quota, err
+	}
+	return quota, nil
+}
+
+// GetQuotas to retrieve all existing quotas
+func (c *Carves) GetQuotas() ([]CarveQuota, error) {
+	var quotas []CarveQuota
+	if err := c.DB.Order("scope, name").Find(&quotas).Error; err != nil {
+		return quotas, err
+	}
+	return quotas, nil
+}
+
+// SetQuota to create or update the quota for a scope and name
+func (c *Carves) SetQuota(quota CarveQuota) error {
+	if !ValidQuotaScope(quota.Scope) {
+		return fmt.Errorf("invalid quota scope %s", quota.Scope)
+	}
+	if quota.MaxCarveSize < 0 || quota.MaxConcurrent < 0 || quota.MaxStorage < 0 {
+		return fmt.Errorf("quota limits can not be negative")
+	}
+	existing, err := c.GetQuota(quota.Scope, quota.Name)
+	if err != nil {
+		if c.DB.NewRecord(quota) {
+			if err := c.DB.Create(&quota).Error; err != nil {
+				return fmt.Errorf("Create CarveQuota %v", err)
+			}
+			return nil
+		}
+		return fmt.Errorf("db.NewRecord did not return true")
+	}
+	updates := map[string]interface{}{
+		"max_carve_size": quota.MaxCarveSize,
+		"max_concurrent": quota.MaxConcurrent,
+		"max_storage":    quota.MaxStorage,
+	}
+	if err := c.DB.Model(&existing).Updates(updates).Error; err != nil {
+		return fmt.Errorf("Updates %v", err)
+	}
+	return nil
+}
+
+// DeleteQuota to remove the quota for a scope and name
+func (c *Carves) DeleteQuota(scope, name string) error {
+	quota, err := c.GetQuota(scope, name)
+	if err != nil {
+		return fmt.Errorf("GetQuota %v", err)
+	}
+	if err := c.DB.Unscoped().Delete(&quota).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// Usage to calculate active carves and storage for a scope and name. Active carves count for what
+// they announced, even if their blocks are not stored yet
+func (c *Carves) Usage(scope, name string) (CarveUsage, error) {
+	var usage CarveUsage
+	var column string
+	switch scope {
+	case QuotaEnvironment:
+		column = "environment"
+	case QuotaUser:
+		column = "creator"
+	default:
+		return usage, fmt.Errorf("invalid quota scope %s", scope)
+	}
+	var active []CarvedFile
+	if err := c.DB.Where(column+" = ?", name).Where("status IN (?)", []string{StatusInitialized, StatusInProgress}).Find(&active).Error; err != nil {
+		return usage, fmt.Errorf("Find %v", err)
+	}
+	usage.Active = len(active)
+	var stored []struct {
+		SessionID string
+		Total     int64
+	}
+	// Storage is what is stored in blocks, not what was announced by nodes
+	sessions := c.DB.Model(&CarvedFile{}).Select("session_id").Where(column+" = ?", name).QueryExpr()
+	if err := c.DB.Model(&CarvedBlock{}).Select("session_id, COALESCE(SUM(size), 0) AS total").Where("session_id IN (?)", sessions).Group("session_id").Scan(&stored).Error; err != nil {
+		return usage, fmt.Errorf("Sum %v", err)
+	}
+	storedBySession := make(map[string]int64)
+	for _, s := range stored {
+		usage.Storage += s.Total
+		storedBySession[s.SessionID] = s.Total
+	}
+	// Active carves reserve what is left of what they announced
+	for _, a := range active {
+		if left := carveBytes(a.CarveSize, a.BlockSize, a.TotalBlocks) - storedBySession[a.SessionID]; left > 0 {
+			usage.Storage += left
+		}
+	}
+	return usage, nil
+}
+
+// Helper to get the bytes a carve can store, as announced by the node. Blocks can add up to more than
+// the carve size, so nodes can not go over the limits announcing a small size with many blocks
+func carveBytes(size, blockSize, blockCount int) int64 {
+	blocks := int64(blockSize) * int64(blockCount)
+	if blocks > int64(size) {
+		return blocks
+	}
+	return int64(size)
+}
+
+// CheckQuota to verify if a new carve is within the limits for environment and user
+func (c *Carves) CheckQuota(environment, user string, size, blockSize, blockCount int) error {
+	if size < 0 || blockSize < 0 || blockCount < 0 {
+		return fmt.Errorf("invalid carve size %d with %d blocks of %d", size, blockCount, blockSize)
+	}
+	total := carveBytes(size, blockSize, blockCount)
+	scopes := map[string]string{
+		QuotaEnvironment: environment,
+		QuotaUser:        user,
+	}
+	for _, scope := range []string{QuotaEnvironment, QuotaUser} {
+		name := scopes[scope]
+		if name == "" {
+			continue
+		}
+		quota, err := c.GetQuota(scope, name)
+		if err != nil {
+			// No quota means no limits
+			continue
+		}
+		if quota.MaxCarveSize > 0 && total > int64(quota.MaxCarveSize) {
+			return &QuotaError{Scope: scope, Name: name, Message: fmt.Sprintf("carve size %d (%d blocks of %d) is over the limit of %d", total, blockCount, blockSize, quota.MaxCarveSize)}
+		}
+		if quota.MaxConcurrent == 0 && quota.MaxStorage == 0 {
+			continue
+		}
+		usage, err := c.Usage(scope, name)
+		if err != nil {
+			return err
+		}
+		if quota.MaxConcurrent > 0 && usage.Active >= quota.MaxConcurrent {
+			return &QuotaError{Scope: scope, Name: name, Message: fmt.Sprintf("%d carves in progress, limit is %d", usage.Active, quota.MaxConcurrent)}
+		}
+		if quota.MaxStorage > 0 && usage.Storage+total > quota.MaxStorage {
+			return &QuotaError{Scope: scope, Name: name, Message: fmt.Sprintf("storage would be %d, limit is %d", usage.Storage+total, quota.MaxStorage)}
+		}
+	}
+	return nil
+}
+
+// QuotaWarnings to describe the expected impact of a carve targeting a number of nodes
+func (c *Carves) QuotaWarnings(environments []string, user string, targets int) []string {
+	var warnings []string
+	check := func(scope, name string) {
+		quota, err := c.GetQuota(scope, name)
+		if err != nil {
+			return
+		}
+		usage, err := c.Usage(scope, name)
+		if err != nil {
+			return
+		}
+		if quota.MaxConcurrent > 0 && usage.Active+targets > quota.MaxConcurrent {
+			warnings = append(warnings, fmt.Sprintf("%s %s allows %d concurrent carves (%d active), %d targeted nodes may be rejected", scope, name, quota.MaxConcurrent, usage.Active, targets))
+		}
+		if quota.MaxStorage > 0 {
+			if usage.Storage >= quota.MaxStorage {
+				warnings = append(warnings, fmt.Sprintf("%s %s has no carve storage left (%d of %d bytes used)", scope, name, usage.Storage, quota.MaxStorage))
+			} else if quota.MaxCarveSize > 0 && usage.Storage+int64(targets)*int64(quota.MaxCarveSize) > quota.MaxStorage {
+				warnings = append(warnings, fmt.Sprintf("%s %s may run out of carve storage (%d of %d bytes used)", scope, name, usage.Storage, quota.MaxStorage))
+			}
+		}
+		if quota.MaxCarveSize > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s %s rejects carves bigger than %d bytes", scope, name, quota.MaxCarveSize))
+		}
+	}
+	for _, e := range environments {
+		check(QuotaEnvironment, e)
+	}
+	if user != "" {
+		check(QuotaUser, user)
+	}
+	return warnings
+}
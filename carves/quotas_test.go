@@ -0,0 +1,57 @@
+package carves
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCarveBytes(t *testing.T) {
+	assert.Equal(t, int64(1000), carveBytes(1000, 300, 3))
+	assert.Equal(t, int64(1200), carveBytes(1000, 300, 4))
+	assert.Equal(t, int64(300000000000), carveBytes(10, 300000, 1000000))
+	assert.Equal(t, int64(0), carveBytes(0, 0, 0))
+}
+
+// Helper to prepare carves in an in-memory database
+func testCarves(t *testing.T) *Carves {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	// Every connection to an in-memory database is a different database
+	db.DB().SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return CreateFileCarves(db)
+}
+
+func TestCheckQuota(t *testing.T) {
+	c := testCarves(t)
+	assert.NoError(t, c.SetQuota(CarveQuota{Scope: QuotaEnvironment, Name: "prod", MaxCarveSize: 600, MaxStorage: 1000}))
+	assert.NoError(t, c.CheckQuota("prod", "alice", 500, 100, 5))
+	assert.Error(t, c.CheckQuota("prod", "alice", 500, 100, 7))
+	assert.Error(t, c.CheckQuota("prod", "alice", -1, 100, 5))
+	assert.NoError(t, c.CheckQuota("dev", "alice", 5000, 100, 50))
+	// Carves in progress reserve what they announced
+	assert.NoError(t, c.CreateCarve(CarvedFile{CarveID: "c1", SessionID: "s1", Environment: "prod", CarveSize: 500, BlockSize: 100, TotalBlocks: 5, Status: StatusInitialized}))
+	assert.Error(t, c.CheckQuota("prod", "alice", 600, 100, 6))
+	assert.NoError(t, c.CheckQuota("prod", "alice", 500, 100, 5))
+	assert.NoError(t, c.CreateBlock(CarvedBlock{SessionID: "s1", BlockID: 0, Data: base64.StdEncoding.EncodeToString(make([]byte, 100))}))
+	usage, err := c.Usage(QuotaEnvironment, "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, CarveUsage{Active: 1, Storage: 500}, usage)
+}
+
+func TestCreateBlockLimits(t *testing.T) {
+	c := testCarves(t)
+	assert.NoError(t, c.CreateCarve(CarvedFile{CarveID: "c1", SessionID: "s1", Environment: "prod", CarveSize: 150, BlockSize: 100, TotalBlocks: 2, Status: StatusInitialized}))
+	assert.NoError(t, c.CreateBlock(CarvedBlock{SessionID: "s1", BlockID: 1, Data: base64.StdEncoding.EncodeToString(make([]byte, 50))}))
+	assert.Error(t, c.CreateBlock(CarvedBlock{SessionID: "s1", BlockID: 2, Data: base64.StdEncoding.EncodeToString(make([]byte, 50))}))
+	assert.Error(t, c.CreateBlock(CarvedBlock{SessionID: "s1", BlockID: 0, Data: base64.StdEncoding.EncodeToString(make([]byte, 101))}))
+	assert.Error(t, c.CreateBlock(CarvedBlock{SessionID: "s1", BlockID: 0, Data: "not base64"}))
+	blocks, err := c.GetBlocks("s1")
+	assert.NoError(t, err)
+	assert.Len(t, blocks, 1)
+	assert.Equal(t, 50, blocks[0].Size)
+}
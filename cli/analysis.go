@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmpsec/osctrl/logging"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+// Helper to parse sources defined as name or table=name
+func parseAnalysisSources(values []string, sourceType string, since time.Time) []logging.AnalysisSource {
+	var sources []logging.AnalysisSource
+	for _, v := range values {
+		s := logging.AnalysisSource{Type: sourceType, Name: v, Since: since}
+		if parts := strings.SplitN(v, "=", 2); len(parts) == 2 {
+			s.Table, s.Name = parts[0], parts[1]
+		}
+		sources = append(sources, s)
+	}
+	return sources
+}
+
+func analyzeResults(c *cli.Context) error {
+	// Get values from flags
+	query := c.String("sql")
+	if file := c.String("file"); file != "" {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		query = string(content)
+	}
+	if query == "" {
+		fmt.Println("SQL or file is required")
+		os.Exit(1)
+	}
+	var since time.Time
+	if window := c.Duration("window"); window > 0 {
+		since = time.Now().Add(-window)
+	}
+	request := logging.AnalysisRequest{
+		SQL:     query,
+		MaxRows: c.Int("max-rows"),
+		Timeout: c.Int("timeout"),
+	}
+	request.Sources = append(request.Sources, parseAnalysisSources(c.StringSlice("query"), logging.AnalysisSourceQuery, time.Time{})...)
+	request.Sources = append(request.Sources, parseAnalysisSources(c.StringSlice("scheduled"), logging.AnalysisSourceScheduled, since)...)
+	if len(request.Sources) == 0 {
+		fmt.Println("At least one query or scheduled query is required")
+		os.Exit(1)
+	}
+	for _, s := range request.Sources {
+		if s.Type != logging.AnalysisSourceQuery {
+			continue
+		}
+		if _, err := queriesmgr.Get(s.Name); err != nil {
+			return fmt.Errorf("query %s - %v", s.Name, err)
+		}
+	}
+	result, err := logging.AnalyzeResults(context.Background(), db, nodesmgr, request)
+	if err != nil {
+		return err
+	}
+	for t, n := range result.Tables {
+		fmt.Printf("Table %s loaded with %d rows\n", t, n)
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(result.Columns)
+	for _, row := range result.Rows {
+		values := make([]string, len(row))
+		for i, v := range row {
+			if v != nil {
+				values[i] = fmt.Sprintf("%v", v)
+			}
+		}
+		table.Append(values)
+	}
+	table.Render()
+	if result.Truncated {
+		fmt.Printf("Only the first %d rows are shown\n", len(result.Rows))
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jmpsec/osctrl/carves"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+// Helper to get the scope and name for a carve quota from flags
+func quotaTarget(c *cli.Context) (string, string) {
+	env := c.String("environment")
+	user := c.String("user")
+	if (env == "" && user == "") || (env != "" && user != "") {
+		fmt.Println("Either environment or user is required")
+		os.Exit(1)
+	}
+	if env != "" {
+		if !envs.Exists(env) {
+			fmt.Printf("Environment %s does not exist\n", env)
+			os.Exit(1)
+		}
+		return carves.QuotaEnvironment, env
+	}
+	if !adminUsers.Exists(user) {
+		fmt.Printf("User %s does not exist\n", user)
+		os.Exit(1)
+	}
+	return carves.QuotaUser, user
+}
+
+func setCarveQuota(c *cli.Context) error {
+	// Get values from flags
+	scope, name := quotaTarget(c)
+	quota := carves.CarveQuota{
+		Scope:         scope,
+		Name:          name,
+		MaxCarveSize:  c.Int("max-size"),
+		MaxConcurrent: c.Int("max-concurrent"),
+		MaxStorage:    c.Int64("max-storage"),
+	}
+	if err := carvesmgr.SetQuota(quota); err != nil {
+		return err
+	}
+	fmt.Printf("Carve quota for %s %s saved\n", scope, name)
+	return nil
+}
+
+func deleteCarveQuota(c *cli.Context) error {
+	// Get values from flags
+	scope, name := quotaTarget(c)
+	return carvesmgr.DeleteQuota(scope, name)
+}
+
+func listCarveQuotas(c *cli.Context) error {
+	quotas, err := carvesmgr.GetQuotas()
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Scope",
+		"Name",
+		"Max Carve Size",
+		"Max Concurrent",
+		"Max Storage",
+		"Active Carves",
+		"Used Storage",
+	})
+	if len(quotas) > 0 {
+		data := [][]string{}
+		for _, q := range quotas {
+			usage, err := carvesmgr.Usage(q.Scope, q.Name)
+			if err != nil {
+				return err
+			}
+			_q := []string{
+				q.Scope,
+				q.Name,
+				strconv.Itoa(q.MaxCarveSize),
+				strconv.Itoa(q.MaxConcurrent),
+				strconv.FormatInt(q.MaxStorage, 10),
+				strconv.Itoa(usage.Active),
+				strconv.FormatInt(usage.Storage, 10),
+			}
+			data = append(data, _q)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No carve quotas\n")
+	}
+	return nil
+}
+
+func rotateCarveKeys(c *cli.Context) error {
+	if carvesmgr.Keys == nil {
+		fmt.Printf("Master keys are required, use a keys file or %s\n", carves.EnvCarvesKeys)
+		os.Exit(1)
+	}
+	rotated, err := carvesmgr.RotateKeys(appName)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d carves now use master key %s\n", rotated, carvesmgr.Keys.Active)
+	return nil
+}
+
+func showCarveAudit(c *cli.Context) error {
+	// Get values from flags
+	session := c.String("session")
+	if session == "" {
+		fmt.Println("session is required")
+		os.Exit(1)
+	}
+	entries, err := carvesmgr.GetAudit(session)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Date",
+		"Action",
+		"User",
+		"Address",
+		"Key ID",
+	})
+	if len(entries) > 0 {
+		data := [][]string{}
+		for _, e := range entries {
+			_e := []string{
+				e.CreatedAt.String(),
+				e.Action,
+				e.Username,
+				e.Address,
+				e.KeyID,
+			}
+			data = append(data, _e)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No audit entries\n")
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jmpsec/osctrl/configs"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+func addOverlay(c *cli.Context) error {
+	// Get values from flags
+	env := c.String("environment")
+	if env == "" {
+		fmt.Println("Environment is required")
+		os.Exit(1)
+	}
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("Overlay name is required")
+		os.Exit(1)
+	}
+	file := c.String("file")
+	if file == "" {
+		fmt.Println("Configuration file is required")
+		os.Exit(1)
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	overlay := configs.ConfigOverlay{
+		Name:          name,
+		Environment:   env,
+		Scope:         c.String("scope"),
+		Target:        c.String("target"),
+		Priority:      c.Int("priority"),
+		Configuration: string(content),
+	}
+	if err := configsmgr.CreateOverlay(overlay); err != nil {
+		return err
+	}
+	fmt.Printf("Overlay %s added to %s\n", name, env)
+	return nil
+}
+
+func deleteOverlay(c *cli.Context) error {
+	// Get values from flags
+	env := c.String("environment")
+	if env == "" {
+		fmt.Println("Environment is required")
+		os.Exit(1)
+	}
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("Overlay name is required")
+		os.Exit(1)
+	}
+	return configsmgr.DeleteOverlay(env, name)
+}
+
+func listOverlays(c *cli.Context) error {
+	// Get values from flags
+	env := c.String("environment")
+	if env == "" {
+		fmt.Println("Environment is required")
+		os.Exit(1)
+	}
+	overlays, err := configsmgr.GetOverlays(env)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Name",
+		"Scope",
+		"Target",
+		"Priority",
+	})
+	if len(overlays) > 0 {
+		data := [][]string{}
+		for _, o := range overlays {
+			_o := []string{
+				o.Name,
+				o.Scope,
+				o.Target,
+				strconv.Itoa(o.Priority),
+			}
+			data = append(data, _o)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No overlays\n")
+	}
+	return nil
+}
+
+func previewConfiguration(c *cli.Context) error {
+	// Get values from flags
+	uuid := c.String("uuid")
+	if uuid == "" {
+		fmt.Println("UUID is required")
+		os.Exit(1)
+	}
+	node, err := nodesmgr.GetByUUID(uuid)
+	if err != nil {
+		return err
+	}
+	effective, err := configsmgr.Effective(node)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Sources: %s\n", strings.Join(effective.Sources, ", "))
+	fmt.Println(effective.Configuration)
+	return nil
+}
+
+func validateConfiguration(c *cli.Context) error {
+	// Get values from flags
+	file := c.String("file")
+	if file == "" {
+		fmt.Println("Configuration file is required")
+		os.Exit(1)
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	if c.String("tables") != "" {
+		if tables, err = configs.LoadTables(c.String("tables")); err != nil {
+			return err
+		}
+	}
+	validation := configs.Validate(string(content), tables)
+	for _, e := range validation.Errors {
+		fmt.Printf("ERROR: %s\n", e)
+	}
+	for _, w := range validation.Warnings {
+		fmt.Printf("WARNING: %s\n", w)
+	}
+	if !validation.Valid {
+		return fmt.Errorf("%s is not a valid configuration", file)
+	}
+	fmt.Printf("%s is a valid configuration\n", file)
+	return nil
+}
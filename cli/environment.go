@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"time"
 
@@ -61,7 +62,7 @@ func addEnvironment(c *cli.Context) error {
 			return err
 		}
 		// Update flags in the newly created environment
-		if err := envs.UpdateFlags(envName, flags); err != nil {
+		if err := envs.SaveFlags(envName, flags, appName, "flags generated for new environment"); err != nil {
 			return err
 		}
 	} else {
@@ -98,7 +99,7 @@ func updateEnvironment(c *cli.Context) error {
 		return err
 	}
 	// Update flags in the newly created environment
-	if err := envs.UpdateFlags(envName, flags); err != nil {
+	if err := envs.SaveFlags(envName, flags, appName, "flags re-generated after update"); err != nil {
 		return err
 	}
 	fmt.Printf("Environment %s was updated successfully", envName)
@@ -147,6 +148,8 @@ func showEnvironment(c *cli.Context) error {
 	fmt.Printf(" Carve Block Path: /%s/%s\n", env.Name, env.CarverBlockPath)
 	fmt.Println(" Flags: ")
 	fmt.Printf("%s\n", env.Flags)
+	fmt.Println(" Extra Flags: ")
+	fmt.Printf("%s\n", env.FlagsExtra)
 	fmt.Println(" Configuration: ")
 	fmt.Printf("%s\n", env.Configuration)
 	fmt.Println(" Certificate: ")
@@ -235,11 +238,17 @@ func flagsEnvironment(c *cli.Context) error {
 	}
 	secret := c.String("secret")
 	cert := c.String("certificate")
+	platform := c.String("platform")
 	env, err := envs.Get(envName)
 	if err != nil {
 		return err
 	}
-	flags, err := environments.GenerateFlags(env, secret, cert)
+	var flags string
+	if platform != "" {
+		flags, err = environments.GenerateFlagsPlatform(env, platform, projectName+"-"+env.Name)
+	} else {
+		flags, err = environments.GenerateFlags(env, secret, cert)
+	}
 	if err != nil {
 		return err
 	}
@@ -247,6 +256,66 @@ func flagsEnvironment(c *cli.Context) error {
 	return nil
 }
 
+func extraFlagsEnvironment(c *cli.Context) error {
+	// Get environment name
+	envName := c.String("name")
+	if envName == "" {
+		fmt.Println("Environment name is required")
+		os.Exit(1)
+	}
+	extra := c.String("extra")
+	if file := c.String("file"); file != "" {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		extra = string(content)
+	}
+	if err := envs.SaveFlagsExtra(envName, extra, appName); err != nil {
+		return err
+	}
+	fmt.Printf("Extra flags updated for %s\n", envName)
+	return nil
+}
+
+func scriptEnvironment(c *cli.Context) error {
+	// Get environment name
+	envName := c.String("name")
+	if envName == "" {
+		fmt.Println("Environment name is required")
+		os.Exit(1)
+	}
+	script := c.String("script")
+	if !environments.ValidScript(script) {
+		fmt.Printf("Invalid script %s\n", script)
+		os.Exit(1)
+	}
+	if c.Bool("reset") {
+		if err := envs.ResetScript(envName, script); err != nil {
+			return err
+		}
+		fmt.Printf("Script %s reset to default for %s\n", script, envName)
+		return nil
+	}
+	if file := c.String("file"); file != "" {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := envs.SetScript(envName, script, string(content)); err != nil {
+			return err
+		}
+		fmt.Printf("Script %s updated for %s\n", script, envName)
+		return nil
+	}
+	content, err := envs.GetScript(envName, script)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", content)
+	return nil
+}
+
 func secretEnvironment(c *cli.Context) error {
 	// Get environment name
 	envName := c.String("name")
@@ -261,3 +330,80 @@ func secretEnvironment(c *cli.Context) error {
 	fmt.Printf("%s\n", env.Secret)
 	return nil
 }
+
+func historyEnvironment(c *cli.Context) error {
+	// Get environment name
+	envName := c.String("name")
+	if envName == "" {
+		fmt.Println("Environment name is required")
+		os.Exit(1)
+	}
+	versions, err := envs.GetVersions(envName, c.String("type"))
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Version",
+		"Type",
+		"Date",
+		"Author",
+		"Comment",
+		"Hash",
+	})
+	if len(versions) > 0 {
+		data := [][]string{}
+		for _, v := range versions {
+			_v := []string{
+				fmt.Sprintf("%d", v.ID),
+				v.Type,
+				v.CreatedAt.String(),
+				v.Author,
+				v.Comment,
+				v.Hash,
+			}
+			data = append(data, _v)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No changes for %s\n", envName)
+	}
+	return nil
+}
+
+func diffEnvironment(c *cli.Context) error {
+	// Get environment name
+	envName := c.String("name")
+	if envName == "" {
+		fmt.Println("Environment name is required")
+		os.Exit(1)
+	}
+	from, err := envs.GetVersion(envName, c.Uint("from"))
+	if err != nil {
+		return err
+	}
+	to, err := envs.GetVersion(envName, c.Uint("to"))
+	if err != nil {
+		return err
+	}
+	for _, d := range environments.DiffVersions(from, to) {
+		fmt.Printf("%s %s\n", d.Op, d.Text)
+	}
+	return nil
+}
+
+func rollbackEnvironment(c *cli.Context) error {
+	// Get environment name
+	envName := c.String("name")
+	if envName == "" {
+		fmt.Println("Environment name is required")
+		os.Exit(1)
+	}
+	version := c.Uint("version")
+	if err := envs.Rollback(envName, version, appName); err != nil {
+		return err
+	}
+	fmt.Printf("Environment %s was rolled back to version %d\n", envName, version)
+	return nil
+}
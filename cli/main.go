@@ -6,8 +6,12 @@ import (
 	"os"
 
 	"github.com/jmpsec/osctrl/backend"
+	"github.com/jmpsec/osctrl/carves"
+	"github.com/jmpsec/osctrl/configs"
 	"github.com/jmpsec/osctrl/environments"
+	"github.com/jmpsec/osctrl/logging"
 	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/packs"
 	"github.com/jmpsec/osctrl/queries"
 	"github.com/jmpsec/osctrl/settings"
 	"github.com/jmpsec/osctrl/tags"
@@ -39,12 +43,16 @@ var (
 	flags        []cli.Flag
 	commands     []cli.Command
 	dbConfigFile string
+	carvesKeys   string
 	settingsmgr  *settings.Settings
 	nodesmgr     *nodes.NodeManager
 	queriesmgr   *queries.Queries
 	adminUsers   *users.UserManager
 	tagsmgr      *tags.TagManager
 	envs         *environments.Environment
+	carvesmgr    *carves.Carves
+	packsmgr     *packs.Packs
+	configsmgr   *configs.Configs
 )
 
 // Initialization code
@@ -58,6 +66,12 @@ func init() {
 			EnvVar:      "DB_CONFIG",
 			Destination: &dbConfigFile,
 		},
+		cli.StringFlag{
+			Name:        "K, carves-keys",
+			Value:       "",
+			Usage:       "Load master keys to encrypt carves from `FILE`",
+			Destination: &carvesKeys,
+		},
 	}
 	// Initialize CLI flags commands
 	commands = []cli.Command{
@@ -244,6 +258,58 @@ func init() {
 					Usage:   "List all existing TLS environments",
 					Action:  cliWrapper(listEnvironment),
 				},
+				{
+					Name:    "history",
+					Aliases: []string{"y"},
+					Usage:   "Show the history of changes for a TLS environment",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Environment to be displayed",
+						},
+						cli.StringFlag{
+							Name:  "type, t",
+							Usage: "Type of changes (configuration, flags or intervals)",
+						},
+					},
+					Action: cliWrapper(historyEnvironment),
+				},
+				{
+					Name:    "diff",
+					Aliases: []string{"i"},
+					Usage:   "Show the differences between two versions of a TLS environment",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Environment to be used",
+						},
+						cli.UintFlag{
+							Name:  "from",
+							Usage: "Version to compare from",
+						},
+						cli.UintFlag{
+							Name:  "to",
+							Usage: "Version to compare to",
+						},
+					},
+					Action: cliWrapper(diffEnvironment),
+				},
+				{
+					Name:    "rollback",
+					Aliases: []string{"b"},
+					Usage:   "Rollback a TLS environment to a previous version",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Environment to be used",
+						},
+						cli.UintFlag{
+							Name:  "version, v",
+							Usage: "Version to rollback to",
+						},
+					},
+					Action: cliWrapper(rollbackEnvironment),
+				},
 				{
 					Name:    "quick-add",
 					Aliases: []string{"q"},
@@ -278,9 +344,58 @@ func init() {
 							Name:  "secret, s",
 							Usage: "Secret file path to be used",
 						},
+						cli.StringFlag{
+							Name:  "platform, p",
+							Usage: "Platform to generate flags for (linux, darwin, windows or freebsd), using its paths",
+						},
 					},
 					Action: cliWrapper(flagsEnvironment),
 				},
+				{
+					Name:    "extra-flags",
+					Aliases: []string{"e"},
+					Usage:   "Set extra lines to be appended to the flags of an environment",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Environment to be updated",
+						},
+						cli.StringFlag{
+							Name:  "extra, x",
+							Usage: "Extra flags, one per line",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "File with the extra flags",
+						},
+					},
+					Action: cliWrapper(extraFlagsEnvironment),
+				},
+				{
+					Name:    "script",
+					Aliases: []string{"p"},
+					Usage:   "Show, set or reset the template of an enroll/remove script for an environment",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Environment to be used",
+						},
+						cli.StringFlag{
+							Name:  "script, s",
+							Value: environments.ScriptEnrollShell,
+							Usage: "Script to be used (enroll.sh, enroll.ps1, remove.sh or remove.ps1)",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "File with the new script template",
+						},
+						cli.BoolFlag{
+							Name:  "reset, r",
+							Usage: "Reset the script to the default template",
+						},
+					},
+					Action: cliWrapper(scriptEnvironment),
+				},
 				{
 					Name:    "secret",
 					Aliases: []string{"x"},
@@ -424,6 +539,30 @@ func init() {
 					},
 					Action: cliWrapper(deleteNode),
 				},
+				{
+					Name:    "label",
+					Aliases: []string{"b"},
+					Usage:   "Show, set or delete labels of a node, used by configuration templates",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "uuid, u",
+							Usage: "Node UUID to be labeled",
+						},
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Label name to be set or deleted",
+						},
+						cli.StringFlag{
+							Name:  "value, v",
+							Usage: "Label value to be set",
+						},
+						cli.BoolFlag{
+							Name:  "delete, d",
+							Usage: "Delete the label",
+						},
+					},
+					Action: cliWrapper(labelNode),
+				},
 				{
 					Name:    "list",
 					Aliases: []string{"l"},
@@ -505,6 +644,684 @@ func init() {
 					},
 					Action: cliWrapper(listQueries),
 				},
+				{
+					Name:    "export",
+					Aliases: []string{"e"},
+					Usage:   "Export the results of an on-demand query",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Query name to be exported",
+						},
+						cli.StringFlag{
+							Name:  "format, f",
+							Value: "csv",
+							Usage: "Export format: csv, ndjson or xlsx",
+						},
+						cli.StringFlag{
+							Name:  "file, o",
+							Usage: "File to write the results, stdout if not provided",
+						},
+					},
+					Action: cliWrapper(exportQuery),
+				},
+				{
+					Name:    "watch",
+					Aliases: []string{"w"},
+					Usage:   "Follow the results of an on-demand query as nodes answer",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Query name to be followed",
+						},
+						cli.DurationFlag{
+							Name:  "interval, i",
+							Value: logging.DefaultStreamInterval,
+							Usage: "Interval to check for new results",
+						},
+					},
+					Action: cliWrapper(watchQuery),
+				},
+				{
+					Name:    "stats",
+					Aliases: []string{"st"},
+					Usage:   "Show the execution stats reported by nodes for an on-demand query",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Query name to show stats",
+						},
+					},
+					Action: cliWrapper(queryStats),
+				},
+				{
+					Name:    "analyze",
+					Aliases: []string{"a"},
+					Usage:   "Run SQL over the results of on-demand and scheduled queries",
+					Flags: []cli.Flag{
+						cli.StringSliceFlag{
+							Name:  "query, q",
+							Usage: "On-demand query to load as table, as name or table=name",
+						},
+						cli.StringSliceFlag{
+							Name:  "scheduled, s",
+							Usage: "Scheduled query to load as table, as name or table=name",
+						},
+						cli.DurationFlag{
+							Name:  "window, w",
+							Usage: "Load only scheduled results from this time window, like 24h",
+						},
+						cli.StringFlag{
+							Name:  "sql",
+							Usage: "Read-only SQL to run over the loaded tables",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "File with the SQL to run",
+						},
+						cli.IntFlag{
+							Name:  "max-rows, m",
+							Value: logging.DefaultAnalysisRows,
+							Usage: "Maximum number of rows to return",
+						},
+						cli.IntFlag{
+							Name:  "timeout, t",
+							Value: logging.DefaultAnalysisTimeout,
+							Usage: "Maximum time in seconds to load results and run SQL",
+						},
+					},
+					Action: cliWrapper(analyzeResults),
+				},
+				{
+					Name:   "approvals",
+					Usage:  "List on-demand queries and carves pending approval",
+					Action: cliWrapper(listApprovals),
+				},
+				{
+					Name:  "approve",
+					Usage: "Approve an on-demand query or carve pending approval",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Query or carve name to be approved",
+						},
+						cli.StringFlag{
+							Name:  "user, u",
+							Usage: "User that approves, it can not be the creator",
+						},
+						cli.StringFlag{
+							Name:  "comment, c",
+							Usage: "Comment explaining the decision, required",
+						},
+					},
+					Action: cliWrapper(approveQuery),
+				},
+				{
+					Name:  "reject",
+					Usage: "Reject an on-demand query or carve pending approval",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Query or carve name to be rejected",
+						},
+						cli.StringFlag{
+							Name:  "user, u",
+							Usage: "User that rejects, it can not be the creator",
+						},
+						cli.StringFlag{
+							Name:  "comment, c",
+							Usage: "Comment explaining the decision, required",
+						},
+					},
+					Action: cliWrapper(rejectQuery),
+				},
+				{
+					Name:    "schedules",
+					Aliases: []string{"s"},
+					Usage:   "List scheduled queries",
+					Action:  cliWrapper(listSchedules),
+				},
+				{
+					Name:    "runs",
+					Aliases: []string{"r"},
+					Usage:   "List the runs of a scheduled query",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Scheduled query name",
+						},
+					},
+					Action: cliWrapper(listScheduleRuns),
+				},
+				{
+					Name:    "pause",
+					Aliases: []string{"p"},
+					Usage:   "Pause a scheduled query",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Scheduled query name to be paused",
+						},
+					},
+					Action: cliWrapper(pauseSchedule),
+				},
+				{
+					Name:    "resume",
+					Aliases: []string{"u"},
+					Usage:   "Resume a paused scheduled query",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Scheduled query name to be resumed",
+						},
+					},
+					Action: cliWrapper(resumeSchedule),
+				},
+				{
+					Name:    "lint",
+					Aliases: []string{"t"},
+					Usage:   "Check a query against the osquery schema",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "query, q",
+							Usage: "Query to be checked",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "File with the query to be checked",
+						},
+						cli.StringFlag{
+							Name:  "tables, t",
+							Usage: "JSON file with osquery tables to check tables and columns",
+						},
+						cli.StringFlag{
+							Name:  "platforms, p",
+							Usage: "Comma separated platforms of the nodes to be queried",
+						},
+					},
+					Action: lintQuery,
+				},
+			},
+		},
+		{
+			Name:  "saved",
+			Usage: "Commands for saved queries",
+			Subcommands: []cli.Command{
+				{
+					Name:    "add",
+					Aliases: []string{"a"},
+					Usage:   "Add or update a saved query, keeping the previous version",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Saved query name",
+						},
+						cli.StringFlag{
+							Name:  "user, u",
+							Usage: "User that owns the saved query",
+						},
+						cli.StringFlag{
+							Name:  "description, d",
+							Usage: "Saved query description",
+						},
+						cli.StringFlag{
+							Name:  "query, q",
+							Usage: "Query with parameters like {{path}}",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "File with the query",
+						},
+						cli.StringFlag{
+							Name:  "tags, t",
+							Usage: "Comma separated tags",
+						},
+						cli.StringSliceFlag{
+							Name:  "parameter, p",
+							Usage: "Parameter as name:type[:default[:description]], type is string, integer, path or hash",
+						},
+						cli.BoolFlag{
+							Name:  "shared, s",
+							Usage: "Share the saved query with all users",
+						},
+					},
+					Action: cliWrapper(addSaved),
+				},
+				{
+					Name:    "delete",
+					Aliases: []string{"d"},
+					Usage:   "Delete a saved query and its history",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Saved query name to be deleted",
+						},
+					},
+					Action: cliWrapper(deleteSaved),
+				},
+				{
+					Name:    "list",
+					Aliases: []string{"l"},
+					Usage:   "List all saved queries",
+					Action:  cliWrapper(listSaved),
+				},
+				{
+					Name:    "show",
+					Aliases: []string{"s"},
+					Usage:   "Show a saved query with its parameters",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Saved query name",
+						},
+					},
+					Action: cliWrapper(showSaved),
+				},
+				{
+					Name:    "history",
+					Aliases: []string{"y"},
+					Usage:   "List the versions of a saved query",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Saved query name",
+						},
+					},
+					Action: cliWrapper(historySaved),
+				},
+				{
+					Name:    "restore",
+					Aliases: []string{"r"},
+					Usage:   "Restore an old version of a saved query",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Saved query name",
+						},
+						cli.StringFlag{
+							Name:  "user, u",
+							Usage: "User restoring the version",
+						},
+						cli.IntFlag{
+							Name:  "version, v",
+							Usage: "Version to be restored",
+						},
+					},
+					Action: cliWrapper(restoreSaved),
+				},
+				{
+					Name:    "import",
+					Aliases: []string{"i"},
+					Usage:   "Import the queries of a pack in the osquery pack format",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "pack, k",
+							Usage: "Pack name, used to tag the imported queries",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "JSON file with the pack",
+						},
+						cli.StringFlag{
+							Name:  "user, u",
+							Usage: "User that owns the imported queries",
+						},
+						cli.BoolFlag{
+							Name:  "shared, s",
+							Usage: "Share the imported queries with all users",
+						},
+						cli.BoolFlag{
+							Name:  "replace, r",
+							Usage: "Replace existing saved queries with the same name",
+						},
+					},
+					Action: cliWrapper(importSaved),
+				},
+				{
+					Name:    "run",
+					Aliases: []string{"x"},
+					Usage:   "Launch a saved query as an on-demand query",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Saved query name",
+						},
+						cli.StringFlag{
+							Name:  "user, u",
+							Usage: "User launching the query",
+						},
+						cli.StringSliceFlag{
+							Name:  "param, p",
+							Usage: "Parameter value as name=value",
+						},
+						cli.StringFlag{
+							Name:  "environment, e",
+							Usage: "Comma separated environments to target",
+						},
+						cli.StringFlag{
+							Name:  "platform, P",
+							Usage: "Comma separated platforms to target",
+						},
+						cli.StringFlag{
+							Name:  "uuid, U",
+							Usage: "Comma separated node UUIDs to target",
+						},
+						cli.StringFlag{
+							Name:  "tag, t",
+							Usage: "Comma separated tags to target",
+						},
+						cli.StringFlag{
+							Name:  "hostname, H",
+							Usage: "Comma separated hostname patterns to target",
+						},
+						cli.StringFlag{
+							Name:  "expression, E",
+							Usage: "Target expression, like environment:prod AND NOT tag:excluded",
+						},
+						cli.Int64Flag{
+							Name:  "expiration, x",
+							Usage: "Hours until the query expires, zero uses the default and negative means never",
+						},
+						cli.StringFlag{
+							Name:  "discovery",
+							Usage: "Discovery query, the query only runs on nodes where it returns rows",
+						},
+						cli.StringFlag{
+							Name:  "tables",
+							Usage: "JSON file with osquery tables to check the query",
+						},
+					},
+					Action: cliWrapper(runSaved),
+				},
+			},
+		},
+		{
+			Name:  "carve",
+			Usage: "Commands for file carves",
+			Subcommands: []cli.Command{
+				{
+					Name:    "quota-set",
+					Aliases: []string{"s"},
+					Usage:   "Set carve limits for an environment or a user",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "environment, e",
+							Usage: "Environment for the quota",
+						},
+						cli.StringFlag{
+							Name:  "user, u",
+							Usage: "User for the quota",
+						},
+						cli.IntFlag{
+							Name:  "max-size",
+							Value: 0,
+							Usage: "Maximum size in bytes for one carve, 0 is unlimited",
+						},
+						cli.IntFlag{
+							Name:  "max-concurrent",
+							Value: 0,
+							Usage: "Maximum number of carves in progress, 0 is unlimited",
+						},
+						cli.Int64Flag{
+							Name:  "max-storage",
+							Value: 0,
+							Usage: "Maximum storage in bytes for all carves, 0 is unlimited",
+						},
+					},
+					Action: cliWrapper(setCarveQuota),
+				},
+				{
+					Name:    "quota-delete",
+					Aliases: []string{"d"},
+					Usage:   "Delete carve limits for an environment or a user",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "environment, e",
+							Usage: "Environment for the quota",
+						},
+						cli.StringFlag{
+							Name:  "user, u",
+							Usage: "User for the quota",
+						},
+					},
+					Action: cliWrapper(deleteCarveQuota),
+				},
+				{
+					Name:    "quota-list",
+					Aliases: []string{"l"},
+					Usage:   "List all carve limits and their usage",
+					Action:  cliWrapper(listCarveQuotas),
+				},
+				{
+					Name:    "rotate-keys",
+					Aliases: []string{"r"},
+					Usage:   "Wrap all carve data keys with the active master key",
+					Action:  cliWrapper(rotateCarveKeys),
+				},
+				{
+					Name:    "audit",
+					Aliases: []string{"a"},
+					Usage:   "Show the audit entries for an encrypted carve",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "session, s",
+							Usage: "Carve session to be displayed",
+						},
+					},
+					Action: cliWrapper(showCarveAudit),
+				},
+			},
+		},
+		{
+			Name:  "pack",
+			Usage: "Commands for osquery packs",
+			Subcommands: []cli.Command{
+				{
+					Name:    "import",
+					Aliases: []string{"i"},
+					Usage:   "Import a pack in the osquery pack format",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Pack name to be imported",
+						},
+						cli.StringFlag{
+							Name:  "description, d",
+							Usage: "Pack description",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "JSON file with the pack",
+						},
+						cli.BoolFlag{
+							Name:  "replace, r",
+							Usage: "Replace the queries of an existing pack",
+						},
+					},
+					Action: cliWrapper(importPack),
+				},
+				{
+					Name:    "export",
+					Aliases: []string{"x"},
+					Usage:   "Export a pack in the osquery pack format",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Pack name to be exported",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "File to write the pack, stdout if empty",
+						},
+					},
+					Action: cliWrapper(exportPack),
+				},
+				{
+					Name:    "delete",
+					Aliases: []string{"d"},
+					Usage:   "Delete an existing pack",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Pack name to be deleted",
+						},
+					},
+					Action: cliWrapper(deletePack),
+				},
+				{
+					Name:    "list",
+					Aliases: []string{"l"},
+					Usage:   "List all packs",
+					Action:  cliWrapper(listPacks),
+				},
+				{
+					Name:    "show",
+					Aliases: []string{"s"},
+					Usage:   "Show queries and targets of a pack",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Pack name to be displayed",
+						},
+					},
+					Action: cliWrapper(showPack),
+				},
+				{
+					Name:    "assign",
+					Aliases: []string{"a"},
+					Usage:   "Assign a pack to an environment or a tag",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Pack name to be assigned",
+						},
+						cli.StringFlag{
+							Name:  "environment, e",
+							Usage: "Environment for the pack",
+						},
+						cli.StringFlag{
+							Name:  "tag, t",
+							Usage: "Tag for the pack",
+						},
+					},
+					Action: cliWrapper(assignPack),
+				},
+				{
+					Name:    "unassign",
+					Aliases: []string{"u"},
+					Usage:   "Unassign a pack from an environment or a tag",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Pack name to be unassigned",
+						},
+						cli.StringFlag{
+							Name:  "environment, e",
+							Usage: "Environment for the pack",
+						},
+						cli.StringFlag{
+							Name:  "tag, t",
+							Usage: "Tag for the pack",
+						},
+					},
+					Action: cliWrapper(unassignPack),
+				},
+			},
+		},
+		{
+			Name:  "config",
+			Usage: "Commands for composed configurations",
+			Subcommands: []cli.Command{
+				{
+					Name:    "overlay-add",
+					Aliases: []string{"a"},
+					Usage:   "Add a configuration overlay to an environment",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "environment, e",
+							Usage: "Environment for the overlay",
+						},
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Overlay name to be added",
+						},
+						cli.StringFlag{
+							Name:  "scope, s",
+							Value: configs.OverlayPlatform,
+							Usage: "Overlay scope (platform, tag or uuid)",
+						},
+						cli.StringFlag{
+							Name:  "target, t",
+							Usage: "Platform, tag or UUID matched by the overlay",
+						},
+						cli.IntFlag{
+							Name:  "priority, p",
+							Value: 0,
+							Usage: "Priority of the overlay within its scope",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "JSON file with the overlay configuration",
+						},
+					},
+					Action: cliWrapper(addOverlay),
+				},
+				{
+					Name:    "overlay-delete",
+					Aliases: []string{"d"},
+					Usage:   "Delete a configuration overlay",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "environment, e",
+							Usage: "Environment for the overlay",
+						},
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Overlay name to be deleted",
+						},
+					},
+					Action: cliWrapper(deleteOverlay),
+				},
+				{
+					Name:    "overlay-list",
+					Aliases: []string{"l"},
+					Usage:   "List all configuration overlays for an environment",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "environment, e",
+							Usage: "Environment to list overlays",
+						},
+					},
+					Action: cliWrapper(listOverlays),
+				},
+				{
+					Name:    "preview",
+					Aliases: []string{"p"},
+					Usage:   "Show the effective configuration for a node",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "uuid, u",
+							Usage: "Node UUID to preview",
+						},
+					},
+					Action: cliWrapper(previewConfiguration),
+				},
+				{
+					Name:    "validate",
+					Aliases: []string{"v"},
+					Usage:   "Validate an osquery configuration file",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "JSON file with the configuration to validate",
+						},
+						cli.StringFlag{
+							Name:  "tables, t",
+							Usage: "JSON file with osquery tables to check queries",
+						},
+					},
+					Action: validateConfiguration,
+				},
 			},
 		},
 		{
@@ -644,10 +1461,23 @@ func cliWrapper(action func(*cli.Context) error) func(*cli.Context) error {
 		settingsmgr = settings.NewSettings(db)
 		// Initialize nodes
 		nodesmgr = nodes.CreateNodes(db)
-		// Initialize queries
-		queriesmgr = queries.CreateQueries(db)
 		// Initialize tags
 		tagsmgr = tags.CreateTagManager(db)
+		// Initialize queries
+		queriesmgr = queries.CreateQueries(db, tagsmgr)
+		// Initialize carves
+		carvesmgr = carves.CreateFileCarves(db)
+		keys, err := carves.LoadKeyRing(carvesKeys)
+		if err != nil {
+			return err
+		}
+		if keys != nil {
+			carvesmgr.EnableEncryption(keys)
+		}
+		// Initialize packs
+		packsmgr = packs.CreatePacks(db)
+		// Initialize configurations
+		configsmgr = configs.CreateConfigs(db, envs, nodesmgr, packsmgr, tagsmgr)
 		// Execute action
 		return action(c)
 	}
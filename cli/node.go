@@ -64,3 +64,40 @@ func deleteNode(c *cli.Context) error {
 	}
 	return nodesmgr.ArchiveDeleteByUUID(uuid)
 }
+
+func labelNode(c *cli.Context) error {
+	// Get values from flags
+	uuid := c.String("uuid")
+	if uuid == "" {
+		fmt.Println("uuid is required")
+		os.Exit(1)
+	}
+	name := c.String("name")
+	if name != "" {
+		if c.Bool("delete") {
+			return nodesmgr.DeleteLabel(uuid, name)
+		}
+		return nodesmgr.SetLabel(uuid, name, c.String("value"))
+	}
+	labels, err := nodesmgr.GetLabels(uuid)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Name",
+		"Value",
+	})
+	if len(labels) > 0 {
+		data := [][]string{}
+		fmt.Printf("Existing labels (%d):\n", len(labels))
+		for n, v := range labels {
+			data = append(data, []string{n, v})
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No labels\n")
+	}
+	return nil
+}
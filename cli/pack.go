@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/jmpsec/osctrl/packs"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+// Helper to get the type and value for a pack target from flags
+func packTarget(c *cli.Context) (string, string) {
+	env := c.String("environment")
+	tag := c.String("tag")
+	if (env == "" && tag == "") || (env != "" && tag != "") {
+		fmt.Println("Either environment or tag is required")
+		os.Exit(1)
+	}
+	if env != "" {
+		if !envs.Exists(env) {
+			fmt.Printf("Environment %s does not exist\n", env)
+			os.Exit(1)
+		}
+		return packs.PackTargetEnvironment, env
+	}
+	if !tagsmgr.Exists(tag) {
+		fmt.Printf("Tag %s does not exist\n", tag)
+		os.Exit(1)
+	}
+	return packs.PackTargetTag, tag
+}
+
+// Helper to get the pack name from flags
+func packName(c *cli.Context) string {
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("Pack name is required")
+		os.Exit(1)
+	}
+	return name
+}
+
+func importPack(c *cli.Context) error {
+	// Get values from flags
+	name := packName(c)
+	file := c.String("file")
+	if file == "" {
+		fmt.Println("Pack file is required")
+		os.Exit(1)
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := packsmgr.Import(name, c.String("description"), content, c.Bool("replace")); err != nil {
+		return err
+	}
+	fmt.Printf("Pack %s imported\n", name)
+	return nil
+}
+
+func exportPack(c *cli.Context) error {
+	// Get values from flags
+	name := packName(c)
+	exported, err := packsmgr.Export(name)
+	if err != nil {
+		return err
+	}
+	file := c.String("file")
+	if file == "" {
+		fmt.Println(string(exported))
+		return nil
+	}
+	return ioutil.WriteFile(file, exported, 0644)
+}
+
+func deletePack(c *cli.Context) error {
+	// Get values from flags
+	name := packName(c)
+	return packsmgr.Delete(name)
+}
+
+func listPacks(c *cli.Context) error {
+	allPacks, err := packsmgr.All()
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Name",
+		"Description",
+		"Platform",
+		"Queries",
+		"Targets",
+	})
+	if len(allPacks) > 0 {
+		data := [][]string{}
+		for _, p := range allPacks {
+			queries, err := packsmgr.GetQueries(p.Name)
+			if err != nil {
+				return err
+			}
+			targets, err := packsmgr.GetTargets(p.Name)
+			if err != nil {
+				return err
+			}
+			_p := []string{
+				p.Name,
+				p.Description,
+				p.Platform,
+				strconv.Itoa(len(queries)),
+				strconv.Itoa(len(targets)),
+			}
+			data = append(data, _p)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No packs\n")
+	}
+	return nil
+}
+
+func showPack(c *cli.Context) error {
+	// Get values from flags
+	name := packName(c)
+	queries, err := packsmgr.GetQueries(name)
+	if err != nil {
+		return err
+	}
+	targets, err := packsmgr.GetTargets(name)
+	if err != nil {
+		return err
+	}
+	for _, t := range targets {
+		fmt.Printf("Assigned to %s %s\n", t.Type, t.Value)
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Name",
+		"Query",
+		"Interval",
+		"Platform",
+		"Snapshot",
+		"Removed",
+		"Shard",
+	})
+	if len(queries) > 0 {
+		data := [][]string{}
+		for _, q := range queries {
+			_q := []string{
+				q.Name,
+				q.Query,
+				strconv.Itoa(q.Interval),
+				q.Platform,
+				stringifyBool(q.Snapshot),
+				stringifyBool(q.Removed),
+				strconv.Itoa(q.Shard),
+			}
+			data = append(data, _q)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No queries in pack %s\n", name)
+	}
+	return nil
+}
+
+func assignPack(c *cli.Context) error {
+	// Get values from flags
+	name := packName(c)
+	targetType, targetValue := packTarget(c)
+	if err := packsmgr.AddTarget(name, targetType, targetValue); err != nil {
+		return err
+	}
+	fmt.Printf("Pack %s assigned to %s %s\n", name, targetType, targetValue)
+	return nil
+}
+
+func unassignPack(c *cli.Context) error {
+	// Get values from flags
+	name := packName(c)
+	targetType, targetValue := packTarget(c)
+	return packsmgr.RemoveTarget(name, targetType, targetValue)
+}
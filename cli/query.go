@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
 
+	"github.com/jmpsec/osctrl/logging"
+	"github.com/jmpsec/osctrl/queries"
+	"github.com/jmpsec/osctrl/utils"
 	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli"
 )
@@ -38,6 +46,7 @@ func listQueries(c *cli.Context) error {
 		"Errors",
 		"Active",
 		"Completed",
+		"Expired",
 		"Deleted",
 	})
 	if len(qs) > 0 {
@@ -53,6 +62,7 @@ func listQueries(c *cli.Context) error {
 				strconv.Itoa(q.Errors),
 				stringifyBool(q.Active),
 				stringifyBool(q.Completed),
+				stringifyBool(q.Expired),
 				stringifyBool(q.Deleted),
 			}
 			data = append(data, _q)
@@ -84,3 +94,326 @@ func deleteQuery(c *cli.Context) error {
 	}
 	return queriesmgr.Delete(name)
 }
+
+func exportQuery(c *cli.Context) error {
+	// Get values from flags
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("name is required")
+		os.Exit(1)
+	}
+	format := c.String("format")
+	if !logging.ValidExportFormat(format) {
+		return fmt.Errorf("invalid format %s, use %s, %s or %s", format, logging.ExportCSV, logging.ExportNDJSON, logging.ExportXLSX)
+	}
+	if _, err := queriesmgr.Get(name); err != nil {
+		return err
+	}
+	// Write to stdout unless a file is provided
+	out := os.Stdout
+	if file := c.String("file"); file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	return logging.ExportQueryResults(db, nodesmgr, name, format, out)
+}
+
+func listApprovals(c *cli.Context) error {
+	qs, err := queriesmgr.GetPending()
+	if err != nil {
+		return err
+	}
+	if len(qs) == 0 {
+		fmt.Printf("No queries pending approval\n")
+		return nil
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Name",
+		"Creator",
+		"Query",
+		"Type",
+		"Expected",
+		"Reason",
+	})
+	data := [][]string{}
+	fmt.Printf("Queries pending approval (%d):\n", len(qs))
+	for _, q := range qs {
+		approvals, err := queriesmgr.GetApprovals(q.Name)
+		if err != nil {
+			return err
+		}
+		// Reason from the latest approval request
+		reason := ""
+		for _, a := range approvals {
+			if a.Action == queries.ApprovalRequested {
+				reason = a.Comment
+			}
+		}
+		_q := []string{
+			q.Name,
+			q.Creator,
+			q.Query,
+			q.Type,
+			strconv.Itoa(q.Expected),
+			reason,
+		}
+		data = append(data, _q)
+	}
+	table.AppendBulk(data)
+	table.Render()
+	return nil
+}
+
+func approveQuery(c *cli.Context) error {
+	// Get values from flags
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("name is required")
+		os.Exit(1)
+	}
+	return queriesmgr.Approve(name, savedUser(c), c.String("comment"))
+}
+
+func rejectQuery(c *cli.Context) error {
+	// Get values from flags
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("name is required")
+		os.Exit(1)
+	}
+	return queriesmgr.Reject(name, savedUser(c), c.String("comment"))
+}
+
+func watchQuery(c *cli.Context) error {
+	// Get values from flags
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("name is required")
+		os.Exit(1)
+	}
+	if _, err := queriesmgr.Get(name); err != nil {
+		return err
+	}
+	if err := logging.StreamSupported(settingsmgr); err != nil {
+		return err
+	}
+	// Stop watching with Ctrl+C
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+	return logging.StreamQueryResults(ctx, db, queriesmgr, nodesmgr, name, 0, c.Duration("interval"), func(e logging.StreamEvent) error {
+		switch data := e.Data.(type) {
+		case logging.StreamResult:
+			fmt.Printf("%s %s (%s) status %d, %d row(s)\n", data.Created.Format("2006-01-02 15:04:05"), data.Hostname, data.UUID, data.Status, len(data.Rows))
+			for _, row := range data.Rows {
+				encoded, err := json.Marshal(row)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("  %s\n", encoded)
+			}
+		case logging.StreamError:
+			fmt.Printf("%s %s (%s) invalid results: %s\n", data.Created.Format("2006-01-02 15:04:05"), data.Hostname, data.UUID, data.Error)
+		case logging.StreamProgress:
+			if e.Event == logging.StreamEventDone {
+				fmt.Printf("Finished: %d/%d answered, %d error(s)\n", data.Answered, data.Expected, data.Errors)
+				return nil
+			}
+			fmt.Printf("Progress: %d/%d answered, %d error(s)\n", data.Answered, data.Expected, data.Errors)
+		}
+		return nil
+	})
+}
+
+func queryStats(c *cli.Context) error {
+	// Get values from flags
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("name is required")
+		os.Exit(1)
+	}
+	summary, err := queriesmgr.ExecutionSummary(name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Executions: %d, errors: %d, with stats: %d\n", summary.Executions, summary.Errors, summary.Reported)
+	if summary.Reported > 0 {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{
+			"",
+			"p50",
+			"p95",
+			"Max",
+		})
+		table.AppendBulk([][]string{
+			{"Runtime", utils.MillisecondsDuration(summary.WallTimeP50), utils.MillisecondsDuration(summary.WallTimeP95), utils.MillisecondsDuration(summary.WallTimeMax)},
+			{"Memory", utils.BytesSize(summary.MemoryP50), utils.BytesSize(summary.MemoryP95), utils.BytesSize(summary.MemoryMax)},
+		})
+		table.Render()
+		fmt.Printf("Average CPU: %s user, %s system\n", utils.MillisecondsDuration(summary.UserTimeAvg), utils.MillisecondsDuration(summary.SystemTimeAvg))
+	}
+	if len(summary.Messages) > 0 {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{
+			"Nodes",
+			"Error",
+		})
+		for _, m := range summary.Messages {
+			table.Append([]string{strconv.Itoa(m.Count), m.Message})
+		}
+		table.Render()
+	}
+	return nil
+}
+
+func listSchedules(c *cli.Context) error {
+	ss, err := queriesmgr.GetSchedules()
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Name",
+		"Creator",
+		"Query",
+		"Schedule",
+		"Runs",
+		"Last Run",
+		"Next Run",
+		"Paused",
+	})
+	if len(ss) > 0 {
+		data := [][]string{}
+		fmt.Printf("Existing scheduled queries (%d):\n", len(ss))
+		for _, s := range ss {
+			_s := []string{
+				s.Name,
+				s.Creator,
+				s.Query,
+				s.Schedule,
+				strconv.Itoa(s.Runs),
+				utils.PastFutureTimes(s.LastRun),
+				utils.PastFutureTimes(s.NextRun),
+				stringifyBool(s.Paused),
+			}
+			data = append(data, _s)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No scheduled queries\n")
+	}
+	return nil
+}
+
+func listScheduleRuns(c *cli.Context) error {
+	// Get values from flags
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("name is required")
+		os.Exit(1)
+	}
+	runs, err := queriesmgr.GetRuns(name)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Name",
+		"Created",
+		"Expected",
+		"Executions",
+		"Errors",
+		"Active",
+	})
+	if len(runs) > 0 {
+		data := [][]string{}
+		fmt.Printf("Runs of %s (%d):\n", name, len(runs))
+		for _, r := range runs {
+			_r := []string{
+				r.Name,
+				utils.PastFutureTimes(r.CreatedAt),
+				strconv.Itoa(r.Expected),
+				strconv.Itoa(r.Executions),
+				strconv.Itoa(r.Errors),
+				stringifyBool(r.Active),
+			}
+			data = append(data, _r)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No runs\n")
+	}
+	return nil
+}
+
+func pauseSchedule(c *cli.Context) error {
+	// Get values from flags
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("name is required")
+		os.Exit(1)
+	}
+	return queriesmgr.PauseSchedule(name)
+}
+
+func resumeSchedule(c *cli.Context) error {
+	// Get values from flags
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("name is required")
+		os.Exit(1)
+	}
+	return queriesmgr.ResumeSchedule(name)
+}
+
+func lintQuery(c *cli.Context) error {
+	// Get values from flags
+	query := c.String("query")
+	if file := c.String("file"); file != "" {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		query = string(content)
+	}
+	if query == "" {
+		fmt.Println("Query or file with query is required")
+		os.Exit(1)
+	}
+	var schema []queries.TableSchema
+	if c.String("tables") != "" {
+		var err error
+		if schema, err = queries.LoadSchema(c.String("tables")); err != nil {
+			return err
+		}
+	}
+	var platforms []string
+	if c.String("platforms") != "" {
+		platforms = strings.Split(c.String("platforms"), ",")
+	}
+	lint := queries.Lint(query, schema, platforms)
+	for _, e := range lint.Errors {
+		fmt.Printf("ERROR: %s\n", e)
+	}
+	for _, w := range lint.Warnings {
+		fmt.Printf("WARNING: %s\n", w)
+	}
+	if !lint.Valid {
+		return fmt.Errorf("query is not valid")
+	}
+	fmt.Println("Query is valid")
+	return nil
+}
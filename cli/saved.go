@@ -0,0 +1,402 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jmpsec/osctrl/queries"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+// Helper to get the saved query name from flags
+func savedName(c *cli.Context) string {
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("Saved query name is required")
+		os.Exit(1)
+	}
+	return name
+}
+
+// Helper to get an existing user from flags, saved queries and their runs belong to users
+func savedUser(c *cli.Context) string {
+	user := c.String("user")
+	if user == "" {
+		fmt.Println("User is required")
+		os.Exit(1)
+	}
+	if !adminUsers.Exists(user) {
+		fmt.Printf("User %s does not exist\n", user)
+		os.Exit(1)
+	}
+	return user
+}
+
+// Helper to parse parameters defined as name:type[:default[:description]]
+func parseSavedParameters(defs []string) ([]queries.SavedQueryParameter, error) {
+	var params []queries.SavedQueryParameter
+	for _, d := range defs {
+		parts := strings.SplitN(d, ":", 4)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid parameter %q, expected name:type[:default[:description]]", d)
+		}
+		p := queries.SavedQueryParameter{Name: parts[0], Type: parts[1]}
+		if len(parts) > 2 {
+			p.Default = parts[2]
+		}
+		if len(parts) > 3 {
+			p.Description = parts[3]
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// Helper to parse parameter values provided as name=value
+func parseSavedValues(values []string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid parameter value %q, expected name=value", v)
+		}
+		parsed[parts[0]] = parts[1]
+	}
+	return parsed, nil
+}
+
+// Helper to split comma separated values from flags
+func splitFlag(c *cli.Context, name string) []string {
+	var values []string
+	for _, v := range strings.Split(c.String(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func listSaved(c *cli.Context) error {
+	saved, err := queriesmgr.GetAllSaved("", true)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Name",
+		"Description",
+		"Tags",
+		"Owner",
+		"Shared",
+		"Version",
+	})
+	if len(saved) > 0 {
+		data := [][]string{}
+		fmt.Printf("Existing saved queries (%d):\n", len(saved))
+		for _, s := range saved {
+			_s := []string{
+				s.Name,
+				s.Description,
+				s.Tags,
+				s.Owner,
+				stringifyBool(s.Shared),
+				strconv.Itoa(s.Version),
+			}
+			data = append(data, _s)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No saved queries\n")
+	}
+	return nil
+}
+
+func showSaved(c *cli.Context) error {
+	// Get values from flags
+	name := savedName(c)
+	saved, err := queriesmgr.GetSaved(name)
+	if err != nil {
+		return err
+	}
+	params, err := queriesmgr.GetSavedParameters(name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Name: %s\n", saved.Name)
+	fmt.Printf("Description: %s\n", saved.Description)
+	fmt.Printf("Tags: %s\n", saved.Tags)
+	fmt.Printf("Owner: %s (shared: %s)\n", saved.Owner, stringifyBool(saved.Shared))
+	fmt.Printf("Version: %d\n", saved.Version)
+	fmt.Printf("Query: %s\n", saved.Query)
+	if len(params) > 0 {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{
+			"Parameter",
+			"Type",
+			"Default",
+			"Description",
+		})
+		for _, p := range params {
+			table.Append([]string{p.Name, p.Type, p.Default, p.Description})
+		}
+		table.Render()
+	}
+	return nil
+}
+
+func addSaved(c *cli.Context) error {
+	// Get values from flags
+	name := savedName(c)
+	user := savedUser(c)
+	query := c.String("query")
+	if file := c.String("file"); file != "" {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		query = string(content)
+	}
+	if query == "" {
+		fmt.Println("Query or file is required")
+		os.Exit(1)
+	}
+	params, err := parseSavedParameters(c.StringSlice("parameter"))
+	if err != nil {
+		return err
+	}
+	if queriesmgr.ExistsSaved(name) {
+		existing, err := queriesmgr.GetSaved(name)
+		if err != nil {
+			return err
+		}
+		if !queries.CanEditSaved(existing, user, adminUsers.IsAdmin(user)) {
+			return fmt.Errorf("%s can not change saved query %s", user, name)
+		}
+	}
+	saved := queries.SavedQuery{
+		Name:        name,
+		Description: c.String("description"),
+		Query:       query,
+		Tags:        strings.Join(splitFlag(c, "tags"), ","),
+		Owner:       user,
+		Shared:      c.Bool("shared"),
+	}
+	if err := queriesmgr.SaveQuery(saved, params, user); err != nil {
+		return err
+	}
+	fmt.Printf("Saved query %s stored\n", name)
+	return nil
+}
+
+func deleteSaved(c *cli.Context) error {
+	// Get values from flags
+	name := savedName(c)
+	return queriesmgr.DeleteSaved(name)
+}
+
+func historySaved(c *cli.Context) error {
+	// Get values from flags
+	name := savedName(c)
+	versions, err := queriesmgr.GetSavedVersions(name)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Version",
+		"Author",
+		"Created",
+		"Query",
+	})
+	if len(versions) > 0 {
+		data := [][]string{}
+		fmt.Printf("Versions of %s (%d):\n", name, len(versions))
+		for _, v := range versions {
+			_v := []string{
+				strconv.Itoa(v.Version),
+				v.Author,
+				v.CreatedAt.Format("2006-01-02 15:04:05"),
+				v.Query,
+			}
+			data = append(data, _v)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No versions\n")
+	}
+	return nil
+}
+
+func restoreSaved(c *cli.Context) error {
+	// Get values from flags
+	name := savedName(c)
+	user := savedUser(c)
+	version := c.Int("version")
+	if version <= 0 {
+		fmt.Println("Version is required")
+		os.Exit(1)
+	}
+	if err := queriesmgr.RestoreSaved(name, version, user); err != nil {
+		return err
+	}
+	fmt.Printf("Saved query %s restored to version %d\n", name, version)
+	return nil
+}
+
+func importSaved(c *cli.Context) error {
+	// Get values from flags
+	user := savedUser(c)
+	pack := c.String("pack")
+	file := c.String("file")
+	if file == "" {
+		fmt.Println("Pack file is required")
+		os.Exit(1)
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	imported, err := queriesmgr.ImportPack(pack, content, user, c.Bool("shared"), c.Bool("replace"))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d saved queries\n", len(imported))
+	return nil
+}
+
+func runSaved(c *cli.Context) error {
+	// Get values from flags
+	name := savedName(c)
+	user := savedUser(c)
+	saved, err := queriesmgr.GetSaved(name)
+	if err != nil {
+		return err
+	}
+	if !queries.CanAccessSaved(saved, user, adminUsers.IsAdmin(user)) {
+		return fmt.Errorf("%s can not run saved query %s", user, name)
+	}
+	values, err := parseSavedValues(c.StringSlice("param"))
+	if err != nil {
+		return err
+	}
+	query, err := queriesmgr.RenderSaved(name, values)
+	if err != nil {
+		return err
+	}
+	// Check query against the osquery schema, warnings do not stop the query
+	var schema []queries.TableSchema
+	if c.String("tables") != "" {
+		if schema, err = queries.LoadSchema(c.String("tables")); err != nil {
+			return err
+		}
+	}
+	if err := lintLaunch("query", query, schema, splitFlag(c, "platform")); err != nil {
+		return err
+	}
+	if err := lintLaunch("discovery query", c.String("discovery"), schema, splitFlag(c, "platform")); err != nil {
+		return err
+	}
+	// Targets by environment, platform and UUID, plus the ones matched against node attributes
+	var targets []queries.DistributedQueryTarget
+	for _, e := range splitFlag(c, "environment") {
+		if !envs.Exists(e) {
+			return fmt.Errorf("environment %s does not exist", e)
+		}
+		targets = append(targets, queries.DistributedQueryTarget{Type: queries.QueryTargetEnvironment, Value: e})
+	}
+	for _, p := range splitFlag(c, "platform") {
+		targets = append(targets, queries.DistributedQueryTarget{Type: queries.QueryTargetPlatform, Value: p})
+	}
+	for _, u := range splitFlag(c, "uuid") {
+		targets = append(targets, queries.DistributedQueryTarget{Type: queries.QueryTargetUUID, Value: u})
+	}
+	matchTargets, err := queries.BuildTargets(splitFlag(c, "tag"), splitFlag(c, "hostname"), nil, "", "", c.String("expression"))
+	if err != nil {
+		return err
+	}
+	targets = append(targets, matchTargets...)
+	if len(targets) == 0 {
+		fmt.Println("At least one target is required")
+		os.Exit(1)
+	}
+	newQuery := queries.DistributedQuery{
+		Query:      query,
+		Name:       generateQueryName(),
+		Creator:    user,
+		Active:     true,
+		Type:       queries.StandardQueryType,
+		SavedQuery: name,
+		Discovery:  c.String("discovery"),
+		Expiration: queries.ExpirationTime(queries.QueryExpirationHours(c.Int64("expiration"), settingsmgr.QueryExpiration())),
+	}
+	// Queries stay pending until the approval policy is checked against the targeted nodes
+	policy := queries.NewApprovalPolicy(settingsmgr.ApprovalCarves(), settingsmgr.ApprovalNodes(), settingsmgr.ApprovalEnvironments())
+	if policy.Enabled() {
+		newQuery.Approval = queries.ApprovalPending
+	}
+	if err := queriesmgr.Create(newQuery); err != nil {
+		return err
+	}
+	for _, t := range targets {
+		if err := queriesmgr.CreateTarget(newQuery.Name, t.Type, t.Value); err != nil {
+			return err
+		}
+	}
+	active, err := nodesmgr.Gets("active", settingsmgr.InactiveHours())
+	if err != nil {
+		return err
+	}
+	matched, err := queriesmgr.MatchingNodes(targets, active)
+	if err != nil {
+		return err
+	}
+	if err := queriesmgr.SetExpected(newQuery.Name, len(matched)); err != nil {
+		return err
+	}
+	if err := queriesmgr.InitStatuses(newQuery.Name, nodesmgr, settingsmgr.InactiveHours()); err != nil {
+		return err
+	}
+	if policy.Enabled() {
+		pending, reason, err := queriesmgr.CheckApproval(newQuery.Name, policy, nodesmgr, settingsmgr.InactiveHours())
+		if err != nil {
+			return err
+		}
+		if pending {
+			if url := settingsmgr.ApprovalWebhook(); url != "" {
+				pendingQuery, err := queriesmgr.Get(newQuery.Name)
+				if err != nil {
+					return err
+				}
+				if err := queries.NotifyApproval(url, pendingQuery, reason); err != nil {
+					fmt.Printf("Error notifying approval - %v\n", err)
+				}
+			}
+			fmt.Printf("Query %s for %d node(s) pending approval: %s\n", newQuery.Name, len(matched), reason)
+			return nil
+		}
+	}
+	fmt.Printf("Query %s launched for %d node(s)\n", newQuery.Name, len(matched))
+	return nil
+}
+
+// Helper to check a query to be launched against the osquery schema, printing warnings and
+// returning the errors. Empty queries are not checked
+func lintLaunch(label, query string, schema []queries.TableSchema, platforms []string) error {
+	if query == "" {
+		return nil
+	}
+	lint := queries.Lint(query, schema, platforms)
+	for _, w := range lint.Warnings {
+		fmt.Printf("WARNING: %s - %s\n", label, w)
+	}
+	if !lint.Valid {
+		return fmt.Errorf("invalid %s: %s", label, strings.Join(lint.Errors, ", "))
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"unicode/utf8"
 )
 
@@ -30,3 +34,17 @@ func stringifyBool(b bool) string {
 	}
 	return "False"
 }
+
+// Helper to generate a random query name
+func generateQueryName() string {
+	return "query_" + randomForNames()
+}
+
+// Helper to generate a random MD5 to be used with queries
+func randomForNames() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	hasher := md5.New()
+	_, _ = hasher.Write([]byte(fmt.Sprintf("%x", b)))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
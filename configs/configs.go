@@ -0,0 +1,234 @@
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/environments"
+	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/packs"
+	"github.com/jmpsec/osctrl/tags"
+	"github.com/jmpsec/osctrl/utils"
+)
+
+// ConfigOverlay to hold a partial configuration merged on top of the environment configuration
+type ConfigOverlay struct {
+	gorm.Model
+	Name          string `gorm:"index"`
+	Environment   string `gorm:"index"`
+	Scope         string
+	Target        string
+	Priority      int
+	Configuration string `gorm:"type:text"`
+}
+
+// EffectiveConfig to hold the composed configuration for a node and where it came from
+type EffectiveConfig struct {
+	Configuration string   `json:"configuration"`
+	Sources       []string `json:"sources"`
+}
+
+// Configs to compose osquery configurations for nodes
+type Configs struct {
+	DB    *gorm.DB
+	Envs  *environments.Environment
+	Nodes *nodes.NodeManager
+	Packs *packs.Packs
+	Tags  *tags.TagManager
+	cache *utils.BoundedCache
+	// Last configuration composed for each node, served if composing fails later
+	lastGood *utils.BoundedCache
+}
+
+// CreateConfigs to initialize the configs struct and tables
+func CreateConfigs(backend *gorm.DB, envs *environments.Environment, nodesmgr *nodes.NodeManager, packsmgr *packs.Packs, tagsmgr *tags.TagManager) *Configs {
+	var c *Configs
+	c = &Configs{DB: backend, Envs: envs, Nodes: nodesmgr, Packs: packsmgr, Tags: tagsmgr, cache: utils.NewBoundedCache(renderCacheSize), lastGood: utils.NewBoundedCache(renderCacheSize)}
+	// table config_overlays
+	if err := backend.AutoMigrate(ConfigOverlay{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (config_overlays): %v", err)
+	}
+	// table node_config_states
+	if err := backend.AutoMigrate(NodeConfigState{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (node_config_states): %v", err)
+	}
+	return c
+}
+
+// GetOverlay to retrieve an overlay by environment and name
+func (c *Configs) GetOverlay(environment, name string) (ConfigOverlay, error) {
+	var overlay ConfigOverlay
+	if err := c.DB.Where("environment = ? AND name = ?", environment, name).First(&overlay).Error; err != nil {
+		return overlay, err
+	}
+	return overlay, nil
+}
+
+// GetOverlays to retrieve all overlays for an environment
+func (c *Configs) GetOverlays(environment string) ([]ConfigOverlay, error) {
+	var overlays []ConfigOverlay
+	if err := c.DB.Where("environment = ?", environment).Order("scope, priority, name").Find(&overlays).Error; err != nil {
+		return overlays, err
+	}
+	return overlays, nil
+}
+
+// CreateOverlay to create a new overlay
+func (c *Configs) CreateOverlay(overlay ConfigOverlay) error {
+	if !ValidOverlayScope(overlay.Scope) {
+		return fmt.Errorf("invalid overlay scope %s", overlay.Scope)
+	}
+	if overlay.Name == "" || overlay.Target == "" {
+		return fmt.Errorf("overlay name and target can not be empty")
+	}
+	if _, err := parseObject(overlay.Configuration); err != nil {
+		return err
+	}
+	if _, err := c.GetOverlay(overlay.Environment, overlay.Name); err == nil {
+		return fmt.Errorf("overlay %s already exists", overlay.Name)
+	}
+	if c.DB.NewRecord(overlay) {
+		if err := c.DB.Create(&overlay).Error; err != nil {
+			return fmt.Errorf("Create ConfigOverlay %v", err)
+		}
+	} else {
+		return fmt.Errorf("db.NewRecord did not return true")
+	}
+	return nil
+}
+
+// UpdateOverlay to update the configuration and priority of an overlay
+func (c *Configs) UpdateOverlay(environment, name, configuration string, priority int) error {
+	if _, err := parseObject(configuration); err != nil {
+		return err
+	}
+	overlay, err := c.GetOverlay(environment, name)
+	if err != nil {
+		return fmt.Errorf("error getting overlay %v", err)
+	}
+	updates := map[string]interface{}{
+		"configuration": configuration,
+		"priority":      priority,
+	}
+	if err := c.DB.Model(&overlay).Updates(updates).Error; err != nil {
+		return fmt.Errorf("Updates %v", err)
+	}
+	return nil
+}
+
+// DeleteOverlay to delete an overlay by environment and name
+func (c *Configs) DeleteOverlay(environment, name string) error {
+	overlay, err := c.GetOverlay(environment, name)
+	if err != nil {
+		return fmt.Errorf("error getting overlay %v", err)
+	}
+	if err := c.DB.Unscoped().Delete(&overlay).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// Effective to compose the configuration for a node: the environment configuration,
+// then the packs assigned to the environment or node tags and then the overlays that match the node
+func (c *Configs) Effective(node nodes.OsqueryNode) (EffectiveConfig, error) {
+	var effective EffectiveConfig
+	env, err := c.Envs.Get(node.Environment)
+	if err != nil {
+		return effective, fmt.Errorf("error getting environment %v", err)
+	}
+	effective.Sources = append(effective.Sources, "environment:"+env.Name)
+	overlays, err := c.GetOverlays(env.Name)
+	if err != nil {
+		return effective, fmt.Errorf("error getting overlays %v", err)
+	}
+	var tagNames []string
+	nodeTags, err := c.Tags.GetTags(node)
+	if err != nil {
+		return effective, fmt.Errorf("error getting tags %v", err)
+	}
+	for _, t := range nodeTags {
+		tagNames = append(tagNames, t.Name)
+	}
+	// The environment configuration is rendered as a template for the node
+	configuration := env.Configuration
+	if IsTemplate(configuration) {
+		labels, err := c.Nodes.GetLabels(node.UUID)
+		if err != nil {
+			return effective, fmt.Errorf("error getting labels %v", err)
+		}
+		if configuration, err = c.Render(configuration, NewNodeTemplateData(node, tagNames, labels)); err != nil {
+			return effective, err
+		}
+		effective.Sources = append(effective.Sources, "template:"+env.Name)
+	}
+	// Rendered templates must be valid JSON before they are served or composed
+	var composed interface{}
+	if composed, err = parseObject(configuration); err != nil {
+		return effective, err
+	}
+	effective.Configuration = configuration
+	nodePacks, err := c.Packs.GetForNode(env.Name, tagNames)
+	if err != nil {
+		return effective, fmt.Errorf("error getting packs %v", err)
+	}
+	matched := MatchOverlays(overlays, node.Platform, node.UUID, tagNames)
+	// Nothing to compose, serve the environment configuration as is
+	if len(nodePacks) == 0 && len(matched) == 0 {
+		c.keepGood(node.UUID, effective.Configuration)
+		return effective, nil
+	}
+	for _, p := range nodePacks {
+		exported, err := c.Packs.Export(p.Name)
+		if err != nil {
+			return effective, fmt.Errorf("pack %s - %v", p.Name, err)
+		}
+		// Packs are merged as plain objects, so overlays can still patch them
+		content, err := parseObject(string(exported))
+		if err != nil {
+			return effective, fmt.Errorf("pack %s - %v", p.Name, err)
+		}
+		patch := map[string]interface{}{
+			"packs": map[string]interface{}{
+				p.Name: content,
+			},
+		}
+		composed = MergePatch(composed, patch)
+		effective.Sources = append(effective.Sources, "pack:"+p.Name)
+	}
+	for _, o := range matched {
+		patch, err := parseObject(o.Configuration)
+		if err != nil {
+			return effective, fmt.Errorf("overlay %s - %v", o.Name, err)
+		}
+		composed = MergePatch(composed, patch)
+		effective.Sources = append(effective.Sources, fmt.Sprintf("overlay:%s:%s:%s", o.Scope, o.Target, o.Name))
+	}
+	result, err := json.Marshal(composed)
+	if err != nil {
+		return effective, fmt.Errorf("error serializing configuration %v", err)
+	}
+	effective.Configuration = string(result)
+	c.keepGood(node.UUID, effective.Configuration)
+	return effective, nil
+}
+
+// Helper to keep the last configuration composed for a node
+func (c *Configs) keepGood(uuid, configuration string) {
+	if c.lastGood != nil {
+		c.lastGood.Set(uuid, configuration)
+	}
+}
+
+// LastGood to get the last configuration composed for a node, to serve when composing fails
+func (c *Configs) LastGood(uuid string) (string, bool) {
+	if c.lastGood == nil {
+		return "", false
+	}
+	configuration, ok := c.lastGood.Get(uuid)
+	if !ok {
+		return "", false
+	}
+	return configuration.(string), true
+}
@@ -0,0 +1,235 @@
+package configs
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/nodes"
+)
+
+const (
+	// DriftInSync when the reported hash matches the expected configuration
+	DriftInSync string = "in-sync"
+	// DriftPending when the hash does not match yet but the grace period has not passed
+	DriftPending string = "pending"
+	// DriftOutOfSync when the hash does not match after the grace period
+	DriftOutOfSync string = "out-of-sync"
+	// DriftUnknown when the node has not reported any hash
+	DriftUnknown string = "unknown"
+)
+
+// NodeConfigState to keep track of the configuration hash served to a node and since when
+type NodeConfigState struct {
+	gorm.Model
+	UUID          string `gorm:"index"`
+	Environment   string `gorm:"index"`
+	ExpectedHash  string
+	ExpectedSince time.Time
+}
+
+// NodeDrift to report the configuration sync status of a node
+type NodeDrift struct {
+	UUID          string    `json:"uuid"`
+	Hostname      string    `json:"hostname"`
+	Environment   string    `json:"environment"`
+	Platform      string    `json:"platform"`
+	ReportedHash  string    `json:"reported_hash"`
+	ExpectedHash  string    `json:"expected_hash"`
+	ExpectedSince time.Time `json:"expected_since"`
+	LastConfig    time.Time `json:"last_config"`
+	Status        string    `json:"status"`
+}
+
+// ValidDriftStatus to check if a drift status is valid
+func ValidDriftStatus(status string) bool {
+	switch status {
+	case DriftInSync, DriftPending, DriftOutOfSync, DriftUnknown:
+		return true
+	}
+	return false
+}
+
+// ConfigHash to calculate the config_hash osquery reports for a configuration blob
+// https://github.com/facebook/osquery/blob/master/osquery/config/config.cpp#L911
+// osquery calculates the SHA1 of the configuration blob, then the SHA1 hash of that
+func ConfigHash(config string) string {
+	firstHasher := sha1.New()
+	secondHasher := sha1.New()
+	// Get SHA1 of configuration blob
+	_, _ = firstHasher.Write([]byte(config))
+	// Get SHA1 of the first hash
+	_, _ = secondHasher.Write([]byte(hex.EncodeToString(firstHasher.Sum(nil))))
+	return hex.EncodeToString(secondHasher.Sum(nil))
+}
+
+// DriftStatus to decide the sync status of a node from the reported and expected hashes
+func DriftStatus(reported, expected string, since, now time.Time, grace time.Duration) string {
+	if reported == expected {
+		return DriftInSync
+	}
+	if now.Sub(since) < grace {
+		return DriftPending
+	}
+	if reported == "" {
+		return DriftUnknown
+	}
+	return DriftOutOfSync
+}
+
+// TrackServed to record the hash of the configuration served to a node, with the time it was
+// first served. Nothing is written if the node already got the same configuration
+func (c *Configs) TrackServed(node nodes.OsqueryNode, configuration string) error {
+	served := ConfigHash(configuration)
+	var state NodeConfigState
+	err := c.DB.Where("uuid = ?", node.UUID).First(&state).Error
+	if err != nil {
+		if !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+		state = NodeConfigState{
+			UUID:          node.UUID,
+			Environment:   node.Environment,
+			ExpectedHash:  served,
+			ExpectedSince: time.Now(),
+		}
+		if err := c.DB.Create(&state).Error; err != nil {
+			return fmt.Errorf("Create NodeConfigState %v", err)
+		}
+		return nil
+	}
+	if state.ExpectedHash == served && state.Environment == node.Environment {
+		return nil
+	}
+	updates := map[string]interface{}{
+		"expected_hash":  served,
+		"expected_since": time.Now(),
+		"environment":    node.Environment,
+	}
+	if err := c.DB.Model(&state).Updates(updates).Error; err != nil {
+		return fmt.Errorf("Updates NodeConfigState %v", err)
+	}
+	return nil
+}
+
+// Drift to compare the hash reported by a node with the hash of its effective configuration. The
+// grace period starts when that configuration was served, or at the last configuration request of
+// nodes that did not get it yet. Nothing is written, states are recorded when serving configurations
+func (c *Configs) Drift(node nodes.OsqueryNode, grace time.Duration) (NodeDrift, error) {
+	effective, err := c.Effective(node)
+	if err != nil {
+		return NodeDrift{}, err
+	}
+	var state NodeConfigState
+	if err := c.DB.Where("uuid = ?", node.UUID).First(&state).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return NodeDrift{}, err
+	}
+	return nodeDrift(node, ConfigHash(effective.Configuration), state, grace), nil
+}
+
+// Helper to get the drift of a node with the expected hash and the recorded state
+func nodeDrift(node nodes.OsqueryNode, expected string, state NodeConfigState, grace time.Duration) NodeDrift {
+	drift := NodeDrift{
+		UUID:          node.UUID,
+		Hostname:      node.Hostname,
+		Environment:   node.Environment,
+		Platform:      node.Platform,
+		ReportedHash:  node.ConfigHash,
+		ExpectedHash:  expected,
+		ExpectedSince: node.LastConfig,
+		LastConfig:    node.LastConfig,
+	}
+	if state.ExpectedHash == drift.ExpectedHash {
+		drift.ExpectedSince = state.ExpectedSince
+	}
+	drift.Status = DriftStatus(drift.ReportedHash, drift.ExpectedHash, drift.ExpectedSince, time.Now(), grace)
+	return drift
+}
+
+// Helper to get the key of the nodes that get the same effective configuration, the environment,
+// platform and tags. Nodes with templates or overlays for their UUID get their own configuration,
+// and the key is empty. Environments are kept in perNode, true when their nodes are not grouped
+func (c *Configs) driftGroup(node nodes.OsqueryNode, perNode map[string]bool, overlays map[string][]ConfigOverlay) (string, error) {
+	if _, ok := perNode[node.Environment]; !ok {
+		env, err := c.Envs.Get(node.Environment)
+		if err != nil {
+			return "", fmt.Errorf("error getting environment %v", err)
+		}
+		if overlays[node.Environment], err = c.GetOverlays(node.Environment); err != nil {
+			return "", fmt.Errorf("error getting overlays %v", err)
+		}
+		perNode[node.Environment] = IsTemplate(env.Configuration)
+	}
+	if perNode[node.Environment] {
+		return "", nil
+	}
+	for _, o := range overlays[node.Environment] {
+		if o.Scope == OverlayUUID && o.Target == node.UUID {
+			return "", nil
+		}
+	}
+	nodeTags, err := c.Tags.GetTags(node)
+	if err != nil {
+		return "", fmt.Errorf("error getting tags %v", err)
+	}
+	var tagNames []string
+	for _, t := range nodeTags {
+		tagNames = append(tagNames, t.Name)
+	}
+	sort.Strings(tagNames)
+	key, err := json.Marshal(append([]string{node.Environment, node.Platform}, tagNames...))
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
+// DriftNodes to get the drift status of multiple nodes, optionally filtered by status. The
+// expected configuration is composed once for the nodes that get the same configuration
+func (c *Configs) DriftNodes(nodeList []nodes.OsqueryNode, grace time.Duration, status string) ([]NodeDrift, error) {
+	var drifts []NodeDrift
+	var uuids []string
+	for _, n := range nodeList {
+		uuids = append(uuids, n.UUID)
+	}
+	var stored []NodeConfigState
+	if len(uuids) > 0 {
+		if err := c.DB.Where("uuid IN (?)", uuids).Find(&stored).Error; err != nil {
+			return drifts, err
+		}
+	}
+	states := make(map[string]NodeConfigState)
+	for _, s := range stored {
+		states[s.UUID] = s
+	}
+	perNode := make(map[string]bool)
+	overlays := make(map[string][]ConfigOverlay)
+	expected := make(map[string]string)
+	for _, n := range nodeList {
+		key, err := c.driftGroup(n, perNode, overlays)
+		if err != nil {
+			return drifts, fmt.Errorf("node %s - %v", n.UUID, err)
+		}
+		hash, ok := expected[key]
+		if key == "" || !ok {
+			effective, err := c.Effective(n)
+			if err != nil {
+				return drifts, fmt.Errorf("node %s - %v", n.UUID, err)
+			}
+			hash = ConfigHash(effective.Configuration)
+			if key != "" {
+				expected[key] = hash
+			}
+		}
+		d := nodeDrift(n, hash, states[n.UUID], grace)
+		if status != "" && d.Status != status {
+			continue
+		}
+		drifts = append(drifts, d)
+	}
+	return drifts, nil
+}
@@ -0,0 +1,87 @@
+package configs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/jmpsec/osctrl/environments"
+	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/packs"
+	"github.com/jmpsec/osctrl/tags"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigHash(t *testing.T) {
+	// sha1(sha1("{}")) with the inner hash hex encoded
+	assert.Equal(t, "f80dee827635db39077a458243379b3ad63311fd", ConfigHash("{}"))
+	assert.NotEqual(t, ConfigHash("{}"), ConfigHash("{ }"))
+}
+
+func TestDriftStatus(t *testing.T) {
+	now := time.Now()
+	grace := 10 * time.Minute
+	assert.Equal(t, DriftInSync, DriftStatus("aaa", "aaa", now.Add(-time.Hour), now, grace))
+	assert.Equal(t, DriftPending, DriftStatus("bbb", "aaa", now.Add(-time.Minute), now, grace))
+	assert.Equal(t, DriftOutOfSync, DriftStatus("bbb", "aaa", now.Add(-time.Hour), now, grace))
+	assert.Equal(t, DriftUnknown, DriftStatus("", "aaa", now.Add(-time.Hour), now, grace))
+}
+
+func TestTrackServed(t *testing.T) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.DB().SetMaxOpenConns(1)
+	assert.NoError(t, db.AutoMigrate(NodeConfigState{}).Error)
+	c := &Configs{DB: db}
+	node := nodes.OsqueryNode{UUID: "AAAA", Environment: "dev"}
+	assert.NoError(t, c.TrackServed(node, "{}"))
+	var first NodeConfigState
+	assert.NoError(t, db.Where("uuid = ?", "AAAA").First(&first).Error)
+	assert.Equal(t, ConfigHash("{}"), first.ExpectedHash)
+	// Serving the same configuration again keeps the time it was first served
+	assert.NoError(t, c.TrackServed(node, "{}"))
+	var same NodeConfigState
+	assert.NoError(t, db.Where("uuid = ?", "AAAA").First(&same).Error)
+	assert.True(t, same.ExpectedSince.Equal(first.ExpectedSince))
+	assert.NoError(t, c.TrackServed(node, `{"options": {}}`))
+	var changed NodeConfigState
+	assert.NoError(t, db.Where("uuid = ?", "AAAA").First(&changed).Error)
+	assert.Equal(t, ConfigHash(`{"options": {}}`), changed.ExpectedHash)
+	assert.False(t, changed.ExpectedSince.Before(first.ExpectedSince))
+	var count int
+	db.Model(&NodeConfigState{}).Count(&count)
+	assert.Equal(t, 1, count)
+}
+
+func TestDriftNodes(t *testing.T) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.DB().SetMaxOpenConns(1)
+	envs := environments.CreateEnvironment(db)
+	assert.NoError(t, envs.Create(envs.Empty("dev", "osctrl.example.com")))
+	assert.NoError(t, envs.UpdateConfiguration("dev", `{"options": {"verbose": false}}`))
+	c := CreateConfigs(db, envs, nodes.CreateNodes(db), packs.CreatePacks(db), tags.CreateTagManager(db))
+	assert.NoError(t, c.CreateOverlay(ConfigOverlay{Name: "debug", Environment: "dev", Scope: OverlayUUID, Target: "BBBB", Configuration: `{"options": {"verbose": true}}`}))
+	nodeList := []nodes.OsqueryNode{
+		{UUID: "AAAA", Environment: "dev", Platform: "ubuntu"},
+		{UUID: "BBBB", Environment: "dev", Platform: "ubuntu"},
+		{UUID: "CCCC", Environment: "dev", Platform: "ubuntu"},
+	}
+	effective, err := c.Effective(nodeList[0])
+	assert.NoError(t, err)
+	nodeList[0].ConfigHash = ConfigHash(effective.Configuration)
+	drifts, err := c.DriftNodes(nodeList, time.Minute, "")
+	assert.NoError(t, err)
+	assert.Len(t, drifts, 3)
+	assert.Equal(t, DriftInSync, drifts[0].Status)
+	assert.Equal(t, drifts[0].ExpectedHash, drifts[2].ExpectedHash)
+	assert.NotEqual(t, drifts[0].ExpectedHash, drifts[1].ExpectedHash)
+	for _, n := range nodeList {
+		d, err := c.Drift(n, time.Minute)
+		assert.NoError(t, err)
+		assert.Contains(t, drifts, d)
+	}
+}
@@ -0,0 +1,24 @@
+module github.com/jmpsec/osctrl/configs
+
+go 1.14
+
+require (
+	github.com/jinzhu/gorm v1.9.8
+	github.com/jmpsec/osctrl/environments v0.2.2
+	github.com/jmpsec/osctrl/nodes v0.2.2
+	github.com/jmpsec/osctrl/packs v0.2.2
+	github.com/jmpsec/osctrl/tags v0.2.2
+	github.com/jmpsec/osctrl/utils v0.2.2
+	github.com/mattn/go-sqlite3 v2.0.1+incompatible // indirect
+	github.com/stretchr/testify v1.5.1
+)
+
+replace github.com/jmpsec/osctrl/environments => ../environments
+
+replace github.com/jmpsec/osctrl/nodes => ../nodes
+
+replace github.com/jmpsec/osctrl/packs => ../packs
+
+replace github.com/jmpsec/osctrl/tags => ../tags
+
+replace github.com/jmpsec/osctrl/utils => ../utils
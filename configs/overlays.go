@@ -0,0 +1,110 @@
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const (
+	// OverlayPlatform for overlays applied to nodes by platform
+	OverlayPlatform string = "platform"
+	// OverlayTag for overlays applied to tagged nodes
+	OverlayTag string = "tag"
+	// OverlayUUID for overlays applied to a single node
+	OverlayUUID string = "uuid"
+	// PlatformLinux to match all platforms that are not darwin, windows or freebsd
+	PlatformLinux string = "linux"
+)
+
+// Overlays are applied in this order, so the most specific one wins
+var overlayPrecedence = map[string]int{
+	OverlayPlatform: 1,
+	OverlayTag:      2,
+	OverlayUUID:     3,
+}
+
+// Platforms that can not be matched by the linux overlay
+var nonLinuxPlatforms = map[string]bool{
+	"darwin":  true,
+	"windows": true,
+	"freebsd": true,
+}
+
+// ValidOverlayScope to check if an overlay scope is valid
+func ValidOverlayScope(scope string) bool {
+	_, ok := overlayPrecedence[scope]
+	return ok
+}
+
+// Helper to check if an overlay platform matches the platform of a node
+func matchPlatform(target, platform string) bool {
+	if target == platform {
+		return true
+	}
+	return target == PlatformLinux && platform != "" && !nonLinuxPlatforms[platform]
+}
+
+// MatchOverlays to select and sort the overlays that apply to a node
+func MatchOverlays(overlays []ConfigOverlay, platform, uuid string, tags []string) []ConfigOverlay {
+	var matched []ConfigOverlay
+	for _, o := range overlays {
+		switch o.Scope {
+		case OverlayPlatform:
+			if matchPlatform(o.Target, platform) {
+				matched = append(matched, o)
+			}
+		case OverlayTag:
+			for _, t := range tags {
+				if o.Target == t {
+					matched = append(matched, o)
+					break
+				}
+			}
+		case OverlayUUID:
+			if o.Target == uuid {
+				matched = append(matched, o)
+			}
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if overlayPrecedence[matched[i].Scope] != overlayPrecedence[matched[j].Scope] {
+			return overlayPrecedence[matched[i].Scope] < overlayPrecedence[matched[j].Scope]
+		}
+		return matched[i].Priority < matched[j].Priority
+	})
+	return matched
+}
+
+// MergePatch to apply a JSON merge patch (RFC 7386) to a target. Objects are
+// merged recursively, null values remove keys and any other value replaces.
+func MergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = MergePatch(t[k], v)
+	}
+	return t
+}
+
+// Helper to parse a configuration that must be a JSON object
+func parseObject(raw string) (map[string]interface{}, error) {
+	parsed := make(map[string]interface{})
+	if raw == "" {
+		return parsed, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		return parsed, fmt.Errorf("configuration is not a valid JSON object - %v", err)
+	}
+	return parsed, nil
+}
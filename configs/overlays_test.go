@@ -0,0 +1,43 @@
+package configs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	base := map[string]interface{}{
+		"options": map[string]interface{}{
+			"host_identifier": "hostname",
+			"verbose":         true,
+		},
+		"schedule": map[string]interface{}{},
+	}
+	patch := map[string]interface{}{
+		"options": map[string]interface{}{
+			"host_identifier": "uuid",
+			"verbose":         nil,
+		},
+		"schedule": "replaced",
+	}
+	merged := MergePatch(base, patch).(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"host_identifier": "uuid"}, merged["options"])
+	assert.Equal(t, "replaced", merged["schedule"])
+}
+
+func TestMatchOverlays(t *testing.T) {
+	overlays := []ConfigOverlay{
+		{Name: "node", Scope: OverlayUUID, Target: "AAAA"},
+		{Name: "linux", Scope: OverlayPlatform, Target: PlatformLinux},
+		{Name: "tag-high", Scope: OverlayTag, Target: "prod", Priority: 10},
+		{Name: "tag-low", Scope: OverlayTag, Target: "prod", Priority: 1},
+		{Name: "darwin", Scope: OverlayPlatform, Target: "darwin"},
+	}
+	var names []string
+	for _, o := range MatchOverlays(overlays, "ubuntu", "AAAA", []string{"prod"}) {
+		names = append(names, o.Name)
+	}
+	assert.Equal(t, []string{"linux", "tag-low", "tag-high", "node"}, names)
+	assert.Empty(t, MatchOverlays(overlays, "windows", "BBBB", nil))
+}
@@ -0,0 +1,190 @@
+package configs
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/jmpsec/osctrl/nodes"
+)
+
+const (
+	// Left delimiter for template actions in configurations
+	templateLeftDelim string = "{{"
+	// Maximum number of rendered configurations to keep in the cache
+	renderCacheSize int = 10000
+	// Configuration served when a template can not be rendered and there is no previous one
+	fallbackConfiguration string = "{}"
+)
+
+// NodeTemplateData to hold the node values available to configuration templates
+type NodeTemplateData struct {
+	UUID            string
+	Hostname        string
+	Localname       string
+	Platform        string
+	PlatformVersion string
+	OsqueryVersion  string
+	Environment     string
+	IPAddress       string
+	Tags            []string
+	Labels          map[string]string
+}
+
+// NewNodeTemplateData to prepare the template data for a node
+func NewNodeTemplateData(node nodes.OsqueryNode, tags []string, labels map[string]string) NodeTemplateData {
+	sortedTags := append([]string{}, tags...)
+	sort.Strings(sortedTags)
+	return NodeTemplateData{
+		UUID:            node.UUID,
+		Hostname:        node.Hostname,
+		Localname:       node.Localname,
+		Platform:        node.Platform,
+		PlatformVersion: node.PlatformVersion,
+		OsqueryVersion:  node.OsqueryVersion,
+		Environment:     node.Environment,
+		IPAddress:       node.IPAddress,
+		Tags:            sortedTags,
+		Labels:          labels,
+	}
+}
+
+// HasTag to check in templates if the node has a tag
+func (d NodeTemplateData) HasTag(tag string) bool {
+	for _, t := range d.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Label to get in templates the value of a node label, empty if it is not set
+func (d NodeTemplateData) Label(name string) string {
+	return d.Labels[name]
+}
+
+// IsPlatform to check in templates if the node matches a platform, where linux matches all linux distributions
+func (d NodeTemplateData) IsPlatform(platform string) bool {
+	return matchPlatform(platform, d.Platform)
+}
+
+// Shard to get in templates a stable value between 0 and n-1 for the node
+func (d NodeTemplateData) Shard(n int) int {
+	return shard(d.UUID, n)
+}
+
+// Helper to calculate a stable shard for a key
+func shard(key string, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	h := sha1.Sum([]byte(key))
+	return int(binary.BigEndian.Uint32(h[:4]) % uint32(n))
+}
+
+// Functions available to configuration templates
+var templateFuncs = template.FuncMap{
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"replace":  strings.ReplaceAll,
+	"contains": strings.Contains,
+	"shard":    shard,
+	"default": func(def, value string) string {
+		if value == "" {
+			return def
+		}
+		return value
+	},
+	// Encode a value as JSON, to safely embed strings in the configuration
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// IsTemplate to check if a configuration has template actions that need rendering. Configurations
+// that do not parse as templates, like JSON with a literal delimiter in a query, are used as they are
+func IsTemplate(configuration string) bool {
+	if !strings.Contains(configuration, templateLeftDelim) {
+		return false
+	}
+	t, err := template.New("configuration").Funcs(templateFuncs).Parse(configuration)
+	if err != nil || t.Tree == nil {
+		return false
+	}
+	for _, n := range t.Tree.Root.Nodes {
+		if n.Type() != parse.NodeText {
+			return true
+		}
+	}
+	return false
+}
+
+// Fallback to get the configuration to serve when the configuration of a node can not be composed,
+// the environment configuration if it is not a template or an empty configuration otherwise
+func Fallback(configuration string) string {
+	if IsTemplate(configuration) {
+		return fallbackConfiguration
+	}
+	return configuration
+}
+
+// ParseTemplate to parse a configuration template, to check the syntax
+func ParseTemplate(configuration string) (*template.Template, error) {
+	t, err := template.New("configuration").Funcs(templateFuncs).Option("missingkey=zero").Parse(configuration)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration template - %v", err)
+	}
+	return t, nil
+}
+
+// RenderTemplate to render a configuration template with the data of a node
+func RenderTemplate(configuration string, data NodeTemplateData) (string, error) {
+	t, err := ParseTemplate(configuration)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("error rendering configuration template - %v", err)
+	}
+	return buf.String(), nil
+}
+
+// Render to render a configuration template for a node, using the cache of rendered configurations
+func (c *Configs) Render(configuration string, data NodeTemplateData) (string, error) {
+	if c.cache == nil {
+		return RenderTemplate(configuration, data)
+	}
+	key, err := renderCacheKey(configuration, data)
+	if err != nil {
+		return "", err
+	}
+	if rendered, ok := c.cache.Get(key); ok {
+		return rendered.(string), nil
+	}
+	rendered, err := RenderTemplate(configuration, data)
+	if err != nil {
+		return "", err
+	}
+	c.cache.Set(key, rendered)
+	return rendered, nil
+}
+
+// Helper to generate the cache key from the template version and the node attributes
+func renderCacheKey(configuration string, data NodeTemplateData) (string, error) {
+	attributes, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	h := sha1.Sum(attributes)
+	return ConfigHash(configuration) + ":" + hex.EncodeToString(h[:]), nil
+}
@@ -0,0 +1,75 @@
+package configs
+
+import (
+	"testing"
+
+	"github.com/jmpsec/osctrl/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	data := NodeTemplateData{
+		UUID:     "AAAA",
+		Hostname: "web-01",
+		Platform: "ubuntu",
+		Tags:     []string{"prod"},
+		Labels:   map[string]string{"team": "infra"},
+	}
+	configuration := `{"file_paths": {"home": ["/home/{{ .Hostname }}/%%"]}` +
+		`{{ if .IsPlatform "linux" }}, "options": {"verbose": true}{{ end }}` +
+		`{{ if .HasTag "prod" }}, "decorators": {"load": [{{ json (.Label "team") }}]}{{ end }}}`
+	rendered, err := RenderTemplate(configuration, data)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"file_paths": {"home": ["/home/web-01/%%"]}, "options": {"verbose": true}, "decorators": {"load": ["infra"]}}`, rendered)
+	_, err = RenderTemplate(`{{ if .Hostname }}`, data)
+	assert.Error(t, err)
+}
+
+func TestShard(t *testing.T) {
+	data := NodeTemplateData{UUID: "AAAA"}
+	assert.Equal(t, data.Shard(10), shard("AAAA", 10))
+	assert.True(t, data.Shard(10) >= 0 && data.Shard(10) < 10)
+	assert.Equal(t, 0, shard("AAAA", 0))
+}
+
+func TestValidateTemplate(t *testing.T) {
+	valid := Validate(`{"options": {"host_identifier": "{{ if eq .Platform "windows" }}uuid{{ else }}hostname{{ end }}"}}`, nil)
+	assert.True(t, valid.Valid)
+	broken := Validate(`{"options": {}{{ if .IsPlatform "darwin" }},{{ end }}}`, nil)
+	assert.False(t, broken.Valid)
+	assert.Len(t, broken.Errors, 1)
+	syntax := Validate(`{"options": {{ .Nope`, nil)
+	assert.False(t, syntax.Valid)
+}
+
+func TestRenderCache(t *testing.T) {
+	c := &Configs{cache: utils.NewBoundedCache(renderCacheSize)}
+	data := NodeTemplateData{Hostname: "one"}
+	first, err := c.Render(`{"h": "{{ .Hostname }}"}`, data)
+	assert.NoError(t, err)
+	data.Hostname = "two"
+	second, err := c.Render(`{"h": "{{ .Hostname }}"}`, data)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, 2, c.cache.Len())
+}
+
+func TestIsTemplate(t *testing.T) {
+	assert.True(t, IsTemplate(`{"options": {"host_identifier": "{{ .Hostname }}"}}`))
+	assert.False(t, IsTemplate(`{"options": {"verbose": true}}`))
+	// Delimiters without actions or that do not parse are not templates
+	assert.False(t, IsTemplate(`{"schedule": {"q": {"query": "SELECT '{{' AS x;"}}}`))
+	assert.False(t, IsTemplate(`{"schedule": {"q": {"query": "SELECT '{{/* x */}}' AS x;"}}}`))
+}
+
+func TestFallback(t *testing.T) {
+	assert.Equal(t, `{"options": {}}`, Fallback(`{"options": {}}`))
+	assert.Equal(t, fallbackConfiguration, Fallback(`{"options": {"host_identifier": "{{ .Hostname }}"}}`))
+	c := &Configs{lastGood: utils.NewBoundedCache(renderCacheSize)}
+	_, ok := c.LastGood("AAAA")
+	assert.False(t, ok)
+	c.keepGood("AAAA", `{"options": {}}`)
+	last, ok := c.LastGood("AAAA")
+	assert.True(t, ok)
+	assert.Equal(t, `{"options": {}}`, last)
+}
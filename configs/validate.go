@@ -0,0 +1,474 @@
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidationResult to hold the outcome of validating an osquery configuration
+type ValidationResult struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+}
+
+// Top level keys accepted by osquery in a configuration
+var knownSections = map[string]bool{
+	"options":                 true,
+	"schedule":                true,
+	"packs":                   true,
+	"decorators":              true,
+	"file_paths":              true,
+	"file_paths_query":        true,
+	"file_accesses":           true,
+	"exclude_paths":           true,
+	"yara":                    true,
+	"prometheus_targets":      true,
+	"views":                   true,
+	"events":                  true,
+	"feature_vectors":         true,
+	"auto_table_construction": true,
+}
+
+// Options that osquery accepts in the options section of a configuration
+var knownOptions = map[string]bool{
+	"audit_allow_config":               true,
+	"audit_allow_process_events":       true,
+	"audit_allow_sockets":              true,
+	"audit_allow_user_events":          true,
+	"audit_persist":                    true,
+	"buffered_log_max":                 true,
+	"carver_block_size":                true,
+	"carver_compression":               true,
+	"carver_continue_endpoint":         true,
+	"carver_disable_function":          true,
+	"carver_start_endpoint":            true,
+	"config_refresh":                   true,
+	"config_accelerated_refresh":       true,
+	"config_tls_max_attempts":          true,
+	"database_path":                    true,
+	"decorations_top_level":            true,
+	"disable_audit":                    true,
+	"disable_caching":                  true,
+	"disable_carver":                   true,
+	"disable_database":                 true,
+	"disable_decorators":               true,
+	"disable_distributed":              true,
+	"disable_events":                   true,
+	"disable_file_events":              true,
+	"disable_logging":                  true,
+	"disable_tables":                   true,
+	"disable_watchdog":                 true,
+	"distributed_interval":             true,
+	"distributed_plugin":               true,
+	"distributed_tls_max_attempts":     true,
+	"distributed_tls_read_endpoint":    true,
+	"distributed_tls_write_endpoint":   true,
+	"enable_bpf_events":                true,
+	"enable_file_events":               true,
+	"enable_keyboard_events":           true,
+	"enable_mouse_events":              true,
+	"enable_ntfs_publisher":            true,
+	"enable_windows_events_publisher":  true,
+	"enable_windows_events_subscriber": true,
+	"events_expiry":                    true,
+	"events_max":                       true,
+	"events_optimize":                  true,
+	"extensions_autoload":              true,
+	"extensions_interval":              true,
+	"extensions_require":               true,
+	"extensions_timeout":               true,
+	"host_identifier":                  true,
+	"logger_event_type":                true,
+	"logger_min_status":                true,
+	"logger_path":                      true,
+	"logger_plugin":                    true,
+	"logger_snapshot_event_type":       true,
+	"logger_tls_compress":              true,
+	"logger_tls_endpoint":              true,
+	"logger_tls_max_lines":             true,
+	"logger_tls_period":                true,
+	"pack_delimiter":                   true,
+	"pack_refresh_interval":            true,
+	"read_max":                         true,
+	"schedule_default_interval":        true,
+	"schedule_splay_percent":           true,
+	"schedule_timeout":                 true,
+	"table_delay":                      true,
+	"utc":                              true,
+	"verbose":                          true,
+	"watchdog_level":                   true,
+	"watchdog_memory_limit":            true,
+	"watchdog_utilization_limit":       true,
+	"windows_event_channels":           true,
+	"worker_threads":                   true,
+	"yara_delay":                       true,
+}
+
+// Keys accepted by osquery for each scheduled query
+var knownQueryKeys = map[string]bool{
+	"query":       true,
+	"interval":    true,
+	"platform":    true,
+	"version":     true,
+	"snapshot":    true,
+	"removed":     true,
+	"shard":       true,
+	"description": true,
+	"value":       true,
+	"denylist":    true,
+	"blacklist":   true,
+}
+
+// Keys accepted by osquery for decorators
+var knownDecorators = map[string]bool{
+	"load":     true,
+	"always":   true,
+	"interval": true,
+}
+
+var (
+	reTables = regexp.MustCompile(`(?i)\b(?:from|join)\s+([a-z_][a-z0-9_]*)`)
+	reCTEs   = regexp.MustCompile(`(?i)\b([a-z_][a-z0-9_]*)\s+as\s*\(`)
+)
+
+// LoadTables to load the names of osquery tables from the JSON file used by the admin
+func LoadTables(file string) ([]string, error) {
+	var tables []struct {
+		Name string `json:"name"`
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &tables); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = t.Name
+	}
+	return names, nil
+}
+
+// QueryTables to extract the names of the tables used by a query, skipping common table expressions
+func QueryTables(query string) []string {
+	ctes := make(map[string]bool)
+	for _, m := range reCTEs.FindAllStringSubmatch(query, -1) {
+		ctes[strings.ToLower(m[1])] = true
+	}
+	seen := make(map[string]bool)
+	var tables []string
+	for _, m := range reTables.FindAllStringSubmatch(query, -1) {
+		t := strings.ToLower(m[1])
+		if ctes[t] || seen[t] {
+			continue
+		}
+		seen[t] = true
+		tables = append(tables, t)
+	}
+	return tables
+}
+
+// Platforms used to render configuration templates for validation
+var validationPlatforms = []string{"darwin", "windows", "ubuntu"}
+
+// Validate to check an osquery configuration. Errors are problems that osquery
+// will reject and warnings are things it will ignore, like unknown options or
+// tables. If tables is empty, queries are not checked against known tables.
+// Templates are rendered for a sample node of each platform and then checked.
+func Validate(configuration string, tables []string) ValidationResult {
+	if IsTemplate(configuration) {
+		return validateTemplate(configuration, tables)
+	}
+	return validate(configuration, tables)
+}
+
+// Helper to validate a configuration template rendered for sample nodes
+func validateTemplate(configuration string, tables []string) ValidationResult {
+	v := &validator{}
+	if _, err := ParseTemplate(configuration); err != nil {
+		v.errorf("%v", err)
+		return v.result()
+	}
+	seen := make(map[string]bool)
+	for _, p := range validationPlatforms {
+		data := NodeTemplateData{
+			UUID:        "00000000-0000-0000-0000-000000000000",
+			Hostname:    "validation-" + p,
+			Localname:   "validation-" + p,
+			Platform:    p,
+			Environment: "validation",
+			Labels:      make(map[string]string),
+		}
+		rendered, err := RenderTemplate(configuration, data)
+		if err != nil {
+			v.errorf("%s: %v", p, err)
+			continue
+		}
+		result := validate(rendered, tables)
+		for _, e := range result.Errors {
+			if !seen["e:"+e] {
+				seen["e:"+e] = true
+				v.errorf("%s: %s", p, e)
+			}
+		}
+		for _, w := range result.Warnings {
+			if !seen["w:"+w] {
+				seen["w:"+w] = true
+				v.warnf("%s: %s", p, w)
+			}
+		}
+	}
+	return v.result()
+}
+
+// Helper to validate a configuration that is not a template
+func validate(configuration string, tables []string) ValidationResult {
+	v := &validator{knownTables: make(map[string]bool)}
+	for _, t := range tables {
+		v.knownTables[t] = true
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(configuration), &parsed); err != nil {
+		v.errorf("configuration is not a valid JSON object - %v", err)
+		return v.result()
+	}
+	for _, section := range sortedKeys(parsed) {
+		value := parsed[section]
+		switch section {
+		case "options":
+			v.options(value)
+		case "schedule":
+			v.schedule("schedule", value)
+		case "packs":
+			v.packs(value)
+		case "decorators":
+			v.decorators(value)
+		case "file_paths", "exclude_paths":
+			v.pathLists(section, value)
+		default:
+			if !knownSections[section] {
+				v.warnf("unknown section %s", section)
+			}
+		}
+	}
+	return v.result()
+}
+
+// Helper to collect errors and warnings while validating
+type validator struct {
+	knownTables map[string]bool
+	errors      []string
+	warnings    []string
+}
+
+func (v *validator) errorf(format string, a ...interface{}) {
+	v.errors = append(v.errors, fmt.Sprintf(format, a...))
+}
+
+func (v *validator) warnf(format string, a ...interface{}) {
+	v.warnings = append(v.warnings, fmt.Sprintf(format, a...))
+}
+
+func (v *validator) result() ValidationResult {
+	return ValidationResult{
+		Valid:    len(v.errors) == 0,
+		Errors:   v.errors,
+		Warnings: v.warnings,
+	}
+}
+
+func (v *validator) options(value interface{}) {
+	options, ok := value.(map[string]interface{})
+	if !ok {
+		v.errorf("options must be an object")
+		return
+	}
+	for _, name := range sortedKeys(options) {
+		switch options[name].(type) {
+		case string, float64, bool:
+		default:
+			v.errorf("option %s must be a string, number or boolean", name)
+		}
+		if !knownOptions[name] {
+			v.warnf("unknown option %s", name)
+		}
+	}
+}
+
+func (v *validator) schedule(location string, value interface{}) {
+	schedule, ok := value.(map[string]interface{})
+	if !ok {
+		v.errorf("%s must be an object", location)
+		return
+	}
+	for _, name := range sortedKeys(schedule) {
+		v.query(location+"."+name, schedule[name])
+	}
+}
+
+func (v *validator) query(location string, value interface{}) {
+	query, ok := value.(map[string]interface{})
+	if !ok {
+		v.errorf("%s must be an object", location)
+		return
+	}
+	for _, key := range sortedKeys(query) {
+		if !knownQueryKeys[key] {
+			v.warnf("unknown key %s in %s", key, location)
+		}
+	}
+	sql, ok := query["query"].(string)
+	if !ok || strings.TrimSpace(sql) == "" {
+		v.errorf("%s needs a query", location)
+	} else if len(v.knownTables) > 0 {
+		for _, t := range QueryTables(sql) {
+			if !v.knownTables[t] {
+				v.warnf("unknown table %s in %s", t, location)
+			}
+		}
+	}
+	// Queries without interval run with schedule_default_interval
+	if i, ok := query["interval"]; !ok {
+		v.warnf("%s has no interval, schedule_default_interval is used", location)
+	} else if interval, ok := numeric(i); !ok || interval <= 0 {
+		v.errorf("%s needs a positive interval", location)
+	}
+	for _, key := range []string{"snapshot", "removed", "denylist", "blacklist"} {
+		if b, ok := query[key]; ok {
+			if _, ok := b.(bool); !ok {
+				v.errorf("%s in %s must be a boolean", key, location)
+			}
+		}
+	}
+	if s, ok := query["shard"]; ok {
+		if shard, ok := numeric(s); !ok || shard < 0 || shard > 100 {
+			v.errorf("shard in %s must be between 0 and 100", location)
+		}
+	}
+}
+
+func (v *validator) packs(value interface{}) {
+	packs, ok := value.(map[string]interface{})
+	if !ok {
+		v.errorf("packs must be an object")
+		return
+	}
+	for _, name := range sortedKeys(packs) {
+		switch pack := packs[name].(type) {
+		case string:
+			// Packs can be loaded from a path in the node
+		case map[string]interface{}:
+			queries, ok := pack["queries"]
+			if !ok {
+				v.errorf("pack %s needs queries", name)
+				continue
+			}
+			v.schedule("packs."+name+".queries", queries)
+		default:
+			v.errorf("pack %s must be an object or a path", name)
+		}
+	}
+}
+
+func (v *validator) decorators(value interface{}) {
+	decorators, ok := value.(map[string]interface{})
+	if !ok {
+		v.errorf("decorators must be an object")
+		return
+	}
+	for _, key := range sortedKeys(decorators) {
+		switch key {
+		case "load", "always":
+			v.queryList("decorators."+key, decorators[key])
+		case "interval":
+			intervals, ok := decorators[key].(map[string]interface{})
+			if !ok {
+				v.errorf("decorators.interval must be an object")
+				continue
+			}
+			for _, i := range sortedKeys(intervals) {
+				if _, err := strconv.Atoi(i); err != nil {
+					v.errorf("decorators.interval key %s must be a number of seconds", i)
+				}
+				v.queryList("decorators.interval."+i, intervals[i])
+			}
+		default:
+			if !knownDecorators[key] {
+				v.warnf("unknown decorator type %s", key)
+			}
+		}
+	}
+}
+
+func (v *validator) queryList(location string, value interface{}) {
+	list, ok := value.([]interface{})
+	if !ok {
+		v.errorf("%s must be a list of queries", location)
+		return
+	}
+	for _, q := range list {
+		sql, ok := q.(string)
+		if !ok {
+			v.errorf("%s must be a list of queries", location)
+			return
+		}
+		if len(v.knownTables) == 0 {
+			continue
+		}
+		for _, t := range QueryTables(sql) {
+			if !v.knownTables[t] {
+				v.warnf("unknown table %s in %s", t, location)
+			}
+		}
+	}
+}
+
+func (v *validator) pathLists(section string, value interface{}) {
+	categories, ok := value.(map[string]interface{})
+	if !ok {
+		v.errorf("%s must be an object", section)
+		return
+	}
+	for _, c := range sortedKeys(categories) {
+		paths, ok := categories[c].([]interface{})
+		if !ok {
+			v.errorf("%s.%s must be a list of paths", section, c)
+			continue
+		}
+		for _, p := range paths {
+			if _, ok := p.(string); !ok {
+				v.errorf("%s.%s must be a list of paths", section, c)
+				break
+			}
+		}
+	}
+}
+
+// Helper to get a number that osquery accepts as a number or a numeric string
+func numeric(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Helper to iterate maps in a stable order, so results are deterministic
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,43 @@
+package configs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryTables(t *testing.T) {
+	query := "WITH recent AS (SELECT * FROM processes) SELECT p.name FROM recent JOIN users u USING (uid) JOIN Processes;"
+	assert.Equal(t, []string{"processes", "users"}, QueryTables(query))
+}
+
+func TestValidate(t *testing.T) {
+	tables := []string{"users", "processes"}
+	result := Validate(`{
+		"options": {"host_identifier": "uuid", "made_up_option": true},
+		"schedule": {
+			"users": {"query": "SELECT * FROM users;", "interval": 60},
+			"ghost": {"query": "SELECT * FROM ghosts;", "interval": "3600"}
+		},
+		"unknown": {}
+	}`, tables)
+	assert.True(t, result.Valid)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, []string{
+		"unknown option made_up_option",
+		"unknown table ghosts in schedule.ghost",
+		"unknown section unknown",
+	}, result.Warnings)
+	result = Validate(`{"schedule": {"bad": {"interval": 0}}, "options": {"verbose": {}}}`, tables)
+	assert.False(t, result.Valid)
+	assert.Equal(t, []string{
+		"option verbose must be a string, number or boolean",
+		"schedule.bad needs a query",
+		"schedule.bad needs a positive interval",
+	}, result.Errors)
+	result = Validate(`{"schedule": {"users": {"query": "SELECT * FROM users;"}}, "options": {"schedule_default_interval": 600}}`, tables)
+	assert.True(t, result.Valid)
+	assert.Equal(t, []string{"schedule.users has no interval, schedule_default_interval is used"}, result.Warnings)
+	result = Validate(`{"options": `, tables)
+	assert.False(t, result.Valid)
+}
@@ -1,6 +1,7 @@
 package environments
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"time"
@@ -54,6 +55,7 @@ type TLSEnvironment struct {
 	Icon             string
 	Configuration    string `gorm:"type:text"`
 	Flags            string `gorm:"type:text"`
+	FlagsExtra       string `gorm:"type:text"`
 	Certificate      string `gorm:"type:varchar(4096)"`
 	ConfigTLS        bool
 	ConfigInterval   int
@@ -87,6 +89,14 @@ func CreateEnvironment(backend *gorm.DB) *Environment {
 	if err := backend.AutoMigrate(TLSEnvironment{}).Error; err != nil {
 		log.Fatalf("Failed to AutoMigrate table (tls_environments): %v", err)
 	}
+	// table environment_versions
+	if err := backend.AutoMigrate(EnvironmentVersion{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (environment_versions): %v", err)
+	}
+	// table environment_scripts
+	if err := backend.AutoMigrate(EnvironmentScript{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (environment_scripts): %v", err)
+	}
 	return e
 }
 
@@ -210,8 +220,12 @@ func (environment *Environment) Update(e TLSEnvironment) error {
 	return nil
 }
 
-// UpdateConfiguration to update configuration for an environment
+// UpdateConfiguration to update configuration for an environment, it must be valid JSON unless it
+// is a template, that is only JSON once rendered and it is checked by the configuration validator
 func (environment *Environment) UpdateConfiguration(name, configuration string) error {
+	if !hasTemplateActions(configuration) && !json.Valid([]byte(configuration)) {
+		return fmt.Errorf("configuration is not valid JSON")
+	}
 	env, err := environment.Get(name)
 	if err != nil {
 		return fmt.Errorf("error getting environment %v", err)
@@ -246,6 +260,18 @@ func (environment *Environment) UpdateFlags(name, flags string) error {
 	return nil
 }
 
+// UpdateFlagsExtra to update the extra lines appended to the flags of an environment
+func (environment *Environment) UpdateFlagsExtra(name, extra string) error {
+	env, err := environment.Get(name)
+	if err != nil {
+		return fmt.Errorf("error getting environment %v", err)
+	}
+	if err := environment.DB.Model(&env).Update("flags_extra", extra).Error; err != nil {
+		return fmt.Errorf("Update %v", err)
+	}
+	return nil
+}
+
 // UpdateIntervals to update intervals for an environment
 func (environment *Environment) UpdateIntervals(name string, csecs, lsecs, qsecs int) error {
 	env, err := environment.Get(name)
@@ -3,6 +3,7 @@ package environments
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"text/template"
 )
 
@@ -34,9 +35,26 @@ const (
 --distributed_tls_write_endpoint=/{{ .Environment.Name }}/{{ .Environment.QueryWritePath }}
 --tls_hostname={{ .Environment.Hostname }}
 --tls_server_certs={{ .CertFile }}
+{{- if .Extra }}
+{{ .Extra }}
+{{- end }}
 `
 )
 
+const (
+	// FlagsLinux for flags of linux nodes
+	FlagsLinux string = "linux"
+	// FlagsDarwin for flags of macOS nodes
+	FlagsDarwin string = "darwin"
+	// FlagsWindows for flags of windows nodes
+	FlagsWindows string = "windows"
+	// FlagsFreeBSD for flags of FreeBSD nodes
+	FlagsFreeBSD string = "freebsd"
+)
+
+// FlagsPlatforms with all the platforms that have specific flags
+var FlagsPlatforms = []string{FlagsLinux, FlagsDarwin, FlagsWindows, FlagsFreeBSD}
+
 const (
 	emptyFlagSecret string = "__SECRET_FILE__"
 	emptyFlagCert   string = "__CERT_FILE__"
@@ -45,15 +63,78 @@ const (
 type flagData struct {
 	SecretFile  string
 	CertFile    string
+	Extra       string
 	Environment TLSEnvironment
 }
 
-// GenerateFlags to generate flags
-func GenerateFlags(env TLSEnvironment, secretPath, certificatePath string) (string, error) {
+// PlatformPaths to hold where osquery keeps its files and how the service is named in a platform
+type PlatformPaths struct {
+	FlagsFile    string
+	SecretFile   string
+	CertFile     string
+	DatabasePath string
+	PidFile      string
+	ServiceName  string
+}
+
+// GetPlatformPaths to get the osquery paths for a platform, with the secret and certificate named after the project
+func GetPlatformPaths(platform, project string) (PlatformPaths, error) {
+	switch platform {
+	case FlagsLinux:
+		return PlatformPaths{
+			FlagsFile:    "/etc/osquery/osquery.flags",
+			SecretFile:   "/etc/osquery/" + project + ".secret",
+			CertFile:     "/etc/osquery/certs/" + project + ".crt",
+			DatabasePath: "/var/osquery/osquery.db",
+			PidFile:      "/var/osquery/osqueryd.pidfile",
+			ServiceName:  "osqueryd",
+		}, nil
+	case FlagsDarwin:
+		return PlatformPaths{
+			FlagsFile:    "/private/var/osquery/osquery.flags",
+			SecretFile:   "/private/var/osquery/" + project + ".secret",
+			CertFile:     "/private/var/osquery/certs/" + project + ".crt",
+			DatabasePath: "/private/var/osquery/osquery.db",
+			PidFile:      "/private/var/osquery/osqueryd.pidfile",
+			ServiceName:  "com.facebook.osqueryd",
+		}, nil
+	case FlagsWindows:
+		return PlatformPaths{
+			FlagsFile:    `C:\Program Files\osquery\osquery.flags`,
+			SecretFile:   `C:\Program Files\osquery\` + project + ".secret",
+			CertFile:     `C:\Program Files\osquery\` + project + ".crt",
+			DatabasePath: `C:\Program Files\osquery\osquery.db`,
+			PidFile:      `C:\Program Files\osquery\osqueryd.pidfile`,
+			ServiceName:  "osqueryd",
+		}, nil
+	case FlagsFreeBSD:
+		return PlatformPaths{
+			FlagsFile:    "/usr/local/etc/osquery.flags",
+			SecretFile:   "/usr/local/etc/" + project + ".secret",
+			CertFile:     "/usr/local/etc/certs/" + project + ".crt",
+			DatabasePath: "/var/db/osquery/osquery.db",
+			PidFile:      "/var/run/osqueryd.pid",
+			ServiceName:  "osqueryd",
+		}, nil
+	}
+	return PlatformPaths{}, fmt.Errorf("unknown platform %s", platform)
+}
+
+// Helper to render the flags template
+func renderFlags(data flagData) (string, error) {
 	t, err := template.New("flags").Parse(FlagsTemplate)
 	if err != nil {
 		return "", err
 	}
+	var tpl bytes.Buffer
+	if err := t.Execute(&tpl, data); err != nil {
+		return "", err
+	}
+	return tpl.String(), nil
+}
+
+// GenerateFlags to generate flags, with placeholders for the secret and certificate if paths are empty
+func GenerateFlags(env TLSEnvironment, secretPath, certificatePath string) (string, error) {
 	flagSecret := secretPath
 	if secretPath == "" {
 		flagSecret = emptyFlagSecret
@@ -65,13 +146,28 @@ func GenerateFlags(env TLSEnvironment, secretPath, certificatePath string) (stri
 	data := flagData{
 		SecretFile:  flagSecret,
 		CertFile:    flagCertificate,
+		Extra:       strings.TrimSpace(env.FlagsExtra),
 		Environment: env,
 	}
-	var tpl bytes.Buffer
-	if err := t.Execute(&tpl, data); err != nil {
+	return renderFlags(data)
+}
+
+// GenerateFlagsPlatform to generate the flags file for nodes of a platform. It uses the flags stored
+// for the environment, so nodes enroll with the flags that are versioned and rolled back
+func GenerateFlagsPlatform(env TLSEnvironment, platform, project string) (string, error) {
+	paths, err := GetPlatformPaths(platform, project)
+	if err != nil {
 		return "", err
 	}
-	return tpl.String(), nil
+	flags := env.Flags
+	if strings.TrimSpace(flags) == "" {
+		if flags, err = GenerateFlags(env, "", ""); err != nil {
+			return "", err
+		}
+	}
+	flags = strings.NewReplacer(emptyFlagSecret, paths.SecretFile, emptyFlagCert, paths.CertFile).Replace(flags)
+	// Platform paths go first, so the flags of the environment can override them
+	return "\n--database_path=" + paths.DatabasePath + "\n--pidfile=" + paths.PidFile + "\n" + strings.TrimLeft(flags, "\n"), nil
 }
 
 // GenerateFlagsEnv to generate flags by environment name
@@ -0,0 +1,36 @@
+package environments
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateFlags(t *testing.T) {
+	env := TLSEnvironment{Name: "dev", Hostname: "osctrl.example.com"}
+	flags, err := GenerateFlags(env, "", "")
+	assert.NoError(t, err)
+	assert.Contains(t, flags, "--enroll_secret_path="+emptyFlagSecret+"\n")
+	assert.True(t, strings.HasSuffix(flags, "--tls_server_certs="+emptyFlagCert+"\n"))
+	assert.NotContains(t, flags, "--database_path")
+}
+
+func TestGenerateFlagsPlatform(t *testing.T) {
+	env := TLSEnvironment{Name: "dev", Hostname: "osctrl.example.com", FlagsExtra: "--verbose=true\n"}
+	flags, err := GenerateFlagsPlatform(env, FlagsWindows, "osctrl-dev")
+	assert.NoError(t, err)
+	assert.Contains(t, flags, `--enroll_secret_path=C:\Program Files\osquery\osctrl-dev.secret`)
+	assert.Contains(t, flags, `--database_path=C:\Program Files\osquery\osquery.db`)
+	assert.True(t, strings.HasSuffix(flags, "\n--verbose=true\n"))
+	flags, err = GenerateFlagsPlatform(env, FlagsDarwin, "osctrl-dev")
+	assert.NoError(t, err)
+	assert.Contains(t, flags, "--tls_server_certs=/private/var/osquery/certs/osctrl-dev.crt\n")
+	_, err = GenerateFlagsPlatform(env, "plan9", "osctrl-dev")
+	assert.Error(t, err)
+	// Stored flags are used when they exist
+	env.Flags = "--enroll_secret_path=" + emptyFlagSecret + "\n--distributed_interval=90\n"
+	flags, err = GenerateFlagsPlatform(env, FlagsLinux, "osctrl-dev")
+	assert.NoError(t, err)
+	assert.Equal(t, "\n--database_path=/var/osquery/osquery.db\n--pidfile=/var/osquery/osqueryd.pidfile\n--enroll_secret_path=/etc/osquery/osctrl-dev.secret\n--distributed_interval=90\n", flags)
+}
@@ -4,5 +4,7 @@ go 1.14
 
 require (
 	github.com/jinzhu/gorm v1.9.8
+	github.com/mattn/go-sqlite3 v2.0.1+incompatible // indirect
 	github.com/segmentio/ksuid v1.0.2
+	github.com/stretchr/testify v1.5.1
 )
@@ -77,36 +77,40 @@ iex ((New-Object System.Net.WebClient).DownloadString('https://{{ .TLSHost }}/{{
 	return QuickRemoveOneLiner(s, environment, "remove.ps1")
 }
 
-// QuickAddScript to get a quick add script for a environment
+// QuickAddScript to get a quick add script for a environment, from the default script templates
 func QuickAddScript(project, script string, environment TLSEnvironment) (string, error) {
-	var templateName, templatePath string
-	// What script is it?
-	switch script {
-	case "enroll.sh":
-		templateName = "quick-add.sh"
-		templatePath = "scripts/quick-add.sh"
-	case "enroll.ps1":
-		templateName = "quick-add.ps1"
-		templatePath = "scripts/quick-add.ps1"
-	case "remove.sh":
-		templateName = "quick-remove.sh"
-		templatePath = "scripts/quick-remove.sh"
-	case "remove.ps1":
-		templateName = "quick-remove.ps1"
-		templatePath = "scripts/quick-remove.ps1"
+	content, err := DefaultScript(script)
+	if err != nil {
+		return "", err
 	}
+	return RenderScript(project, script, content, environment)
+}
+
+// RenderScript to render a quick add/remove script template for an environment
+func RenderScript(project, script, content string, environment TLSEnvironment) (string, error) {
 	// Prepare template
-	t, err := template.New(templateName).ParseFiles(templatePath)
+	t, err := template.New(script).Parse(content)
 	if err != nil {
 		return "", err
 	}
+	// Flags for each platform, so scripts can write the right flags file
+	flags := make(map[string]string)
+	for _, p := range FlagsPlatforms {
+		f, err := GenerateFlagsPlatform(environment, p, project)
+		if err != nil {
+			return "", err
+		}
+		flags[p] = f
+	}
 	// Prepare template data
 	data := struct {
 		Project     string
 		Environment TLSEnvironment
+		Flags       map[string]string
 	}{
 		Project:     project,
 		Environment: environment,
+		Flags:       flags,
 	}
 	// Compile template into buffer
 	var tpl bytes.Buffer
@@ -0,0 +1,110 @@
+package environments
+
+import (
+	"fmt"
+	"io/ioutil"
+	"text/template"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// ScriptEnrollShell to enroll Linux/OSX/FreeBSD nodes
+	ScriptEnrollShell string = "enroll.sh"
+	// ScriptEnrollPowershell to enroll Windows nodes
+	ScriptEnrollPowershell string = "enroll.ps1"
+	// ScriptRemoveShell to remove Linux/OSX/FreeBSD nodes
+	ScriptRemoveShell string = "remove.sh"
+	// ScriptRemovePowershell to remove Windows nodes
+	ScriptRemovePowershell string = "remove.ps1"
+)
+
+// Default templates for each script, used when an environment does not have its own
+var defaultScripts = map[string]string{
+	ScriptEnrollShell:      "scripts/quick-add.sh",
+	ScriptEnrollPowershell: "scripts/quick-add.ps1",
+	ScriptRemoveShell:      "scripts/quick-remove.sh",
+	ScriptRemovePowershell: "scripts/quick-remove.ps1",
+}
+
+// EnvironmentScript to hold a customized quick add/remove script template for an environment
+type EnvironmentScript struct {
+	gorm.Model
+	Environment string `gorm:"index"`
+	Name        string
+	Content     string `gorm:"type:text"`
+}
+
+// ValidScript to check if a script name is valid
+func ValidScript(name string) bool {
+	_, ok := defaultScripts[name]
+	return ok
+}
+
+// DefaultScript to read the default template for a script
+func DefaultScript(name string) (string, error) {
+	path, ok := defaultScripts[name]
+	if !ok {
+		return "", fmt.Errorf("unknown script %s", name)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// GetScript to retrieve the template of a script for an environment, falling back to the default one
+func (environment *Environment) GetScript(name, script string) (string, error) {
+	if !ValidScript(script) {
+		return "", fmt.Errorf("unknown script %s", script)
+	}
+	var s EnvironmentScript
+	if err := environment.DB.Where("environment = ? AND name = ?", name, script).First(&s).Error; err != nil {
+		return DefaultScript(script)
+	}
+	return s.Content, nil
+}
+
+// SetScript to store a customized template of a script for an environment
+func (environment *Environment) SetScript(name, script, content string) error {
+	if !ValidScript(script) {
+		return fmt.Errorf("unknown script %s", script)
+	}
+	if _, err := template.New(script).Parse(content); err != nil {
+		return fmt.Errorf("invalid script template %v", err)
+	}
+	var s EnvironmentScript
+	if err := environment.DB.Where("environment = ? AND name = ?", name, script).First(&s).Error; err == nil {
+		if err := environment.DB.Model(&s).Update("content", content).Error; err != nil {
+			return fmt.Errorf("Update %v", err)
+		}
+		return nil
+	}
+	s = EnvironmentScript{
+		Environment: name,
+		Name:        script,
+		Content:     content,
+	}
+	if err := environment.DB.Create(&s).Error; err != nil {
+		return fmt.Errorf("Create EnvironmentScript %v", err)
+	}
+	return nil
+}
+
+// ResetScript to remove the customized template of a script, so the default one is used
+func (environment *Environment) ResetScript(name, script string) error {
+	if err := environment.DB.Unscoped().Where("environment = ? AND name = ?", name, script).Delete(&EnvironmentScript{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// QuickScript to generate a quick add/remove script for an environment, using its own template if there is one
+func (environment *Environment) QuickScript(project, script string, env TLSEnvironment) (string, error) {
+	content, err := environment.GetScript(env.Name, script)
+	if err != nil {
+		return "", err
+	}
+	return RenderScript(project, script, content, env)
+}
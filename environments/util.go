@@ -4,6 +4,8 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"io/ioutil"
+	"strings"
+	"text/template/parse"
 	"time"
 
 	"github.com/segmentio/ksuid"
@@ -45,3 +47,22 @@ func IsItExpired(t time.Time) bool {
 	now := time.Now()
 	return (int(t.Sub(now).Seconds()) <= 0)
 }
+
+// Helper to check if a configuration has template actions, so it is only JSON once it is rendered.
+// Functions are not checked here, templates are validated when they are rendered
+func hasTemplateActions(configuration string) bool {
+	if !strings.Contains(configuration, "{{") {
+		return false
+	}
+	tree := parse.New("configuration")
+	tree.Mode = parse.SkipFuncCheck
+	if _, err := tree.Parse(configuration, "", "", make(map[string]*parse.Tree)); err != nil {
+		return false
+	}
+	for _, n := range tree.Root.Nodes {
+		if n.Type() != parse.NodeText {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,324 @@
+package environments
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// VersionConfiguration for versions of the osquery configuration
+	VersionConfiguration string = "configuration"
+	// VersionFlags for versions of the osquery flags
+	VersionFlags string = "flags"
+	// VersionIntervals for versions of the config, log and query intervals
+	VersionIntervals string = "intervals"
+	// DiffEqual for lines present in both versions
+	DiffEqual string = " "
+	// DiffAdd for lines only present in the new version
+	DiffAdd string = "+"
+	// DiffRemove for lines only present in the old version
+	DiffRemove string = "-"
+)
+
+// EnvironmentVersion to keep each change of configuration, flags or intervals
+type EnvironmentVersion struct {
+	gorm.Model
+	Environment string `gorm:"index"`
+	Type        string `gorm:"index"`
+	Content     string `gorm:"type:text"`
+	Hash        string
+	Author      string
+	Comment     string
+}
+
+// IntervalsContent to store intervals as the content of a version
+type IntervalsContent struct {
+	Config int `json:"config"`
+	Log    int `json:"log"`
+	Query  int `json:"query"`
+}
+
+// DiffLine to hold each line of the difference between two versions
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Helper to generate the hash for the content of a version
+func versionHash(content string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
+
+// Helper to get the current content of an environment for a version type
+func versionContent(env TLSEnvironment, vType string) (string, error) {
+	switch vType {
+	case VersionConfiguration:
+		return env.Configuration, nil
+	case VersionFlags:
+		return env.Flags, nil
+	case VersionIntervals:
+		intervals, err := json.Marshal(IntervalsContent{
+			Config: env.ConfigInterval,
+			Log:    env.LogInterval,
+			Query:  env.QueryInterval,
+		})
+		return string(intervals), err
+	}
+	return "", fmt.Errorf("invalid version type %s", vType)
+}
+
+// Helper to store a new version, skipping it when the content has not changed. The
+// first time a type is versioned, the previous content is kept as the initial version.
+func (environment *Environment) recordVersion(name, vType, previous, content, author, comment string) error {
+	latest, err := environment.latestVersion(name, vType)
+	if err != nil {
+		initial := EnvironmentVersion{
+			Environment: name,
+			Type:        vType,
+			Content:     previous,
+			Hash:        versionHash(previous),
+			Comment:     "initial version",
+		}
+		if err := environment.DB.Create(&initial).Error; err != nil {
+			return fmt.Errorf("Create EnvironmentVersion %v", err)
+		}
+		latest = initial
+	}
+	hash := versionHash(content)
+	if latest.Hash == hash {
+		return nil
+	}
+	version := EnvironmentVersion{
+		Environment: name,
+		Type:        vType,
+		Content:     content,
+		Hash:        hash,
+		Author:      author,
+		Comment:     comment,
+	}
+	if environment.DB.NewRecord(version) {
+		if err := environment.DB.Create(&version).Error; err != nil {
+			return fmt.Errorf("Create EnvironmentVersion %v", err)
+		}
+	} else {
+		return fmt.Errorf("db.NewRecord did not return true")
+	}
+	return nil
+}
+
+// Helper to get the latest version of a type for an environment
+func (environment *Environment) latestVersion(name, vType string) (EnvironmentVersion, error) {
+	var version EnvironmentVersion
+	if err := environment.DB.Where("environment = ? AND type = ?", name, vType).Order("id desc").First(&version).Error; err != nil {
+		return version, err
+	}
+	return version, nil
+}
+
+// SaveConfiguration to update the configuration for an environment and keep the version
+func (environment *Environment) SaveConfiguration(name, configuration, author, comment string) error {
+	env, err := environment.Get(name)
+	if err != nil {
+		return fmt.Errorf("error getting environment %v", err)
+	}
+	if err := environment.UpdateConfiguration(name, configuration); err != nil {
+		return err
+	}
+	return environment.recordVersion(name, VersionConfiguration, env.Configuration, configuration, author, comment)
+}
+
+// SaveFlags to update the flags for an environment and keep the version
+func (environment *Environment) SaveFlags(name, flags, author, comment string) error {
+	env, err := environment.Get(name)
+	if err != nil {
+		return fmt.Errorf("error getting environment %v", err)
+	}
+	if err := environment.UpdateFlags(name, flags); err != nil {
+		return err
+	}
+	return environment.recordVersion(name, VersionFlags, env.Flags, flags, author, comment)
+}
+
+// SaveFlagsExtra to update the extra flags for an environment, the flags are re-generated with
+// them and saved as a new version
+func (environment *Environment) SaveFlagsExtra(name, extra, author string) error {
+	if err := environment.UpdateFlagsExtra(name, extra); err != nil {
+		return err
+	}
+	flags, err := environment.GenerateFlagsEnv(name, "", "")
+	if err != nil {
+		return fmt.Errorf("error re-generating flags %v", err)
+	}
+	return environment.SaveFlags(name, flags, author, "flags re-generated after extra flags update")
+}
+
+// SaveIntervals to update the intervals for an environment and keep the version
+func (environment *Environment) SaveIntervals(name string, csecs, lsecs, qsecs int, author, comment string) error {
+	env, err := environment.Get(name)
+	if err != nil {
+		return fmt.Errorf("error getting environment %v", err)
+	}
+	previous, err := versionContent(env, VersionIntervals)
+	if err != nil {
+		return err
+	}
+	if err := environment.UpdateIntervals(name, csecs, lsecs, qsecs); err != nil {
+		return err
+	}
+	intervals, err := json.Marshal(IntervalsContent{Config: csecs, Log: lsecs, Query: qsecs})
+	if err != nil {
+		return fmt.Errorf("error serializing intervals %v", err)
+	}
+	return environment.recordVersion(name, VersionIntervals, previous, string(intervals), author, comment)
+}
+
+// GetVersions to retrieve all versions for an environment, newest first. An empty type returns all types.
+func (environment *Environment) GetVersions(name, vType string) ([]EnvironmentVersion, error) {
+	var versions []EnvironmentVersion
+	query := environment.DB.Where("environment = ?", name)
+	if vType != "" {
+		query = query.Where("type = ?", vType)
+	}
+	if err := query.Order("id desc").Find(&versions).Error; err != nil {
+		return versions, err
+	}
+	return versions, nil
+}
+
+// GetVersion to retrieve one version of an environment by id
+func (environment *Environment) GetVersion(name string, id uint) (EnvironmentVersion, error) {
+	var version EnvironmentVersion
+	if err := environment.DB.Where("environment = ? AND id = ?", name, id).First(&version).Error; err != nil {
+		return version, err
+	}
+	return version, nil
+}
+
+// Rollback to apply the content of a previous version, which is kept as a new version
+func (environment *Environment) Rollback(name string, id uint, author string) error {
+	version, err := environment.GetVersion(name, id)
+	if err != nil {
+		return fmt.Errorf("error getting version %v", err)
+	}
+	comment := fmt.Sprintf("rollback to version %d", version.ID)
+	switch version.Type {
+	case VersionConfiguration:
+		return environment.SaveConfiguration(name, version.Content, author, comment)
+	case VersionFlags:
+		return environment.SaveFlags(name, version.Content, author, comment)
+	case VersionIntervals:
+		var intervals IntervalsContent
+		if err := json.Unmarshal([]byte(version.Content), &intervals); err != nil {
+			return fmt.Errorf("error parsing intervals %v", err)
+		}
+		if err := environment.SaveIntervals(name, intervals.Config, intervals.Log, intervals.Query, author, comment); err != nil {
+			return err
+		}
+		// Flags include the intervals, so they are re-generated as when intervals are changed
+		flags, err := environment.GenerateFlagsEnv(name, "", "")
+		if err != nil {
+			return fmt.Errorf("error re-generating flags %v", err)
+		}
+		return environment.SaveFlags(name, flags, author, "flags re-generated after "+comment)
+	}
+	return fmt.Errorf("invalid version type %s", version.Type)
+}
+
+// DiffVersions to compare the content of two versions line by line, JSON is indented first
+func DiffVersions(from, to EnvironmentVersion) []DiffLine {
+	return DiffLines(indentJSON(from.Content), indentJSON(to.Content))
+}
+
+// Helper to indent content if it is JSON, so the difference is readable
+func indentJSON(content string) string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(content), "", "  "); err != nil {
+		return content
+	}
+	return out.String()
+}
+
+// Maximum size of the table to compare the lines that changed, bigger changes are shown as all
+// lines removed and added
+const maxDiffCells = 4000000
+
+// DiffLines to compare two texts line by line using the longest common subsequence. Lines equal
+// at the start and the end are not compared
+func DiffLines(from, to string) []DiffLine {
+	a := strings.Split(from, "\n")
+	b := strings.Split(to, "\n")
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var diff []DiffLine
+	for _, line := range a[:prefix] {
+		diff = append(diff, DiffLine{Op: DiffEqual, Text: line})
+	}
+	diff = append(diff, diffChanged(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		diff = append(diff, DiffLine{Op: DiffEqual, Text: line})
+	}
+	return diff
+}
+
+// Helper to compare the lines that changed between two texts
+func diffChanged(a, b []string) []DiffLine {
+	var diff []DiffLine
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			diff = append(diff, DiffLine{Op: DiffRemove, Text: line})
+		}
+		for _, line := range b {
+			diff = append(diff, DiffLine{Op: DiffAdd, Text: line})
+		}
+		return diff
+	}
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, DiffLine{Op: DiffEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: DiffRemove, Text: a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: DiffAdd, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, DiffLine{Op: DiffRemove, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, DiffLine{Op: DiffAdd, Text: b[j]})
+	}
+	return diff
+}
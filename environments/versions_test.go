@@ -0,0 +1,108 @@
+package environments
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffLines(t *testing.T) {
+	diff := DiffLines("a\nb\nc", "a\nc\nd")
+	assert.Equal(t, []DiffLine{
+		{Op: DiffEqual, Text: "a"},
+		{Op: DiffRemove, Text: "b"},
+		{Op: DiffEqual, Text: "c"},
+		{Op: DiffAdd, Text: "d"},
+	}, diff)
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	var from, to []string
+	for i := 0; i < 5000; i++ {
+		from = append(from, fmt.Sprintf("a%d", i))
+		to = append(to, fmt.Sprintf("b%d", i))
+	}
+	header := "{\n"
+	footer := "\n}"
+	diff := DiffLines(header+strings.Join(from, "\n")+footer, header+strings.Join(to, "\n")+footer)
+	assert.Len(t, diff, 10002)
+	assert.Equal(t, DiffLine{Op: DiffEqual, Text: "{"}, diff[0])
+	assert.Equal(t, DiffLine{Op: DiffRemove, Text: "a0"}, diff[1])
+	assert.Equal(t, DiffLine{Op: DiffAdd, Text: "b0"}, diff[5001])
+	assert.Equal(t, DiffLine{Op: DiffEqual, Text: "}"}, diff[10001])
+}
+
+func TestDiffVersions(t *testing.T) {
+	from := EnvironmentVersion{Content: `{"options":{"verbose":false}}`}
+	to := EnvironmentVersion{Content: `{"options":{"verbose":true}}`}
+	assert.Equal(t, []DiffLine{
+		{Op: DiffEqual, Text: "{"},
+		{Op: DiffEqual, Text: `  "options": {`},
+		{Op: DiffRemove, Text: `    "verbose": false`},
+		{Op: DiffAdd, Text: `    "verbose": true`},
+		{Op: DiffEqual, Text: "  }"},
+		{Op: DiffEqual, Text: "}"},
+	}, DiffVersions(from, to))
+}
+
+// Helper to prepare environments in an in-memory database, with the dev environment created
+func testEnvironments(t *testing.T) *Environment {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	// Every connection to an in-memory database is a different database
+	db.DB().SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	envs := CreateEnvironment(db)
+	assert.NoError(t, envs.Create(envs.Empty("dev", "osctrl.example.com")))
+	return envs
+}
+
+func TestRollbackIntervals(t *testing.T) {
+	envs := testEnvironments(t)
+	assert.NoError(t, envs.SaveIntervals("dev", 10, 20, 30, "alice", "faster"))
+	intervals, err := envs.GetVersions("dev", VersionIntervals)
+	assert.NoError(t, err)
+	assert.Len(t, intervals, 2)
+	assert.NoError(t, envs.SaveIntervals("dev", 100, 200, 300, "alice", "slower"))
+	assert.NoError(t, envs.Rollback("dev", intervals[0].ID, "bob"))
+	env, err := envs.Get("dev")
+	assert.NoError(t, err)
+	assert.Equal(t, 30, env.QueryInterval)
+	assert.True(t, strings.Contains(env.Flags, "--distributed_interval=30"))
+	flags, err := envs.GetVersions("dev", VersionFlags)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, flags)
+	assert.Equal(t, env.Flags, flags[0].Content)
+	assert.Equal(t, "bob", flags[0].Author)
+}
+
+func TestSaveConfigurationTemplate(t *testing.T) {
+	envs := testEnvironments(t)
+	template := `{"options": {"host_identifier": "hostname"}{{ if .IsPlatform "darwin" }}, "decorators": {}{{ end }}}`
+	assert.NoError(t, envs.SaveConfiguration("dev", template, "alice", "darwin decorators"))
+	env, err := envs.Get("dev")
+	assert.NoError(t, err)
+	assert.Equal(t, template, env.Configuration)
+	assert.Error(t, envs.SaveConfiguration("dev", `{"options": {}`, "alice", "broken"))
+	assert.Error(t, envs.SaveConfiguration("dev", `{"options": {}{{ if }}`, "alice", "broken template"))
+}
+
+func TestSaveFlagsExtra(t *testing.T) {
+	envs := testEnvironments(t)
+	assert.NoError(t, envs.SaveFlagsExtra("dev", "--verbose=true", "alice"))
+	env, err := envs.Get("dev")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(env.Flags, "\n--verbose=true\n"))
+	flags, err := envs.GetVersions("dev", VersionFlags)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, flags)
+	assert.Equal(t, env.Flags, flags[0].Content)
+	assert.Equal(t, "alice", flags[0].Author)
+	platform, err := GenerateFlagsPlatform(env, FlagsLinux, "osctrl-dev")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(platform, "\n--verbose=true\n"))
+}
@@ -12,10 +12,12 @@ require (
 	github.com/jmpsec/osctrl/admin/sessions v0.2.2
 	github.com/jmpsec/osctrl/backend v0.2.2
 	github.com/jmpsec/osctrl/carves v0.2.2
+	github.com/jmpsec/osctrl/configs v0.2.2
 	github.com/jmpsec/osctrl/environments v0.2.2
 	github.com/jmpsec/osctrl/logging v0.2.2
 	github.com/jmpsec/osctrl/metrics v0.2.2
 	github.com/jmpsec/osctrl/nodes v0.2.2
+	github.com/jmpsec/osctrl/packs v0.2.2
 	github.com/jmpsec/osctrl/queries v0.2.2
 	github.com/jmpsec/osctrl/settings v0.2.2
 	github.com/jmpsec/osctrl/tags v0.2.2
@@ -23,6 +25,7 @@ require (
 	github.com/jmpsec/osctrl/types v0.2.2
 	github.com/jmpsec/osctrl/users v0.2.2
 	github.com/jmpsec/osctrl/utils v0.2.2
+	github.com/mattn/go-sqlite3 v2.0.1+incompatible
 	github.com/olekukonko/tablewriter v0.0.4
 	github.com/russellhaering/goxmldsig v0.0.0-20180430223755-7acd5e4a6ef7 // indirect
 	github.com/spf13/viper v1.6.2
@@ -33,12 +36,16 @@ replace github.com/jmpsec/osctrl/backend => ./backend
 
 replace github.com/jmpsec/osctrl/carves => ./carves
 
+replace github.com/jmpsec/osctrl/configs => ./configs
+
 replace github.com/jmpsec/osctrl/environments => ./environments
 
 replace github.com/jmpsec/osctrl/metrics => ./metrics
 
 replace github.com/jmpsec/osctrl/nodes => ./nodes
 
+replace github.com/jmpsec/osctrl/packs => ./packs
+
 replace github.com/jmpsec/osctrl/queries => ./queries
 
 replace github.com/jmpsec/osctrl/settings => ./settings
@@ -0,0 +1,276 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/nodes"
+)
+
+const (
+	// AggregateEqual to keep rows where the column has the value
+	AggregateEqual string = "eq"
+	// AggregateNotEqual to keep rows where the column does not have the value
+	AggregateNotEqual string = "ne"
+	// AggregateContains to keep rows where the column contains the value
+	AggregateContains string = "contains"
+	// AggregateMatches to keep rows where the column matches the value as regular expression
+	AggregateMatches string = "matches"
+)
+
+// DefaultAggregateLimit to limit the number of groups returned when no limit is requested
+const DefaultAggregateLimit = 100
+
+// AggregateFilter to keep only the result rows where a column satisfies a condition
+type AggregateFilter struct {
+	Column   string `json:"column"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+	re       *regexp.Regexp
+}
+
+// AggregateRequest to group the results of a query by one or more columns
+type AggregateRequest struct {
+	GroupBy       []string          `json:"group_by"`
+	Filters       []AggregateFilter `json:"filters"`
+	LeastFrequent bool              `json:"least_frequent"`
+	Limit         int               `json:"limit"`
+}
+
+// AggregateBucket to hold the values of the group-by columns and how often they were seen
+type AggregateBucket struct {
+	Values []string `json:"values"`
+	Count  int      `json:"count"`
+	Nodes  int      `json:"nodes"`
+}
+
+// AggregateResult to return the groups of results of a query
+type AggregateResult struct {
+	GroupBy []string          `json:"group_by"`
+	Columns []string          `json:"columns"`
+	Rows    int               `json:"rows"`
+	Nodes   int               `json:"nodes"`
+	Groups  int               `json:"groups"`
+	Buckets []AggregateBucket `json:"buckets"`
+}
+
+// ParseAggregateFilter to parse a filter written as column=value, column!=value,
+// column~value (contains) or column=~regex (matches)
+func ParseAggregateFilter(filter string) (AggregateFilter, error) {
+	i := strings.IndexAny(filter, "=!~")
+	if i <= 0 {
+		return AggregateFilter{}, fmt.Errorf("invalid filter %q", filter)
+	}
+	f := AggregateFilter{Column: strings.TrimSpace(filter[:i])}
+	rest := filter[i:]
+	switch {
+	case strings.HasPrefix(rest, "!="):
+		f.Operator, f.Value = AggregateNotEqual, rest[2:]
+	case strings.HasPrefix(rest, "=~"):
+		f.Operator, f.Value = AggregateMatches, rest[2:]
+	case strings.HasPrefix(rest, "="):
+		f.Operator, f.Value = AggregateEqual, rest[1:]
+	case strings.HasPrefix(rest, "~"):
+		f.Operator, f.Value = AggregateContains, rest[1:]
+	default:
+		return AggregateFilter{}, fmt.Errorf("invalid filter %q", filter)
+	}
+	return f, nil
+}
+
+// Helper to verify a filter and compile regular expressions
+func (f *AggregateFilter) prepare() error {
+	if f.Column == "" {
+		return fmt.Errorf("filter without column")
+	}
+	switch f.Operator {
+	case AggregateEqual, AggregateNotEqual, AggregateContains:
+		return nil
+	case AggregateMatches:
+		re, err := regexp.Compile(f.Value)
+		if err != nil {
+			return fmt.Errorf("invalid expression for %s - %v", f.Column, err)
+		}
+		f.re = re
+		return nil
+	}
+	return fmt.Errorf("invalid operator %q for %s", f.Operator, f.Column)
+}
+
+// Helper to check if a row satisfies a filter, missing columns are empty
+func (f *AggregateFilter) match(row map[string]string) bool {
+	value := row[f.Column]
+	switch f.Operator {
+	case AggregateEqual:
+		return value == f.Value
+	case AggregateNotEqual:
+		return value != f.Value
+	case AggregateContains:
+		return strings.Contains(value, f.Value)
+	case AggregateMatches:
+		return f.re.MatchString(value)
+	}
+	return false
+}
+
+// Aggregator to group result rows as they are added, so results are never kept in memory
+type Aggregator struct {
+	request AggregateRequest
+	buckets map[string]*aggregateBucket
+	columns map[string]bool
+	nodes   map[string]bool
+	rows    int
+}
+
+type aggregateBucket struct {
+	values []string
+	count  int
+	nodes  map[string]bool
+}
+
+// NewAggregator to initialize an aggregator, verifying the request
+func NewAggregator(request AggregateRequest) (*Aggregator, error) {
+	for i := range request.Filters {
+		if err := request.Filters[i].prepare(); err != nil {
+			return nil, err
+		}
+	}
+	for _, g := range request.GroupBy {
+		if g == "" {
+			return nil, fmt.Errorf("empty group-by column")
+		}
+	}
+	if request.Limit <= 0 {
+		request.Limit = DefaultAggregateLimit
+	}
+	return &Aggregator{
+		request: request,
+		buckets: make(map[string]*aggregateBucket),
+		columns: make(map[string]bool),
+		nodes:   make(map[string]bool),
+	}, nil
+}
+
+// Uses to check if the request needs a column, to skip getting node details that are not used
+func (a *Aggregator) Uses(column string) bool {
+	for _, g := range a.request.GroupBy {
+		if g == column {
+			return true
+		}
+	}
+	for _, f := range a.request.Filters {
+		if f.Column == column {
+			return true
+		}
+	}
+	return false
+}
+
+// Add to aggregate the result rows of one node
+func (a *Aggregator) Add(uuid string, rows []map[string]string) {
+	for _, row := range rows {
+		for k := range row {
+			a.columns[k] = true
+		}
+		if !a.matchAll(row) {
+			continue
+		}
+		a.rows++
+		a.nodes[uuid] = true
+		if len(a.request.GroupBy) == 0 {
+			continue
+		}
+		values := make([]string, len(a.request.GroupBy))
+		for i, g := range a.request.GroupBy {
+			values[i] = row[g]
+		}
+		key := strings.Join(values, "\x00")
+		b, ok := a.buckets[key]
+		if !ok {
+			b = &aggregateBucket{values: values, nodes: make(map[string]bool)}
+			a.buckets[key] = b
+		}
+		b.count++
+		b.nodes[uuid] = true
+	}
+}
+
+// Helper to check if a row satisfies all filters
+func (a *Aggregator) matchAll(row map[string]string) bool {
+	for i := range a.request.Filters {
+		if !a.request.Filters[i].match(row) {
+			return false
+		}
+	}
+	return true
+}
+
+// Result to get the groups, ordered by distinct nodes and then by rows. Most frequent values come
+// first unless least frequent values are requested, to stack rare values when hunting
+func (a *Aggregator) Result() AggregateResult {
+	result := AggregateResult{
+		GroupBy: a.request.GroupBy,
+		Columns: sortedColumns(a.columns),
+		Rows:    a.rows,
+		Nodes:   len(a.nodes),
+		Groups:  len(a.buckets),
+		Buckets: []AggregateBucket{},
+	}
+	for _, b := range a.buckets {
+		result.Buckets = append(result.Buckets, AggregateBucket{Values: b.values, Count: b.count, Nodes: len(b.nodes)})
+	}
+	least := a.request.LeastFrequent
+	sort.Slice(result.Buckets, func(i, j int) bool {
+		bi, bj := result.Buckets[i], result.Buckets[j]
+		if bi.Nodes != bj.Nodes {
+			return (bi.Nodes < bj.Nodes) == least
+		}
+		if bi.Count != bj.Count {
+			return (bi.Count < bj.Count) == least
+		}
+		return strings.Join(bi.Values, "\x00") < strings.Join(bj.Values, "\x00")
+	})
+	if len(result.Buckets) > a.request.Limit {
+		result.Buckets = result.Buckets[:a.request.Limit]
+	}
+	return result
+}
+
+// AggregateQueryLogs to aggregate the results of an on-demand query, see AggregateQueryResults
+func (logDB *LoggerDB) AggregateQueryLogs(name string, request AggregateRequest, nodesmgr *nodes.NodeManager) (AggregateResult, error) {
+	return AggregateQueryResults(logDB.Database, nodesmgr, name, request)
+}
+
+// AggregateQueryResults to group the results of an on-demand query across all nodes. Node details
+// are available as the same columns used to export results
+func AggregateQueryResults(database *gorm.DB, nodesmgr *nodes.NodeManager, name string, request AggregateRequest) (AggregateResult, error) {
+	aggregator, err := NewAggregator(request)
+	if err != nil {
+		return AggregateResult{}, err
+	}
+	withHostname := aggregator.Uses(ExportColumnHostname)
+	err = eachQueryLog(database, name, func(l OsqueryQueryData) error {
+		rows, err := FlattenQueryData(l.Data)
+		if err != nil {
+			return fmt.Errorf("results from %s - %v", l.UUID, err)
+		}
+		var hostname string
+		if withHostname {
+			hostname = exportHostname(nodesmgr, l.UUID)
+		}
+		for _, row := range rows {
+			row[ExportColumnUUID] = l.UUID
+			row[ExportColumnHostname] = hostname
+			row[ExportColumnEnvironment] = l.Environment
+		}
+		aggregator.Add(l.UUID, rows)
+		return nil
+	})
+	if err != nil {
+		return AggregateResult{}, err
+	}
+	return aggregator.Result(), nil
+}
@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"testing"
+)
+
+func TestParseAggregateFilter(t *testing.T) {
+	tests := []struct {
+		filter   string
+		expected AggregateFilter
+	}{
+		{"name=osqueryd", AggregateFilter{Column: "name", Operator: AggregateEqual, Value: "osqueryd"}},
+		{"name!=osqueryd", AggregateFilter{Column: "name", Operator: AggregateNotEqual, Value: "osqueryd"}},
+		{"path~/tmp/", AggregateFilter{Column: "path", Operator: AggregateContains, Value: "/tmp/"}},
+		{"path=~^/tmp/.*\\.sh$", AggregateFilter{Column: "path", Operator: AggregateMatches, Value: "^/tmp/.*\\.sh$"}},
+		{"cmdline=a=b", AggregateFilter{Column: "cmdline", Operator: AggregateEqual, Value: "a=b"}},
+	}
+	for _, tt := range tests {
+		f, err := ParseAggregateFilter(tt.filter)
+		if err != nil {
+			t.Errorf("ParseAggregateFilter(%q) error %v", tt.filter, err)
+			continue
+		}
+		if f.Column != tt.expected.Column || f.Operator != tt.expected.Operator || f.Value != tt.expected.Value {
+			t.Errorf("ParseAggregateFilter(%q) = %+v, expected %+v", tt.filter, f, tt.expected)
+		}
+	}
+	for _, filter := range []string{"", "name", "=osqueryd", "name!osqueryd"} {
+		if _, err := ParseAggregateFilter(filter); err == nil {
+			t.Errorf("ParseAggregateFilter(%q) expected error", filter)
+		}
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	a, err := NewAggregator(AggregateRequest{GroupBy: []string{"name"}})
+	if err != nil {
+		t.Fatalf("NewAggregator() error %v", err)
+	}
+	a.Add("AAAA", []map[string]string{{"name": "osqueryd"}, {"name": "osqueryd"}, {"name": "sshd"}})
+	a.Add("BBBB", []map[string]string{{"name": "osqueryd"}, {"name": "backdoor"}})
+	a.Add("CCCC", []map[string]string{{"name": "osqueryd"}, {"name": "sshd"}})
+	result := a.Result()
+	if result.Rows != 7 || result.Nodes != 3 || result.Groups != 3 {
+		t.Fatalf("Result() = %+v", result)
+	}
+	first := result.Buckets[0]
+	if first.Values[0] != "osqueryd" || first.Count != 4 || first.Nodes != 3 {
+		t.Errorf("Result() most frequent = %+v", first)
+	}
+	// Stack rare values first
+	a, _ = NewAggregator(AggregateRequest{GroupBy: []string{"name"}, LeastFrequent: true, Limit: 1})
+	a.Add("AAAA", []map[string]string{{"name": "osqueryd"}, {"name": "sshd"}})
+	a.Add("BBBB", []map[string]string{{"name": "osqueryd"}, {"name": "backdoor"}, {"name": "backdoor"}})
+	a.Add("CCCC", []map[string]string{{"name": "osqueryd"}, {"name": "sshd"}})
+	result = a.Result()
+	if len(result.Buckets) != 1 || result.Buckets[0].Values[0] != "backdoor" || result.Buckets[0].Nodes != 1 || result.Buckets[0].Count != 2 {
+		t.Errorf("Result() least frequent = %+v", result.Buckets)
+	}
+	// Filters apply before grouping
+	f, _ := ParseAggregateFilter("path~/tmp/")
+	a, _ = NewAggregator(AggregateRequest{GroupBy: []string{"name", "path"}, Filters: []AggregateFilter{f}})
+	a.Add("AAAA", []map[string]string{{"name": "a", "path": "/tmp/a"}, {"name": "b", "path": "/usr/bin/b"}})
+	result = a.Result()
+	if result.Rows != 1 || len(result.Buckets) != 1 || result.Buckets[0].Values[1] != "/tmp/a" {
+		t.Errorf("Result() filtered = %+v", result)
+	}
+	if _, err := NewAggregator(AggregateRequest{Filters: []AggregateFilter{{Column: "name", Operator: AggregateMatches, Value: "("}}}); err == nil {
+		t.Errorf("NewAggregator() expected error for invalid expression")
+	}
+	if _, err := NewAggregator(AggregateRequest{Filters: []AggregateFilter{{Column: "name", Operator: "like"}}}); err == nil {
+		t.Errorf("NewAggregator() expected error for invalid operator")
+	}
+}
+
+func TestAggregateQueryResults(t *testing.T) {
+	db := testQueryLogsDB(t,
+		storedQueryLog("q1", "AAAA", 0, `[{"name":"osqueryd"},{"name":"sshd"}]`),
+		storedQueryLog("q1", "BBBB", 0, `[{"name":"osqueryd"}]`),
+		storedQueryLog("q1", "CCCC", 1, `""`),
+	)
+	defer db.Close()
+	result, err := AggregateQueryResults(db, nil, "q1", AggregateRequest{GroupBy: []string{"name"}})
+	if err != nil {
+		t.Fatalf("AggregateQueryResults() error %v", err)
+	}
+	if result.Rows != 3 || result.Nodes != 2 || result.Buckets[0].Values[0] != "osqueryd" || result.Buckets[0].Nodes != 2 {
+		t.Errorf("AggregateQueryResults() = %+v", result)
+	}
+}
@@ -0,0 +1,437 @@
+package logging
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/nodes"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// AnalysisSourceQuery to load the results of an on-demand query
+	AnalysisSourceQuery string = "query"
+	// AnalysisSourceScheduled to load the results of a scheduled query by name
+	AnalysisSourceScheduled string = "scheduled"
+)
+
+const (
+	// DefaultAnalysisRows to limit the rows returned when no limit is requested
+	DefaultAnalysisRows = 1000
+	// MaxAnalysisRows to limit the rows returned by any analysis
+	MaxAnalysisRows = 10000
+	// DefaultAnalysisTimeout in seconds when no timeout is requested
+	DefaultAnalysisTimeout = 30
+	// MaxAnalysisTimeout in seconds for any analysis, including loading results
+	MaxAnalysisTimeout = 120
+	// MaxAnalysisLoadRows to limit the result rows loaded for one analysis, they are kept in memory
+	MaxAnalysisLoadRows = 250000
+)
+
+// Columns with details of scheduled results
+const (
+	AnalysisColumnAction string = "result_action"
+	AnalysisColumnEpoch  string = "result_epoch"
+)
+
+// Column types used in analysis tables
+const (
+	analysisInteger string = "INTEGER"
+	analysisReal    string = "REAL"
+	analysisText    string = "TEXT"
+)
+
+// SQLITE_RECURSIVE is not exported by the driver, needed for WITH RECURSIVE
+const analysisRecursive = 33
+
+// Table names that can be used without quoting
+var analysisTableRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,63}$`)
+
+// AnalysisSource to define results to be loaded as a table
+type AnalysisSource struct {
+	Table string    `json:"table"`
+	Type  string    `json:"type"`
+	Name  string    `json:"name"`
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+}
+
+// AnalysisRequest to run SQL over the results loaded from one or more sources
+type AnalysisRequest struct {
+	Sources []AnalysisSource `json:"sources"`
+	SQL     string           `json:"sql"`
+	MaxRows int              `json:"max_rows"`
+	Timeout int              `json:"timeout"`
+}
+
+// AnalysisResult to return the rows of an analysis and the rows loaded in each table
+type AnalysisResult struct {
+	Tables    map[string]int  `json:"tables"`
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Truncated bool            `json:"truncated"`
+}
+
+// AnalysisTable to hold the rows of results to be loaded in a table with typed columns
+type AnalysisTable struct {
+	Name    string
+	Columns []string
+	Types   []string
+	Rows    []map[string]string
+}
+
+// ValidAnalysisTable to check if a name can be used as table in an analysis
+func ValidAnalysisTable(name string) bool {
+	return analysisTableRe.MatchString(name)
+}
+
+// AnalysisTableName to generate a valid table name from a query name
+func AnalysisTableName(name string) string {
+	table := []byte(name)
+	for i, c := range table {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			table[i] = '_'
+		}
+	}
+	result := string(table)
+	if result == "" || (result[0] >= '0' && result[0] <= '9') {
+		result = "t_" + result
+	}
+	if len(result) > 64 {
+		result = result[:64]
+	}
+	return result
+}
+
+// NewAnalysisTable to prepare rows of results as a table, inferring the type of each column. The
+// node columns and any columns passed are always created, so sources without rows can be queried
+func NewAnalysisTable(name string, rows []map[string]string, columns ...string) AnalysisTable {
+	seen := make(map[string]bool)
+	for _, c := range columns {
+		seen[c] = true
+	}
+	for _, row := range rows {
+		for k := range row {
+			seen[k] = true
+		}
+	}
+	t := AnalysisTable{Name: name, Columns: sortedColumns(seen), Rows: rows}
+	for _, c := range t.Columns {
+		t.Types = append(t.Types, inferColumnType(rows, c))
+	}
+	return t
+}
+
+// Helper to get the type of a column, empty values are ignored because they are stored as NULL
+func inferColumnType(rows []map[string]string, column string) string {
+	isInteger, isReal, seen := true, true, false
+	for _, row := range rows {
+		value := row[column]
+		if value == "" {
+			continue
+		}
+		seen = true
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			isInteger = false
+		}
+		if f, err := strconv.ParseFloat(value, 64); err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			isReal = false
+		}
+		if !isInteger && !isReal {
+			break
+		}
+	}
+	switch {
+	case !seen:
+		return analysisText
+	case isInteger:
+		return analysisInteger
+	case isReal:
+		return analysisReal
+	}
+	return analysisText
+}
+
+// Helper to convert a value to the type of its column
+func analysisValue(value, columnType string) interface{} {
+	if value == "" && columnType != analysisText {
+		return nil
+	}
+	switch columnType {
+	case analysisInteger:
+		v, _ := strconv.ParseInt(value, 10, 64)
+		return v
+	case analysisReal:
+		v, _ := strconv.ParseFloat(value, 64)
+		return v
+	}
+	return value
+}
+
+// Helper to quote column names, they come from results and can be anything
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// Helper to allow only statements that read data, once results are loaded
+func analysisAuthorizer(op int, arg1, arg2, arg3 string) int {
+	switch op {
+	case sqlite3.SQLITE_SELECT, sqlite3.SQLITE_READ, sqlite3.SQLITE_FUNCTION, analysisRecursive:
+		return sqlite3.SQLITE_OK
+	}
+	return sqlite3.SQLITE_DENY
+}
+
+// AnalyzeResults to run an analysis over results stored by the logger, see AnalyzeResults
+func (logDB *LoggerDB) AnalyzeResults(ctx context.Context, request AnalysisRequest, nodesmgr *nodes.NodeManager) (AnalysisResult, error) {
+	return AnalyzeResults(ctx, logDB.Database, nodesmgr, request)
+}
+
+// AnalyzeResults to load results of on-demand and scheduled queries into an in-memory SQLite
+// database, one table per source, and run read-only SQL over them within the request limits
+func AnalyzeResults(ctx context.Context, database *gorm.DB, nodesmgr *nodes.NodeManager, request AnalysisRequest) (AnalysisResult, error) {
+	if strings.TrimSpace(request.SQL) == "" {
+		return AnalysisResult{}, fmt.Errorf("empty SQL")
+	}
+	if len(request.Sources) == 0 {
+		return AnalysisResult{}, fmt.Errorf("no sources")
+	}
+	if request.MaxRows <= 0 {
+		request.MaxRows = DefaultAnalysisRows
+	}
+	if request.MaxRows > MaxAnalysisRows {
+		request.MaxRows = MaxAnalysisRows
+	}
+	if request.Timeout <= 0 {
+		request.Timeout = DefaultAnalysisTimeout
+	}
+	if request.Timeout > MaxAnalysisTimeout {
+		request.Timeout = MaxAnalysisTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(request.Timeout)*time.Second)
+	defer cancel()
+	tableNames := make(map[string]bool)
+	hostnames := make(map[string]string)
+	var tables []AnalysisTable
+	loaded := 0
+	for _, s := range request.Sources {
+		if s.Name == "" {
+			return AnalysisResult{}, fmt.Errorf("source without name")
+		}
+		if s.Table == "" {
+			s.Table = AnalysisTableName(s.Name)
+		}
+		if !ValidAnalysisTable(s.Table) {
+			return AnalysisResult{}, fmt.Errorf("invalid table name %s", s.Table)
+		}
+		if tableNames[strings.ToLower(s.Table)] {
+			return AnalysisResult{}, fmt.Errorf("duplicated table name %s", s.Table)
+		}
+		tableNames[strings.ToLower(s.Table)] = true
+		rows, err := loadAnalysisSource(ctx, database, nodesmgr, s, hostnames, MaxAnalysisLoadRows-loaded)
+		if err != nil {
+			return AnalysisResult{}, err
+		}
+		loaded += len(rows)
+		var columns []string
+		if s.Type == AnalysisSourceScheduled {
+			columns = []string{AnalysisColumnAction, AnalysisColumnEpoch}
+		}
+		tables = append(tables, NewAnalysisTable(s.Table, rows, columns...))
+	}
+	return RunAnalysis(ctx, tables, request.SQL, request.MaxRows)
+}
+
+// Helper to load the rows of one source, with node details
+func loadAnalysisSource(ctx context.Context, database *gorm.DB, nodesmgr *nodes.NodeManager, s AnalysisSource, hostnames map[string]string, limit int) ([]map[string]string, error) {
+	var rows []map[string]string
+	hostname := func(uuid string) string {
+		if h, ok := hostnames[uuid]; ok {
+			return h
+		}
+		hostnames[uuid] = exportHostname(nodesmgr, uuid)
+		return hostnames[uuid]
+	}
+	add := func(r []map[string]string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if len(rows)+len(r) > limit {
+			return fmt.Errorf("too many rows to load, up to %d can be analyzed", MaxAnalysisLoadRows)
+		}
+		rows = append(rows, r...)
+		return nil
+	}
+	var err error
+	switch s.Type {
+	case AnalysisSourceQuery:
+		err = eachQueryLog(database, s.Name, func(l OsqueryQueryData) error {
+			r, err := FlattenQueryData(l.Data)
+			if err != nil {
+				return fmt.Errorf("results from %s - %v", l.UUID, err)
+			}
+			for _, row := range r {
+				row[ExportColumnUUID] = l.UUID
+				row[ExportColumnHostname] = hostname(l.UUID)
+				row[ExportColumnEnvironment] = l.Environment
+			}
+			return add(r)
+		})
+	case AnalysisSourceScheduled:
+		err = eachResultLog(database, s.Name, s.Since, s.Until, func(l OsqueryResultData) error {
+			var raw map[string]interface{}
+			if len(l.Columns) > 0 {
+				if err := json.Unmarshal(l.Columns, &raw); err != nil {
+					return fmt.Errorf("results from %s - %v", l.UUID, err)
+				}
+			}
+			row := flattenRow(raw)
+			row[ExportColumnUUID] = l.UUID
+			row[ExportColumnHostname] = hostname(l.UUID)
+			row[ExportColumnEnvironment] = l.Environment
+			row[AnalysisColumnAction] = l.Action
+			row[AnalysisColumnEpoch] = strconv.FormatInt(l.Epoch, 10)
+			return add([]map[string]string{row})
+		})
+	default:
+		return nil, fmt.Errorf("invalid source type %q", s.Type)
+	}
+	return rows, err
+}
+
+// Helper to iterate over scheduled results by name within a time window, zero times are not used
+func eachResultLog(database *gorm.DB, name string, since, until time.Time, fn func(OsqueryResultData) error) error {
+	query := database.Model(&OsqueryResultData{}).Where("name = ?", name)
+	if !since.IsZero() {
+		query = query.Where("created_at >= ?", since)
+	}
+	if !until.IsZero() {
+		query = query.Where("created_at <= ?", until)
+	}
+	rows, err := query.Order("id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l OsqueryResultData
+		if err := database.ScanRows(rows, &l); err != nil {
+			return err
+		}
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// RunAnalysis to load tables into an in-memory SQLite database and run a read-only query,
+// returning up to maxRows rows
+func RunAnalysis(ctx context.Context, tables []AnalysisTable, query string, maxRows int) (AnalysisResult, error) {
+	result := AnalysisResult{Tables: make(map[string]int), Rows: [][]interface{}{}}
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return result, err
+	}
+	defer db.Close()
+	// Every connection to :memory: is a different database, so only one is used
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+	for _, t := range tables {
+		if err := loadAnalysisTable(ctx, conn, t); err != nil {
+			return result, fmt.Errorf("loading %s - %v", t.Name, err)
+		}
+		result.Tables[t.Name] = len(t.Rows)
+	}
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected connection")
+		}
+		c.RegisterAuthorizer(analysisAuthorizer)
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+	if result.Columns, err = rows.Columns(); err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		if len(result.Rows) >= maxRows {
+			result.Truncated = true
+			break
+		}
+		values := make([]interface{}, len(result.Columns))
+		pointers := make([]interface{}, len(values))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return result, err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result, rows.Err()
+}
+
+// Helper to create and fill one table
+func loadAnalysisTable(ctx context.Context, conn *sql.Conn, t AnalysisTable) error {
+	// SQLite does not allow tables without columns
+	if len(t.Columns) == 0 {
+		t.Columns = sortedColumns(nil)
+		t.Types = []string{analysisText, analysisText, analysisText}
+	}
+	definitions := make([]string, len(t.Columns))
+	placeholders := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		definitions[i] = quoteIdentifier(c) + " " + t.Types[i]
+		placeholders[i] = "?"
+	}
+	create := fmt.Sprintf("CREATE TABLE %s (%s)", t.Name, strings.Join(definitions, ", "))
+	if _, err := conn.ExecContext(ctx, create); err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s VALUES (%s)", t.Name, strings.Join(placeholders, ", ")))
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	values := make([]interface{}, len(t.Columns))
+	for _, row := range t.Rows {
+		for i, c := range t.Columns {
+			values[i] = analysisValue(row[c], t.Types[i])
+		}
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAnalysisTableName(t *testing.T) {
+	tests := map[string]string{
+		"processes":         "processes",
+		"pack_ir_processes": "pack_ir_processes",
+		"pack/ir:listening": "pack_ir_listening",
+		"1234-abcd":         "t_1234_abcd",
+		"":                  "t_",
+	}
+	for name, expected := range tests {
+		if table := AnalysisTableName(name); table != expected || !ValidAnalysisTable(table) {
+			t.Errorf("AnalysisTableName(%q) = %q, expected %q", name, table, expected)
+		}
+	}
+}
+
+func TestNewAnalysisTable(t *testing.T) {
+	table := NewAnalysisTable("processes", []map[string]string{
+		{"pid": "1", "name": "launchd", "cpu": "0.5", "port": ""},
+		{"pid": "42", "name": "osqueryd", "cpu": "12", "port": ""},
+	})
+	types := make(map[string]string)
+	for i, c := range table.Columns {
+		types[c] = table.Types[i]
+	}
+	expected := map[string]string{"pid": analysisInteger, "cpu": analysisReal, "name": analysisText, "port": analysisText}
+	for c, e := range expected {
+		if types[c] != e {
+			t.Errorf("NewAnalysisTable() type of %s = %s, expected %s", c, types[c], e)
+		}
+	}
+}
+
+func TestRunAnalysis(t *testing.T) {
+	processes := NewAnalysisTable("processes", []map[string]string{
+		{ExportColumnUUID: "AAAA", "pid": "1", "name": "launchd"},
+		{ExportColumnUUID: "AAAA", "pid": "900", "name": "nc"},
+		{ExportColumnUUID: "BBBB", "pid": "1", "name": "launchd"},
+	})
+	sockets := NewAnalysisTable("sockets", []map[string]string{
+		{ExportColumnUUID: "AAAA", "pid": "900", "port": "4444"},
+	})
+	tables := []AnalysisTable{processes, sockets}
+	result, err := RunAnalysis(context.Background(), tables,
+		"SELECT p.node_uuid, p.name, s.port FROM processes p JOIN sockets s ON p.node_uuid = s.node_uuid AND p.pid = s.pid", 10)
+	if err != nil {
+		t.Fatalf("RunAnalysis() error %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][1] != "nc" || result.Rows[0][2] != int64(4444) {
+		t.Errorf("RunAnalysis() rows = %v", result.Rows)
+	}
+	if result.Tables["processes"] != 3 || result.Tables["sockets"] != 1 {
+		t.Errorf("RunAnalysis() tables = %v", result.Tables)
+	}
+	result, err = RunAnalysis(context.Background(), tables, "SELECT * FROM processes", 2)
+	if err != nil || len(result.Rows) != 2 || !result.Truncated {
+		t.Errorf("RunAnalysis() limited = %v, %v", result, err)
+	}
+	result, err = RunAnalysis(context.Background(), tables, "WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM n WHERE x < 3) SELECT count(*) FROM n", 10)
+	if err != nil || len(result.Rows) != 1 || result.Rows[0][0] != int64(3) {
+		t.Errorf("RunAnalysis() recursive = %v, %v", result, err)
+	}
+	for _, query := range []string{
+		"DELETE FROM processes",
+		"INSERT INTO processes (pid) VALUES (2)",
+		"DROP TABLE processes",
+		"ATTACH DATABASE '/tmp/other.db' AS other",
+		"PRAGMA table_info(processes)",
+	} {
+		if _, err := RunAnalysis(context.Background(), tables, query, 10); err == nil {
+			t.Errorf("RunAnalysis(%q) expected error", query)
+		}
+	}
+}
+
+func TestAnalyzeResultsStored(t *testing.T) {
+	db := testQueryLogsDB(t,
+		storedQueryLog("q1", "AAAA", 0, `[{"name":"osqueryd","pid":"42"},{"name":"nc","pid":"900"}]`),
+		storedQueryLog("q1", "BBBB", 0, `[{"name":"osqueryd","pid":"43"}]`),
+		storedQueryLog("q1", "CCCC", 1, `""`),
+	)
+	defer db.Close()
+	request := AnalysisRequest{
+		Sources: []AnalysisSource{{Table: "processes", Type: AnalysisSourceQuery, Name: "q1"}},
+		SQL:     "SELECT name, count(*) AS c FROM processes GROUP BY name ORDER BY c DESC",
+	}
+	result, err := AnalyzeResults(context.Background(), db, nil, request)
+	if err != nil {
+		t.Fatalf("AnalyzeResults() error %v", err)
+	}
+	if result.Tables["processes"] != 3 || len(result.Rows) != 2 || result.Rows[0][0] != "osqueryd" || result.Rows[0][1] != int64(2) {
+		t.Errorf("AnalyzeResults() = %+v", result)
+	}
+}
+
+func TestAnalyzeResultsEmpty(t *testing.T) {
+	db := testQueryLogsDB(t)
+	defer db.Close()
+	request := AnalysisRequest{
+		Sources: []AnalysisSource{
+			{Table: "processes", Type: AnalysisSourceQuery, Name: "q1"},
+			{Table: "changes", Type: AnalysisSourceScheduled, Name: "pack_processes"},
+		},
+		SQL: "SELECT count(*) FROM processes p JOIN changes c ON p.node_uuid = c.node_uuid WHERE c.result_action = 'added'",
+	}
+	result, err := AnalyzeResults(context.Background(), db, nil, request)
+	if err != nil {
+		t.Fatalf("AnalyzeResults() error %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] != int64(0) {
+		t.Errorf("AnalyzeResults() rows = %v", result.Rows)
+	}
+	result, err = RunAnalysis(context.Background(), []AnalysisTable{{Name: "empty"}}, "SELECT node_uuid FROM empty", 10)
+	if err != nil || len(result.Rows) != 0 {
+		t.Errorf("RunAnalysis() without columns = %v, %v", result, err)
+	}
+}
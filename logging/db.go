@@ -246,6 +246,23 @@ func (logDB *LoggerDB) QueryLogs(name string) ([]OsqueryQueryData, error) {
 	return logs, nil
 }
 
+// QueryLogsPage will retrieve one page of query logs and the total of logs, newest first if requested
+func (logDB *LoggerDB) QueryLogsPage(name string, offset, limit int, newest bool) ([]OsqueryQueryData, int, error) {
+	var logs []OsqueryQueryData
+	var total int
+	if err := logDB.Database.Model(&OsqueryQueryData{}).Where("name = ?", name).Count(&total).Error; err != nil {
+		return logs, 0, err
+	}
+	order := "id asc"
+	if newest {
+		order = "id desc"
+	}
+	if err := logDB.Database.Where("name = ?", name).Order(order).Offset(offset).Limit(limit).Find(&logs).Error; err != nil {
+		return logs, total, err
+	}
+	return logs, total, nil
+}
+
 // StatusLogs will retrieve all status logs
 func (logDB *LoggerDB) StatusLogs(uuid, environment string, seconds int64) ([]OsqueryStatusData, error) {
 	var logs []OsqueryStatusData
@@ -0,0 +1,244 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/queries"
+)
+
+// RowChange to hold a row that has the same key columns but different values
+type RowChange struct {
+	Before map[string]string `json:"before"`
+	After  map[string]string `json:"after"`
+}
+
+// RowsDiff to hold the rows added, removed and changed between two sets of results
+type RowsDiff struct {
+	Added   []map[string]string `json:"added"`
+	Removed []map[string]string `json:"removed"`
+	Changed []RowChange         `json:"changed"`
+}
+
+// Empty to check if there are no differences
+func (d RowsDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// NodeDiff to hold the differences in the results of one node between two runs
+type NodeDiff struct {
+	UUID     string `json:"uuid"`
+	Hostname string `json:"hostname"`
+	InBase   bool   `json:"in_base"`
+	InTarget bool   `json:"in_target"`
+	RowsDiff
+}
+
+// RunsDiff to hold the differences per node between two runs of the same query
+type RunsDiff struct {
+	Base    string     `json:"base"`
+	Target  string     `json:"target"`
+	Keys    []string   `json:"keys"`
+	Added   int        `json:"added"`
+	Removed int        `json:"removed"`
+	Changed int        `json:"changed"`
+	Nodes   []NodeDiff `json:"nodes"`
+}
+
+// NodesDiff to hold the differences between the results of two nodes for the same query
+type NodesDiff struct {
+	Query          string   `json:"query"`
+	Base           string   `json:"base"`
+	BaseHostname   string   `json:"base_hostname"`
+	Target         string   `json:"target"`
+	TargetHostname string   `json:"target_hostname"`
+	Keys           []string `json:"keys"`
+	RowsDiff
+}
+
+// Helper to get the identity of a row from all its columns
+func rowIdentity(row map[string]string) string {
+	// Keys are sorted when encoding maps
+	encoded, _ := json.Marshal(row)
+	return string(encoded)
+}
+
+// Helper to get the identity of a row from the key columns
+func rowKey(row map[string]string, keys []string) string {
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		values[i] = row[k]
+	}
+	encoded, _ := json.Marshal(values)
+	return string(encoded)
+}
+
+// DiffRows to compare two sets of result rows. Rows are compared with all their columns, and
+// when key columns are provided, removed and added rows with the same keys are paired as changed
+func DiffRows(base, target []map[string]string, keys []string) RowsDiff {
+	diff := RowsDiff{
+		Added:   []map[string]string{},
+		Removed: []map[string]string{},
+		Changed: []RowChange{},
+	}
+	// Rows can be repeated, so they are counted
+	pending := make(map[string]int)
+	for _, row := range base {
+		pending[rowIdentity(row)]++
+	}
+	var added []map[string]string
+	for _, row := range target {
+		id := rowIdentity(row)
+		if pending[id] > 0 {
+			pending[id]--
+			continue
+		}
+		added = append(added, row)
+	}
+	var removed []map[string]string
+	for _, row := range base {
+		id := rowIdentity(row)
+		if pending[id] > 0 {
+			pending[id]--
+			removed = append(removed, row)
+		}
+	}
+	if len(keys) == 0 {
+		diff.Added = append(diff.Added, added...)
+		diff.Removed = append(diff.Removed, removed...)
+		return diff
+	}
+	byKey := make(map[string][]int)
+	for i, row := range added {
+		k := rowKey(row, keys)
+		byKey[k] = append(byKey[k], i)
+	}
+	paired := make(map[int]bool)
+	for _, row := range removed {
+		k := rowKey(row, keys)
+		if candidates := byKey[k]; len(candidates) > 0 {
+			paired[candidates[0]] = true
+			byKey[k] = candidates[1:]
+			diff.Changed = append(diff.Changed, RowChange{Before: row, After: added[candidates[0]]})
+			continue
+		}
+		diff.Removed = append(diff.Removed, row)
+	}
+	for i, row := range added {
+		if !paired[i] {
+			diff.Added = append(diff.Added, row)
+		}
+	}
+	return diff
+}
+
+// MaxDiffLoadRows to limit the result rows loaded for one diff, all of them are kept in memory
+const MaxDiffLoadRows = 250000
+
+// Helper to load the results of a query by node, from some nodes or all when none is given. Up to
+// limit rows are loaded
+func queryRowsByNode(database *gorm.DB, name string, limit int, uuids ...string) (map[string][]map[string]string, int, error) {
+	results := make(map[string][]map[string]string)
+	loaded := 0
+	err := eachQueryLogNodes(database, name, uuids, func(l OsqueryQueryData) error {
+		rows, err := FlattenQueryData(l.Data)
+		if err != nil {
+			return fmt.Errorf("results from %s - %v", l.UUID, err)
+		}
+		if loaded+len(rows) > limit {
+			return fmt.Errorf("too many rows to load, up to %d can be compared", MaxDiffLoadRows)
+		}
+		loaded += len(rows)
+		results[l.UUID] = append(results[l.UUID], rows...)
+		return nil
+	})
+	return results, loaded, err
+}
+
+// DiffQueryRuns to compare the results of two runs of the same SQL node by node, only nodes with
+// differences are returned, including the nodes that answered only one of the runs. Both runs are
+// loaded in memory, up to MaxDiffLoadRows rows between them
+func DiffQueryRuns(database *gorm.DB, nodesmgr *nodes.NodeManager, base, target queries.DistributedQuery, keys []string) (RunsDiff, error) {
+	diff := RunsDiff{Base: base.Name, Target: target.Name, Keys: keys, Nodes: []NodeDiff{}}
+	if strings.TrimSpace(base.Query) != strings.TrimSpace(target.Query) {
+		return diff, fmt.Errorf("queries %s and %s do not have the same SQL", base.Name, target.Name)
+	}
+	baseRows, loaded, err := queryRowsByNode(database, base.Name, MaxDiffLoadRows)
+	if err != nil {
+		return diff, err
+	}
+	targetRows, _, err := queryRowsByNode(database, target.Name, MaxDiffLoadRows-loaded)
+	if err != nil {
+		return diff, err
+	}
+	uuids := make(map[string]bool)
+	for u := range baseRows {
+		uuids[u] = true
+	}
+	for u := range targetRows {
+		uuids[u] = true
+	}
+	var sorted []string
+	for u := range uuids {
+		sorted = append(sorted, u)
+	}
+	sort.Strings(sorted)
+	for _, u := range sorted {
+		b, inBase := baseRows[u]
+		t, inTarget := targetRows[u]
+		rows := DiffRows(b, t, keys)
+		if rows.Empty() && inBase == inTarget {
+			continue
+		}
+		diff.Added += len(rows.Added)
+		diff.Removed += len(rows.Removed)
+		diff.Changed += len(rows.Changed)
+		diff.Nodes = append(diff.Nodes, NodeDiff{
+			UUID:     u,
+			Hostname: exportHostname(nodesmgr, u),
+			InBase:   inBase,
+			InTarget: inTarget,
+			RowsDiff: rows,
+		})
+	}
+	return diff, nil
+}
+
+// DiffQueryNodes to compare the results of two nodes for the same query, only the results of
+// those nodes are loaded
+func DiffQueryNodes(database *gorm.DB, nodesmgr *nodes.NodeManager, name, base, target string, keys []string) (NodesDiff, error) {
+	diff := NodesDiff{
+		Query:          name,
+		Base:           base,
+		BaseHostname:   exportHostname(nodesmgr, base),
+		Target:         target,
+		TargetHostname: exportHostname(nodesmgr, target),
+		Keys:           keys,
+	}
+	results, _, err := queryRowsByNode(database, name, MaxDiffLoadRows, base, target)
+	if err != nil {
+		return diff, err
+	}
+	if _, ok := results[base]; !ok {
+		return diff, fmt.Errorf("no results from %s", base)
+	}
+	if _, ok := results[target]; !ok {
+		return diff, fmt.Errorf("no results from %s", target)
+	}
+	diff.RowsDiff = DiffRows(results[base], results[target], keys)
+	return diff, nil
+}
+
+// DiffQueryRuns to compare two runs of the same query, see DiffQueryRuns
+func (logDB *LoggerDB) DiffQueryRuns(base, target queries.DistributedQuery, keys []string, nodesmgr *nodes.NodeManager) (RunsDiff, error) {
+	return DiffQueryRuns(logDB.Database, nodesmgr, base, target, keys)
+}
+
+// DiffQueryNodes to compare the results of two nodes, see DiffQueryNodes
+func (logDB *LoggerDB) DiffQueryNodes(name, base, target string, keys []string, nodesmgr *nodes.NodeManager) (NodesDiff, error) {
+	return DiffQueryNodes(logDB.Database, nodesmgr, name, base, target, keys)
+}
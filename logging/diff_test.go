@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/jmpsec/osctrl/queries"
+)
+
+func TestDiffRows(t *testing.T) {
+	base := []map[string]string{
+		{"path": "/usr/bin/a", "sha256": "aaaa"},
+		{"path": "/usr/bin/b", "sha256": "bbbb"},
+		{"path": "/usr/bin/c", "sha256": "cccc"},
+		{"path": "/usr/bin/c", "sha256": "cccc"},
+	}
+	target := []map[string]string{
+		{"path": "/usr/bin/a", "sha256": "aaaa"},
+		{"path": "/usr/bin/b", "sha256": "ffff"},
+		{"path": "/usr/bin/c", "sha256": "cccc"},
+		{"path": "/usr/bin/d", "sha256": "dddd"},
+	}
+	diff := DiffRows(base, target, nil)
+	if len(diff.Added) != 2 || len(diff.Removed) != 2 || len(diff.Changed) != 0 {
+		t.Errorf("DiffRows() without keys = %+v", diff)
+	}
+	diff = DiffRows(base, target, []string{"path"})
+	if len(diff.Added) != 1 || diff.Added[0]["path"] != "/usr/bin/d" {
+		t.Errorf("DiffRows() added = %v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0]["path"] != "/usr/bin/c" {
+		t.Errorf("DiffRows() removed = %v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Before["sha256"] != "bbbb" || diff.Changed[0].After["sha256"] != "ffff" {
+		t.Errorf("DiffRows() changed = %v", diff.Changed)
+	}
+	if diff := DiffRows(base, base, []string{"path"}); !diff.Empty() {
+		t.Errorf("DiffRows() same rows = %+v", diff)
+	}
+}
+
+func TestDiffQueryStored(t *testing.T) {
+	db := testQueryLogsDB(t,
+		storedQueryLog("base", "AAAA", 0, `[{"path":"/usr/bin/a","sha256":"aaaa"},{"path":"/usr/bin/b","sha256":"bbbb"}]`),
+		storedQueryLog("base", "BBBB", 0, `[{"path":"/usr/bin/a","sha256":"aaaa"}]`),
+		storedQueryLog("target", "AAAA", 0, `[{"path":"/usr/bin/a","sha256":"aaaa"},{"path":"/usr/bin/b","sha256":"ffff"}]`),
+		storedQueryLog("target", "BBBB", 0, `[{"path":"/usr/bin/a","sha256":"aaaa"}]`),
+		storedQueryLog("target", "CCCC", 1, `""`),
+	)
+	defer db.Close()
+	base := queries.DistributedQuery{Name: "base", Query: "SELECT path, sha256 FROM hash;"}
+	target := queries.DistributedQuery{Name: "target", Query: "SELECT path, sha256 FROM hash;"}
+	runs, err := DiffQueryRuns(db, nil, base, target, []string{"path"})
+	if err != nil {
+		t.Fatalf("DiffQueryRuns() error %v", err)
+	}
+	if runs.Changed != 1 || runs.Added != 0 || runs.Removed != 0 || len(runs.Nodes) != 2 {
+		t.Fatalf("DiffQueryRuns() = %+v", runs)
+	}
+	if runs.Nodes[0].UUID != "AAAA" || runs.Nodes[0].Changed[0].After["sha256"] != "ffff" {
+		t.Errorf("DiffQueryRuns() changed node = %+v", runs.Nodes[0])
+	}
+	if runs.Nodes[1].UUID != "CCCC" || runs.Nodes[1].InBase || !runs.Nodes[1].InTarget {
+		t.Errorf("DiffQueryRuns() node only in target = %+v", runs.Nodes[1])
+	}
+	nodes, err := DiffQueryNodes(db, nil, "base", "AAAA", "BBBB", nil)
+	if err != nil {
+		t.Fatalf("DiffQueryNodes() error %v", err)
+	}
+	if len(nodes.Removed) != 1 || nodes.Removed[0]["path"] != "/usr/bin/b" || len(nodes.Added) != 0 {
+		t.Errorf("DiffQueryNodes() = %+v", nodes.RowsDiff)
+	}
+	if _, err := DiffQueryNodes(db, nil, "base", "AAAA", "CCCC", nil); err == nil {
+		t.Errorf("DiffQueryNodes() expected error for node without results")
+	}
+	results, loaded, err := queryRowsByNode(db, "base", MaxDiffLoadRows, "BBBB")
+	if err != nil || loaded != 1 || len(results) != 1 || len(results["BBBB"]) != 1 {
+		t.Errorf("queryRowsByNode() one node = %v, %d, %v", results, loaded, err)
+	}
+	if _, _, err := queryRowsByNode(db, "base", 2); err == nil {
+		t.Errorf("queryRowsByNode() expected error over the limit")
+	}
+}
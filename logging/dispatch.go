@@ -33,13 +33,8 @@ func (l *LoggerTLS) DispatchLogs(data []byte, uuid, logType, environment string,
 	}
 }
 
-// DispatchQueries - Helper to dispatch queries
+// DispatchQueries - Helper to dispatch queries, results are limited and sent in chunks
 func (l *LoggerTLS) DispatchQueries(queryData types.QueryWriteData, node nodes.OsqueryNode, debug bool) {
-	// Prepare data to send
-	data, err := json.Marshal(queryData)
-	if err != nil {
-		log.Printf("error preparing data %v", err)
-	}
 	// Refresh last query write request
 	if err := l.Nodes.RefreshLastQueryWrite(node.UUID); err != nil {
 		log.Printf("error refreshing last query write %v", err)
@@ -49,12 +44,19 @@ func (l *LoggerTLS) DispatchQueries(queryData types.QueryWriteData, node nodes.O
 	if debug {
 		log.Printf("dispatching queries to %s", l.Logging)
 	}
-	l.QueryLog(
-		types.QueryLog,
-		data,
-		node.Environment,
-		node.UUID,
-		queryData.Name,
-		queryData.Status,
-		debug)
+	for _, d := range l.limitQueryData(queryData) {
+		// Prepare data to send
+		data, err := json.Marshal(d)
+		if err != nil {
+			log.Printf("error preparing data %v", err)
+		}
+		l.QueryLog(
+			types.QueryLog,
+			data,
+			node.Environment,
+			node.UUID,
+			d.Name,
+			d.Status,
+			debug)
+	}
 }
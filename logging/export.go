@@ -0,0 +1,389 @@
+package logging
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/types"
+)
+
+const (
+	// ExportCSV to export query results as comma separated values
+	ExportCSV string = "csv"
+	// ExportNDJSON to export query results as one JSON object per line
+	ExportNDJSON string = "ndjson"
+	// ExportXLSX to export query results as an Excel spreadsheet
+	ExportXLSX string = "xlsx"
+)
+
+// ExportContentTypes to serve each export format
+var ExportContentTypes = map[string]string{
+	ExportCSV:    "text/csv; charset=UTF-8",
+	ExportNDJSON: "application/x-ndjson",
+	ExportXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// Columns with node details, prefixed so they do not collide with result columns like uuid
+const (
+	ExportColumnUUID        string = "node_uuid"
+	ExportColumnHostname    string = "node_hostname"
+	ExportColumnEnvironment string = "node_environment"
+)
+
+// Maximum length of a cell in a spreadsheet
+const xlsxMaxCell = 32767
+
+// ValidExportFormat to check if query results can be exported in a format
+func ValidExportFormat(format string) bool {
+	_, ok := ExportContentTypes[format]
+	return ok
+}
+
+// ExportFilename to get the name of the file for the exported results of a query
+func ExportFilename(name, format string) string {
+	return name + "." + format
+}
+
+// ExportQueryLogs to export the results of an on-demand query, see ExportQueryResults
+func (logDB *LoggerDB) ExportQueryLogs(name, format string, nodesmgr *nodes.NodeManager, w io.Writer) error {
+	return ExportQueryResults(logDB.Database, nodesmgr, name, format, w)
+}
+
+// ExportQueryResults to write the results of an on-demand query with one row per result row,
+// adding the UUID, hostname and environment of the node. Results are read node by node from
+// the database, so only the results of one node are kept in memory at any time.
+func ExportQueryResults(database *gorm.DB, nodesmgr *nodes.NodeManager, name, format string, w io.Writer) error {
+	if !ValidExportFormat(format) {
+		return fmt.Errorf("invalid export format %s", format)
+	}
+	var columns []string
+	// Columns must be known before the first row, except for NDJSON
+	if format != ExportNDJSON {
+		var err error
+		if columns, err = exportColumns(database, name); err != nil {
+			return err
+		}
+	}
+	var exporter resultExporter
+	switch format {
+	case ExportCSV:
+		exporter = newCSVExporter(w)
+	case ExportNDJSON:
+		exporter = newNDJSONExporter(w)
+	case ExportXLSX:
+		exporter = newXLSXExporter(w)
+	}
+	if err := exporter.Header(columns); err != nil {
+		return err
+	}
+	err := eachQueryLog(database, name, func(l OsqueryQueryData) error {
+		rows, err := FlattenQueryData(l.Data)
+		if err != nil {
+			return fmt.Errorf("results from %s - %v", l.UUID, err)
+		}
+		hostname := exportHostname(nodesmgr, l.UUID)
+		for _, row := range rows {
+			row[ExportColumnUUID] = l.UUID
+			row[ExportColumnHostname] = hostname
+			row[ExportColumnEnvironment] = l.Environment
+			if err := exporter.Row(columns, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return exporter.Close()
+}
+
+// FlattenQueryData to convert the results of one node into rows of column values. Results are
+// stored as written by nodes, with the rows in the result field, but plain rows are also accepted
+func FlattenQueryData(data json.RawMessage) ([]map[string]string, error) {
+	var rows []map[string]string
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var written types.QueryWriteData
+		if err := json.Unmarshal(data, &written); err != nil {
+			return nil, err
+		}
+		data = bytes.TrimSpace(written.Result)
+	}
+	if len(data) == 0 || string(data) == "null" || string(data) == `""` {
+		return rows, nil
+	}
+	var raw []map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	for _, r := range raw {
+		rows = append(rows, flattenRow(r))
+	}
+	return rows, nil
+}
+
+// Helper to convert one row of results into column values
+func flattenRow(r map[string]interface{}) map[string]string {
+	row := make(map[string]string, len(r)+3)
+	for k, v := range r {
+		switch value := v.(type) {
+		case string:
+			row[k] = value
+		case nil:
+			row[k] = ""
+		case float64:
+			row[k] = strconv.FormatFloat(value, 'f', -1, 64)
+		default:
+			encoded, _ := json.Marshal(value)
+			row[k] = string(encoded)
+		}
+	}
+	return row
+}
+
+// Helper to iterate over the results of a query without loading all of them
+func eachQueryLog(database *gorm.DB, name string, fn func(OsqueryQueryData) error) error {
+	return eachQueryLogNodes(database, name, nil, fn)
+}
+
+// Helper to go through the stored results of a query from some nodes, all nodes when none is given
+func eachQueryLogNodes(database *gorm.DB, name string, uuids []string, fn func(OsqueryQueryData) error) error {
+	query := database.Model(&OsqueryQueryData{}).Where("name = ?", name)
+	if len(uuids) > 0 {
+		query = query.Where("uuid IN (?)", uuids)
+	}
+	rows, err := query.Order("id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l OsqueryQueryData
+		if err := database.ScanRows(rows, &l); err != nil {
+			return err
+		}
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Helper to collect the columns of all the results of a query, node columns first
+func exportColumns(database *gorm.DB, name string) ([]string, error) {
+	seen := make(map[string]bool)
+	err := eachQueryLog(database, name, func(l OsqueryQueryData) error {
+		rows, err := FlattenQueryData(l.Data)
+		if err != nil {
+			return fmt.Errorf("results from %s - %v", l.UUID, err)
+		}
+		for _, row := range rows {
+			for k := range row {
+				seen[k] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortedColumns(seen), nil
+}
+
+// Helper to sort result columns after the node columns
+func sortedColumns(seen map[string]bool) []string {
+	var result []string
+	for k := range seen {
+		if k != ExportColumnUUID && k != ExportColumnHostname && k != ExportColumnEnvironment {
+			result = append(result, k)
+		}
+	}
+	sort.Strings(result)
+	return append([]string{ExportColumnUUID, ExportColumnHostname, ExportColumnEnvironment}, result...)
+}
+
+// Helper to get the hostname of a node, empty if the node is gone
+func exportHostname(nodesmgr *nodes.NodeManager, uuid string) string {
+	if nodesmgr == nil {
+		return ""
+	}
+	node, err := nodesmgr.GetByUUID(uuid)
+	if err != nil {
+		return ""
+	}
+	if node.Hostname != "" {
+		return node.Hostname
+	}
+	return node.Localname
+}
+
+// resultExporter to write rows of results in one format
+type resultExporter interface {
+	Header(columns []string) error
+	Row(columns []string, row map[string]string) error
+	Close() error
+}
+
+// csvExporter to write results as CSV with a header line
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func newCSVExporter(w io.Writer) *csvExporter {
+	return &csvExporter{w: csv.NewWriter(w)}
+}
+
+func (e *csvExporter) Header(columns []string) error {
+	return e.w.Write(columns)
+}
+
+func (e *csvExporter) Row(columns []string, row map[string]string) error {
+	record := make([]string, len(columns))
+	for i, c := range columns {
+		record[i] = row[c]
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvExporter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonExporter to write each row as a JSON object in its own line
+type ndjsonExporter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONExporter(w io.Writer) *ndjsonExporter {
+	buf := bufio.NewWriter(w)
+	return &ndjsonExporter{w: buf, enc: json.NewEncoder(buf)}
+}
+
+func (e *ndjsonExporter) Header(columns []string) error {
+	return nil
+}
+
+func (e *ndjsonExporter) Row(columns []string, row map[string]string) error {
+	return e.enc.Encode(row)
+}
+
+func (e *ndjsonExporter) Close() error {
+	return e.w.Flush()
+}
+
+// xlsxExporter to write results as a spreadsheet with one worksheet, rows are streamed
+// to the worksheet using inline strings so no shared strings table is kept in memory
+type xlsxExporter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	err   error
+}
+
+// Static parts of a spreadsheet with one worksheet
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="results" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+func newXLSXExporter(w io.Writer) *xlsxExporter {
+	e := &xlsxExporter{zw: zip.NewWriter(w)}
+	for _, p := range xlsxParts {
+		f, err := e.zw.Create(p.name)
+		if err != nil {
+			e.err = err
+			return e
+		}
+		if _, err := io.WriteString(f, p.content); err != nil {
+			e.err = err
+			return e
+		}
+	}
+	f, err := e.zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		e.err = err
+		return e
+	}
+	e.sheet = bufio.NewWriter(f)
+	_, e.err = e.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return e
+}
+
+// Helper to write one row of cells
+func (e *xlsxExporter) writeRow(values []string) error {
+	if e.err != nil {
+		return e.err
+	}
+	if _, err := e.sheet.WriteString("<row>"); err != nil {
+		return err
+	}
+	for _, v := range values {
+		if len(v) > xlsxMaxCell {
+			v = v[:xlsxMaxCell]
+		}
+		if _, err := e.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`); err != nil {
+			return err
+		}
+		if err := xml.EscapeText(e.sheet, []byte(v)); err != nil {
+			return err
+		}
+		if _, err := e.sheet.WriteString("</t></is></c>"); err != nil {
+			return err
+		}
+	}
+	_, err := e.sheet.WriteString("</row>")
+	return err
+}
+
+func (e *xlsxExporter) Header(columns []string) error {
+	return e.writeRow(columns)
+}
+
+func (e *xlsxExporter) Row(columns []string, row map[string]string) error {
+	values := make([]string, len(columns))
+	for i, c := range columns {
+		values[i] = row[c]
+	}
+	return e.writeRow(values)
+}
+
+func (e *xlsxExporter) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if _, err := e.sheet.WriteString("</sheetData></worksheet>"); err != nil {
+		return err
+	}
+	if err := e.sheet.Flush(); err != nil {
+		return err
+	}
+	return e.zw.Close()
+}
@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/jmpsec/osctrl/types"
+)
+
+// Helper to prepare a database with query logs stored the same way nodes write them
+func testQueryLogsDB(t *testing.T, logs ...OsqueryQueryData) *gorm.DB {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("error opening database %v", err)
+	}
+	// Every connection to an in-memory database is a different database
+	db.DB().SetMaxOpenConns(1)
+	if err := db.AutoMigrate(OsqueryQueryData{}, OsqueryResultData{}).Error; err != nil {
+		t.Fatalf("error creating table %v", err)
+	}
+	for _, l := range logs {
+		if err := db.Create(&l).Error; err != nil {
+			t.Fatalf("error storing log %v", err)
+		}
+	}
+	return db
+}
+
+// Helper to prepare a query log with the result written by a node
+func storedQueryLog(name, uuid string, status int, result string) OsqueryQueryData {
+	data, _ := json.Marshal(types.QueryWriteData{Name: name, Result: json.RawMessage(result), Status: status})
+	return OsqueryQueryData{Name: name, UUID: uuid, Environment: "dev", Data: data, Status: status}
+}
+
+func TestFlattenQueryData(t *testing.T) {
+	rows, err := FlattenQueryData([]byte(`[{"name":"osqueryd","pid":"42"},{"name":"launchd","pid":1,"extra":null}]`))
+	if err != nil {
+		t.Fatalf("FlattenQueryData() error %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("FlattenQueryData() = %d rows, expected 2", len(rows))
+	}
+	if rows[0]["name"] != "osqueryd" || rows[0]["pid"] != "42" {
+		t.Errorf("FlattenQueryData()[0] = %v", rows[0])
+	}
+	if rows[1]["pid"] != "1" || rows[1]["extra"] != "" {
+		t.Errorf("FlattenQueryData()[1] = %v", rows[1])
+	}
+	if rows, err := FlattenQueryData(nil); err != nil || len(rows) != 0 {
+		t.Errorf("FlattenQueryData(nil) = %v, %v", rows, err)
+	}
+	rows, err = FlattenQueryData([]byte(`{"name":"q1","result":[{"name":"osqueryd"}],"status":0}`))
+	if err != nil || len(rows) != 1 || rows[0]["name"] != "osqueryd" {
+		t.Errorf("FlattenQueryData(written) = %v, %v", rows, err)
+	}
+	if rows, err := FlattenQueryData([]byte(`{"name":"q1","result":"","status":1}`)); err != nil || len(rows) != 0 {
+		t.Errorf("FlattenQueryData(failed) = %v, %v", rows, err)
+	}
+	if _, err := FlattenQueryData([]byte(`"osqueryd"`)); err == nil {
+		t.Errorf("FlattenQueryData(string) expected error")
+	}
+}
+
+func TestSortedColumns(t *testing.T) {
+	columns := sortedColumns(map[string]bool{"uuid": true, "pid": true, ExportColumnUUID: true, "name": true})
+	expected := []string{ExportColumnUUID, ExportColumnHostname, ExportColumnEnvironment, "name", "pid", "uuid"}
+	if strings.Join(columns, ",") != strings.Join(expected, ",") {
+		t.Errorf("sortedColumns() = %v, expected %v", columns, expected)
+	}
+}
+
+func TestExporters(t *testing.T) {
+	columns := []string{ExportColumnUUID, "name", "path"}
+	row := map[string]string{ExportColumnUUID: "AAAA", "name": "a,b", "path": "<tmp>"}
+	var buf bytes.Buffer
+	csvExp := newCSVExporter(&buf)
+	if err := csvExp.Header(columns); err != nil {
+		t.Fatal(err)
+	}
+	if err := csvExp.Row(columns, row); err != nil {
+		t.Fatal(err)
+	}
+	if err := csvExp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "node_uuid,name,path\nAAAA,\"a,b\",<tmp>\n"; buf.String() != expected {
+		t.Errorf("CSV = %q, expected %q", buf.String(), expected)
+	}
+	buf.Reset()
+	xlsxExp := newXLSXExporter(&buf)
+	if err := xlsxExp.Header(columns); err != nil {
+		t.Fatal(err)
+	}
+	if err := xlsxExp.Row(columns, row); err != nil {
+		t.Fatal(err)
+	}
+	if err := xlsxExp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("XLSX is not a valid zip %v", err)
+	}
+	var sheet string
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, _ := f.Open()
+			content, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			sheet = string(content)
+		}
+	}
+	if !strings.Contains(sheet, "&lt;tmp&gt;") || strings.Count(sheet, "<row>") != 2 {
+		t.Errorf("XLSX worksheet = %q", sheet)
+	}
+}
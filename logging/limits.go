@@ -0,0 +1,171 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"sort"
+
+	"github.com/jmpsec/osctrl/queries"
+	"github.com/jmpsec/osctrl/types"
+)
+
+// DefaultChunkRows for the number of rows stored together when it is not configured
+const DefaultChunkRows = 1000
+
+// Number of times rows are reserved against the query limits before dropping them
+const reserveAttempts = 5
+
+// LimitedResult to hold the rows of a result kept within limits
+type LimitedResult struct {
+	Rows      []json.RawMessage
+	Bytes     int
+	Total     int
+	Truncated bool
+}
+
+// LimitResult to keep the rows of a result within limits, zero means no limit and negative means
+// that no rows are kept. Results that are not a list of rows, like failed queries, return error
+func LimitResult(result json.RawMessage, maxRows, maxBytes int) (LimitedResult, error) {
+	var limited LimitedResult
+	var rows []json.RawMessage
+	if err := json.Unmarshal(result, &rows); err != nil {
+		return limited, err
+	}
+	limited.Total = len(rows)
+	for _, row := range rows {
+		if maxRows < 0 || maxBytes < 0 {
+			break
+		}
+		if maxRows > 0 && len(limited.Rows) >= maxRows {
+			break
+		}
+		if maxBytes > 0 && limited.Bytes+len(row) > maxBytes {
+			break
+		}
+		limited.Rows = append(limited.Rows, row)
+		limited.Bytes += len(row)
+	}
+	limited.Truncated = len(limited.Rows) < limited.Total
+	return limited, nil
+}
+
+// ChunkResult to split the rows kept of a result into chunks, so large results are stored and
+// sent in parts. Truncated results are marked in every chunk, with the total rows received
+func ChunkResult(queryData types.QueryWriteData, limited LimitedResult, chunkRows int) []types.QueryWriteData {
+	if chunkRows <= 0 {
+		chunkRows = DefaultChunkRows
+	}
+	chunks := (len(limited.Rows) + chunkRows - 1) / chunkRows
+	if chunks == 0 {
+		chunks = 1
+	}
+	var result []types.QueryWriteData
+	for c := 0; c < chunks; c++ {
+		end := (c + 1) * chunkRows
+		if end > len(limited.Rows) {
+			end = len(limited.Rows)
+		}
+		var b bytes.Buffer
+		b.WriteByte('[')
+		for i, row := range limited.Rows[c*chunkRows : end] {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.Write(row)
+		}
+		b.WriteByte(']')
+		d := types.QueryWriteData{
+			Name:   queryData.Name,
+			Result: b.Bytes(),
+			Status: queryData.Status,
+		}
+		if limited.Truncated {
+			d.Truncated = true
+			d.TotalRows = limited.Total
+		}
+		if chunks > 1 {
+			d.Chunk = c
+			d.Chunks = chunks
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+// MergeChunks to put together the chunks stored with the results of one node, in order. Data that
+// was not stored in chunks is returned as it is, keeping the last one
+func MergeChunks(chunks []json.RawMessage) json.RawMessage {
+	if len(chunks) == 0 {
+		return nil
+	}
+	parts := make([]types.QueryWriteData, len(chunks))
+	for i, c := range chunks {
+		if err := json.Unmarshal(c, &parts[i]); err != nil || parts[i].Chunks == 0 {
+			return chunks[len(chunks)-1]
+		}
+	}
+	sort.SliceStable(parts, func(i, j int) bool {
+		return parts[i].Chunk < parts[j].Chunk
+	})
+	limited := LimitedResult{Truncated: parts[0].Truncated, Total: parts[0].TotalRows}
+	for _, p := range parts {
+		var rows []json.RawMessage
+		if err := json.Unmarshal(p.Result, &rows); err != nil {
+			return chunks[len(chunks)-1]
+		}
+		limited.Rows = append(limited.Rows, rows...)
+	}
+	merged := ChunkResult(parts[0], limited, len(limited.Rows)+1)[0]
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return chunks[len(chunks)-1]
+	}
+	return data
+}
+
+// Helper to apply the result limits to the results of one node, split in chunks to be dispatched.
+// Rows are reserved against the query limits, and when other results took them first the limits
+// are read again to keep what is left
+func (l *LoggerTLS) limitQueryData(queryData types.QueryWriteData) []types.QueryWriteData {
+	if l.Settings == nil || l.Queries == nil {
+		return []types.QueryWriteData{queryData}
+	}
+	defaults := queries.ResultLimits{
+		NodeRows:   int(l.Settings.QueryNodeMaxRows()),
+		NodeBytes:  int(l.Settings.QueryNodeMaxBytes()),
+		QueryRows:  int(l.Settings.QueryMaxRows()),
+		QueryBytes: int(l.Settings.QueryMaxBytes()),
+	}
+	chunkRows := int(l.Settings.QueryChunkRows())
+	for i := 0; i < reserveAttempts; i++ {
+		query, err := l.Queries.Get(queryData.Name)
+		if err != nil {
+			log.Printf("error getting query %s for limits %v", queryData.Name, err)
+			return []types.QueryWriteData{queryData}
+		}
+		limits := query.Limits(defaults)
+		limited, err := LimitResult(queryData.Result, limits.NodeRows, limits.NodeBytes)
+		if err != nil {
+			// Results without rows are kept as they are
+			return []types.QueryWriteData{queryData}
+		}
+		reserved, err := l.Queries.ReserveStored(queryData.Name, len(limited.Rows), limited.Bytes, limits, limited.Truncated)
+		if err != nil {
+			log.Printf("error reserving stored results %v", err)
+			return ChunkResult(queryData, limited, chunkRows)
+		}
+		if reserved {
+			return ChunkResult(queryData, limited, chunkRows)
+		}
+	}
+	// Limits keep changing with other results, so no rows are kept for this one
+	limited, err := LimitResult(queryData.Result, -1, -1)
+	if err != nil {
+		return []types.QueryWriteData{queryData}
+	}
+	if err := l.Queries.TrackStored(queryData.Name, 0, 0, limited.Truncated); err != nil {
+		log.Printf("error tracking stored results %v", err)
+	}
+	return ChunkResult(queryData, limited, chunkRows)
+}
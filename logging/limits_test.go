@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jmpsec/osctrl/types"
+)
+
+func TestLimitResult(t *testing.T) {
+	result := json.RawMessage(`[{"a":"1"},{"a":"2"},{"a":"3"}]`)
+	limited, err := LimitResult(result, 0, 0)
+	if err != nil || len(limited.Rows) != 3 || limited.Truncated || limited.Bytes != 27 {
+		t.Errorf("LimitResult() without limits = %+v, %v", limited, err)
+	}
+	limited, err = LimitResult(result, 2, 0)
+	if err != nil || len(limited.Rows) != 2 || !limited.Truncated || limited.Total != 3 {
+		t.Errorf("LimitResult() with rows = %+v, %v", limited, err)
+	}
+	limited, err = LimitResult(result, 0, 20)
+	if err != nil || len(limited.Rows) != 2 || !limited.Truncated {
+		t.Errorf("LimitResult() with bytes = %+v, %v", limited, err)
+	}
+	limited, err = LimitResult(result, -1, -1)
+	if err != nil || len(limited.Rows) != 0 || !limited.Truncated {
+		t.Errorf("LimitResult() exhausted = %+v, %v", limited, err)
+	}
+	if _, err := LimitResult(json.RawMessage(`""`), 0, 0); err == nil {
+		t.Errorf("LimitResult(failed) expected error")
+	}
+}
+
+func TestChunkResult(t *testing.T) {
+	data := types.QueryWriteData{Name: "q1", Status: 0}
+	limited, _ := LimitResult(json.RawMessage(`[{"a":"1"},{"a":"2"},{"a":"3"}]`), 0, 0)
+	chunks := ChunkResult(data, limited, 2)
+	if len(chunks) != 2 || chunks[1].Chunk != 1 || chunks[1].Chunks != 2 {
+		t.Fatalf("ChunkResult() = %+v", chunks)
+	}
+	if string(chunks[0].Result) != `[{"a":"1"},{"a":"2"}]` || string(chunks[1].Result) != `[{"a":"3"}]` {
+		t.Errorf("ChunkResult() results = %s %s", chunks[0].Result, chunks[1].Result)
+	}
+	limited, _ = LimitResult(json.RawMessage(`[{"a":"1"},{"a":"2"}]`), 1, 0)
+	chunks = ChunkResult(data, limited, 0)
+	if len(chunks) != 1 || chunks[0].Chunks != 0 || !chunks[0].Truncated || chunks[0].TotalRows != 2 {
+		t.Errorf("ChunkResult() truncated = %+v", chunks)
+	}
+	limited, _ = LimitResult(json.RawMessage(`[]`), 0, 0)
+	chunks = ChunkResult(data, limited, 10)
+	if len(chunks) != 1 || string(chunks[0].Result) != `[]` {
+		t.Errorf("ChunkResult() empty = %+v", chunks)
+	}
+}
+
+func TestMergeChunks(t *testing.T) {
+	chunks := []json.RawMessage{
+		json.RawMessage(`{"name":"q1","result":[{"a":"3"}],"status":0,"truncated":true,"total_rows":4,"chunk":1,"chunks":2}`),
+		json.RawMessage(`{"name":"q1","result":[{"a":"1"},{"a":"2"}],"status":0,"truncated":true,"total_rows":4,"chunks":2}`),
+	}
+	var merged types.QueryWriteData
+	if err := json.Unmarshal(MergeChunks(chunks), &merged); err != nil {
+		t.Fatalf("MergeChunks() error %v", err)
+	}
+	if string(merged.Result) != `[{"a":"1"},{"a":"2"},{"a":"3"}]` || merged.Chunks != 0 || !merged.Truncated || merged.TotalRows != 4 {
+		t.Errorf("MergeChunks() = %+v", merged)
+	}
+	single := json.RawMessage(`{"name":"q1","result":"","status":1}`)
+	if string(MergeChunks([]json.RawMessage{single})) != string(single) {
+		t.Errorf("MergeChunks(single) changed data")
+	}
+}
@@ -15,23 +15,25 @@ const (
 
 // LoggerTLS will be used to handle logging for the TLS endpoint
 type LoggerTLS struct {
-	DB      *LoggerDB
-	Graylog *LoggerGraylog
-	Splunk  *LoggerSplunk
-	Logging []string
-	Nodes   *nodes.NodeManager
-	Queries *queries.Queries
+	DB       *LoggerDB
+	Graylog  *LoggerGraylog
+	Splunk   *LoggerSplunk
+	Logging  []string
+	Nodes    *nodes.NodeManager
+	Queries  *queries.Queries
+	Settings *settings.Settings
 }
 
 // CreateLoggerTLS to instantiate a new logger for the TLS endpoint
 func CreateLoggerTLS(logging []string, mgr *settings.Settings, nodes *nodes.NodeManager, queries *queries.Queries) (*LoggerTLS, error) {
 	l := &LoggerTLS{
-		DB:      &LoggerDB{},
-		Splunk:  &LoggerSplunk{},
-		Logging: logging,
-		Graylog: &LoggerGraylog{},
-		Nodes:   nodes,
-		Queries: queries,
+		DB:       &LoggerDB{},
+		Splunk:   &LoggerSplunk{},
+		Logging:  logging,
+		Graylog:  &LoggerGraylog{},
+		Nodes:    nodes,
+		Queries:  queries,
+		Settings: mgr,
 	}
 	for _, _l := range logging {
 		switch _l {
@@ -5,6 +5,7 @@ import (
 	"log"
 
 	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/queries"
 	"github.com/jmpsec/osctrl/types"
 )
 
@@ -50,24 +51,24 @@ func (l *LoggerTLS) ProcessLogs(data json.RawMessage, logType, environment, ipad
 }
 
 // ProcessLogQueryResult - Helper to process on-demand query result logs
-func (l *LoggerTLS) ProcessLogQueryResult(queries types.QueryWriteQueries, statuses types.QueryWriteStatuses, nodeKey string, environment string, debug bool) {
+func (l *LoggerTLS) ProcessLogQueryResult(t types.QueryWriteRequest, environment string, debug bool) {
 	// Retrieve node
-	node, err := l.Nodes.GetByKey(nodeKey)
+	node, err := l.Nodes.GetByKey(t.NodeKey)
 	if err != nil {
 		log.Printf("error retrieving node %s", err)
 	}
 	// Tap into results so we can update internal metrics
-	for q, r := range queries {
+	for q, r := range t.Queries {
 		// Dispatch query name, result and status
 		d := types.QueryWriteData{
 			Name:   q,
 			Result: r,
-			Status: statuses[q],
+			Status: t.Statuses[q],
 		}
 		go l.DispatchQueries(d, node, debug)
 		// Update internal metrics per query
 		var err error
-		if statuses[q] != 0 {
+		if t.Statuses[q] != 0 {
 			err = l.Queries.IncError(q)
 		} else {
 			err = l.Queries.IncExecution(q)
@@ -75,13 +76,35 @@ func (l *LoggerTLS) ProcessLogQueryResult(queries types.QueryWriteQueries, statu
 		if err != nil {
 			log.Printf("error updating query %s", err)
 		}
-		// Add a record for this query
-		if err := l.Queries.TrackExecution(q, node.UUID, statuses[q]); err != nil {
+		// Add a record for this query, with the stats if the node sent them
+		if err := l.Queries.TrackExecutionStats(q, node.UUID, t.Statuses[q], t.Messages[q], executionStats(t.Stats, q)); err != nil {
 			log.Printf("error adding query execution %s", err)
 		}
+		// Update the status of this query for the node
+		if err := l.Queries.TrackAnswer(q, node, t.Statuses[q], t.Messages[q]); err != nil {
+			log.Printf("error updating query status %s", err)
+		}
 		// Check if query is completed
 		if err := l.Queries.VerifyComplete(q); err != nil {
 			log.Printf("error verifying and completing query %s", err)
 		}
 	}
 }
+
+// Helper to get the execution stats of a query sent by a node, nil if they were not sent
+func executionStats(stats types.QueryWriteStats, name string) *queries.ExecutionStats {
+	s, ok := stats[name]
+	if !ok {
+		return nil
+	}
+	wallTime := s.WallTimeMs
+	if wallTime == 0 {
+		wallTime = s.WallTime * 1000
+	}
+	return &queries.ExecutionStats{
+		WallTimeMs: wallTime,
+		UserTime:   s.UserTime,
+		SystemTime: s.SystemTime,
+		Memory:     s.Memory,
+	}
+}
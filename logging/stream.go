@@ -0,0 +1,259 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/queries"
+	"github.com/jmpsec/osctrl/settings"
+)
+
+const (
+	// StreamEventResult for the results of one node
+	StreamEventResult string = "result"
+	// StreamEventProgress for the counters of the query
+	StreamEventProgress string = "progress"
+	// StreamEventDone when the query will not get more results
+	StreamEventDone string = "done"
+	// StreamEventError for results of one node that can not be parsed
+	StreamEventError string = "error"
+)
+
+const (
+	// DefaultStreamInterval to check for new results
+	DefaultStreamInterval = 2 * time.Second
+	// Maximum number of results read from the database at once
+	streamBatchSize = 500
+	// Progress is sent at least this often, so idle connections are not closed
+	streamKeepAlive = 30 * time.Second
+)
+
+// StreamEvent to hold one event of a query stream, the ID is the last result sent
+type StreamEvent struct {
+	ID    string
+	Event string
+	Data  interface{}
+}
+
+// StreamResult to hold the results of one node for a query stream
+type StreamResult struct {
+	UUID        string              `json:"uuid"`
+	Hostname    string              `json:"hostname"`
+	Environment string              `json:"environment"`
+	Status      int                 `json:"status"`
+	Rows        []map[string]string `json:"rows"`
+	Created     time.Time           `json:"created"`
+}
+
+// StreamError to hold the results of one node that can not be parsed, for a query stream
+type StreamError struct {
+	UUID     string    `json:"uuid"`
+	Hostname string    `json:"hostname"`
+	Error    string    `json:"error"`
+	Created  time.Time `json:"created"`
+}
+
+// StreamProgress to hold the counters of a query for a query stream
+type StreamProgress struct {
+	Expected   int    `json:"expected"`
+	Answered   int    `json:"answered"`
+	Executions int    `json:"executions"`
+	Errors     int    `json:"errors"`
+	Skipped    int    `json:"skipped"`
+	Completed  bool   `json:"completed"`
+	Expired    bool   `json:"expired"`
+	Approval   string `json:"approval"`
+}
+
+// QueryStream to keep track of the results and counters already sent for a query
+type QueryStream struct {
+	Name      string
+	LastID    uint
+	progress  StreamProgress
+	sent      bool
+	hostnames map[string]string
+}
+
+// NewQueryStream to prepare a stream of results, starting after the result with lastID
+func NewQueryStream(name string, lastID uint) *QueryStream {
+	return &QueryStream{
+		Name:      name,
+		LastID:    lastID,
+		hostnames: make(map[string]string),
+	}
+}
+
+// Helper to get the ID of the last result sent
+func (s *QueryStream) eventID() string {
+	if s.LastID == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(s.LastID), 10)
+}
+
+// Results to convert new results into events, results that can not be parsed are sent as errors
+func (s *QueryStream) Results(logs []OsqueryQueryData, nodesmgr *nodes.NodeManager) []StreamEvent {
+	var events []StreamEvent
+	for _, l := range logs {
+		if l.ID <= s.LastID {
+			continue
+		}
+		s.LastID = l.ID
+		hostname, ok := s.hostnames[l.UUID]
+		if !ok {
+			hostname = exportHostname(nodesmgr, l.UUID)
+			s.hostnames[l.UUID] = hostname
+		}
+		rows, err := FlattenQueryData(l.Data)
+		if err != nil {
+			events = append(events, StreamEvent{
+				ID:    s.eventID(),
+				Event: StreamEventError,
+				Data: StreamError{
+					UUID:     l.UUID,
+					Hostname: hostname,
+					Error:    err.Error(),
+					Created:  l.CreatedAt,
+				},
+			})
+			continue
+		}
+		if rows == nil {
+			rows = []map[string]string{}
+		}
+		events = append(events, StreamEvent{
+			ID:    s.eventID(),
+			Event: StreamEventResult,
+			Data: StreamResult{
+				UUID:        l.UUID,
+				Hostname:    hostname,
+				Environment: l.Environment,
+				Status:      l.Status,
+				Rows:        rows,
+				Created:     l.CreatedAt,
+			},
+		})
+	}
+	return events
+}
+
+// Progress to get an event with the counters of the query, only if they changed or force is set
+func (s *QueryStream) Progress(query queries.DistributedQuery, force bool) (StreamEvent, bool) {
+	progress := StreamProgress{
+		Expected:   query.Expected,
+		Answered:   query.Executions + query.Errors + query.Skipped,
+		Executions: query.Executions,
+		Errors:     query.Errors,
+		Skipped:    query.Skipped,
+		Completed:  query.Completed,
+		Expired:    query.Expired,
+		Approval:   query.Approval,
+	}
+	if s.sent && progress == s.progress && !force {
+		return StreamEvent{}, false
+	}
+	s.progress = progress
+	s.sent = true
+	return StreamEvent{ID: s.eventID(), Event: StreamEventProgress, Data: progress}, true
+}
+
+// Done to get the event that ends the stream
+func (s *QueryStream) Done() StreamEvent {
+	return StreamEvent{ID: s.eventID(), Event: StreamEventDone, Data: s.progress}
+}
+
+// StreamFinished to check if a query will not get more results
+func StreamFinished(query queries.DistributedQuery) bool {
+	return query.Completed || query.Expired || query.Deleted || query.Approval == queries.ApprovalRejected
+}
+
+// Helper to read the results of a query after the last one sent
+func streamQueryLogs(database *gorm.DB, name string, lastID uint) ([]OsqueryQueryData, error) {
+	var logs []OsqueryQueryData
+	if err := database.Where("name = ? AND id > ?", name, lastID).Order("id").Limit(streamBatchSize).Find(&logs).Error; err != nil {
+		return logs, err
+	}
+	return logs, nil
+}
+
+// StreamSupported to check if the results of the TLS service can be streamed. Streams read results
+// from the database, so they are rejected when the TLS service is not configured with the db logger
+func StreamSupported(mgr *settings.Settings) error {
+	value, err := mgr.RetrieveJSON(settings.ServiceTLS, settings.JSONLogging)
+	if err != nil {
+		// The TLS service did not store its configuration yet, there are no results either
+		return nil
+	}
+	return streamLogging(value.String)
+}
+
+// Helper to check the loggers of the TLS service, separated by commas
+func streamLogging(logging string) error {
+	for _, l := range strings.Split(logging, ",") {
+		if strings.TrimSpace(l) == settings.LoggingDB {
+			return nil
+		}
+	}
+	return fmt.Errorf("results are not stored in the database, the TLS service logs to %q", logging)
+}
+
+// StreamQueryResults to send the results of an on-demand query as they are written by nodes, along
+// with its counters. Results are read from the database, so any service can follow queries that
+// other services dispatch, as long as the TLS service uses the db logger (see StreamSupported).
+// The stream ends once the query will not get more results, or with ctx.
+func StreamQueryResults(ctx context.Context, database *gorm.DB, queriesmgr *queries.Queries, nodesmgr *nodes.NodeManager, name string, lastID uint, interval time.Duration, emit func(StreamEvent) error) error {
+	if interval <= 0 {
+		interval = DefaultStreamInterval
+	}
+	stream := NewQueryStream(name, lastID)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastSent := time.Now()
+	finishing := false
+	for {
+		query, err := queriesmgr.Get(name)
+		if err != nil {
+			return err
+		}
+		logs, err := streamQueryLogs(database, name, stream.LastID)
+		if err != nil {
+			return err
+		}
+		events := stream.Results(logs, nodesmgr)
+		if progress, ok := stream.Progress(query, time.Since(lastSent) >= streamKeepAlive); ok {
+			events = append(events, progress)
+		}
+		for _, e := range events {
+			if err := emit(e); err != nil {
+				return err
+			}
+			lastSent = time.Now()
+		}
+		// Keep reading while results are pending
+		if len(logs) == streamBatchSize {
+			continue
+		}
+		// Results are written after counters are updated, so wait once more before ending
+		if StreamFinished(query) {
+			if finishing {
+				return emit(stream.Done())
+			}
+			finishing = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// StreamQueryLogs to stream the results of an on-demand query, see StreamQueryResults
+func (logDB *LoggerDB) StreamQueryLogs(ctx context.Context, name string, lastID uint, queriesmgr *queries.Queries, nodesmgr *nodes.NodeManager, emit func(StreamEvent) error) error {
+	return StreamQueryResults(ctx, logDB.Database, queriesmgr, nodesmgr, name, lastID, DefaultStreamInterval, emit)
+}
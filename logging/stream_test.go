@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/queries"
+)
+
+func TestQueryStreamResults(t *testing.T) {
+	stream := NewQueryStream("q1", 1)
+	logs := []OsqueryQueryData{
+		{Model: gorm.Model{ID: 1}, UUID: "AAAA", Data: []byte(`{"name":"q1","result":[{"pid":"1"}],"status":0}`)},
+		{Model: gorm.Model{ID: 2}, UUID: "BBBB", Data: []byte(`{"name":"q1","result":[{"pid":"2"},{"pid":"3"}],"status":0}`)},
+		{Model: gorm.Model{ID: 3}, UUID: "CCCC", Data: []byte(`{"name":"q1","result":"","status":1}`), Status: 1},
+		{Model: gorm.Model{ID: 4}, UUID: "DDDD", Data: []byte(`{"name":"q1","result":{"pid":"4"},"status":0}`)},
+	}
+	events := stream.Results(logs, nil)
+	if len(events) != 3 {
+		t.Fatalf("Results() = %d events, expected 3", len(events))
+	}
+	first := events[0].Data.(StreamResult)
+	if events[0].ID != "2" || events[0].Event != StreamEventResult || first.UUID != "BBBB" || len(first.Rows) != 2 {
+		t.Errorf("Results()[0] = %+v", events[0])
+	}
+	second := events[1].Data.(StreamResult)
+	if events[1].ID != "3" || second.Status != 1 || second.Rows == nil || len(second.Rows) != 0 {
+		t.Errorf("Results()[1] = %+v", events[1])
+	}
+	if failed, ok := events[2].Data.(StreamError); !ok || events[2].ID != "4" || events[2].Event != StreamEventError || failed.UUID != "DDDD" || failed.Error == "" {
+		t.Errorf("Results()[2] = %+v", events[2])
+	}
+	if stream.LastID != 4 {
+		t.Errorf("LastID = %d, expected 4", stream.LastID)
+	}
+	if events := stream.Results(logs, nil); len(events) != 0 {
+		t.Errorf("Results() again = %d events, expected 0", len(events))
+	}
+}
+
+func TestQueryStreamProgress(t *testing.T) {
+	stream := NewQueryStream("q1", 0)
+	query := queries.DistributedQuery{Expected: 3, Executions: 1, Errors: 1}
+	event, ok := stream.Progress(query, false)
+	if !ok || event.ID != "" || event.Data.(StreamProgress).Answered != 2 {
+		t.Errorf("Progress() = %+v, %v", event, ok)
+	}
+	if _, ok := stream.Progress(query, false); ok {
+		t.Errorf("Progress() without changes expected no event")
+	}
+	if _, ok := stream.Progress(query, true); !ok {
+		t.Errorf("Progress() forced expected event")
+	}
+	query.Executions = 2
+	if event, ok := stream.Progress(query, false); !ok || event.Data.(StreamProgress).Answered != 3 {
+		t.Errorf("Progress() with changes = %+v, %v", event, ok)
+	}
+}
+
+func TestStreamFinished(t *testing.T) {
+	if StreamFinished(queries.DistributedQuery{Active: true}) {
+		t.Errorf("StreamFinished(active) = true")
+	}
+	if StreamFinished(queries.DistributedQuery{Active: true, Approval: queries.ApprovalPending}) {
+		t.Errorf("StreamFinished(pending) = true")
+	}
+	for _, q := range []queries.DistributedQuery{
+		{Completed: true},
+		{Expired: true},
+		{Deleted: true},
+		{Approval: queries.ApprovalRejected},
+	} {
+		if !StreamFinished(q) {
+			t.Errorf("StreamFinished(%+v) = false", q)
+		}
+	}
+}
+
+func TestStreamLogging(t *testing.T) {
+	for _, logging := range []string{"db", "splunk,db", "graylog, db"} {
+		if err := streamLogging(logging); err != nil {
+			t.Errorf("streamLogging(%q) error %v", logging, err)
+		}
+	}
+	for _, logging := range []string{"", "splunk", "graylog,splunk"} {
+		if err := streamLogging(logging); err == nil {
+			t.Errorf("streamLogging(%q) expected error", logging)
+		}
+	}
+}
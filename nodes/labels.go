@@ -0,0 +1,61 @@
+package nodes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// NodeLabel to hold custom name/value labels for a node
+type NodeLabel struct {
+	gorm.Model
+	UUID  string `gorm:"index"`
+	Name  string
+	Value string
+}
+
+// GetLabels to retrieve all labels for a node by UUID
+func (n *NodeManager) GetLabels(uuid string) (map[string]string, error) {
+	var labels []NodeLabel
+	labelsMap := make(map[string]string)
+	if err := n.DB.Where("uuid = ?", strings.ToUpper(uuid)).Find(&labels).Error; err != nil {
+		return labelsMap, err
+	}
+	for _, l := range labels {
+		labelsMap[l.Name] = l.Value
+	}
+	return labelsMap, nil
+}
+
+// SetLabel to create or update a label for a node by UUID
+func (n *NodeManager) SetLabel(uuid, name, value string) error {
+	if name == "" {
+		return fmt.Errorf("label name can not be empty")
+	}
+	var label NodeLabel
+	err := n.DB.Where("uuid = ? AND name = ?", strings.ToUpper(uuid), name).First(&label).Error
+	if err == nil {
+		if err := n.DB.Model(&label).Update("value", value).Error; err != nil {
+			return fmt.Errorf("Update %v", err)
+		}
+		return nil
+	}
+	label = NodeLabel{
+		UUID:  strings.ToUpper(uuid),
+		Name:  name,
+		Value: value,
+	}
+	if err := n.DB.Create(&label).Error; err != nil {
+		return fmt.Errorf("Create NodeLabel %v", err)
+	}
+	return nil
+}
+
+// DeleteLabel to remove a label from a node by UUID
+func (n *NodeManager) DeleteLabel(uuid, name string) error {
+	if err := n.DB.Unscoped().Where("uuid = ? AND name = ?", strings.ToUpper(uuid), name).Delete(&NodeLabel{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
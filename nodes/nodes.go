@@ -137,6 +137,10 @@ func CreateNodes(backend *gorm.DB) *NodeManager {
 	if err := backend.AutoMigrate(NodeHistoryUsername{}).Error; err != nil {
 		log.Fatalf("Failed to AutoMigrate table (node_history_username): %v", err)
 	}
+	// table node_labels
+	if err := backend.AutoMigrate(NodeLabel{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (node_labels): %v", err)
+	}
 	return n
 }
 
@@ -191,6 +195,16 @@ func (n *NodeManager) GetByUUID(uuid string) (OsqueryNode, error) {
 	return node, nil
 }
 
+// GetByUUIDEnv to retrieve full node object from DB, by uuid and environment
+// UUID is expected uppercase
+func (n *NodeManager) GetByUUIDEnv(uuid, environment string) (OsqueryNode, error) {
+	var node OsqueryNode
+	if err := n.DB.Where("uuid = ? AND environment = ?", strings.ToUpper(uuid), environment).First(&node).Error; err != nil {
+		return node, err
+	}
+	return node, nil
+}
+
 // GetBySelector to retrieve target nodes by selector
 func (n *NodeManager) GetBySelector(stype, selector, target string, hours int64) ([]OsqueryNode, error) {
 	var nodes []OsqueryNode
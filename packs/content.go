@@ -0,0 +1,194 @@
+package packs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// PackContent to represent a pack in the standard osquery pack JSON format
+type PackContent struct {
+	Platform  string                  `json:"platform,omitempty"`
+	Version   string                  `json:"version,omitempty"`
+	Shard     int                     `json:"shard,omitempty"`
+	Discovery []string                `json:"discovery,omitempty"`
+	Queries   map[string]QueryContent `json:"queries"`
+}
+
+// QueryContent to represent a query in the standard osquery pack JSON format
+type QueryContent struct {
+	Query       string      `json:"query"`
+	Interval    json.Number `json:"interval"`
+	Platform    string      `json:"platform,omitempty"`
+	Version     string      `json:"version,omitempty"`
+	Snapshot    bool        `json:"snapshot,omitempty"`
+	Removed     *bool       `json:"removed,omitempty"`
+	Shard       int         `json:"shard,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Value       string      `json:"value,omitempty"`
+}
+
+// ParseContent to parse a pack in the standard osquery pack JSON format
+func ParseContent(data []byte) (PackContent, error) {
+	var content PackContent
+	if err := json.Unmarshal(data, &content); err != nil {
+		return content, fmt.Errorf("pack is not valid JSON - %v", err)
+	}
+	if len(content.Queries) == 0 {
+		return content, fmt.Errorf("pack has no queries")
+	}
+	return content, nil
+}
+
+// PackFromContent to convert a pack in osquery format to the pack and queries to be stored
+func PackFromContent(name, description string, content PackContent) (OsqueryPack, []PackQuery, error) {
+	pack := OsqueryPack{
+		Name:        name,
+		Description: description,
+		Platform:    content.Platform,
+		Version:     content.Version,
+		Shard:       content.Shard,
+	}
+	if len(content.Discovery) > 0 {
+		discovery, err := json.Marshal(content.Discovery)
+		if err != nil {
+			return pack, nil, fmt.Errorf("error serializing discovery %v", err)
+		}
+		pack.Discovery = string(discovery)
+	}
+	if err := validPack(pack); err != nil {
+		return pack, nil, err
+	}
+	var queries []PackQuery
+	for qName, q := range content.Queries {
+		interval, err := strconv.Atoi(q.Interval.String())
+		if err != nil {
+			return pack, nil, fmt.Errorf("invalid interval for %s - %v", qName, err)
+		}
+		query := PackQuery{
+			Pack:        name,
+			Name:        qName,
+			Query:       q.Query,
+			Interval:    interval,
+			Platform:    q.Platform,
+			Version:     q.Version,
+			Snapshot:    q.Snapshot,
+			Removed:     q.Removed == nil || *q.Removed,
+			Shard:       q.Shard,
+			Description: q.Description,
+			Value:       q.Value,
+		}
+		if err := validQuery(query); err != nil {
+			return pack, nil, err
+		}
+		queries = append(queries, query)
+	}
+	return pack, queries, nil
+}
+
+// ContentFromPack to convert a stored pack and its queries to the osquery format
+func ContentFromPack(pack OsqueryPack, queries []PackQuery) PackContent {
+	content := PackContent{
+		Platform: pack.Platform,
+		Version:  pack.Version,
+		Shard:    pack.Shard,
+		Queries:  make(map[string]QueryContent),
+	}
+	if pack.Discovery != "" {
+		if err := json.Unmarshal([]byte(pack.Discovery), &content.Discovery); err != nil {
+			content.Discovery = []string{pack.Discovery}
+		}
+	}
+	for _, q := range queries {
+		query := QueryContent{
+			Query:       q.Query,
+			Interval:    json.Number(strconv.Itoa(q.Interval)),
+			Platform:    q.Platform,
+			Version:     q.Version,
+			Snapshot:    q.Snapshot,
+			Shard:       q.Shard,
+			Description: q.Description,
+			Value:       q.Value,
+		}
+		// Queries are removed by default, only include it when it is disabled
+		if !q.Removed {
+			removed := false
+			query.Removed = &removed
+		}
+		content.Queries[q.Name] = query
+	}
+	return content
+}
+
+// Content to retrieve a stored pack in the osquery format
+func (p *Packs) Content(name string) (PackContent, error) {
+	pack, err := p.Get(name)
+	if err != nil {
+		return PackContent{}, fmt.Errorf("error getting pack %v", err)
+	}
+	queries, err := p.GetQueries(name)
+	if err != nil {
+		return PackContent{}, fmt.Errorf("error getting queries %v", err)
+	}
+	return ContentFromPack(pack, queries), nil
+}
+
+// Export to serialize a stored pack in the osquery pack JSON format
+func (p *Packs) Export(name string) ([]byte, error) {
+	content, err := p.Content(name)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(content, "", "  ")
+}
+
+// Import to store a pack in the osquery pack JSON format, replacing the queries
+// of an existing pack with the same name only if replace is true. The pack and its
+// queries are stored in one transaction, so a failed import leaves the pack as it was
+func (p *Packs) Import(name, description string, data []byte, replace bool) error {
+	content, err := ParseContent(data)
+	if err != nil {
+		return err
+	}
+	pack, queries, err := PackFromContent(name, description, content)
+	if err != nil {
+		return err
+	}
+	if p.Exists(name) && !replace {
+		return fmt.Errorf("pack %s already exists", name)
+	}
+	tx := p.DB.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("Begin %v", tx.Error)
+	}
+	if err := (&Packs{DB: tx}).store(pack, queries); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("Commit %v", err)
+	}
+	return nil
+}
+
+// Helper to create or update a pack, replacing all its queries
+func (p *Packs) store(pack OsqueryPack, queries []PackQuery) error {
+	if p.Exists(pack.Name) {
+		if err := p.Update(pack); err != nil {
+			return err
+		}
+		if err := p.DB.Unscoped().Where("pack = ?", pack.Name).Delete(&PackQuery{}).Error; err != nil {
+			return fmt.Errorf("Delete queries %v", err)
+		}
+	} else {
+		if err := p.Create(pack); err != nil {
+			return err
+		}
+	}
+	for _, q := range queries {
+		if err := p.SetQuery(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
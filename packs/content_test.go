@@ -0,0 +1,85 @@
+package packs
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPack = `{
+  "platform": "linux",
+  "discovery": ["SELECT pid FROM processes WHERE name = 'sshd';"],
+  "queries": {
+    "users": {
+      "query": "SELECT * FROM users;",
+      "interval": "3600",
+      "snapshot": true
+    },
+    "listening_ports": {
+      "query": "SELECT * FROM listening_ports;",
+      "interval": 60,
+      "removed": false,
+      "description": "Open ports"
+    }
+  }
+}`
+
+func TestPackFromContent(t *testing.T) {
+	content, err := ParseContent([]byte(testPack))
+	assert.NoError(t, err)
+	pack, queries, err := PackFromContent("test", "Test pack", content)
+	assert.NoError(t, err)
+	assert.Equal(t, "linux", pack.Platform)
+	assert.Equal(t, 2, len(queries))
+	for _, q := range queries {
+		switch q.Name {
+		case "users":
+			assert.Equal(t, 3600, q.Interval)
+			assert.True(t, q.Snapshot)
+			assert.True(t, q.Removed)
+		case "listening_ports":
+			assert.Equal(t, 60, q.Interval)
+			assert.False(t, q.Removed)
+		}
+	}
+	exported := ContentFromPack(pack, queries)
+	assert.Equal(t, content.Discovery, exported.Discovery)
+	assert.Nil(t, exported.Queries["users"].Removed)
+	assert.False(t, *exported.Queries["listening_ports"].Removed)
+}
+
+func TestPackFromContentInvalid(t *testing.T) {
+	_, err := ParseContent([]byte(`{"queries": {}}`))
+	assert.Error(t, err)
+	content, err := ParseContent([]byte(`{"queries": {"q": {"query": "SELECT 1;", "interval": 0}}}`))
+	assert.NoError(t, err)
+	_, _, err = PackFromContent("test", "", content)
+	assert.Error(t, err)
+	content, err = ParseContent([]byte(`{"platform": "beos", "queries": {"q": {"query": "SELECT 1;", "interval": 10}}}`))
+	assert.NoError(t, err)
+	_, _, err = PackFromContent("test", "", content)
+	assert.Error(t, err)
+}
+
+func TestImportReplace(t *testing.T) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	// Every connection to an in-memory database is a different database
+	db.DB().SetMaxOpenConns(1)
+	defer db.Close()
+	p := CreatePacks(db)
+	assert.NoError(t, p.Import("test", "Test pack", []byte(testPack), false))
+	assert.Error(t, p.Import("test", "Test pack", []byte(testPack), false))
+	assert.NoError(t, p.Import("test", "Replaced", []byte(`{"queries": {"uptime": {"query": "SELECT * FROM uptime;", "interval": 60}}}`), true))
+	queries, err := p.GetQueries("test")
+	assert.NoError(t, err)
+	assert.Len(t, queries, 1)
+	// A failed import leaves the pack as it was
+	assert.NoError(t, db.DropTable(&PackQuery{}).Error)
+	assert.Error(t, p.Import("test", "Broken", []byte(testPack), true))
+	pack, err := p.Get("test")
+	assert.NoError(t, err)
+	assert.Equal(t, "Replaced", pack.Description)
+}
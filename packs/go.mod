@@ -0,0 +1,9 @@
+module github.com/jmpsec/osctrl/packs
+
+go 1.14
+
+require (
+	github.com/jinzhu/gorm v1.9.8
+	github.com/mattn/go-sqlite3 v2.0.1+incompatible // indirect
+	github.com/stretchr/testify v1.5.1
+)
@@ -0,0 +1,356 @@
+package packs
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// PackTargetEnvironment for packs assigned to all nodes in an environment
+	PackTargetEnvironment string = "environment"
+	// PackTargetTag for packs assigned to all nodes with a tag
+	PackTargetTag string = "tag"
+	// MaxInterval is the maximum interval in seconds accepted by osquery
+	MaxInterval int = 604800
+)
+
+// Platforms that osquery accepts in packs and queries
+var validPlatforms = map[string]bool{
+	"any":     true,
+	"all":     true,
+	"posix":   true,
+	"darwin":  true,
+	"linux":   true,
+	"windows": true,
+	"freebsd": true,
+}
+
+// OsqueryPack to hold a named osquery pack that can be reused across environments
+type OsqueryPack struct {
+	gorm.Model
+	Name        string `gorm:"unique;index"`
+	Description string
+	Platform    string
+	Version     string
+	Shard       int
+	Discovery   string `gorm:"type:text"`
+}
+
+// PackQuery to hold each of the queries in a pack
+type PackQuery struct {
+	gorm.Model
+	Pack        string `gorm:"index"`
+	Name        string
+	Query       string `gorm:"type:text"`
+	Interval    int
+	Platform    string
+	Version     string
+	Snapshot    bool
+	Removed     bool
+	Shard       int
+	Description string
+	Value       string
+}
+
+// PackTarget to assign a pack to nodes
+type PackTarget struct {
+	gorm.Model
+	Pack  string `gorm:"index"`
+	Type  string
+	Value string
+}
+
+// Packs to handle osquery packs
+type Packs struct {
+	DB *gorm.DB
+}
+
+// CreatePacks to initialize the packs struct and tables
+func CreatePacks(backend *gorm.DB) *Packs {
+	var p *Packs
+	p = &Packs{DB: backend}
+	// table osquery_packs
+	if err := backend.AutoMigrate(OsqueryPack{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (osquery_packs): %v", err)
+	}
+	// table pack_queries
+	if err := backend.AutoMigrate(PackQuery{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (pack_queries): %v", err)
+	}
+	// table pack_targets
+	if err := backend.AutoMigrate(PackTarget{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (pack_targets): %v", err)
+	}
+	return p
+}
+
+// ValidPlatform to check if a platform string is accepted by osquery, it can be a comma separated list
+func ValidPlatform(platform string) bool {
+	if platform == "" {
+		return true
+	}
+	for _, p := range strings.Split(platform, ",") {
+		if !validPlatforms[strings.TrimSpace(p)] {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidTargetType to check if a pack target type is valid
+func ValidTargetType(targetType string) bool {
+	return targetType == PackTargetEnvironment || targetType == PackTargetTag
+}
+
+// Helper to verify the values of a pack
+func validPack(pack OsqueryPack) error {
+	if pack.Name == "" {
+		return fmt.Errorf("pack name can not be empty")
+	}
+	if !ValidPlatform(pack.Platform) {
+		return fmt.Errorf("invalid platform %s", pack.Platform)
+	}
+	if pack.Shard < 0 || pack.Shard > 100 {
+		return fmt.Errorf("shard must be between 0 and 100")
+	}
+	return nil
+}
+
+// Helper to verify the values of a pack query
+func validQuery(query PackQuery) error {
+	if query.Name == "" {
+		return fmt.Errorf("query name can not be empty")
+	}
+	if strings.TrimSpace(query.Query) == "" {
+		return fmt.Errorf("query %s can not be empty", query.Name)
+	}
+	if query.Interval <= 0 || query.Interval > MaxInterval {
+		return fmt.Errorf("interval for %s must be between 1 and %d", query.Name, MaxInterval)
+	}
+	if !ValidPlatform(query.Platform) {
+		return fmt.Errorf("invalid platform %s for %s", query.Platform, query.Name)
+	}
+	if query.Shard < 0 || query.Shard > 100 {
+		return fmt.Errorf("shard for %s must be between 0 and 100", query.Name)
+	}
+	return nil
+}
+
+// Get pack by name
+func (p *Packs) Get(name string) (OsqueryPack, error) {
+	var pack OsqueryPack
+	if err := p.DB.Where("name = ?", name).First(&pack).Error; err != nil {
+		return pack, err
+	}
+	return pack, nil
+}
+
+// Exists checks if pack exists
+func (p *Packs) Exists(name string) bool {
+	var results int
+	p.DB.Model(&OsqueryPack{}).Where("name = ?", name).Count(&results)
+	return (results > 0)
+}
+
+// All gets all packs
+func (p *Packs) All() ([]OsqueryPack, error) {
+	var packs []OsqueryPack
+	if err := p.DB.Order("name").Find(&packs).Error; err != nil {
+		return packs, err
+	}
+	return packs, nil
+}
+
+// Create new pack without queries
+func (p *Packs) Create(pack OsqueryPack) error {
+	if err := validPack(pack); err != nil {
+		return err
+	}
+	if p.Exists(pack.Name) {
+		return fmt.Errorf("pack %s already exists", pack.Name)
+	}
+	if p.DB.NewRecord(pack) {
+		if err := p.DB.Create(&pack).Error; err != nil {
+			return fmt.Errorf("Create OsqueryPack %v", err)
+		}
+	} else {
+		return fmt.Errorf("db.NewRecord did not return true")
+	}
+	return nil
+}
+
+// Update to change the values of an existing pack
+func (p *Packs) Update(pack OsqueryPack) error {
+	if err := validPack(pack); err != nil {
+		return err
+	}
+	existing, err := p.Get(pack.Name)
+	if err != nil {
+		return fmt.Errorf("error getting pack %v", err)
+	}
+	updates := map[string]interface{}{
+		"description": pack.Description,
+		"platform":    pack.Platform,
+		"version":     pack.Version,
+		"shard":       pack.Shard,
+		"discovery":   pack.Discovery,
+	}
+	if err := p.DB.Model(&existing).Updates(updates).Error; err != nil {
+		return fmt.Errorf("Updates %v", err)
+	}
+	return nil
+}
+
+// Delete pack by name, including its queries and targets
+func (p *Packs) Delete(name string) error {
+	pack, err := p.Get(name)
+	if err != nil {
+		return fmt.Errorf("error getting pack %v", err)
+	}
+	if err := p.DB.Unscoped().Where("pack = ?", name).Delete(&PackQuery{}).Error; err != nil {
+		return fmt.Errorf("Delete queries %v", err)
+	}
+	if err := p.DB.Unscoped().Where("pack = ?", name).Delete(&PackTarget{}).Error; err != nil {
+		return fmt.Errorf("Delete targets %v", err)
+	}
+	if err := p.DB.Unscoped().Delete(&pack).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// GetQuery to retrieve one query from a pack
+func (p *Packs) GetQuery(pack, name string) (PackQuery, error) {
+	var query PackQuery
+	if err := p.DB.Where("pack = ? AND name = ?", pack, name).First(&query).Error; err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// GetQueries to retrieve all queries from a pack
+func (p *Packs) GetQueries(pack string) ([]PackQuery, error) {
+	var queries []PackQuery
+	if err := p.DB.Where("pack = ?", pack).Order("name").Find(&queries).Error; err != nil {
+		return queries, err
+	}
+	return queries, nil
+}
+
+// SetQuery to add a query to a pack or replace the existing query with the same name
+func (p *Packs) SetQuery(query PackQuery) error {
+	if err := validQuery(query); err != nil {
+		return err
+	}
+	if !p.Exists(query.Pack) {
+		return fmt.Errorf("pack %s does not exist", query.Pack)
+	}
+	existing, err := p.GetQuery(query.Pack, query.Name)
+	if err != nil {
+		if p.DB.NewRecord(query) {
+			if err := p.DB.Create(&query).Error; err != nil {
+				return fmt.Errorf("Create PackQuery %v", err)
+			}
+			return nil
+		}
+		return fmt.Errorf("db.NewRecord did not return true")
+	}
+	updates := map[string]interface{}{
+		"query":       query.Query,
+		"interval":    query.Interval,
+		"platform":    query.Platform,
+		"version":     query.Version,
+		"snapshot":    query.Snapshot,
+		"removed":     query.Removed,
+		"shard":       query.Shard,
+		"description": query.Description,
+		"value":       query.Value,
+	}
+	if err := p.DB.Model(&existing).Updates(updates).Error; err != nil {
+		return fmt.Errorf("Updates %v", err)
+	}
+	return nil
+}
+
+// DeleteQuery to remove a query from a pack
+func (p *Packs) DeleteQuery(pack, name string) error {
+	query, err := p.GetQuery(pack, name)
+	if err != nil {
+		return fmt.Errorf("error getting query %v", err)
+	}
+	if err := p.DB.Unscoped().Delete(&query).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// AddTarget to assign a pack to a target
+func (p *Packs) AddTarget(name, targetType, targetValue string) error {
+	if !ValidTargetType(targetType) {
+		return fmt.Errorf("invalid target type %s", targetType)
+	}
+	if !p.Exists(name) {
+		return fmt.Errorf("pack %s does not exist", name)
+	}
+	var results int
+	p.DB.Model(&PackTarget{}).Where("pack = ? AND type = ? AND value = ?", name, targetType, targetValue).Count(&results)
+	if results > 0 {
+		return nil
+	}
+	target := PackTarget{
+		Pack:  name,
+		Type:  targetType,
+		Value: targetValue,
+	}
+	if p.DB.NewRecord(target) {
+		if err := p.DB.Create(&target).Error; err != nil {
+			return fmt.Errorf("Create PackTarget %v", err)
+		}
+	} else {
+		return fmt.Errorf("db.NewRecord did not return true")
+	}
+	return nil
+}
+
+// RemoveTarget to unassign a pack from a target
+func (p *Packs) RemoveTarget(name, targetType, targetValue string) error {
+	if err := p.DB.Unscoped().Where("pack = ? AND type = ? AND value = ?", name, targetType, targetValue).Delete(&PackTarget{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// GetTargets to retrieve the targets of a pack
+func (p *Packs) GetTargets(name string) ([]PackTarget, error) {
+	var targets []PackTarget
+	if err := p.DB.Where("pack = ?", name).Order("type, value").Find(&targets).Error; err != nil {
+		return targets, err
+	}
+	return targets, nil
+}
+
+// GetByTarget to retrieve all packs assigned to a target
+func (p *Packs) GetByTarget(targetType, targetValue string) ([]OsqueryPack, error) {
+	var packs []OsqueryPack
+	names := p.DB.Model(&PackTarget{}).Select("pack").Where("type = ? AND value = ?", targetType, targetValue).QueryExpr()
+	if err := p.DB.Where("name IN (?)", names).Order("name").Find(&packs).Error; err != nil {
+		return packs, err
+	}
+	return packs, nil
+}
+
+// GetForNode to retrieve all packs assigned to the environment or any of the tags of a node
+func (p *Packs) GetForNode(environment string, tags []string) ([]OsqueryPack, error) {
+	var packs []OsqueryPack
+	targets := p.DB.Model(&PackTarget{}).Select("pack").Where("type = ? AND value = ?", PackTargetEnvironment, environment)
+	if len(tags) > 0 {
+		targets = targets.Or("type = ? AND value IN (?)", PackTargetTag, tags)
+	}
+	if err := p.DB.Where("name IN (?)", targets.QueryExpr()).Order("name").Find(&packs).Error; err != nil {
+		return packs, err
+	}
+	return packs, nil
+}
@@ -0,0 +1,238 @@
+package queries
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/nodes"
+)
+
+const (
+	// ApprovalPending for queries and carves waiting for approval, not sent to nodes
+	ApprovalPending string = "pending"
+	// ApprovalApproved for queries and carves approved by another user
+	ApprovalApproved string = "approved"
+	// ApprovalRejected for queries and carves rejected by another user
+	ApprovalRejected string = "rejected"
+	// ApprovalRequested to record that approval was requested
+	ApprovalRequested string = "requested"
+)
+
+// Timeout to send approval notifications
+const approvalNotifyTimeout = 10 * time.Second
+
+// DistributedQueryApproval to record the approval requests and decisions for queries and carves
+type DistributedQueryApproval struct {
+	gorm.Model
+	Name    string `gorm:"index"`
+	User    string
+	Action  string
+	Comment string
+}
+
+// ApprovalPolicy to decide which queries and carves need approval by another user
+type ApprovalPolicy struct {
+	Carves       bool
+	MaxNodes     int64
+	Environments []string
+}
+
+// ApprovalNotification to notify approvers about a pending query or carve
+type ApprovalNotification struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Creator  string `json:"creator"`
+	Query    string `json:"query"`
+	Expected int    `json:"expected"`
+	Reason   string `json:"reason"`
+}
+
+// NewApprovalPolicy to prepare a policy from settings, environments are separated by commas
+func NewApprovalPolicy(carves bool, maxNodes int64, environments string) ApprovalPolicy {
+	p := ApprovalPolicy{Carves: carves, MaxNodes: maxNodes}
+	for _, e := range strings.Split(environments, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			p.Environments = append(p.Environments, e)
+		}
+	}
+	return p
+}
+
+// Enabled to check if any query or carve may need approval
+func (p ApprovalPolicy) Enabled() bool {
+	return p.Carves || p.MaxNodes > 0 || len(p.Environments) > 0
+}
+
+// Required to check if a query or carve needs approval for the nodes it targets, with the reason
+func (p ApprovalPolicy) Required(qtype string, targeted []nodes.OsqueryNode) (bool, string) {
+	var reasons []string
+	if p.Carves && qtype == CarveQueryType {
+		reasons = append(reasons, "carves need approval")
+	}
+	if p.MaxNodes > 0 && int64(len(targeted)) > p.MaxNodes {
+		reasons = append(reasons, fmt.Sprintf("targets %d nodes, more than %d", len(targeted), p.MaxNodes))
+	}
+	if len(p.Environments) > 0 {
+		seen := make(map[string]bool)
+		for _, n := range targeted {
+			seen[n.Environment] = true
+		}
+		var envs []string
+		for _, e := range p.Environments {
+			if seen[e] {
+				envs = append(envs, e)
+			}
+		}
+		if len(envs) > 0 {
+			sort.Strings(envs)
+			reasons = append(reasons, "targets environments "+strings.Join(envs, ", "))
+		}
+	}
+	return len(reasons) > 0, strings.Join(reasons, "; ")
+}
+
+// Approved to check if a query can be sent to nodes
+func (q DistributedQuery) Approved() bool {
+	return q.Approval != ApprovalPending && q.Approval != ApprovalRejected
+}
+
+// CanReview to check if a user can approve or reject a query, always with a comment
+func CanReview(query DistributedQuery, username, comment string) error {
+	if query.Approval != ApprovalPending {
+		return fmt.Errorf("%s is not pending approval", query.Name)
+	}
+	if query.Creator == username {
+		return fmt.Errorf("%s can not be approved by its creator", query.Name)
+	}
+	if strings.TrimSpace(comment) == "" {
+		return fmt.Errorf("a comment is required")
+	}
+	return nil
+}
+
+// CheckApproval to apply an approval policy to a query once its targets are created. Queries that
+// need approval stay pending and the request is recorded, the rest are released to nodes
+func (q *Queries) CheckApproval(name string, policy ApprovalPolicy, nodesmgr *nodes.NodeManager, hours int64) (bool, string, error) {
+	query, err := q.Get(name)
+	if err != nil {
+		return false, "", err
+	}
+	targets, err := q.GetTargets(name)
+	if err != nil {
+		return false, "", err
+	}
+	active, err := nodesmgr.Gets("active", hours)
+	if err != nil {
+		return false, "", err
+	}
+	targeted, err := q.MatchingNodes(targets, active)
+	if err != nil {
+		return false, "", err
+	}
+	required, reason := policy.Required(query.Type, targeted)
+	if !required {
+		return false, "", q.DB.Model(&query).Update("approval", "").Error
+	}
+	if err := q.DB.Model(&query).Update("approval", ApprovalPending).Error; err != nil {
+		return false, "", err
+	}
+	return true, reason, q.recordApproval(name, query.Creator, ApprovalRequested, reason)
+}
+
+// Helper to record an approval action
+func (q *Queries) recordApproval(name, username, action, comment string) error {
+	approval := DistributedQueryApproval{
+		Name:    name,
+		User:    username,
+		Action:  action,
+		Comment: comment,
+	}
+	return q.DB.Create(&approval).Error
+}
+
+// Approve to release a pending query to nodes. Expiration starts again, keeping the same duration
+func (q *Queries) Approve(name, username, comment string) error {
+	query, err := q.Get(name)
+	if err != nil {
+		return err
+	}
+	if err := CanReview(query, username, comment); err != nil {
+		return err
+	}
+	if query.Expired {
+		return fmt.Errorf("%s expired before approval", name)
+	}
+	updates := map[string]interface{}{"approval": ApprovalApproved}
+	if !query.Expiration.IsZero() {
+		updates["expiration"] = time.Now().Add(query.Expiration.Sub(query.CreatedAt))
+	}
+	if err := q.DB.Model(&query).Updates(updates).Error; err != nil {
+		return err
+	}
+	return q.recordApproval(name, username, ApprovalApproved, comment)
+}
+
+// Reject to stop a pending query, it will never be sent to nodes
+func (q *Queries) Reject(name, username, comment string) error {
+	query, err := q.Get(name)
+	if err != nil {
+		return err
+	}
+	if err := CanReview(query, username, comment); err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"approval": ApprovalRejected, "active": false, "completed": true}
+	if err := q.DB.Model(&query).Updates(updates).Error; err != nil {
+		return err
+	}
+	return q.recordApproval(name, username, ApprovalRejected, comment)
+}
+
+// GetPending to get all queries and carves pending approval
+func (q *Queries) GetPending() ([]DistributedQuery, error) {
+	var pending []DistributedQuery
+	if err := q.DB.Where("approval = ? AND deleted = ?", ApprovalPending, false).Order("created_at").Find(&pending).Error; err != nil {
+		return pending, err
+	}
+	return pending, nil
+}
+
+// GetApprovals to get the approval history of a query or carve
+func (q *Queries) GetApprovals(name string) ([]DistributedQueryApproval, error) {
+	var approvals []DistributedQueryApproval
+	if err := q.DB.Where("name = ?", name).Order("created_at").Find(&approvals).Error; err != nil {
+		return approvals, err
+	}
+	return approvals, nil
+}
+
+// NotifyApproval to send a pending query or carve to a webhook, so approvers can review it
+func NotifyApproval(url string, query DistributedQuery, reason string) error {
+	payload, err := json.Marshal(ApprovalNotification{
+		Name:     query.Name,
+		Type:     query.Type,
+		Creator:  query.Creator,
+		Query:    query.Query,
+		Expected: query.Expected,
+		Reason:   reason,
+	})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: approvalNotifyTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("approval notification returned %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package queries
+
+import (
+	"testing"
+
+	"github.com/jmpsec/osctrl/nodes"
+)
+
+func TestApprovalPolicy(t *testing.T) {
+	targeted := []nodes.OsqueryNode{
+		{UUID: "AAAA", Environment: "dev"},
+		{UUID: "BBBB", Environment: "prod"},
+		{UUID: "CCCC", Environment: "prod"},
+	}
+	tests := []struct {
+		policy   ApprovalPolicy
+		qtype    string
+		targeted []nodes.OsqueryNode
+		required bool
+	}{
+		{NewApprovalPolicy(false, 0, ""), CarveQueryType, targeted, false},
+		{NewApprovalPolicy(true, 0, ""), CarveQueryType, targeted[:1], true},
+		{NewApprovalPolicy(true, 0, ""), StandardQueryType, targeted, false},
+		{NewApprovalPolicy(false, 2, ""), StandardQueryType, targeted, true},
+		{NewApprovalPolicy(false, 3, ""), StandardQueryType, targeted, false},
+		{NewApprovalPolicy(false, 0, "prod, pci"), StandardQueryType, targeted, true},
+		{NewApprovalPolicy(false, 0, "prod, pci"), StandardQueryType, targeted[:1], false},
+	}
+	for i, tt := range tests {
+		required, reason := tt.policy.Required(tt.qtype, tt.targeted)
+		if required != tt.required {
+			t.Errorf("%d: Required() = %v (%s), expected %v", i, required, reason, tt.required)
+		}
+		if required && reason == "" {
+			t.Errorf("%d: Required() without reason", i)
+		}
+	}
+	if NewApprovalPolicy(false, 0, " , ").Enabled() {
+		t.Errorf("Enabled() expected false for empty policy")
+	}
+}
+
+func TestCanReview(t *testing.T) {
+	pending := DistributedQuery{Name: "q", Creator: "alice", Approval: ApprovalPending}
+	if err := CanReview(pending, "bob", "looks good"); err != nil {
+		t.Errorf("CanReview() error %v", err)
+	}
+	if err := CanReview(pending, "alice", "looks good"); err == nil {
+		t.Errorf("CanReview() expected error for creator")
+	}
+	if err := CanReview(pending, "bob", " "); err == nil {
+		t.Errorf("CanReview() expected error without comment")
+	}
+	approved := DistributedQuery{Name: "q", Creator: "alice", Approval: ApprovalApproved}
+	if err := CanReview(approved, "bob", "again"); err == nil {
+		t.Errorf("CanReview() expected error for approved query")
+	}
+	if !approved.Approved() || pending.Approved() || !(DistributedQuery{}).Approved() {
+		t.Errorf("Approved() unexpected result")
+	}
+}
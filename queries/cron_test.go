@@ -0,0 +1,41 @@
+package queries
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	base := time.Date(2020, time.March, 15, 10, 30, 45, 0, time.UTC)
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2020, time.March, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, time.March, 15, 10, 45, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2020, time.March, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2020, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 9-17 * * 1-5", time.Date(2020, time.March, 16, 9, 0, 0, 0, time.UTC)},
+		{"30 10 * * 7", time.Date(2020, time.March, 22, 10, 30, 0, 0, time.UTC)},
+		{"0 0 1 1,6 *", time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2020, time.March, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) - %v", tt.spec, err)
+		}
+		if got := s.Next(base); !got.Equal(tt.next) {
+			t.Errorf("Next(%q) = %v, expected %v", tt.spec, got, tt.next)
+		}
+	}
+}
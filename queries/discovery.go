@@ -0,0 +1,65 @@
+package queries
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/nodes"
+)
+
+// MessageDiscoverySkipped for the status of nodes where the discovery query returned no rows
+const MessageDiscoverySkipped = "discovery query returned no rows"
+
+// SkipUndiscovered to mark as skipped the queries with discovery that a node read at least delay
+// ago without answering them. osquery runs the discovery query first and only answers if it returned
+// rows, so a node reading again without answering means the query did not apply to it. Results are
+// written separately from reads, so the delay, like one distributed interval, gives them time to arrive
+func (q *Queries) SkipUndiscovered(node nodes.OsqueryNode, delay time.Duration) ([]string, error) {
+	var skipped []string
+	var statuses []DistributedQueryStatus
+	if err := q.DB.Where("uuid = ? AND status = ? AND delivered_at <= ?", node.UUID, NodeStatusDelivered, time.Now().Add(-delay)).Find(&statuses).Error; err != nil {
+		return skipped, err
+	}
+	for _, s := range statuses {
+		query, err := q.Get(s.Name)
+		if err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				continue
+			}
+			return skipped, err
+		}
+		if query.Discovery == "" || !query.Active || !q.NotYetExecuted(query.Name, node.UUID) {
+			continue
+		}
+		if err := q.TrackSkipped(query.Name, node); err != nil {
+			return skipped, err
+		}
+		skipped = append(skipped, query.Name)
+	}
+	return skipped, nil
+}
+
+// TrackSkipped to keep track of a node where the discovery query of a query returned no rows, the
+// node is completed for the query without running it
+func (q *Queries) TrackSkipped(name string, node nodes.OsqueryNode) error {
+	queryExecution := DistributedQueryExecution{
+		Name:    name,
+		UUID:    node.UUID,
+		Skipped: true,
+	}
+	if q.DB.NewRecord(queryExecution) {
+		if err := q.DB.Create(&queryExecution).Error; err != nil {
+			return err
+		}
+	} else {
+		return fmt.Errorf("db.NewRecord did not return true")
+	}
+	if err := q.SetStatus(name, node, NodeStatusSkipped, MessageDiscoverySkipped); err != nil {
+		return err
+	}
+	if err := q.DB.Model(&DistributedQuery{}).Where("name = ?", name).Update("skipped", gorm.Expr("skipped + ?", 1)).Error; err != nil {
+		return err
+	}
+	return q.VerifyComplete(name)
+}
@@ -0,0 +1,51 @@
+package queries
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jmpsec/osctrl/nodes"
+)
+
+func TestSkipUndiscovered(t *testing.T) {
+	node := nodes.OsqueryNode{UUID: "AAAA", Hostname: "a", Environment: "prod"}
+	q, nodesmgr := testQueriesDB(t, node)
+	query := DistributedQuery{Name: "q1", Query: "SELECT 1;", Discovery: "SELECT 1 FROM processes WHERE name = 'nginx';", Active: true}
+	if err := q.Create(query); err != nil {
+		t.Fatalf("Create() error %v", err)
+	}
+	if err := q.CreateTarget("q1", QueryTargetEnvironment, "prod"); err != nil {
+		t.Fatalf("CreateTarget() error %v", err)
+	}
+	if err := q.InitStatuses("q1", nodesmgr, -72); err != nil {
+		t.Fatalf("InitStatuses() error %v", err)
+	}
+	if err := q.TrackDelivery(QueryReadQueries{"q1": query.Query}, node); err != nil {
+		t.Fatalf("TrackDelivery() error %v", err)
+	}
+	// Results can still be on their way within the delay, even if the node reads again
+	skipped, err := q.SkipUndiscovered(node, time.Minute)
+	if err != nil || len(skipped) != 0 {
+		t.Fatalf("SkipUndiscovered() within delay = %v, %v", skipped, err)
+	}
+	delivered := time.Now().Add(-2 * time.Minute)
+	if err := q.DB.Model(&DistributedQueryStatus{}).Where("name = ? AND uuid = ?", "q1", "AAAA").UpdateColumn("delivered_at", delivered).Error; err != nil {
+		t.Fatalf("error updating status %v", err)
+	}
+	// Reading the query again keeps the time of the first delivery
+	if err := q.TrackDelivery(QueryReadQueries{"q1": query.Query}, node); err != nil {
+		t.Fatalf("TrackDelivery() error %v", err)
+	}
+	skipped, err = q.SkipUndiscovered(node, time.Minute)
+	if err != nil || len(skipped) != 1 || skipped[0] != "q1" {
+		t.Fatalf("SkipUndiscovered() after delay = %v, %v", skipped, err)
+	}
+	statuses, _ := q.GetStatuses("q1")
+	if len(statuses) != 1 || statuses[0].Status != NodeStatusSkipped || statuses[0].Message != MessageDiscoverySkipped {
+		t.Errorf("GetStatuses() = %+v", statuses)
+	}
+	stored, _ := q.Get("q1")
+	if stored.Skipped != 1 || !stored.Completed {
+		t.Errorf("SkipUndiscovered() query = %+v", stored)
+	}
+}
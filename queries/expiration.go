@@ -0,0 +1,93 @@
+package queries
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DistributedQueryNoAnswer to keep track of targeted nodes that never answered an expired query
+type DistributedQueryNoAnswer struct {
+	gorm.Model
+	Name     string `gorm:"index"`
+	UUID     string `gorm:"index"`
+	Hostname string
+}
+
+// ExpirationTime to calculate when a query created now expires, zero hours means never
+func ExpirationTime(hours int64) time.Time {
+	if hours <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(hours) * time.Hour)
+}
+
+// QueryExpirationHours to get the hours until a new query expires, the same for every client: zero
+// uses the default hours and negative values mean that the query never expires
+func QueryExpirationHours(hours, defaults int64) int64 {
+	if hours == 0 {
+		return defaults
+	}
+	return hours
+}
+
+// GetExpired to get all active queries with an expiration time that has passed
+func (q *Queries) GetExpired(now time.Time) ([]DistributedQuery, error) {
+	var queries []DistributedQuery
+	if err := q.DB.Where("active = ? AND expiration > ? AND expiration <= ?", true, time.Time{}, now).Find(&queries).Error; err != nil {
+		return queries, err
+	}
+	return queries, nil
+}
+
+// Expire to mark a query as expired, recording the nodes targeted when it was created that did
+// not answer it, from their delivery status. Nodes that went inactive since then are included
+func (q *Queries) Expire(query DistributedQuery) error {
+	var unanswered []DistributedQueryStatus
+	if err := q.DB.Where("name = ? AND status IN (?)", query.Name, []string{NodeStatusPending, NodeStatusDelivered}).Find(&unanswered).Error; err != nil {
+		return err
+	}
+	for _, s := range unanswered {
+		noAnswer := DistributedQueryNoAnswer{
+			Name:     query.Name,
+			UUID:     s.UUID,
+			Hostname: s.Hostname,
+		}
+		if err := q.DB.Create(&noAnswer).Error; err != nil {
+			return err
+		}
+	}
+	if err := q.ExpireStatuses(query.Name); err != nil {
+		return err
+	}
+	if err := q.DB.Model(&query).Updates(map[string]interface{}{"expired": true, "completed": true, "active": false}).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// ExpireQueries to expire all queries past their expiration time
+func (q *Queries) ExpireQueries() ([]DistributedQuery, error) {
+	var expired []DistributedQuery
+	queries, err := q.GetExpired(time.Now())
+	if err != nil {
+		return expired, err
+	}
+	for _, _q := range queries {
+		if err := q.Expire(_q); err != nil {
+			return expired, fmt.Errorf("query %s - %v", _q.Name, err)
+		}
+		expired = append(expired, _q)
+	}
+	return expired, nil
+}
+
+// GetNoAnswers to retrieve the targeted nodes that did not answer an expired query
+func (q *Queries) GetNoAnswers(name string) ([]DistributedQueryNoAnswer, error) {
+	var noAnswers []DistributedQueryNoAnswer
+	if err := q.DB.Where("name = ?", name).Find(&noAnswers).Error; err != nil {
+		return noAnswers, err
+	}
+	return noAnswers, nil
+}
@@ -0,0 +1,80 @@
+package queries
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jmpsec/osctrl/nodes"
+)
+
+func TestExpirationTime(t *testing.T) {
+	if !ExpirationTime(0).IsZero() {
+		t.Errorf("expected no expiration for zero hours")
+	}
+	if !ExpirationTime(-1).IsZero() {
+		t.Errorf("expected no expiration for negative hours")
+	}
+	exp := ExpirationTime(2)
+	if d := time.Until(exp); d <= time.Hour || d > 2*time.Hour {
+		t.Errorf("unexpected expiration in %v", d)
+	}
+}
+
+func TestQueryExpirationHours(t *testing.T) {
+	if h := QueryExpirationHours(0, 24); h != 24 {
+		t.Errorf("QueryExpirationHours() default = %d", h)
+	}
+	if h := QueryExpirationHours(2, 24); h != 2 {
+		t.Errorf("QueryExpirationHours() = %d", h)
+	}
+	if !ExpirationTime(QueryExpirationHours(-1, 24)).IsZero() {
+		t.Errorf("expected no expiration for negative hours")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	q, nodesmgr := testQueriesDB(t,
+		nodes.OsqueryNode{UUID: "AAAA", Hostname: "a", Environment: "prod"},
+		nodes.OsqueryNode{UUID: "BBBB", Hostname: "b", Environment: "prod"},
+		nodes.OsqueryNode{UUID: "CCCC", Hostname: "c", Environment: "prod"},
+	)
+	query := DistributedQuery{Name: "q1", Query: "SELECT 1;", Active: true, Expiration: time.Now().Add(-time.Minute)}
+	if err := q.Create(query); err != nil {
+		t.Fatalf("Create() error %v", err)
+	}
+	if err := q.CreateTarget("q1", QueryTargetEnvironment, "prod"); err != nil {
+		t.Fatalf("CreateTarget() error %v", err)
+	}
+	if err := q.InitStatuses("q1", nodesmgr, -72); err != nil {
+		t.Fatalf("InitStatuses() error %v", err)
+	}
+	if err := q.TrackAnswer("q1", nodes.OsqueryNode{UUID: "AAAA", Hostname: "a"}, 0, ""); err != nil {
+		t.Fatalf("TrackAnswer() error %v", err)
+	}
+	if err := q.TrackDelivery(QueryReadQueries{"q1": "SELECT 1;"}, nodes.OsqueryNode{UUID: "BBBB", Hostname: "b"}); err != nil {
+		t.Fatalf("TrackDelivery() error %v", err)
+	}
+	// Nodes that go inactive after the query was created are still expected to answer
+	if err := nodesmgr.DB.Model(&nodes.OsqueryNode{}).Where("uuid = ?", "CCCC").UpdateColumn("updated_at", time.Now().Add(-100*time.Hour)).Error; err != nil {
+		t.Fatalf("error updating node %v", err)
+	}
+	expired, err := q.ExpireQueries()
+	if err != nil || len(expired) != 1 {
+		t.Fatalf("ExpireQueries() = %v, %v", expired, err)
+	}
+	noAnswers, err := q.GetNoAnswers("q1")
+	if err != nil || len(noAnswers) != 2 || noAnswers[0].UUID != "BBBB" || noAnswers[1].UUID != "CCCC" || noAnswers[1].Hostname != "c" {
+		t.Errorf("GetNoAnswers() = %+v, %v", noAnswers, err)
+	}
+	counts := map[string]int{}
+	statuses, _ := q.GetStatuses("q1")
+	for _, s := range statuses {
+		counts[s.Status]++
+	}
+	if counts[NodeStatusOK] != 1 || counts[NodeStatusExpired] != 2 {
+		t.Errorf("GetStatuses() after expiration = %v", counts)
+	}
+	if stored, _ := q.Get("q1"); !stored.Expired || stored.Active {
+		t.Errorf("Expire() query = %+v", stored)
+	}
+}
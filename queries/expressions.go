@@ -0,0 +1,231 @@
+package queries
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/utils"
+)
+
+// QueryTargetExpression defines a boolean expression of targets as target
+const QueryTargetExpression string = "expression"
+
+// Target types that can be used as terms in expressions
+var expressionTerms = map[string]bool{
+	QueryTargetEnvironment:     true,
+	QueryTargetPlatform:        true,
+	QueryTargetUUID:            true,
+	QueryTargetLocalname:       true,
+	QueryTargetTag:             true,
+	QueryTargetHostname:        true,
+	QueryTargetHostnameRegex:   true,
+	QueryTargetCIDR:            true,
+	QueryTargetOsqueryVersion:  true,
+	QueryTargetPlatformVersion: true,
+}
+
+// Expression to hold a parsed target expression, like:
+// environment:prod AND platform:darwin AND NOT tag:excluded
+type Expression struct {
+	op    string
+	left  *Expression
+	right *Expression
+	term  DistributedQueryTarget
+}
+
+// Operators of expressions
+const (
+	exprAnd  = "AND"
+	exprOr   = "OR"
+	exprNot  = "NOT"
+	exprTerm = "TERM"
+)
+
+// Maximum number of parsed expressions and compiled regular expressions kept in their caches
+const parsedCacheSize int = 10000
+
+// Parsed expressions, so they are not parsed again every time nodes check for queries
+var parsedExpressions = utils.NewBoundedCache(parsedCacheSize)
+
+// ParseExpression to parse a target expression with terms type:value, AND, OR, NOT and parentheses
+// Values with spaces or special characters can be quoted, like osquery-version:">=4.2.0, <4.5.0"
+func ParseExpression(expr string) (*Expression, error) {
+	if e, ok := parsedExpressions.Get(expr); ok {
+		return e.(*Expression), nil
+	}
+	tokens, err := tokenizeExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	p := &expressionParser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	parsedExpressions.Set(expr, e)
+	return e, nil
+}
+
+// Helper to split an expression in parentheses, words and quoted values
+func tokenizeExpression(expr string) ([]string, error) {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range expr {
+		switch {
+		case quoted && r == '"':
+			quoted = false
+		case quoted:
+			current.WriteRune(r)
+		case r == '"':
+			quoted = true
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	flush()
+	return tokens, nil
+}
+
+// expressionParser to parse tokens with precedence NOT > AND > OR
+type expressionParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *expressionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *expressionParser) parseOr() (*Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.ToUpper(p.peek()) == exprOr {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Expression{op: exprOr, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseAnd() (*Expression, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for strings.ToUpper(p.peek()) == exprAnd {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &Expression{op: exprAnd, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseNot() (*Expression, error) {
+	if strings.ToUpper(p.peek()) == exprNot {
+		p.pos++
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &Expression{op: exprNot, left: e}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *expressionParser) parsePrimary() (*Expression, error) {
+	token := p.peek()
+	if token == "" {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	if token == "(" {
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return e, nil
+	}
+	i := strings.Index(token, ":")
+	if i <= 0 {
+		return nil, fmt.Errorf("invalid term %q, expected type:value", token)
+	}
+	term := DistributedQueryTarget{Type: strings.ToLower(token[:i]), Value: token[i+1:]}
+	if !expressionTerms[term.Type] {
+		return nil, fmt.Errorf("unknown target type %q", term.Type)
+	}
+	if err := ValidateTarget(term.Type, term.Value); err != nil {
+		return nil, err
+	}
+	return &Expression{op: exprTerm, term: term}, nil
+}
+
+// Match to evaluate the expression for a node with its tags
+func (e *Expression) Match(node nodes.OsqueryNode, nodeTags []string) bool {
+	switch e.op {
+	case exprAnd:
+		return e.left.Match(node, nodeTags) && e.right.Match(node, nodeTags)
+	case exprOr:
+		return e.left.Match(node, nodeTags) || e.right.Match(node, nodeTags)
+	case exprNot:
+		return !e.left.Match(node, nodeTags)
+	}
+	return isQueryTarget(node, []DistributedQueryTarget{e.term}, nodeTags)
+}
+
+// UsesTags to check if any term of the expression needs the tags of nodes
+func (e *Expression) UsesTags() bool {
+	switch e.op {
+	case exprAnd, exprOr:
+		return e.left.UsesTags() || e.right.UsesTags()
+	case exprNot:
+		return e.left.UsesTags()
+	}
+	return e.term.Type == QueryTargetTag
+}
+
+// Helper to evaluate a stored expression target, invalid expressions never match
+func matchExpression(expr string, node nodes.OsqueryNode, nodeTags []string) bool {
+	e, err := ParseExpression(expr)
+	if err != nil {
+		return false
+	}
+	return e.Match(node, nodeTags)
+}
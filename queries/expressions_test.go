@@ -0,0 +1,37 @@
+package queries
+
+import "testing"
+
+func TestParseExpressionInvalid(t *testing.T) {
+	for _, expr := range []string{"", "prod", "environment:prod AND", "(platform:darwin", "unknown:value", "cidr:10.0.0.0", `tag:"web`, "platform:darwin OR )"} {
+		if _, err := ParseExpression(expr); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestExpressionMatch(t *testing.T) {
+	tests := []struct {
+		expr  string
+		tags  []string
+		match bool
+	}{
+		{"environment:prod AND platform:ubuntu AND NOT tag:excluded", []string{"web"}, true},
+		{"environment:prod AND platform:ubuntu AND NOT tag:excluded", []string{"excluded"}, false},
+		{"environment:prod and platform:darwin", nil, false},
+		{"platform:darwin OR platform:ubuntu", nil, true},
+		{"NOT (platform:darwin OR environment:dev)", nil, true},
+		{"platform:darwin OR environment:prod AND cidr:10.0.0.0/8", nil, true},
+		{"(platform:darwin OR environment:prod) AND cidr:192.168.0.0/16", nil, false},
+		{`osquery-version:">=4.2.0, <4.5.0" AND hostname:web-*`, nil, true},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpression(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseExpression(%q) - %v", tt.expr, err)
+		}
+		if got := e.Match(testNode, tt.tags); got != tt.match {
+			t.Errorf("Match(%q) = %v, expected %v", tt.expr, got, tt.match)
+		}
+	}
+}
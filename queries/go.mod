@@ -4,5 +4,14 @@ go 1.14
 
 require (
 	github.com/jinzhu/gorm v1.9.8
-	github.com/jmpsec/osctrl/nodes v0.0.0-20200321003619-c21be7214ee4
+	github.com/jmpsec/osctrl/nodes v0.2.2
+	github.com/jmpsec/osctrl/tags v0.2.2
+	github.com/jmpsec/osctrl/utils v0.2.2
+	github.com/mattn/go-sqlite3 v2.0.1+incompatible // indirect
 )
+
+replace github.com/jmpsec/osctrl/nodes => ../nodes
+
+replace github.com/jmpsec/osctrl/tags => ../tags
+
+replace github.com/jmpsec/osctrl/utils => ../utils
@@ -0,0 +1,95 @@
+package queries
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// ResultLimits to hold the limits for the results of a query, zero means no limit. Node limits
+// apply to the results of each node and query limits to all the results stored for a query
+type ResultLimits struct {
+	NodeRows   int
+	NodeBytes  int
+	QueryRows  int
+	QueryBytes int
+}
+
+// Helper to get the lowest of two limits, zero means no limit
+func lowerLimit(a, b int) int {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 || a < b {
+		return a
+	}
+	return b
+}
+
+// Helper to get what is left of a limit, negative when nothing is left
+func remainingLimit(limit, used int) int {
+	if limit <= 0 {
+		return 0
+	}
+	if used >= limit {
+		return -1
+	}
+	return limit - used
+}
+
+// Limits to get the limits for the next results of a query, using the limits of the query when set
+// and what is left of the query limits after the results already stored
+func (q DistributedQuery) Limits(defaults ResultLimits) ResultLimits {
+	limits := defaults
+	if q.MaxRows > 0 {
+		limits.QueryRows = q.MaxRows
+	}
+	if q.MaxBytes > 0 {
+		limits.QueryBytes = q.MaxBytes
+	}
+	rows := remainingLimit(limits.QueryRows, q.StoredRows)
+	bytes := remainingLimit(limits.QueryBytes, q.StoredBytes)
+	if rows < 0 || bytes < 0 {
+		limits.NodeRows = -1
+		limits.NodeBytes = -1
+		return limits
+	}
+	limits.NodeRows = lowerLimit(limits.NodeRows, rows)
+	limits.NodeBytes = lowerLimit(limits.NodeBytes, bytes)
+	return limits
+}
+
+// ReserveStored to add the rows and bytes stored for a query only when they fit in what is left of
+// the query limits. The check and the update are one statement, so results stored at the same time
+// can not go over the limits. It returns false when the rows and bytes do not fit anymore
+func (q *Queries) ReserveStored(name string, rows, bytes int, limits ResultLimits, truncated bool) (bool, error) {
+	updates := map[string]interface{}{
+		"stored_rows":  gorm.Expr("stored_rows + ?", rows),
+		"stored_bytes": gorm.Expr("stored_bytes + ?", bytes),
+	}
+	if truncated {
+		updates["truncated"] = gorm.Expr("truncated + ?", 1)
+	}
+	tx := q.DB.Model(&DistributedQuery{}).Where("name = ?", name)
+	if limits.QueryRows > 0 {
+		tx = tx.Where("stored_rows + ? <= ?", rows, limits.QueryRows)
+	}
+	if limits.QueryBytes > 0 {
+		tx = tx.Where("stored_bytes + ? <= ?", bytes, limits.QueryBytes)
+	}
+	res := tx.Updates(updates)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// TrackStored to add the rows and bytes stored for a query, counting the results that were truncated
+func (q *Queries) TrackStored(name string, rows, bytes int, truncated bool) error {
+	updates := map[string]interface{}{
+		"stored_rows":  gorm.Expr("stored_rows + ?", rows),
+		"stored_bytes": gorm.Expr("stored_bytes + ?", bytes),
+	}
+	if truncated {
+		updates["truncated"] = gorm.Expr("truncated + ?", 1)
+	}
+	return q.DB.Model(&DistributedQuery{}).Where("name = ?", name).Updates(updates).Error
+}
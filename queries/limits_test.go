@@ -0,0 +1,71 @@
+package queries
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	defaults := ResultLimits{NodeRows: 1000, NodeBytes: 0, QueryRows: 5000, QueryBytes: 1 << 20}
+	limits := DistributedQuery{}.Limits(defaults)
+	if limits.NodeRows != 1000 || limits.NodeBytes != 1<<20 {
+		t.Errorf("Limits() = %+v", limits)
+	}
+	limits = DistributedQuery{StoredRows: 4500, StoredBytes: 1024}.Limits(defaults)
+	if limits.NodeRows != 500 || limits.NodeBytes != 1<<20-1024 {
+		t.Errorf("Limits() with stored results = %+v", limits)
+	}
+	limits = DistributedQuery{MaxRows: 10}.Limits(defaults)
+	if limits.QueryRows != 10 || limits.NodeRows != 10 {
+		t.Errorf("Limits() with query limits = %+v", limits)
+	}
+	limits = DistributedQuery{StoredRows: 5000}.Limits(defaults)
+	if limits.NodeRows != -1 || limits.NodeBytes != -1 {
+		t.Errorf("Limits() exhausted = %+v", limits)
+	}
+	limits = DistributedQuery{StoredRows: 5000}.Limits(ResultLimits{})
+	if limits.NodeRows != 0 || limits.NodeBytes != 0 {
+		t.Errorf("Limits() without limits = %+v", limits)
+	}
+}
+
+func TestReserveStored(t *testing.T) {
+	q, _ := testQueriesDB(t)
+	if err := q.Create(DistributedQuery{Name: "limited", Query: "SELECT * FROM processes;", MaxRows: 10}); err != nil {
+		t.Fatalf("Create() error %v", err)
+	}
+	limits := ResultLimits{QueryRows: 10}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := q.ReserveStored("limited", 3, 30, limits, false)
+			if err != nil {
+				t.Errorf("ReserveStored() error %v", err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	query, err := q.Get("limited")
+	if err != nil {
+		t.Fatalf("Get() error %v", err)
+	}
+	if reserved != 3 || query.StoredRows != 9 || query.StoredBytes != 90 {
+		t.Errorf("ReserveStored() concurrent = %d reserved, %d rows, %d bytes", reserved, query.StoredRows, query.StoredBytes)
+	}
+	if ok, err := q.ReserveStored("limited", 1, 10, limits, true); err != nil || !ok {
+		t.Errorf("ReserveStored() last row = %v, %v", ok, err)
+	}
+	if ok, err := q.ReserveStored("limited", 1, 10, limits, true); err != nil || ok {
+		t.Errorf("ReserveStored() over limit = %v, %v", ok, err)
+	}
+}
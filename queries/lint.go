@@ -0,0 +1,525 @@
+package queries
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// TableSchema to hold the schema of an osquery table, from the JSON file used by the admin
+type TableSchema struct {
+	Name      string         `json:"name"`
+	Platforms []string       `json:"platforms"`
+	Evented   bool           `json:"evented"`
+	Columns   []ColumnSchema `json:"columns"`
+}
+
+// ColumnSchema to hold the schema of a column of an osquery table
+type ColumnSchema struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+	Hidden   bool   `json:"hidden"`
+}
+
+// LintResult to hold the outcome of checking a query. Errors are problems that
+// make osquery reject the query and warnings are things that may not work as
+// expected, like tables missing in some platforms or expensive scans. Unknown
+// tables and columns are warnings, the schema may not match every osquery version.
+type LintResult struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+}
+
+// LoadSchema to load the schema of osquery tables from the JSON file used by the admin
+func LoadSchema(file string) ([]TableSchema, error) {
+	var schema []TableSchema
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return schema, err
+	}
+	if err := json.Unmarshal(content, &schema); err != nil {
+		return schema, err
+	}
+	return schema, nil
+}
+
+// OsqueryPlatform to get the osquery platform of a node platform, like ubuntu or centos for linux
+func OsqueryPlatform(platform string) string {
+	switch p := strings.ToLower(platform); p {
+	case "darwin", "windows", "freebsd", "linux":
+		return p
+	}
+	return "linux"
+}
+
+// SQL keywords that are never columns
+var sqlKeywords = map[string]bool{
+	"ALL": true, "AND": true, "AS": true, "ASC": true, "BETWEEN": true, "BY": true,
+	"CASE": true, "CAST": true, "COLLATE": true, "CROSS": true, "CURRENT_DATE": true,
+	"CURRENT_TIME": true, "CURRENT_TIMESTAMP": true, "DESC": true, "DISTINCT": true,
+	"ELSE": true, "END": true, "ESCAPE": true, "EXCEPT": true, "EXISTS": true,
+	"FALSE": true, "FROM": true, "GLOB": true, "GROUP": true, "HAVING": true, "IN": true,
+	"INDEXED": true, "INNER": true, "INTERSECT": true, "IS": true, "ISNULL": true,
+	"JOIN": true, "LEFT": true, "LIKE": true, "LIMIT": true, "MATCH": true,
+	"NATURAL": true, "NOCASE": true, "NOT": true, "NOTNULL": true, "NULL": true,
+	"OFFSET": true, "ON": true, "OR": true, "ORDER": true, "OUTER": true,
+	"RECURSIVE": true, "REGEXP": true, "RIGHT": true, "ROWID": true, "SELECT": true,
+	"THEN": true, "TRUE": true, "UNION": true, "USING": true, "VALUES": true,
+	"WHEN": true, "WHERE": true, "WITH": true, "WINDOW": true, "OVER": true,
+	"PARTITION": true, "FILTER": true,
+}
+
+// Operators that constrain a column, so osquery can use it to generate the table
+var constraintOperators = map[string]bool{"=": true, "==": true, "LIKE": true, "IN": true, "GLOB": true}
+
+type sqlTokenKind int
+
+const (
+	sqlIdent sqlTokenKind = iota
+	sqlKeyword
+	sqlString
+	sqlNumber
+	sqlSymbol
+)
+
+type sqlToken struct {
+	kind  sqlTokenKind
+	value string
+}
+
+// Helper to check if a token is a keyword or a symbol with the given value
+func (t sqlToken) is(value string) bool {
+	return (t.kind == sqlKeyword || t.kind == sqlSymbol) && t.value == value
+}
+
+// Helper to split a query in identifiers, keywords, literals and symbols, skipping comments
+func tokenizeSQL(query string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	rs := []rune(query)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			i++
+		case r == '-' && i+1 < len(rs) && rs[i+1] == '-':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(rs) && rs[i+1] == '*':
+			end := strings.Index(string(rs[i+2:]), "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += 2 + len([]rune(string(rs[i+2:])[:end])) + 2
+		case r == '\'' || r == '"' || r == '`' || r == '[':
+			closing := r
+			if r == '[' {
+				closing = ']'
+			}
+			var value strings.Builder
+			j := i + 1
+			for ; j < len(rs); j++ {
+				if rs[j] == closing {
+					// Quotes are escaped by doubling them
+					if closing != ']' && j+1 < len(rs) && rs[j+1] == closing {
+						value.WriteRune(closing)
+						j++
+						continue
+					}
+					break
+				}
+				value.WriteRune(rs[j])
+			}
+			if j >= len(rs) {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			kind := sqlIdent
+			if r == '\'' {
+				kind = sqlString
+			}
+			tokens = append(tokens, sqlToken{kind: kind, value: value.String()})
+			i = j + 1
+		case r >= '0' && r <= '9':
+			j := i
+			for j < len(rs) && (rs[j] >= '0' && rs[j] <= '9' || rs[j] == '.' || rs[j] == 'x' || rs[j] == 'X' || rs[j] >= 'a' && rs[j] <= 'f' || rs[j] >= 'A' && rs[j] <= 'F') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlNumber, value: string(rs[i:j])})
+			i = j
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+			j := i
+			for j < len(rs) && (rs[j] == '_' || rs[j] == '$' || rs[j] >= 'a' && rs[j] <= 'z' || rs[j] >= 'A' && rs[j] <= 'Z' || rs[j] >= '0' && rs[j] <= '9') {
+				j++
+			}
+			word := string(rs[i:j])
+			if sqlKeywords[strings.ToUpper(word)] {
+				tokens = append(tokens, sqlToken{kind: sqlKeyword, value: strings.ToUpper(word)})
+			} else {
+				tokens = append(tokens, sqlToken{kind: sqlIdent, value: word})
+			}
+			i = j
+		default:
+			if i+1 < len(rs) {
+				switch two := string(rs[i : i+2]); two {
+				case "||", "<=", ">=", "<>", "!=", "==", "<<", ">>":
+					tokens = append(tokens, sqlToken{kind: sqlSymbol, value: two})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("(),.;*=<>+-/%&|~?:@", r) {
+				return nil, fmt.Errorf("unexpected character %q", r)
+			}
+			tokens = append(tokens, sqlToken{kind: sqlSymbol, value: string(r)})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// linter to collect errors and warnings while checking a query
+type linter struct {
+	tokens   []sqlToken
+	schema   map[string]TableSchema
+	tables   map[string]string // aliases and names of the tables in the query
+	ctes     map[string]bool
+	used     []string // osquery tables used by the query, in order
+	consumed map[int]bool
+	complex  bool // subqueries or CTEs, bare columns can not be checked
+	errors   []string
+	warnings []string
+}
+
+func (l *linter) errorf(format string, a ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprintf(format, a...))
+}
+
+func (l *linter) warnf(format string, a ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, a...))
+}
+
+func (l *linter) token(i int) sqlToken {
+	if i >= 0 && i < len(l.tokens) {
+		return l.tokens[i]
+	}
+	return sqlToken{kind: sqlSymbol}
+}
+
+// Lint to check a query before it is sent to nodes. If schema is empty, tables
+// and columns are not checked. If platforms is not empty, tables not available
+// in any of those platforms are reported.
+func Lint(query string, schema []TableSchema, platforms []string) LintResult {
+	l := &linter{
+		schema:   make(map[string]TableSchema),
+		tables:   make(map[string]string),
+		ctes:     make(map[string]bool),
+		consumed: make(map[int]bool),
+	}
+	for _, t := range schema {
+		l.schema[t.Name] = t
+	}
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		l.errorf("%v", err)
+		return l.result()
+	}
+	// A trailing semicolon is fine, more statements are not
+	if len(tokens) > 0 && tokens[len(tokens)-1].is(";") {
+		tokens = tokens[:len(tokens)-1]
+	}
+	l.tokens = tokens
+	if len(tokens) == 0 {
+		l.errorf("query can not be empty")
+		return l.result()
+	}
+	if !tokens[0].is("SELECT") && !tokens[0].is("WITH") {
+		l.errorf("only SELECT queries are supported")
+		return l.result()
+	}
+	depth := 0
+	for _, t := range tokens {
+		if t.is(";") {
+			l.errorf("multiple statements are not supported")
+			return l.result()
+		}
+		if t.is("(") {
+			depth++
+		}
+		if t.is(")") {
+			depth--
+		}
+		if depth < 0 {
+			break
+		}
+	}
+	if depth != 0 {
+		l.errorf("unbalanced parentheses")
+		return l.result()
+	}
+	l.findTables()
+	if len(l.schema) > 0 {
+		l.checkColumns()
+		l.checkPlatforms(platforms)
+		l.checkScans()
+	}
+	return l.result()
+}
+
+func (l *linter) result() LintResult {
+	return LintResult{
+		Valid:    len(l.errors) == 0,
+		Errors:   l.errors,
+		Warnings: l.warnings,
+	}
+}
+
+// Helper to find the tables used after FROM and JOIN, with their aliases
+func (l *linter) findTables() {
+	// Common table expressions, like WITH name AS (...)
+	for i, t := range l.tokens {
+		if t.kind == sqlIdent && l.token(i+1).is("AS") && l.token(i+2).is("(") {
+			l.ctes[strings.ToLower(t.value)] = true
+			l.complex = true
+		}
+	}
+	for i, t := range l.tokens {
+		if !t.is("FROM") && !t.is("JOIN") {
+			continue
+		}
+		for pos := i + 1; ; {
+			next := l.tableReference(pos)
+			if !l.token(next).is(",") {
+				break
+			}
+			pos = next + 1
+		}
+	}
+}
+
+// Helper to parse a table reference with its alias, returning the position after it
+func (l *linter) tableReference(pos int) int {
+	t := l.token(pos)
+	name := ""
+	switch {
+	case t.is("("):
+		// Subquery, its tables are found on their own
+		l.complex = true
+		depth := 0
+		for ; pos < len(l.tokens); pos++ {
+			if l.token(pos).is("(") {
+				depth++
+			} else if l.token(pos).is(")") {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+	case t.kind == sqlIdent:
+		name = strings.ToLower(t.value)
+		l.consumed[pos] = true
+		if l.ctes[name] {
+			name = ""
+		} else if _, ok := l.schema[name]; ok || len(l.schema) == 0 {
+			l.tables[name] = name
+			l.addUsed(name)
+		} else {
+			l.warnf("unknown table %s", t.value)
+			l.complex = true
+			name = ""
+		}
+	default:
+		return pos
+	}
+	pos++
+	if l.token(pos).is("AS") {
+		pos++
+	}
+	if alias := l.token(pos); alias.kind == sqlIdent {
+		l.tables[strings.ToLower(alias.value)] = name
+		l.consumed[pos] = true
+		pos++
+	}
+	return pos
+}
+
+func (l *linter) addUsed(name string) {
+	for _, u := range l.used {
+		if u == name {
+			return
+		}
+	}
+	l.used = append(l.used, name)
+}
+
+// Helper to check if a table has a column
+func (l *linter) hasColumn(table, column string) bool {
+	for _, c := range l.schema[table].Columns {
+		if strings.EqualFold(c.Name, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper to check qualified columns, and bare columns when the query is simple enough
+func (l *linter) checkColumns() {
+	aliases := make(map[string]bool)
+	for i, t := range l.tokens {
+		if t.kind != sqlIdent {
+			continue
+		}
+		prev, next := l.token(i-1), l.token(i+1)
+		// Result column aliases, with or without AS
+		if prev.is("AS") || ((prev.kind == sqlIdent || prev.kind == sqlString || prev.kind == sqlNumber || prev.is(")")) && (next.is(",") || next.is("FROM") || i == len(l.tokens)-1)) {
+			aliases[strings.ToLower(t.value)] = true
+		}
+	}
+	var unknown []string
+	seen := make(map[string]bool)
+	for i, t := range l.tokens {
+		if t.kind != sqlIdent || l.consumed[i] {
+			continue
+		}
+		prev, next := l.token(i-1), l.token(i+1)
+		name := strings.ToLower(t.value)
+		switch {
+		case next.is("."):
+			// Qualified column, like p.name
+			column := l.token(i + 2)
+			table, ok := l.tables[name]
+			if !ok {
+				if !l.ctes[name] && !l.complex {
+					l.warnf("unknown table or alias %s", t.value)
+				}
+				continue
+			}
+			if table != "" && column.kind == sqlIdent && !l.hasColumn(table, column.value) {
+				l.warnf("unknown column %s in table %s", column.value, table)
+			}
+		case prev.is("."), next.is("("), prev.is("AS"), aliases[name]:
+			// Already checked, function or alias
+		default:
+			if l.complex || len(l.used) == 0 || seen[name] {
+				continue
+			}
+			found := false
+			for _, table := range l.used {
+				if l.hasColumn(table, name) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				seen[name] = true
+				unknown = append(unknown, t.value)
+			}
+		}
+	}
+	for _, c := range unknown {
+		l.warnf("unknown column %s in %s", c, strings.Join(l.used, ", "))
+	}
+}
+
+// Helper to warn about tables that are not available in the platforms of the targets
+func (l *linter) checkPlatforms(platforms []string) {
+	families := make(map[string]bool)
+	for _, p := range platforms {
+		if p != "" {
+			families[OsqueryPlatform(p)] = true
+		}
+	}
+	common := map[string]bool{"darwin": true, "linux": true, "windows": true, "freebsd": true}
+	for _, name := range l.used {
+		table := l.schema[name]
+		supported := make(map[string]bool)
+		for _, p := range table.Platforms {
+			supported[p] = true
+		}
+		for c := range common {
+			if !supported[c] {
+				delete(common, c)
+			}
+		}
+		var missing []string
+		for f := range families {
+			if !supported[f] {
+				missing = append(missing, f)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			l.warnf("table %s is not available on %s", name, strings.Join(missing, ", "))
+		}
+	}
+	if len(l.used) > 1 && len(common) == 0 {
+		l.warnf("no platform has all the tables %s", strings.Join(l.used, ", "))
+	}
+}
+
+// Helper to warn about expensive patterns, like file or hash scans without the required constraints
+func (l *linter) checkScans() {
+	where := false
+	for _, t := range l.tokens {
+		if t.is("WHERE") || t.is("LIMIT") {
+			where = true
+		}
+	}
+	for _, name := range l.used {
+		table := l.schema[name]
+		var required []string
+		for _, c := range table.Columns {
+			if c.Required {
+				required = append(required, c.Name)
+			}
+		}
+		if len(required) > 0 && !l.constrained(name, required) {
+			l.warnf("table %s needs a constraint on %s, otherwise it scans everything or returns nothing", name, strings.Join(required, " or "))
+		}
+		if table.Evented && !where {
+			l.warnf("evented table %s without constraints returns all buffered events", name)
+		}
+	}
+	// Recursive wildcards walk the whole filesystem
+	for i, t := range l.tokens {
+		if t.is("LIKE") && l.token(i+1).kind == sqlString && strings.Contains(l.token(i+1).value, "%%") {
+			l.warnf("recursive wildcard %q can scan the whole filesystem", l.token(i+1).value)
+		}
+	}
+}
+
+// Helper to check if any of the columns of a table is constrained in the query
+func (l *linter) constrained(table string, columns []string) bool {
+	for i, t := range l.tokens {
+		if t.kind != sqlIdent {
+			continue
+		}
+		match := false
+		for _, c := range columns {
+			if strings.EqualFold(t.value, c) {
+				match = true
+			}
+		}
+		if !match {
+			continue
+		}
+		// Qualifier must point to this table, bare columns may belong to any table
+		if l.token(i - 1).is(".") {
+			if l.tables[strings.ToLower(l.token(i-2).value)] != table {
+				continue
+			}
+		}
+		next, prev := l.token(i+1), l.token(i-1)
+		if constraintOperators[next.value] && (next.kind == sqlSymbol || next.kind == sqlKeyword) {
+			return true
+		}
+		if prev.is("=") || prev.is("==") || prev.is("(") && l.token(i-2).is("USING") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package queries
+
+import "testing"
+
+var testSchema = []TableSchema{
+	{Name: "processes", Platforms: []string{"darwin", "linux", "windows", "freebsd"}, Columns: []ColumnSchema{{Name: "pid"}, {Name: "name"}, {Name: "path"}, {Name: "uid"}}},
+	{Name: "users", Platforms: []string{"darwin", "linux", "windows", "freebsd"}, Columns: []ColumnSchema{{Name: "uid"}, {Name: "username"}}},
+	{Name: "file", Platforms: []string{"darwin", "linux", "windows", "freebsd"}, Columns: []ColumnSchema{{Name: "path", Required: true}, {Name: "directory", Required: true}, {Name: "size"}}},
+	{Name: "hash", Platforms: []string{"darwin", "linux", "windows", "freebsd"}, Columns: []ColumnSchema{{Name: "path", Required: true}, {Name: "directory", Required: true}, {Name: "sha256"}}},
+	{Name: "registry", Platforms: []string{"windows"}, Columns: []ColumnSchema{{Name: "key"}, {Name: "name"}}},
+	{Name: "process_events", Platforms: []string{"darwin", "linux"}, Evented: true, Columns: []ColumnSchema{{Name: "pid"}, {Name: "cmdline"}}},
+}
+
+func TestLintValid(t *testing.T) {
+	for _, query := range []string{
+		"SELECT * FROM processes;",
+		"select p.pid, p.name AS process, u.username FROM processes p JOIN users u ON p.uid = u.uid ORDER BY process;",
+		"SELECT name, count(*) total FROM processes GROUP BY name HAVING total > 1 LIMIT 10;",
+		"SELECT f.path, h.sha256 FROM file f, hash h WHERE f.directory = '/bin' AND h.path = f.path;",
+		"WITH names AS (SELECT name FROM processes) SELECT * FROM names;",
+		"SELECT * FROM (SELECT pid FROM processes) p WHERE p.pid > 1; -- comment",
+		"SELECT datetime('now') AS now, CAST(pid AS TEXT) FROM processes /* comment */;",
+	} {
+		result := Lint(query, testSchema, nil)
+		if !result.Valid || len(result.Warnings) > 0 {
+			t.Errorf("Lint(%q) = %v %v, expected no errors or warnings", query, result.Errors, result.Warnings)
+		}
+	}
+}
+
+func TestLintErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"", "query can not be empty"},
+		{"DELETE FROM processes;", "only SELECT queries are supported"},
+		{"SELECT * FROM processes; SELECT * FROM users;", "multiple statements are not supported"},
+		{"SELECT count(* FROM processes;", "unbalanced parentheses"},
+		{"SELECT * FROM processes WHERE name = 'osqueryd;", "unterminated quote"},
+	}
+	for _, tt := range tests {
+		result := Lint(tt.query, testSchema, nil)
+		if result.Valid || !containsString(result.Errors, tt.err) {
+			t.Errorf("Lint(%q) errors = %v, expected %q", tt.query, result.Errors, tt.err)
+		}
+	}
+}
+
+func TestLintWarnings(t *testing.T) {
+	tests := []struct {
+		query     string
+		platforms []string
+		warning   string
+	}{
+		{"SELECT * FROM registry;", []string{"ubuntu", "windows"}, "table registry is not available on linux"},
+		{"SELECT * FROM registry JOIN process_events;", nil, "no platform has all the tables registry, process_events"},
+		{"SELECT * FROM file;", nil, "table file needs a constraint on path or directory, otherwise it scans everything or returns nothing"},
+		{"SELECT * FROM hash JOIN processes USING (pid);", nil, "table hash needs a constraint on path or directory, otherwise it scans everything or returns nothing"},
+		{"SELECT * FROM process_events;", nil, "evented table process_events without constraints returns all buffered events"},
+		{"SELECT * FROM file WHERE path LIKE '/%%';", nil, `recursive wildcard "/%%" can scan the whole filesystem`},
+		{"SELECT * FROM process;", nil, "unknown table process"},
+		{"SELECT p.cmdline FROM processes p;", nil, "unknown column cmdline in table processes"},
+		{"SELECT x.pid FROM processes p;", nil, "unknown table or alias x"},
+		{"SELECT pid, sha256 FROM processes;", nil, "unknown column sha256 in processes"},
+	}
+	for _, tt := range tests {
+		result := Lint(tt.query, testSchema, tt.platforms)
+		if !result.Valid || !containsString(result.Warnings, tt.warning) {
+			t.Errorf("Lint(%q) = %v %v, expected warning %q", tt.query, result.Errors, result.Warnings, tt.warning)
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -3,9 +3,11 @@ package queries
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/tags"
 )
 
 const (
@@ -30,6 +32,8 @@ const (
 	StatusActive string = "ACTIVE"
 	// StatusComplete defines complete status constant
 	StatusComplete string = "COMPLETE"
+	// StatusExpired defines expired status constant
+	StatusExpired string = "EXPIRED"
 )
 
 const (
@@ -54,19 +58,31 @@ const (
 // DistributedQuery as abstraction of a distributed query
 type DistributedQuery struct {
 	gorm.Model
-	Name       string `gorm:"not null;unique;index"`
-	Creator    string
-	Query      string
-	Expected   int
-	Executions int
-	Errors     int
-	Active     bool
-	Hidden     bool
-	Protected  bool
-	Completed  bool
-	Deleted    bool
-	Type       string
-	Path       string
+	Name        string `gorm:"not null;unique;index"`
+	Creator     string
+	Query       string
+	Discovery   string
+	Expected    int
+	Executions  int
+	Errors      int
+	Skipped     int
+	Active      bool
+	Hidden      bool
+	Protected   bool
+	Completed   bool
+	Deleted     bool
+	Type        string
+	Path        string
+	Schedule    string `gorm:"index"`
+	SavedQuery  string `gorm:"index"`
+	Expiration  time.Time
+	Expired     bool
+	Approval    string `gorm:"index"`
+	MaxRows     int
+	MaxBytes    int
+	StoredRows  int
+	StoredBytes int
+	Truncated   int
 }
 
 // DistributedQueryTarget to keep target logic for queries
@@ -77,26 +93,37 @@ type DistributedQueryTarget struct {
 	Value string
 }
 
-// DistributedQueryExecution to keep track of queries executing
+// DistributedQueryExecution to keep track of queries executing, with the stats reported by osquery
 type DistributedQueryExecution struct {
 	gorm.Model
-	Name   string `gorm:"index"`
-	UUID   string `gorm:"index"`
-	Result int
+	Name       string `gorm:"index"`
+	UUID       string `gorm:"index"`
+	Result     int
+	Message    string
+	Skipped    bool
+	Reported   bool
+	WallTimeMs int64
+	UserTime   int64
+	SystemTime int64
+	Memory     int64
 }
 
 // QueryReadQueries to hold all the on-demand queries
 type QueryReadQueries map[string]string
 
+// QueryReadDiscovery to hold the discovery queries of the on-demand queries
+type QueryReadDiscovery map[string]string
+
 // Queries to handle on-demand queries
 type Queries struct {
-	DB *gorm.DB
+	DB   *gorm.DB
+	Tags *tags.TagManager
 }
 
 // CreateQueries to initialize the queries struct
-func CreateQueries(backend *gorm.DB) *Queries {
+func CreateQueries(backend *gorm.DB, tagsmgr *tags.TagManager) *Queries {
 	var q *Queries
-	q = &Queries{DB: backend}
+	q = &Queries{DB: backend, Tags: tagsmgr}
 	// table distributed_queries
 	if err := backend.AutoMigrate(DistributedQuery{}).Error; err != nil {
 		log.Fatalf("Failed to AutoMigrate table (distributed_queries): %v", err)
@@ -109,34 +136,78 @@ func CreateQueries(backend *gorm.DB) *Queries {
 	if err := backend.AutoMigrate(DistributedQueryTarget{}).Error; err != nil {
 		log.Fatalf("Failed to AutoMigrate table (distributed_query_targets): %v", err)
 	}
+	// table distributed_query_no_answers
+	if err := backend.AutoMigrate(DistributedQueryNoAnswer{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (distributed_query_no_answers): %v", err)
+	}
+	// table distributed_query_statuses
+	if err := backend.AutoMigrate(DistributedQueryStatus{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (distributed_query_statuses): %v", err)
+	}
+	// table scheduled_queries
+	if err := backend.AutoMigrate(ScheduledQuery{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (scheduled_queries): %v", err)
+	}
+	// table scheduled_query_targets
+	if err := backend.AutoMigrate(ScheduledQueryTarget{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (scheduled_query_targets): %v", err)
+	}
+	// table saved_queries
+	if err := backend.AutoMigrate(SavedQuery{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (saved_queries): %v", err)
+	}
+	// table saved_query_parameters
+	if err := backend.AutoMigrate(SavedQueryParameters{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (saved_query_parameters): %v", err)
+	}
+	// table saved_query_versions
+	if err := backend.AutoMigrate(SavedQueryVersion{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (saved_query_versions): %v", err)
+	}
+	// table distributed_query_approvals
+	if err := backend.AutoMigrate(DistributedQueryApproval{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (distributed_query_approvals): %v", err)
+	}
 	return q
 }
 
-// NodeQueries to get all queries that belong to the provided node
+// NodeQueries to get all queries that belong to the provided node, with their discovery queries
 // FIXME this will impact the performance of the TLS endpoint due to being CPU and I/O hungry
 // FIMXE potential mitigation can be add a cache (Redis?) layer to store queries per node_key
-func (q *Queries) NodeQueries(node nodes.OsqueryNode) (QueryReadQueries, bool, error) {
+func (q *Queries) NodeQueries(node nodes.OsqueryNode) (QueryReadQueries, QueryReadDiscovery, bool, error) {
 	acelerate := false
 	// Get all current active queries and carves
 	queries, err := q.GetActive()
 	if err != nil {
-		return QueryReadQueries{}, false, err
+		return QueryReadQueries{}, QueryReadDiscovery{}, false, err
 	}
 	// Iterate through active queries, see if they target this node and prepare data in the same loop
 	qs := make(QueryReadQueries)
+	discovery := make(QueryReadDiscovery)
 	for _, _q := range queries {
+		// Queries and carves waiting for approval are not sent
+		if !_q.Approved() {
+			continue
+		}
 		targets, err := q.GetTargets(_q.Name)
 		if err != nil {
-			return QueryReadQueries{}, false, err
+			return QueryReadQueries{}, QueryReadDiscovery{}, false, err
 		}
 		if len(targets) == 1 {
 			acelerate = true
 		}
-		if isQueryTarget(node, targets) && q.NotYetExecuted(_q.Name, node.UUID) {
+		nodeTags, err := q.targetTags(node, targets)
+		if err != nil {
+			return QueryReadQueries{}, QueryReadDiscovery{}, false, err
+		}
+		if isQueryTarget(node, targets, nodeTags) && q.NotYetExecuted(_q.Name, node.UUID) {
 			qs[_q.Name] = _q.Query
+			if _q.Discovery != "" {
+				discovery[_q.Name] = _q.Discovery
+			}
 		}
 	}
-	return qs, acelerate, nil
+	return qs, discovery, acelerate, nil
 }
 
 // Gets all queries by target (active/completed/all/all-full/deleted/hidden)
@@ -203,6 +274,15 @@ func (q *Queries) Get(name string) (DistributedQuery, error) {
 	return query, nil
 }
 
+// GetSameQuery to get the other queries that were launched with the same SQL, newest first
+func (q *Queries) GetSameQuery(query DistributedQuery) ([]DistributedQuery, error) {
+	var runs []DistributedQuery
+	if err := q.DB.Where("query = ? AND name <> ? AND deleted = ? AND type = ?", query.Query, query.Name, false, StandardQueryType).Order("created_at desc").Find(&runs).Error; err != nil {
+		return runs, err
+	}
+	return runs, nil
+}
+
 // Complete to mark query as completed
 func (q *Queries) Complete(name string) error {
 	query, err := q.Get(name)
@@ -221,7 +301,7 @@ func (q *Queries) VerifyComplete(name string) error {
 	if err != nil {
 		return err
 	}
-	if (query.Executions + query.Errors) >= query.Expected {
+	if (query.Executions + query.Errors + query.Skipped) >= query.Expected {
 		if err := q.DB.Model(&query).Updates(map[string]interface{}{"completed": true, "active": false}).Error; err != nil {
 			return err
 		}
@@ -336,10 +416,24 @@ func (q *Queries) SetExpected(name string, expected int) error {
 
 // TrackExecution to keep track of where queries have already ran
 func (q *Queries) TrackExecution(name, uuid string, result int) error {
+	return q.TrackExecutionStats(name, uuid, result, "", nil)
+}
+
+// TrackExecutionStats to keep track of where queries have already ran, with the osquery error message
+// and the stats of the execution when the node reports them
+func (q *Queries) TrackExecutionStats(name, uuid string, result int, message string, stats *ExecutionStats) error {
 	queryExecution := DistributedQueryExecution{
-		Name:   name,
-		UUID:   uuid,
-		Result: result,
+		Name:    name,
+		UUID:    uuid,
+		Result:  result,
+		Message: message,
+	}
+	if stats != nil {
+		queryExecution.Reported = true
+		queryExecution.WallTimeMs = stats.WallTimeMs
+		queryExecution.UserTime = stats.UserTime
+		queryExecution.SystemTime = stats.SystemTime
+		queryExecution.Memory = stats.Memory
 	}
 	if q.DB.NewRecord(queryExecution) {
 		if err := q.DB.Create(&queryExecution).Error; err != nil {
@@ -352,7 +446,7 @@ func (q *Queries) TrackExecution(name, uuid string, result int) error {
 }
 
 // Helper to decide whether if the query targets apply to a give node
-func isQueryTarget(node nodes.OsqueryNode, targets []DistributedQueryTarget) bool {
+func isQueryTarget(node nodes.OsqueryNode, targets []DistributedQueryTarget, nodeTags []string) bool {
 	for _, t := range targets {
 		// Check for environment match
 		if t.Type == QueryTargetEnvironment && t.Value == node.Environment {
@@ -370,6 +464,36 @@ func isQueryTarget(node nodes.OsqueryNode, targets []DistributedQueryTarget) boo
 		if t.Type == QueryTargetLocalname && node.Localname == t.Value {
 			return true
 		}
+		// Check for tag match
+		if t.Type == QueryTargetTag {
+			for _, tag := range nodeTags {
+				if tag == t.Value {
+					return true
+				}
+			}
+		}
+		// Check for hostname pattern match
+		if t.Type == QueryTargetHostname && matchHostname(t.Value, node) {
+			return true
+		}
+		if t.Type == QueryTargetHostnameRegex && matchHostnameRegex(t.Value, node) {
+			return true
+		}
+		// Check for IP address range match
+		if t.Type == QueryTargetCIDR && matchCIDR(t.Value, node) {
+			return true
+		}
+		// Check for version constraints match
+		if t.Type == QueryTargetOsqueryVersion && matchVersion(t.Value, node.OsqueryVersion) {
+			return true
+		}
+		if t.Type == QueryTargetPlatformVersion && matchVersion(t.Value, node.PlatformVersion) {
+			return true
+		}
+		// Check for target expression match
+		if t.Type == QueryTargetExpression && matchExpression(t.Value, node, nodeTags) {
+			return true
+		}
 	}
 	return false
 }
@@ -0,0 +1,416 @@
+package queries
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// ParameterString for parameters with any text value
+	ParameterString string = "string"
+	// ParameterInteger for parameters with integer values
+	ParameterInteger string = "integer"
+	// ParameterPath for parameters with file or directory paths
+	ParameterPath string = "path"
+	// ParameterHash for parameters with MD5, SHA1 or SHA256 hashes
+	ParameterHash string = "hash"
+)
+
+// SavedQuery to keep a named query in the library, with parameters like {{path}}
+type SavedQuery struct {
+	gorm.Model
+	Name        string `gorm:"not null;unique;index"`
+	Description string
+	Query       string `gorm:"type:text"`
+	Tags        string
+	Owner       string
+	Shared      bool
+	Version     int
+}
+
+// SavedQueryParameter to hold each typed parameter of a saved query
+type SavedQueryParameter struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Default     string `json:"default"`
+	Description string `json:"description"`
+}
+
+// SavedQueryParameters to store the parameters of a saved query
+type SavedQueryParameters struct {
+	gorm.Model
+	SavedQuery string `gorm:"unique;index"`
+	Parameters string `gorm:"type:text"`
+}
+
+// SavedQueryVersion to keep each change of a saved query
+type SavedQueryVersion struct {
+	gorm.Model
+	Name        string `gorm:"index"`
+	Version     int
+	Description string
+	Query       string `gorm:"type:text"`
+	Parameters  string `gorm:"type:text"`
+	Author      string
+}
+
+var (
+	reParameter         = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
+	reParameterName     = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	reParameterHash     = regexp.MustCompile(`^[a-fA-F0-9]+$`)
+	validParameterTypes = map[string]bool{
+		ParameterString:  true,
+		ParameterInteger: true,
+		ParameterPath:    true,
+		ParameterHash:    true,
+	}
+)
+
+// QueryParameters to extract the names of the parameters used by a query, in order of appearance
+func QueryParameters(query string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range reParameter.FindAllStringSubmatch(query, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// ValidateParameter to check a value for a parameter of a given type
+func ValidateParameter(pType, value string) error {
+	switch pType {
+	case ParameterInteger:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+	case ParameterHash:
+		if !reParameterHash.MatchString(value) || (len(value) != 32 && len(value) != 40 && len(value) != 64) {
+			return fmt.Errorf("%q is not a MD5, SHA1 or SHA256 hash", value)
+		}
+	case ParameterPath:
+		if value == "" || strings.ContainsAny(value, "\n\r\x00") {
+			return fmt.Errorf("%q is not a valid path", value)
+		}
+	case ParameterString:
+	default:
+		return fmt.Errorf("unknown parameter type %s", pType)
+	}
+	return nil
+}
+
+// ValidateSavedQuery to check a saved query and its parameters before storing it
+func ValidateSavedQuery(saved SavedQuery, params []SavedQueryParameter) error {
+	if !ValidScheduleName(saved.Name) {
+		return fmt.Errorf("invalid saved query name %q", saved.Name)
+	}
+	if strings.TrimSpace(saved.Query) == "" {
+		return fmt.Errorf("query can not be empty")
+	}
+	declared := make(map[string]bool)
+	for _, p := range params {
+		if !reParameterName.MatchString(p.Name) {
+			return fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("duplicated parameter %s", p.Name)
+		}
+		if !validParameterTypes[p.Type] {
+			return fmt.Errorf("unknown type %s for parameter %s", p.Type, p.Name)
+		}
+		if p.Default != "" {
+			if err := ValidateParameter(p.Type, p.Default); err != nil {
+				return fmt.Errorf("default for %s - %v", p.Name, err)
+			}
+		}
+		declared[p.Name] = true
+	}
+	for _, name := range QueryParameters(saved.Query) {
+		if !declared[name] {
+			return fmt.Errorf("parameter %s is not declared", name)
+		}
+		delete(declared, name)
+	}
+	for name := range declared {
+		return fmt.Errorf("parameter %s is not used in the query", name)
+	}
+	return nil
+}
+
+// RenderSavedQuery to fill in the parameters of a saved query. Values that are not
+// integers are quoted as SQL strings, so they can be used like path = {{path}}
+func RenderSavedQuery(query string, params []SavedQueryParameter, values map[string]string) (string, error) {
+	rendered := make(map[string]string)
+	for _, p := range params {
+		value, ok := values[p.Name]
+		if !ok || value == "" {
+			value = p.Default
+		}
+		if value == "" {
+			return "", fmt.Errorf("missing value for parameter %s", p.Name)
+		}
+		if err := ValidateParameter(p.Type, value); err != nil {
+			return "", fmt.Errorf("parameter %s - %v", p.Name, err)
+		}
+		if p.Type != ParameterInteger {
+			value = "'" + strings.Replace(value, "'", "''", -1) + "'"
+		}
+		rendered[p.Name] = value
+	}
+	var missing error
+	result := reParameter.ReplaceAllStringFunc(query, func(m string) string {
+		name := reParameter.FindStringSubmatch(m)[1]
+		value, ok := rendered[name]
+		if !ok {
+			missing = fmt.Errorf("parameter %s is not declared", name)
+		}
+		return value
+	})
+	return result, missing
+}
+
+// SplitTags to get the list of tags of a saved query
+func SplitTags(tags string) []string {
+	var list []string
+	for _, t := range strings.Split(tags, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+// Helper to serialize parameters to be stored
+func encodeParameters(params []SavedQueryParameter) (string, error) {
+	if params == nil {
+		params = []SavedQueryParameter{}
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Helper to parse stored parameters
+func decodeParameters(data string) ([]SavedQueryParameter, error) {
+	var params []SavedQueryParameter
+	if data == "" {
+		return params, nil
+	}
+	if err := json.Unmarshal([]byte(data), &params); err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+// CanAccessSaved to check if a user can see and run a saved query
+func CanAccessSaved(saved SavedQuery, username string, admin bool) bool {
+	return admin || saved.Shared || saved.Owner == username
+}
+
+// CanEditSaved to check if a user can change or delete a saved query
+func CanEditSaved(saved SavedQuery, username string, admin bool) bool {
+	return admin || saved.Owner == username
+}
+
+// GetSaved to get a saved query by name
+func (q *Queries) GetSaved(name string) (SavedQuery, error) {
+	var saved SavedQuery
+	if err := q.DB.Where("name = ?", name).First(&saved).Error; err != nil {
+		return saved, err
+	}
+	return saved, nil
+}
+
+// GetSavedParameters to get the parameters of a saved query
+func (q *Queries) GetSavedParameters(name string) ([]SavedQueryParameter, error) {
+	var stored SavedQueryParameters
+	if err := q.DB.Where("saved_query = ?", name).First(&stored).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return []SavedQueryParameter{}, nil
+		}
+		return nil, err
+	}
+	return decodeParameters(stored.Parameters)
+}
+
+// ExistsSaved to check if a saved query exists
+func (q *Queries) ExistsSaved(name string) bool {
+	var results int
+	q.DB.Model(&SavedQuery{}).Where("name = ?", name).Count(&results)
+	return (results > 0)
+}
+
+// GetAllSaved to get all the saved queries that a user can access, sorted by name
+func (q *Queries) GetAllSaved(username string, admin bool) ([]SavedQuery, error) {
+	var all []SavedQuery
+	if err := q.DB.Order("name").Find(&all).Error; err != nil {
+		return all, err
+	}
+	var saved []SavedQuery
+	for _, s := range all {
+		if CanAccessSaved(s, username, admin) {
+			saved = append(saved, s)
+		}
+	}
+	return saved, nil
+}
+
+// SaveQuery to create or update a saved query, keeping the previous content as a version
+func (q *Queries) SaveQuery(saved SavedQuery, params []SavedQueryParameter, author string) error {
+	if err := ValidateSavedQuery(saved, params); err != nil {
+		return err
+	}
+	encoded, err := encodeParameters(params)
+	if err != nil {
+		return fmt.Errorf("error serializing parameters %v", err)
+	}
+	existing, err := q.GetSaved(saved.Name)
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+	if err == nil {
+		saved.ID = existing.ID
+		saved.CreatedAt = existing.CreatedAt
+		saved.Owner = existing.Owner
+		saved.Version = existing.Version + 1
+	} else {
+		saved.Version = 1
+	}
+	if err := q.DB.Save(&saved).Error; err != nil {
+		return fmt.Errorf("Save SavedQuery %v", err)
+	}
+	var stored SavedQueryParameters
+	if err := q.DB.Where("saved_query = ?", saved.Name).First(&stored).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+	stored.SavedQuery = saved.Name
+	stored.Parameters = encoded
+	if err := q.DB.Save(&stored).Error; err != nil {
+		return fmt.Errorf("Save SavedQueryParameters %v", err)
+	}
+	version := SavedQueryVersion{
+		Name:        saved.Name,
+		Version:     saved.Version,
+		Description: saved.Description,
+		Query:       saved.Query,
+		Parameters:  encoded,
+		Author:      author,
+	}
+	if err := q.DB.Create(&version).Error; err != nil {
+		return fmt.Errorf("Create SavedQueryVersion %v", err)
+	}
+	return nil
+}
+
+// DeleteSaved to remove a saved query with its parameters and history
+func (q *Queries) DeleteSaved(name string) error {
+	saved, err := q.GetSaved(name)
+	if err != nil {
+		return err
+	}
+	if err := q.DB.Unscoped().Where("saved_query = ?", name).Delete(&SavedQueryParameters{}).Error; err != nil {
+		return err
+	}
+	if err := q.DB.Unscoped().Where("name = ?", name).Delete(&SavedQueryVersion{}).Error; err != nil {
+		return err
+	}
+	if err := q.DB.Unscoped().Delete(&saved).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetSavedVersions to get the history of a saved query, most recent first
+func (q *Queries) GetSavedVersions(name string) ([]SavedQueryVersion, error) {
+	var versions []SavedQueryVersion
+	if err := q.DB.Where("name = ?", name).Order("version desc").Find(&versions).Error; err != nil {
+		return versions, err
+	}
+	return versions, nil
+}
+
+// RestoreSaved to make an old version the current content of a saved query, as a new version
+func (q *Queries) RestoreSaved(name string, version int, author string) error {
+	saved, err := q.GetSaved(name)
+	if err != nil {
+		return err
+	}
+	var old SavedQueryVersion
+	if err := q.DB.Where("name = ? AND version = ?", name, version).First(&old).Error; err != nil {
+		return err
+	}
+	params, err := decodeParameters(old.Parameters)
+	if err != nil {
+		return err
+	}
+	saved.Description = old.Description
+	saved.Query = old.Query
+	return q.SaveQuery(saved, params, author)
+}
+
+// RenderSaved to get the query of a saved query with the parameters filled in
+func (q *Queries) RenderSaved(name string, values map[string]string) (string, error) {
+	saved, err := q.GetSaved(name)
+	if err != nil {
+		return "", err
+	}
+	params, err := q.GetSavedParameters(name)
+	if err != nil {
+		return "", err
+	}
+	return RenderSavedQuery(saved.Query, params, values)
+}
+
+// savedPack to parse the queries of a pack in the osquery pack JSON format
+type savedPack struct {
+	Queries map[string]struct {
+		Query       string `json:"query"`
+		Description string `json:"description"`
+	} `json:"queries"`
+}
+
+// ImportPack to add the queries of a pack in the osquery pack JSON format to the library,
+// tagged with the name of the pack. Existing saved queries are updated only if replace is set.
+func (q *Queries) ImportPack(pack string, data []byte, owner string, shared, replace bool) ([]string, error) {
+	var content savedPack
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("pack is not valid JSON - %v", err)
+	}
+	if len(content.Queries) == 0 {
+		return nil, fmt.Errorf("pack has no queries")
+	}
+	names := make([]string, 0, len(content.Queries))
+	for name := range content.Queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var imported []string
+	for _, name := range names {
+		if q.ExistsSaved(name) && !replace {
+			continue
+		}
+		saved := SavedQuery{
+			Name:        name,
+			Description: content.Queries[name].Description,
+			Query:       content.Queries[name].Query,
+			Tags:        pack,
+			Owner:       owner,
+			Shared:      shared,
+		}
+		if err := q.SaveQuery(saved, nil, owner); err != nil {
+			return imported, fmt.Errorf("query %s - %v", name, err)
+		}
+		imported = append(imported, name)
+	}
+	return imported, nil
+}
@@ -0,0 +1,62 @@
+package queries
+
+import "testing"
+
+func TestQueryParameters(t *testing.T) {
+	names := QueryParameters("SELECT * FROM hash WHERE path = {{path}} AND sha256 = {{ sha256 }} OR path = {{path}}")
+	if len(names) != 2 || names[0] != "path" || names[1] != "sha256" {
+		t.Errorf("QueryParameters() = %v, expected [path sha256]", names)
+	}
+}
+
+func TestValidateSavedQuery(t *testing.T) {
+	params := []SavedQueryParameter{{Name: "path", Type: ParameterPath}}
+	tests := []struct {
+		saved  SavedQuery
+		params []SavedQueryParameter
+		valid  bool
+	}{
+		{SavedQuery{Name: "files", Query: "SELECT * FROM file WHERE path = {{path}};"}, params, true},
+		{SavedQuery{Name: "osquery", Query: "SELECT * FROM osquery_info;"}, nil, true},
+		{SavedQuery{Name: "bad name", Query: "SELECT 1;"}, nil, false},
+		{SavedQuery{Name: "empty", Query: " "}, nil, false},
+		{SavedQuery{Name: "undeclared", Query: "SELECT * FROM file WHERE path = {{path}};"}, nil, false},
+		{SavedQuery{Name: "unused", Query: "SELECT 1;"}, params, false},
+		{SavedQuery{Name: "type", Query: "SELECT {{n}};"}, []SavedQueryParameter{{Name: "n", Type: "number"}}, false},
+		{SavedQuery{Name: "default", Query: "SELECT {{n}};"}, []SavedQueryParameter{{Name: "n", Type: ParameterInteger, Default: "ten"}}, false},
+	}
+	for _, tt := range tests {
+		err := ValidateSavedQuery(tt.saved, tt.params)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateSavedQuery(%s) = %v, expected valid %v", tt.saved.Name, err, tt.valid)
+		}
+	}
+}
+
+func TestRenderSavedQuery(t *testing.T) {
+	query := "SELECT * FROM hash WHERE path = {{path}} AND sha256 = {{hash}} LIMIT {{limit}};"
+	params := []SavedQueryParameter{
+		{Name: "path", Type: ParameterPath},
+		{Name: "hash", Type: ParameterHash},
+		{Name: "limit", Type: ParameterInteger, Default: "10"},
+	}
+	hash := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	rendered, err := RenderSavedQuery(query, params, map[string]string{"path": "/tmp/it's", "hash": hash})
+	if err != nil {
+		t.Fatalf("RenderSavedQuery() error %v", err)
+	}
+	expected := "SELECT * FROM hash WHERE path = '/tmp/it''s' AND sha256 = '" + hash + "' LIMIT 10;"
+	if rendered != expected {
+		t.Errorf("RenderSavedQuery() = %q, expected %q", rendered, expected)
+	}
+	invalid := []map[string]string{
+		{"hash": hash},
+		{"path": "/tmp", "hash": "abc"},
+		{"path": "/tmp", "hash": hash, "limit": "1; DROP"},
+	}
+	for _, values := range invalid {
+		if _, err := RenderSavedQuery(query, params, values); err == nil {
+			t.Errorf("RenderSavedQuery(%v) expected error", values)
+		}
+	}
+}
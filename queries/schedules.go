@@ -0,0 +1,301 @@
+package queries
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/nodes"
+)
+
+// ScheduledQuery to run an on-demand query periodically, following a cron-style schedule
+type ScheduledQuery struct {
+	gorm.Model
+	Name     string `gorm:"not null;unique;index"`
+	Creator  string
+	Query    string
+	Schedule string
+	// ExpirationHours for each run, see QueryExpirationHours
+	ExpirationHours int64
+	Paused          bool
+	LastRun         time.Time
+	NextRun         time.Time
+	Runs            int
+}
+
+// ScheduledQueryTarget to keep target logic for scheduled queries
+type ScheduledQueryTarget struct {
+	gorm.Model
+	Name  string `gorm:"index"`
+	Type  string
+	Value string
+}
+
+// Names of scheduled queries are part of the names of their runs
+var scheduleNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// ValidScheduleName to check if a name can be used for a scheduled query
+func ValidScheduleName(name string) bool {
+	return scheduleNameRegexp.MatchString(name)
+}
+
+// Helper to generate the name of the query materialized for a run of a schedule
+func scheduledRunName(name string, run time.Time) string {
+	return fmt.Sprintf("%s_%s", name, run.UTC().Format("20060102T150405"))
+}
+
+// CreateSchedule to create a new scheduled query, calculating the first run
+func (q *Queries) CreateSchedule(schedule ScheduledQuery) error {
+	if !ValidScheduleName(schedule.Name) {
+		return fmt.Errorf("invalid schedule name %q", schedule.Name)
+	}
+	cron, err := ParseCron(schedule.Schedule)
+	if err != nil {
+		return err
+	}
+	schedule.NextRun = cron.Next(time.Now())
+	if q.DB.NewRecord(schedule) {
+		if err := q.DB.Create(&schedule).Error; err != nil {
+			return err
+		}
+	} else {
+		return fmt.Errorf("db.NewRecord did not return true")
+	}
+	return nil
+}
+
+// CreateScheduleTarget to create target entry for a given scheduled query
+func (q *Queries) CreateScheduleTarget(name, targetType, targetValue string) error {
+	scheduleTarget := ScheduledQueryTarget{
+		Name:  name,
+		Type:  targetType,
+		Value: targetValue,
+	}
+	if q.DB.NewRecord(scheduleTarget) {
+		if err := q.DB.Create(&scheduleTarget).Error; err != nil {
+			return err
+		}
+	} else {
+		return fmt.Errorf("db.NewRecord did not return true")
+	}
+	return nil
+}
+
+// GetSchedule to get a scheduled query by name
+func (q *Queries) GetSchedule(name string) (ScheduledQuery, error) {
+	var schedule ScheduledQuery
+	if err := q.DB.Where("name = ?", name).First(&schedule).Error; err != nil {
+		return schedule, err
+	}
+	return schedule, nil
+}
+
+// GetSchedules to get all scheduled queries
+func (q *Queries) GetSchedules() ([]ScheduledQuery, error) {
+	var schedules []ScheduledQuery
+	if err := q.DB.Find(&schedules).Error; err != nil {
+		return schedules, err
+	}
+	return schedules, nil
+}
+
+// GetScheduleTargets to retrieve targets for a given scheduled query
+func (q *Queries) GetScheduleTargets(name string) ([]ScheduledQueryTarget, error) {
+	var targets []ScheduledQueryTarget
+	if err := q.DB.Where("name = ?", name).Find(&targets).Error; err != nil {
+		return targets, err
+	}
+	return targets, nil
+}
+
+// GetRuns to retrieve the queries materialized by a scheduled query, most recent first
+func (q *Queries) GetRuns(name string) ([]DistributedQuery, error) {
+	var runs []DistributedQuery
+	if err := q.DB.Where("schedule = ? AND deleted = ?", name, false).Order("created_at desc").Find(&runs).Error; err != nil {
+		return runs, err
+	}
+	return runs, nil
+}
+
+// PauseSchedule to stop materializing runs of a scheduled query
+func (q *Queries) PauseSchedule(name string) error {
+	schedule, err := q.GetSchedule(name)
+	if err != nil {
+		return err
+	}
+	if err := q.DB.Model(&schedule).Update("paused", true).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// ResumeSchedule to resume a paused scheduled query, runs missed while paused are skipped
+func (q *Queries) ResumeSchedule(name string) error {
+	schedule, err := q.GetSchedule(name)
+	if err != nil {
+		return err
+	}
+	cron, err := ParseCron(schedule.Schedule)
+	if err != nil {
+		return err
+	}
+	if err := q.DB.Model(&schedule).Updates(map[string]interface{}{"paused": false, "next_run": cron.Next(time.Now())}).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteSchedule to remove a scheduled query and its targets, past runs are kept
+func (q *Queries) DeleteSchedule(name string) error {
+	schedule, err := q.GetSchedule(name)
+	if err != nil {
+		return err
+	}
+	if err := q.DB.Where("name = ?", name).Delete(&ScheduledQueryTarget{}).Error; err != nil {
+		return err
+	}
+	if err := q.DB.Unscoped().Delete(&schedule).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetDueSchedules to get all scheduled queries not paused that must run at the given time
+func (q *Queries) GetDueSchedules(now time.Time) ([]ScheduledQuery, error) {
+	var schedules []ScheduledQuery
+	if err := q.DB.Where("paused = ? AND next_run <= ?", false, now).Find(&schedules).Error; err != nil {
+		return schedules, err
+	}
+	return schedules, nil
+}
+
+// Helper to get the active nodes expected to run a query with the given targets
+func (q *Queries) targetedNodes(targets []ScheduledQueryTarget, nodesmgr *nodes.NodeManager, hours int64) ([]nodes.OsqueryNode, error) {
+	var queryTargets []DistributedQueryTarget
+	for _, t := range targets {
+		queryTargets = append(queryTargets, DistributedQueryTarget{Type: t.Type, Value: t.Value})
+	}
+	active, err := nodesmgr.Gets("active", hours)
+	if err != nil {
+		return nil, err
+	}
+	return q.MatchingNodes(queryTargets, active)
+}
+
+// Run to materialize a run of a scheduled query as a distributed query, expiring like any other
+// query. Each run goes through the approval policy and stays pending until it is approved
+// The previous run still active is completed, so nodes only get the latest one. The next run is
+// set even if this one fails, and schedules that can not be parsed are paused
+func (q *Queries) Run(schedule ScheduledQuery, nodesmgr *nodes.NodeManager, policy ApprovalPolicy, hours, expiration int64, now time.Time) (DistributedQuery, error) {
+	cron, err := ParseCron(schedule.Schedule)
+	if err != nil {
+		if err := q.DB.Model(&schedule).Update("paused", true).Error; err != nil {
+			log.Printf("error pausing schedule %s %v", schedule.Name, err)
+		}
+		return DistributedQuery{}, err
+	}
+	query, err := q.run(schedule, nodesmgr, policy, hours, expiration, now)
+	updates := map[string]interface{}{
+		"next_run": cron.Next(now),
+	}
+	if err == nil {
+		updates["last_run"] = now
+		updates["runs"] = schedule.Runs + 1
+	}
+	if uerr := q.DB.Model(&schedule).Updates(updates).Error; uerr != nil && err == nil {
+		err = uerr
+	}
+	return query, err
+}
+
+// Helper to create the distributed query of a run, with its targets and statuses in one transaction
+func (q *Queries) run(schedule ScheduledQuery, nodesmgr *nodes.NodeManager, policy ApprovalPolicy, hours, expiration int64, now time.Time) (DistributedQuery, error) {
+	query := DistributedQuery{
+		Name:     scheduledRunName(schedule.Name, now),
+		Creator:  schedule.Creator,
+		Query:    schedule.Query,
+		Active:   true,
+		Type:     StandardQueryType,
+		Schedule: schedule.Name,
+	}
+	if expiration = QueryExpirationHours(schedule.ExpirationHours, expiration); expiration > 0 {
+		query.Expiration = now.Add(time.Duration(expiration) * time.Hour)
+	}
+	if policy.Enabled() {
+		query.Approval = ApprovalPending
+	}
+	targets, err := q.GetScheduleTargets(schedule.Name)
+	if err != nil {
+		return query, err
+	}
+	targeted, err := q.targetedNodes(targets, nodesmgr, hours)
+	if err != nil {
+		return query, err
+	}
+	query.Expected = len(targeted)
+	tx := q.DB.Begin()
+	if tx.Error != nil {
+		return query, tx.Error
+	}
+	txq := &Queries{DB: tx, Tags: q.Tags}
+	if err := txq.createRun(query, targets, targeted); err != nil {
+		tx.Rollback()
+		return query, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return query, err
+	}
+	if policy.Enabled() {
+		pending, _, err := q.CheckApproval(query.Name, policy, nodesmgr, hours)
+		if err != nil {
+			return query, err
+		}
+		if !pending {
+			query.Approval = ""
+		}
+	}
+	return query, nil
+}
+
+// Helper to complete the previous run and create a new one, with targets and pending statuses
+func (q *Queries) createRun(query DistributedQuery, targets []ScheduledQueryTarget, targeted []nodes.OsqueryNode) error {
+	if err := q.DB.Model(&DistributedQuery{}).Where("schedule = ? AND active = ?", query.Schedule, true).Updates(map[string]interface{}{"completed": true, "active": false}).Error; err != nil {
+		return err
+	}
+	if err := q.Create(query); err != nil {
+		return err
+	}
+	for _, t := range targets {
+		if err := q.CreateTarget(query.Name, t.Type, t.Value); err != nil {
+			return err
+		}
+	}
+	for _, n := range targeted {
+		if err := q.SetStatus(query.Name, n, NodeStatusPending, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunDueSchedules to materialize all scheduled queries that are due, see Run. Schedules that fail
+// are logged and do not stop the rest
+func (q *Queries) RunDueSchedules(nodesmgr *nodes.NodeManager, policy ApprovalPolicy, hours, expiration int64) ([]DistributedQuery, error) {
+	var runs []DistributedQuery
+	now := time.Now()
+	schedules, err := q.GetDueSchedules(now)
+	if err != nil {
+		return runs, err
+	}
+	for _, s := range schedules {
+		query, err := q.Run(s, nodesmgr, policy, hours, expiration, now)
+		if err != nil {
+			log.Printf("error running schedule %s - %v", s.Name, err)
+			continue
+		}
+		runs = append(runs, query)
+	}
+	return runs, nil
+}
@@ -0,0 +1,109 @@
+package queries
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/jmpsec/osctrl/nodes"
+)
+
+// Helper to prepare queries and nodes in an in-memory database, with the nodes active
+func testQueriesDB(t *testing.T, targeted ...nodes.OsqueryNode) (*Queries, *nodes.NodeManager) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("error opening database %v", err)
+	}
+	// Every connection to an in-memory database is a different database
+	db.DB().SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	nodesmgr := nodes.CreateNodes(db)
+	for _, n := range targeted {
+		if err := db.Create(&n).Error; err != nil {
+			t.Fatalf("error creating node %v", err)
+		}
+	}
+	return CreateQueries(db, nil), nodesmgr
+}
+
+func TestRunSchedule(t *testing.T) {
+	q, nodesmgr := testQueriesDB(t,
+		nodes.OsqueryNode{UUID: "AAAA", Environment: "prod"},
+		nodes.OsqueryNode{UUID: "BBBB", Environment: "dev"},
+	)
+	schedule := ScheduledQuery{Name: "uptime", Creator: "alice", Query: "SELECT * FROM uptime;", Schedule: "@hourly", ExpirationHours: 2}
+	if err := q.CreateSchedule(schedule); err != nil {
+		t.Fatalf("CreateSchedule() error %v", err)
+	}
+	if err := q.CreateScheduleTarget("uptime", QueryTargetEnvironment, "prod"); err != nil {
+		t.Fatalf("CreateScheduleTarget() error %v", err)
+	}
+	schedule, _ = q.GetSchedule("uptime")
+	now := time.Now()
+	run, err := q.Run(schedule, nodesmgr, NewApprovalPolicy(false, 0, "prod"), -72, 24, now)
+	if err != nil {
+		t.Fatalf("Run() error %v", err)
+	}
+	stored, err := q.Get(run.Name)
+	if err != nil {
+		t.Fatalf("Get() error %v", err)
+	}
+	if stored.Approval != ApprovalPending || run.Approved() || stored.Expected != 1 {
+		t.Errorf("Run() with approval = %+v", stored)
+	}
+	if !stored.Expiration.Equal(now.Add(2 * time.Hour)) {
+		t.Errorf("Run() expiration = %v", stored.Expiration)
+	}
+	if queries, _, _, err := q.NodeQueries(nodes.OsqueryNode{UUID: "AAAA", Environment: "prod"}); err != nil || len(queries) != 0 {
+		t.Errorf("NodeQueries() pending run = %v, %v", queries, err)
+	}
+	schedule, _ = q.GetSchedule("uptime")
+	schedule.ExpirationHours = 0
+	run, err = q.Run(schedule, nodesmgr, NewApprovalPolicy(false, 0, "pci"), -72, 24, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Run() error %v", err)
+	}
+	stored, _ = q.Get(run.Name)
+	if stored.Approval != "" || !run.Approved() || !stored.Expiration.Equal(now.Add(25*time.Hour)) {
+		t.Errorf("Run() without approval = %+v", stored)
+	}
+	if queries, _, _, err := q.NodeQueries(nodes.OsqueryNode{UUID: "AAAA", Environment: "prod"}); err != nil || len(queries) != 1 {
+		t.Errorf("NodeQueries() approved run = %v, %v", queries, err)
+	}
+}
+
+func TestRunDueSchedules(t *testing.T) {
+	q, nodesmgr := testQueriesDB(t, nodes.OsqueryNode{UUID: "AAAA", Environment: "prod"})
+	past := time.Now().Add(-time.Minute)
+	// A schedule that can not be parsed fails, without stopping the schedules after it
+	broken := ScheduledQuery{Name: "broken", Creator: "alice", Query: "SELECT 1;", Schedule: "not a schedule", NextRun: past}
+	if err := q.DB.Create(&broken).Error; err != nil {
+		t.Fatalf("error creating schedule %v", err)
+	}
+	if err := q.CreateSchedule(ScheduledQuery{Name: "uptime", Creator: "alice", Query: "SELECT * FROM uptime;", Schedule: "@hourly"}); err != nil {
+		t.Fatalf("CreateSchedule() error %v", err)
+	}
+	if err := q.CreateScheduleTarget("uptime", QueryTargetEnvironment, "prod"); err != nil {
+		t.Fatalf("CreateScheduleTarget() error %v", err)
+	}
+	if err := q.DB.Model(&ScheduledQuery{}).Where("name = ?", "uptime").Update("next_run", past).Error; err != nil {
+		t.Fatalf("error updating schedule %v", err)
+	}
+	runs, err := q.RunDueSchedules(nodesmgr, NewApprovalPolicy(false, 0, ""), -72, 24)
+	if err != nil {
+		t.Fatalf("RunDueSchedules() error %v", err)
+	}
+	if len(runs) != 1 || runs[0].Schedule != "uptime" || runs[0].Expected != 1 {
+		t.Fatalf("RunDueSchedules() = %+v", runs)
+	}
+	if broken, _ = q.GetSchedule("broken"); !broken.Paused {
+		t.Errorf("RunDueSchedules() did not pause broken schedule")
+	}
+	if due, _ := q.GetDueSchedules(time.Now()); len(due) != 0 {
+		t.Errorf("GetDueSchedules() after run = %+v", due)
+	}
+	if statuses, err := q.GetStatuses(runs[0].Name); err != nil || len(statuses) != 1 {
+		t.Errorf("GetStatuses() = %v, %v", statuses, err)
+	}
+}
@@ -0,0 +1,139 @@
+package queries
+
+import (
+	"sort"
+)
+
+// ExecutionStats to hold the stats reported by osquery for one execution of a query, times are
+// in milliseconds and memory in bytes
+type ExecutionStats struct {
+	WallTimeMs int64 `json:"wall_time_ms"`
+	UserTime   int64 `json:"user_time"`
+	SystemTime int64 `json:"system_time"`
+	Memory     int64 `json:"memory"`
+}
+
+// ExecutionMessage to hold an error message reported by nodes and how many nodes reported it
+type ExecutionMessage struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
+
+// ExecutionSummary to hold the stats of all the executions of a query
+type ExecutionSummary struct {
+	Executions    int                `json:"executions"`
+	Errors        int                `json:"errors"`
+	Skipped       int                `json:"skipped"`
+	Reported      int                `json:"reported"`
+	WallTimeP50   int64              `json:"wall_time_p50"`
+	WallTimeP95   int64              `json:"wall_time_p95"`
+	WallTimeMax   int64              `json:"wall_time_max"`
+	MemoryP50     int64              `json:"memory_p50"`
+	MemoryP95     int64              `json:"memory_p95"`
+	MemoryMax     int64              `json:"memory_max"`
+	UserTimeAvg   int64              `json:"user_time_avg"`
+	SystemTimeAvg int64              `json:"system_time_avg"`
+	Messages      []ExecutionMessage `json:"messages"`
+}
+
+// Helper to get a percentile of sorted values, using the nearest rank
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// SummarizeExecutions to aggregate the stats of the executions of a query, only executions with
+// stats reported by osquery are used for times and memory. Nodes skipped by discovery are counted apart
+func SummarizeExecutions(executions []DistributedQueryExecution) ExecutionSummary {
+	summary := ExecutionSummary{Messages: []ExecutionMessage{}}
+	var wallTimes, memory []int64
+	var userTime, systemTime int64
+	messages := make(map[string]int)
+	for _, e := range executions {
+		if e.Skipped {
+			summary.Skipped++
+			continue
+		}
+		summary.Executions++
+		if e.Result != 0 {
+			summary.Errors++
+			if e.Message != "" {
+				messages[e.Message]++
+			}
+		}
+		if !e.Reported {
+			continue
+		}
+		summary.Reported++
+		wallTimes = append(wallTimes, e.WallTimeMs)
+		memory = append(memory, e.Memory)
+		userTime += e.UserTime
+		systemTime += e.SystemTime
+	}
+	if summary.Reported > 0 {
+		sort.Slice(wallTimes, func(i, j int) bool { return wallTimes[i] < wallTimes[j] })
+		sort.Slice(memory, func(i, j int) bool { return memory[i] < memory[j] })
+		summary.WallTimeP50 = percentile(wallTimes, 50)
+		summary.WallTimeP95 = percentile(wallTimes, 95)
+		summary.WallTimeMax = wallTimes[len(wallTimes)-1]
+		summary.MemoryP50 = percentile(memory, 50)
+		summary.MemoryP95 = percentile(memory, 95)
+		summary.MemoryMax = memory[len(memory)-1]
+		summary.UserTimeAvg = userTime / int64(summary.Reported)
+		summary.SystemTimeAvg = systemTime / int64(summary.Reported)
+	}
+	for m, c := range messages {
+		summary.Messages = append(summary.Messages, ExecutionMessage{Message: m, Count: c})
+	}
+	sort.Slice(summary.Messages, func(i, j int) bool {
+		if summary.Messages[i].Count != summary.Messages[j].Count {
+			return summary.Messages[i].Count > summary.Messages[j].Count
+		}
+		return summary.Messages[i].Message < summary.Messages[j].Message
+	})
+	return summary
+}
+
+// GetExecutions to retrieve the executions of a query by all nodes
+func (q *Queries) GetExecutions(name string) ([]DistributedQueryExecution, error) {
+	var executions []DistributedQueryExecution
+	if err := q.DB.Where("name = ?", name).Find(&executions).Error; err != nil {
+		return executions, err
+	}
+	return executions, nil
+}
+
+// ExecutionSummary to aggregate the stats of the executions of a query
+func (q *Queries) ExecutionSummary(name string) (ExecutionSummary, error) {
+	executions, err := q.GetExecutions(name)
+	if err != nil {
+		return ExecutionSummary{}, err
+	}
+	return SummarizeExecutions(executions), nil
+}
+
+// ExecutionSummaries to aggregate the stats of the executions of several queries at once
+func (q *Queries) ExecutionSummaries(names []string) (map[string]ExecutionSummary, error) {
+	summaries := make(map[string]ExecutionSummary)
+	if len(names) == 0 {
+		return summaries, nil
+	}
+	var executions []DistributedQueryExecution
+	if err := q.DB.Where("name IN (?)", names).Find(&executions).Error; err != nil {
+		return summaries, err
+	}
+	byName := make(map[string][]DistributedQueryExecution)
+	for _, e := range executions {
+		byName[e.Name] = append(byName[e.Name], e)
+	}
+	for _, n := range names {
+		summaries[n] = SummarizeExecutions(byName[n])
+	}
+	return summaries, nil
+}
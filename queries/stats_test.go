@@ -0,0 +1,41 @@
+package queries
+
+import "testing"
+
+func TestSummarizeExecutions(t *testing.T) {
+	var executions []DistributedQueryExecution
+	for i := int64(1); i <= 20; i++ {
+		executions = append(executions, DistributedQueryExecution{
+			Reported:   true,
+			WallTimeMs: i * 10,
+			UserTime:   i,
+			SystemTime: 2,
+			Memory:     i * 1024,
+		})
+	}
+	executions = append(executions,
+		DistributedQueryExecution{Result: 1, Message: "no such table: foo"},
+		DistributedQueryExecution{Result: 1, Message: "no such table: foo"},
+		DistributedQueryExecution{Result: 1, Message: "timeout"},
+		DistributedQueryExecution{Skipped: true},
+	)
+	summary := SummarizeExecutions(executions)
+	if summary.Executions != 23 || summary.Errors != 3 || summary.Reported != 20 || summary.Skipped != 1 {
+		t.Errorf("SummarizeExecutions() counts = %+v", summary)
+	}
+	if summary.WallTimeP50 != 100 || summary.WallTimeP95 != 190 || summary.WallTimeMax != 200 {
+		t.Errorf("SummarizeExecutions() wall time = %d %d %d", summary.WallTimeP50, summary.WallTimeP95, summary.WallTimeMax)
+	}
+	if summary.MemoryP95 != 190*1024/10 || summary.MemoryMax != 20*1024 {
+		t.Errorf("SummarizeExecutions() memory = %d %d", summary.MemoryP95, summary.MemoryMax)
+	}
+	if summary.UserTimeAvg != 10 || summary.SystemTimeAvg != 2 {
+		t.Errorf("SummarizeExecutions() averages = %d %d", summary.UserTimeAvg, summary.SystemTimeAvg)
+	}
+	if len(summary.Messages) != 2 || summary.Messages[0].Message != "no such table: foo" || summary.Messages[0].Count != 2 {
+		t.Errorf("SummarizeExecutions() messages = %+v", summary.Messages)
+	}
+	if empty := SummarizeExecutions(nil); empty.Executions != 0 || empty.WallTimeP95 != 0 || empty.Messages == nil {
+		t.Errorf("SummarizeExecutions(nil) = %+v", empty)
+	}
+}
@@ -0,0 +1,136 @@
+package queries
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/nodes"
+)
+
+const (
+	// NodeStatusPending for targeted nodes that have not picked up the query yet
+	NodeStatusPending string = "pending"
+	// NodeStatusDelivered for nodes that have read the query but not answered yet
+	NodeStatusDelivered string = "delivered"
+	// NodeStatusOK for nodes that answered the query successfully
+	NodeStatusOK string = "ok"
+	// NodeStatusError for nodes that answered the query with an error
+	NodeStatusError string = "error"
+	// NodeStatusExpired for nodes that did not answer before the query expired
+	NodeStatusExpired string = "expired"
+	// NodeStatusSkipped for nodes where the discovery query of the query returned no rows
+	NodeStatusSkipped string = "skipped"
+)
+
+// DistributedQueryStatus to keep track of the delivery of a query to each node
+type DistributedQueryStatus struct {
+	gorm.Model
+	Name        string `gorm:"index"`
+	UUID        string `gorm:"index"`
+	Hostname    string
+	Status      string
+	Message     string
+	DeliveredAt time.Time
+	AnsweredAt  time.Time
+}
+
+// InitStatuses to create pending statuses for the active nodes targeted by a query
+func (q *Queries) InitStatuses(name string, nodesmgr *nodes.NodeManager, hours int64) error {
+	targets, err := q.GetTargets(name)
+	if err != nil {
+		return err
+	}
+	active, err := nodesmgr.Gets("active", hours)
+	if err != nil {
+		return err
+	}
+	targeted, err := q.MatchingNodes(targets, active)
+	if err != nil {
+		return err
+	}
+	for _, n := range targeted {
+		if err := q.SetStatus(name, n, NodeStatusPending, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetStatus to create or update the status of a query for a node
+func (q *Queries) SetStatus(name string, node nodes.OsqueryNode, status, message string) error {
+	var nodeStatus DistributedQueryStatus
+	err := q.DB.Where("name = ? AND uuid = ?", name, node.UUID).First(&nodeStatus).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+	previous := nodeStatus.Status
+	nodeStatus.Name = name
+	nodeStatus.UUID = node.UUID
+	nodeStatus.Hostname = node.Hostname
+	nodeStatus.Status = status
+	nodeStatus.Message = message
+	switch status {
+	case NodeStatusDelivered:
+		// Queries read again keep the time of the first delivery
+		if previous != NodeStatusDelivered || nodeStatus.DeliveredAt.IsZero() {
+			nodeStatus.DeliveredAt = time.Now()
+		}
+	case NodeStatusOK, NodeStatusError, NodeStatusSkipped:
+		nodeStatus.AnsweredAt = time.Now()
+	}
+	if err := q.DB.Save(&nodeStatus).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// TrackDelivery to mark the queries read by a node as delivered
+func (q *Queries) TrackDelivery(qs QueryReadQueries, node nodes.OsqueryNode) error {
+	for name := range qs {
+		if err := q.SetStatus(name, node, NodeStatusDelivered, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TrackAnswer to mark a query as answered by a node, with the osquery error message if it failed
+func (q *Queries) TrackAnswer(name string, node nodes.OsqueryNode, result int, message string) error {
+	if result != 0 {
+		return q.SetStatus(name, node, NodeStatusError, message)
+	}
+	return q.SetStatus(name, node, NodeStatusOK, "")
+}
+
+// ExpireStatuses to mark as expired all nodes of a query that have not answered yet
+func (q *Queries) ExpireStatuses(name string) error {
+	if err := q.DB.Model(&DistributedQueryStatus{}).Where("name = ? AND status IN (?)", name, []string{NodeStatusPending, NodeStatusDelivered}).Update("status", NodeStatusExpired).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetStatuses to retrieve the status of a query for every node
+func (q *Queries) GetStatuses(name string) ([]DistributedQueryStatus, error) {
+	var statuses []DistributedQueryStatus
+	if err := q.DB.Where("name = ?", name).Order("status").Find(&statuses).Error; err != nil {
+		return statuses, err
+	}
+	return statuses, nil
+}
+
+// StatusCounts to count how many nodes are in each status
+func StatusCounts(statuses []DistributedQueryStatus) map[string]int {
+	counts := map[string]int{
+		NodeStatusPending:   0,
+		NodeStatusDelivered: 0,
+		NodeStatusOK:        0,
+		NodeStatusError:     0,
+		NodeStatusExpired:   0,
+		NodeStatusSkipped:   0,
+	}
+	for _, s := range statuses {
+		counts[s.Status]++
+	}
+	return counts
+}
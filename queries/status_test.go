@@ -0,0 +1,26 @@
+package queries
+
+import "testing"
+
+func TestStatusCounts(t *testing.T) {
+	statuses := []DistributedQueryStatus{
+		{Status: NodeStatusOK},
+		{Status: NodeStatusOK},
+		{Status: NodeStatusError},
+		{Status: NodeStatusDelivered},
+	}
+	counts := StatusCounts(statuses)
+	expected := map[string]int{
+		NodeStatusPending:   0,
+		NodeStatusDelivered: 1,
+		NodeStatusOK:        2,
+		NodeStatusError:     1,
+		NodeStatusExpired:   0,
+		NodeStatusSkipped:   0,
+	}
+	for status, c := range expected {
+		if counts[status] != c {
+			t.Errorf("StatusCounts()[%s] = %d, expected %d", status, counts[status], c)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package queries
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/utils"
+)
+
+const (
+	// QueryTargetTag defines tag name as target
+	QueryTargetTag string = "tag"
+	// QueryTargetHostname defines hostname glob pattern as target
+	QueryTargetHostname string = "hostname"
+	// QueryTargetHostnameRegex defines hostname regular expression as target
+	QueryTargetHostnameRegex string = "hostname-regex"
+	// QueryTargetCIDR defines IP address range in CIDR notation as target
+	QueryTargetCIDR string = "cidr"
+	// QueryTargetOsqueryVersion defines osquery version constraints as target
+	QueryTargetOsqueryVersion string = "osquery-version"
+	// QueryTargetPlatformVersion defines platform version constraints as target
+	QueryTargetPlatformVersion string = "platform-version"
+)
+
+// Operators for version constraints, longest first so they are matched before their prefixes
+var versionOperators = []string{">=", "<=", "!=", ">", "<", "="}
+
+// HostnameTarget to get the target for a hostname pattern, where /pattern/ is a regular expression
+func HostnameTarget(pattern string) (string, string) {
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return QueryTargetHostnameRegex, pattern[1 : len(pattern)-1]
+	}
+	return QueryTargetHostname, pattern
+}
+
+// ValidateTarget to check if the value of a target can be used to match nodes
+func ValidateTarget(targetType, targetValue string) error {
+	if targetValue == "" {
+		return fmt.Errorf("empty value for target %s", targetType)
+	}
+	switch targetType {
+	case QueryTargetHostname:
+		if _, err := path.Match(targetValue, ""); err != nil {
+			return fmt.Errorf("invalid hostname pattern %q - %v", targetValue, err)
+		}
+	case QueryTargetHostnameRegex:
+		if _, err := regexp.Compile(targetValue); err != nil {
+			return fmt.Errorf("invalid hostname regex %q - %v", targetValue, err)
+		}
+	case QueryTargetCIDR:
+		if _, _, err := net.ParseCIDR(targetValue); err != nil {
+			return fmt.Errorf("invalid CIDR %q - %v", targetValue, err)
+		}
+	case QueryTargetOsqueryVersion, QueryTargetPlatformVersion:
+		if _, err := parseVersionConstraints(targetValue); err != nil {
+			return err
+		}
+	case QueryTargetExpression:
+		if _, err := ParseExpression(targetValue); err != nil {
+			return fmt.Errorf("invalid target expression - %v", err)
+		}
+	}
+	return nil
+}
+
+// Helper to match a node hostname or localname with a glob pattern, case insensitive
+func matchHostname(pattern string, node nodes.OsqueryNode) bool {
+	pattern = strings.ToLower(pattern)
+	for _, h := range []string{node.Hostname, node.Localname} {
+		if ok, _ := path.Match(pattern, strings.ToLower(h)); ok && h != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Compiled hostname regular expressions, so they are not compiled again for every node
+var compiledRegexps = utils.NewBoundedCache(parsedCacheSize)
+
+// Helper to compile a regular expression, keeping it in the cache. Invalid ones are cached as nil
+func compileRegexp(expr string) *regexp.Regexp {
+	if re, ok := compiledRegexps.Get(expr); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, _ := regexp.Compile(expr)
+	compiledRegexps.Set(expr, re)
+	return re
+}
+
+// Helper to match a node hostname or localname with a regular expression
+func matchHostnameRegex(expr string, node nodes.OsqueryNode) bool {
+	re := compileRegexp(expr)
+	if re == nil {
+		return false
+	}
+	return (node.Hostname != "" && re.MatchString(node.Hostname)) || (node.Localname != "" && re.MatchString(node.Localname))
+}
+
+// Helper to check if the node IP address is in a CIDR range
+func matchCIDR(cidr string, node nodes.OsqueryNode) bool {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(node.IPAddress)
+	if ip == nil {
+		return false
+	}
+	return network.Contains(ip)
+}
+
+// Helper to check if a version satisfies all constraints
+func matchVersion(constraints, version string) bool {
+	if version == "" {
+		return false
+	}
+	cs, err := parseVersionConstraints(constraints)
+	if err != nil {
+		return false
+	}
+	for _, c := range cs {
+		cmp := compareVersions(version, c.version)
+		var ok bool
+		switch c.operator {
+		case ">=":
+			ok = cmp >= 0
+		case "<=":
+			ok = cmp <= 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case "<":
+			ok = cmp < 0
+		default:
+			ok = cmp == 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// versionConstraint to hold one operator and version, like >=4.2.0
+type versionConstraint struct {
+	operator string
+	version  string
+}
+
+// Helper to parse version constraints separated by commas, like ">=4.2.0, <4.5.0"
+func parseVersionConstraints(value string) ([]versionConstraint, error) {
+	var constraints []versionConstraint
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		c := versionConstraint{operator: "="}
+		for _, op := range versionOperators {
+			if strings.HasPrefix(part, op) {
+				c.operator = op
+				part = strings.TrimSpace(strings.TrimPrefix(part, op))
+				break
+			}
+		}
+		if part == "" {
+			return nil, fmt.Errorf("missing version in constraint %q", value)
+		}
+		c.version = part
+		constraints = append(constraints, c)
+	}
+	if len(constraints) == 0 {
+		return nil, fmt.Errorf("no version constraints in %q", value)
+	}
+	return constraints, nil
+}
+
+// Helper to compare two dotted versions, numeric parts are compared as numbers
+func compareVersions(a, b string) int {
+	split := func(v string) []string {
+		return strings.FieldsFunc(v, func(r rune) bool { return r == '.' || r == '-' || r == '_' })
+	}
+	pa, pb := split(a), split(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y string
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		nx, errx := strconv.Atoi(x)
+		ny, erry := strconv.Atoi(y)
+		if x == "" {
+			nx, errx = 0, nil
+		}
+		if y == "" {
+			ny, erry = 0, nil
+		}
+		if errx == nil && erry == nil {
+			if nx != ny {
+				if nx < ny {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// BuildTargets to prepare and validate targets by tag, hostname pattern, CIDR, versions and expression
+func BuildTargets(tagList, hostnames, cidrs []string, osqueryVersion, platformVersion, expression string) ([]DistributedQueryTarget, error) {
+	var targets []DistributedQueryTarget
+	for _, t := range tagList {
+		if t != "" {
+			targets = append(targets, DistributedQueryTarget{Type: QueryTargetTag, Value: t})
+		}
+	}
+	for _, h := range hostnames {
+		if h != "" {
+			tType, tValue := HostnameTarget(h)
+			targets = append(targets, DistributedQueryTarget{Type: tType, Value: tValue})
+		}
+	}
+	for _, c := range cidrs {
+		if c != "" {
+			targets = append(targets, DistributedQueryTarget{Type: QueryTargetCIDR, Value: c})
+		}
+	}
+	if osqueryVersion != "" {
+		targets = append(targets, DistributedQueryTarget{Type: QueryTargetOsqueryVersion, Value: osqueryVersion})
+	}
+	if platformVersion != "" {
+		targets = append(targets, DistributedQueryTarget{Type: QueryTargetPlatformVersion, Value: platformVersion})
+	}
+	if expression != "" {
+		targets = append(targets, DistributedQueryTarget{Type: QueryTargetExpression, Value: expression})
+	}
+	for _, t := range targets {
+		if err := ValidateTarget(t.Type, t.Value); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+// MatchingNodes to filter the nodes that are targeted by any of the targets
+func (q *Queries) MatchingNodes(targets []DistributedQueryTarget, candidates []nodes.OsqueryNode) ([]nodes.OsqueryNode, error) {
+	var matched []nodes.OsqueryNode
+	for _, n := range candidates {
+		nodeTags, err := q.targetTags(n, targets)
+		if err != nil {
+			return matched, err
+		}
+		if isQueryTarget(n, targets, nodeTags) {
+			matched = append(matched, n)
+		}
+	}
+	return matched, nil
+}
+
+// Helper to get the tags of a node, only if any of the targets needs them
+func (q *Queries) targetTags(node nodes.OsqueryNode, targets []DistributedQueryTarget) ([]string, error) {
+	var nodeTags []string
+	if q.Tags == nil {
+		return nodeTags, nil
+	}
+	for _, t := range targets {
+		if t.Type != QueryTargetTag && !expressionUsesTags(t) {
+			continue
+		}
+		tags, err := q.Tags.GetTags(node)
+		if err != nil {
+			return nodeTags, err
+		}
+		for _, tag := range tags {
+			nodeTags = append(nodeTags, tag.Name)
+		}
+		break
+	}
+	return nodeTags, nil
+}
+
+// Helper to check if a target is an expression that needs the tags of nodes
+func expressionUsesTags(target DistributedQueryTarget) bool {
+	if target.Type != QueryTargetExpression {
+		return false
+	}
+	e, err := ParseExpression(target.Value)
+	if err != nil {
+		return false
+	}
+	return e.UsesTags()
+}
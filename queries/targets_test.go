@@ -0,0 +1,102 @@
+package queries
+
+import (
+	"testing"
+
+	"github.com/jmpsec/osctrl/nodes"
+)
+
+var testNode = nodes.OsqueryNode{
+	UUID:            "11111111-2222-3333-4444-555555555555",
+	Hostname:        "web-01.prod.example.com",
+	Localname:       "web-01",
+	Platform:        "ubuntu",
+	PlatformVersion: "18.04",
+	OsqueryVersion:  "4.4.0",
+	IPAddress:       "10.1.2.3",
+	Environment:     "prod",
+}
+
+func TestIsQueryTarget(t *testing.T) {
+	tests := []struct {
+		target DistributedQueryTarget
+		tags   []string
+		match  bool
+	}{
+		{DistributedQueryTarget{Type: QueryTargetTag, Value: "web"}, []string{"db", "web"}, true},
+		{DistributedQueryTarget{Type: QueryTargetTag, Value: "web"}, []string{"db"}, false},
+		{DistributedQueryTarget{Type: QueryTargetHostname, Value: "WEB-*"}, nil, true},
+		{DistributedQueryTarget{Type: QueryTargetHostname, Value: "db-*"}, nil, false},
+		{DistributedQueryTarget{Type: QueryTargetHostnameRegex, Value: `^web-\d+\.prod\.`}, nil, true},
+		{DistributedQueryTarget{Type: QueryTargetHostnameRegex, Value: `^db-`}, nil, false},
+		{DistributedQueryTarget{Type: QueryTargetCIDR, Value: "10.1.0.0/16"}, nil, true},
+		{DistributedQueryTarget{Type: QueryTargetCIDR, Value: "192.168.0.0/16"}, nil, false},
+		{DistributedQueryTarget{Type: QueryTargetOsqueryVersion, Value: ">=4.2.0, <4.5"}, nil, true},
+		{DistributedQueryTarget{Type: QueryTargetOsqueryVersion, Value: "<4.4.0"}, nil, false},
+		{DistributedQueryTarget{Type: QueryTargetPlatformVersion, Value: "18.04"}, nil, true},
+		{DistributedQueryTarget{Type: QueryTargetPlatformVersion, Value: ">=20.04"}, nil, false},
+	}
+	for _, tt := range tests {
+		if got := isQueryTarget(testNode, []DistributedQueryTarget{tt.target}, tt.tags); got != tt.match {
+			t.Errorf("isQueryTarget(%s=%s) = %v, expected %v", tt.target.Type, tt.target.Value, got, tt.match)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		cmp  int
+	}{
+		{"4.4.0", "4.4.0", 0},
+		{"4.4", "4.4.0", 0},
+		{"4.10.0", "4.9.2", 1},
+		{"3.3.2", "4.0.0", -1},
+		{"10.0.18363", "10.0.17763", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.cmp {
+			t.Errorf("compareVersions(%s, %s) = %d, expected %d", tt.a, tt.b, got, tt.cmp)
+		}
+	}
+}
+
+func TestValidateTarget(t *testing.T) {
+	if err := ValidateTarget(QueryTargetCIDR, "10.0.0.0/33"); err == nil {
+		t.Errorf("expected error for invalid CIDR")
+	}
+	if err := ValidateTarget(QueryTargetHostnameRegex, "web-(["); err == nil {
+		t.Errorf("expected error for invalid regex")
+	}
+	if err := ValidateTarget(QueryTargetOsqueryVersion, ">="); err == nil {
+		t.Errorf("expected error for missing version")
+	}
+	if err := ValidateTarget(QueryTargetHostname, "web-*"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestHostnameTarget(t *testing.T) {
+	if tt, v := HostnameTarget("/^web-/"); tt != QueryTargetHostnameRegex || v != "^web-" {
+		t.Errorf("unexpected regex target %s=%s", tt, v)
+	}
+	if tt, v := HostnameTarget("web-*"); tt != QueryTargetHostname || v != "web-*" {
+		t.Errorf("unexpected glob target %s=%s", tt, v)
+	}
+}
+
+func TestCompileRegexp(t *testing.T) {
+	re := compileRegexp(`^web-\d+$`)
+	if re == nil || !re.MatchString("web-01") {
+		t.Fatalf("compileRegexp() = %v", re)
+	}
+	if compileRegexp(`^web-\d+$`) != re {
+		t.Errorf("compileRegexp() compiled a cached expression again")
+	}
+	if compileRegexp(`web-(`) != nil {
+		t.Errorf("compileRegexp() invalid expression is not nil")
+	}
+	if matchHostnameRegex(`web-(`, testNode) {
+		t.Errorf("matchHostnameRegex() invalid expression matched")
+	}
+}
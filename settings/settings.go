@@ -44,18 +44,29 @@ const (
 
 // Names for all possible settings values for services
 const (
-	DebugHTTP          string = "debug_http"
-	DebugService       string = "debug_service"
-	RefreshEnvs        string = "refresh_envs"
-	RefreshSettings    string = "refresh_settings"
-	CleanupSessions    string = "cleanup_sessions"
-	ServiceMetrics     string = "service_metrics"
-	MetricsHost        string = "metrics_host"
-	MetricsPort        string = "metrics_port"
-	MetricsProtocol    string = "metrics_protocol"
-	DefaultEnv         string = "default_env"
-	InactiveHours      string = "inactive_hours"
-	AcceleratedSeconds string = "accelerated_seconds"
+	DebugHTTP            string = "debug_http"
+	DebugService         string = "debug_service"
+	RefreshEnvs          string = "refresh_envs"
+	RefreshSettings      string = "refresh_settings"
+	CleanupSessions      string = "cleanup_sessions"
+	ServiceMetrics       string = "service_metrics"
+	MetricsHost          string = "metrics_host"
+	MetricsPort          string = "metrics_port"
+	MetricsProtocol      string = "metrics_protocol"
+	DefaultEnv           string = "default_env"
+	InactiveHours        string = "inactive_hours"
+	DriftGraceMinutes    string = "drift_grace_minutes"
+	AcceleratedSeconds   string = "accelerated_seconds"
+	QueryExpiration      string = "query_expiration_hours"
+	ApprovalCarves       string = "approval_carves"
+	ApprovalNodes        string = "approval_nodes"
+	ApprovalEnvironments string = "approval_environments"
+	ApprovalWebhook      string = "approval_webhook"
+	QueryNodeMaxRows     string = "query_node_max_rows"
+	QueryNodeMaxBytes    string = "query_node_max_bytes"
+	QueryMaxRows         string = "query_max_rows"
+	QueryMaxBytes        string = "query_max_bytes"
+	QueryChunkRows       string = "query_chunk_rows"
 )
 
 // Names for setting values for logging
@@ -496,6 +507,105 @@ func (conf *Settings) InactiveHours() int64 {
 	return value.Integer
 }
 
+// DriftGraceMinutes gets the minutes a node has to apply a new configuration before it is out of sync
+func (conf *Settings) DriftGraceMinutes() int64 {
+	value, err := conf.RetrieveValue(ServiceAdmin, DriftGraceMinutes)
+	if err != nil {
+		return 0
+	}
+	return value.Integer
+}
+
+// QueryExpiration gets the default hours for on-demand queries to expire, zero for no expiration
+func (conf *Settings) QueryExpiration() int64 {
+	value, err := conf.RetrieveValue(ServiceAdmin, QueryExpiration)
+	if err != nil {
+		return 0
+	}
+	return value.Integer
+}
+
+// ApprovalCarves checks if carves need approval by another user
+func (conf *Settings) ApprovalCarves() bool {
+	value, err := conf.RetrieveValue(ServiceAdmin, ApprovalCarves)
+	if err != nil {
+		return false
+	}
+	return value.Boolean
+}
+
+// ApprovalNodes gets the number of nodes a query can target without approval, zero for no limit
+func (conf *Settings) ApprovalNodes() int64 {
+	value, err := conf.RetrieveValue(ServiceAdmin, ApprovalNodes)
+	if err != nil {
+		return 0
+	}
+	return value.Integer
+}
+
+// ApprovalEnvironments gets the environments, separated by commas, where queries need approval
+func (conf *Settings) ApprovalEnvironments() string {
+	value, err := conf.RetrieveValue(ServiceAdmin, ApprovalEnvironments)
+	if err != nil {
+		return ""
+	}
+	return value.String
+}
+
+// ApprovalWebhook gets the URL to notify approvers about pending queries and carves
+func (conf *Settings) ApprovalWebhook() string {
+	value, err := conf.RetrieveValue(ServiceAdmin, ApprovalWebhook)
+	if err != nil {
+		return ""
+	}
+	return value.String
+}
+
+// QueryNodeMaxRows gets the maximum number of rows stored from each node for a query, zero for no limit
+func (conf *Settings) QueryNodeMaxRows() int64 {
+	value, err := conf.RetrieveValue(ServiceTLS, QueryNodeMaxRows)
+	if err != nil {
+		return 0
+	}
+	return value.Integer
+}
+
+// QueryNodeMaxBytes gets the maximum number of bytes stored from each node for a query, zero for no limit
+func (conf *Settings) QueryNodeMaxBytes() int64 {
+	value, err := conf.RetrieveValue(ServiceTLS, QueryNodeMaxBytes)
+	if err != nil {
+		return 0
+	}
+	return value.Integer
+}
+
+// QueryMaxRows gets the maximum number of rows stored for a query from all nodes, zero for no limit
+func (conf *Settings) QueryMaxRows() int64 {
+	value, err := conf.RetrieveValue(ServiceTLS, QueryMaxRows)
+	if err != nil {
+		return 0
+	}
+	return value.Integer
+}
+
+// QueryMaxBytes gets the maximum number of bytes stored for a query from all nodes, zero for no limit
+func (conf *Settings) QueryMaxBytes() int64 {
+	value, err := conf.RetrieveValue(ServiceTLS, QueryMaxBytes)
+	if err != nil {
+		return 0
+	}
+	return value.Integer
+}
+
+// QueryChunkRows gets the number of rows stored together for query results
+func (conf *Settings) QueryChunkRows() int64 {
+	value, err := conf.RetrieveValue(ServiceTLS, QueryChunkRows)
+	if err != nil {
+		return 0
+	}
+	return value.Integer
+}
+
 // QueryResultLink gets the value to be used to generate links for on-demand queries results
 func (conf *Settings) QueryResultLink() string {
 	value, err := conf.RetrieveValue(ServiceAdmin, QueryResultLink)
@@ -16,6 +16,17 @@ func (h *HandlersTLS) ProcessCarveInit(req types.CarveInitRequest, sessionid, en
 		log.Printf("error retrieving node %s", err)
 		return err
 	}
+	// Retrieve the user that requested the carve, for per-user quotas
+	var creator string
+	if q, err := h.Queries.Get(req.RequestID); err == nil {
+		creator = q.Creator
+	}
+	// Make sure the carve is within the limits for environment and user
+	if err := h.Carves.CheckQuota(environment, creator, req.CarveSize, req.BlockSize, req.BlockCount); err != nil {
+		h.Inc(metricInitErr)
+		log.Printf("rejected carve %s from %s - %v", req.CarveID, node.UUID, err)
+		return err
+	}
 	// Prepare carve to initialize
 	carve := carves.CarvedFile{
 		CarveID:         req.CarveID,
@@ -23,6 +34,7 @@ func (h *HandlersTLS) ProcessCarveInit(req types.CarveInitRequest, sessionid, en
 		SessionID:       sessionid,
 		UUID:            node.UUID,
 		Environment:     environment,
+		Creator:         creator,
 		CarveSize:       req.CarveSize,
 		BlockSize:       req.BlockSize,
 		TotalBlocks:     req.BlockCount,
@@ -49,12 +61,12 @@ func (h *HandlersTLS) ProcessCarveBlock(req types.CarveBlockRequest, environment
 		Environment: environment,
 		BlockID:     req.BlockID,
 		Data:        req.Data,
-		Size:        len(req.Data),
 	}
-	// Create Block
+	// Create Block, blocks that were not announced are not stored nor completed
 	if err := h.Carves.CreateBlock(block); err != nil {
 		h.Inc(metricBlockErr)
 		log.Printf("error creating CarvedBlock %v", err)
+		return
 	}
 	// Bump block completion
 	if err := h.Carves.CompleteBlock(req.SessionID); err != nil {
@@ -5,10 +5,12 @@ go 1.14
 require (
 	github.com/gorilla/mux v1.6.2
 	github.com/jmpsec/osctrl/carves v0.2.2
+	github.com/jmpsec/osctrl/configs v0.2.2
 	github.com/jmpsec/osctrl/environments v0.2.2
 	github.com/jmpsec/osctrl/logging v0.2.2
 	github.com/jmpsec/osctrl/metrics v0.2.2
 	github.com/jmpsec/osctrl/nodes v0.2.2
+	github.com/jmpsec/osctrl/packs v0.2.2
 	github.com/jmpsec/osctrl/queries v0.2.2
 	github.com/jmpsec/osctrl/settings v0.2.2
 	github.com/jmpsec/osctrl/tags v0.0.0-20200527045717-0e3b5d71cf19
@@ -20,6 +22,8 @@ require (
 
 replace github.com/jmpsec/osctrl/carves => ../../carves
 
+replace github.com/jmpsec/osctrl/configs => ../../configs
+
 replace github.com/jmpsec/osctrl/environments => ../../environments
 
 replace github.com/jmpsec/osctrl/logging => ../../logging
@@ -35,3 +39,5 @@ replace github.com/jmpsec/osctrl/settings => ../../settings
 replace github.com/jmpsec/osctrl/types => ../../types
 
 replace github.com/jmpsec/osctrl/utils => ../../utils
+
+replace github.com/jmpsec/osctrl/packs => ../../packs
@@ -10,6 +10,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/jmpsec/osctrl/carves"
+	"github.com/jmpsec/osctrl/configs"
 	"github.com/jmpsec/osctrl/environments"
 	"github.com/jmpsec/osctrl/logging"
 	"github.com/jmpsec/osctrl/metrics"
@@ -58,6 +59,7 @@ type HandlersTLS struct {
 	Tags        *tags.TagManager
 	Queries     *queries.Queries
 	Carves      *carves.Carves
+	Configs     *configs.Configs
 	Settings    *settings.Settings
 	SettingsMap *settings.MapSettings
 	Metrics     *metrics.Metrics
@@ -114,6 +116,12 @@ func WithCarves(carves *carves.Carves) HandlersOption {
 	}
 }
 
+func WithConfigs(configs *configs.Configs) HandlersOption {
+	return func(h *HandlersTLS) {
+		h.Configs = configs
+	}
+}
+
 func WithMetrics(metrics *metrics.Metrics) HandlersOption {
 	return func(h *HandlersTLS) {
 		h.Metrics = metrics
@@ -283,7 +291,7 @@ func (h *HandlersTLS) ConfigHandler(w http.ResponseWriter, r *http.Request) {
 			h.Inc(metricConfigErr)
 			log.Printf("error refreshing last config %v", err)
 		}
-		response = []byte(e.Configuration)
+		response = []byte(h.nodeConfiguration(e, t.NodeKey))
 	} else {
 		response = types.ConfigResponse{NodeInvalid: true}
 	}
@@ -398,6 +406,7 @@ func (h *HandlersTLS) QueryReadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	var nodeInvalid, accelerate bool
 	qs := make(queries.QueryReadQueries)
+	discovery := make(queries.QueryReadDiscovery)
 	// Lookup node by node_key
 	node, err := h.Nodes.GetByKey(t.NodeKey)
 	if err == nil {
@@ -407,11 +416,22 @@ func (h *HandlersTLS) QueryReadHandler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("error updating IP Address %v", err)
 		}
 		nodeInvalid = false
-		qs, accelerate, err = h.Queries.NodeQueries(node)
+		// Queries read a full interval ago and not answered did not match their discovery query
+		interval := time.Duration((*h.EnvsMap)[env].QueryInterval) * time.Second
+		if _, err := h.Queries.SkipUndiscovered(node, interval); err != nil {
+			h.Inc(metricReadErr)
+			log.Printf("error skipping undiscovered queries %v", err)
+		}
+		qs, discovery, accelerate, err = h.Queries.NodeQueries(node)
 		if err != nil {
 			h.Inc(metricReadErr)
 			log.Printf("error getting queries from db %v", err)
 		}
+		// Keep track of the queries delivered to this node
+		if err := h.Queries.TrackDelivery(qs, node); err != nil {
+			h.Inc(metricReadErr)
+			log.Printf("error tracking delivered queries %v", err)
+		}
 		// Refresh last query read request
 		err = h.Nodes.RefreshLastQueryRead(t.NodeKey)
 		if err != nil {
@@ -426,9 +446,9 @@ func (h *HandlersTLS) QueryReadHandler(w http.ResponseWriter, r *http.Request) {
 	var response interface{}
 	if accelerate {
 		sAccelerate := int((*h.SettingsMap)[settings.AcceleratedSeconds].Integer)
-		response = types.AcceleratedQueryReadResponse{Queries: qs, Accelerate: sAccelerate, NodeInvalid: nodeInvalid}
+		response = types.AcceleratedQueryReadResponse{Queries: qs, Discovery: discovery, Accelerate: sAccelerate, NodeInvalid: nodeInvalid}
 	} else {
-		response = types.QueryReadResponse{Queries: qs, NodeInvalid: nodeInvalid}
+		response = types.QueryReadResponse{Queries: qs, Discovery: discovery, NodeInvalid: nodeInvalid}
 	}
 	// Debug HTTP
 	if (*h.EnvsMap)[env].DebugHTTP {
@@ -474,7 +494,7 @@ func (h *HandlersTLS) QueryWriteHandler(w http.ResponseWriter, r *http.Request)
 		}
 		nodeInvalid = false
 		// Process submitted results
-		go h.Logs.ProcessLogQueryResult(t.Queries, t.Statuses, t.NodeKey, env, (*h.EnvsMap)[env].DebugHTTP)
+		go h.Logs.ProcessLogQueryResult(t, env, (*h.EnvsMap)[env].DebugHTTP)
 	} else {
 		nodeInvalid = true
 	}
@@ -543,7 +563,7 @@ func (h *HandlersTLS) QuickEnrollHandler(w http.ResponseWriter, r *http.Request)
 		}
 	}
 	// Prepare response with the script
-	quickScript, err := environments.QuickAddScript("osctrl-"+e.Name, script, e)
+	quickScript, err := h.Envs.QuickScript("osctrl-"+e.Name, script, e)
 	if err != nil {
 		h.Inc(metricOnelinerErr)
 		log.Printf("error getting script %v", err)
@@ -583,7 +603,7 @@ func (h *HandlersTLS) CarveInitHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	initCarve := false
-	var carveSessionID string
+	var carveSessionID, initError string
 	// Check if provided node_key is valid and if so, update node
 	if h.Nodes.CheckByKey(t.NodeKey) {
 		if err := h.Nodes.UpdateIPAddressByKey(r.Header.Get("X-Real-IP"), t.NodeKey); err != nil {
@@ -597,10 +617,13 @@ func (h *HandlersTLS) CarveInitHandler(w http.ResponseWriter, r *http.Request) {
 			h.Inc(metricInitErr)
 			log.Printf("error procesing carve init %v", err)
 			initCarve = false
+			if _, ok := err.(*carves.QuotaError); ok {
+				initError = err.Error()
+			}
 		}
 	}
 	// Prepare response
-	response := types.CarveInitResponse{Success: initCarve, SessionID: carveSessionID}
+	response := types.CarveInitResponse{Success: initCarve, SessionID: carveSessionID, Error: initError}
 	// Debug HTTP
 	if (*h.EnvsMap)[env].DebugHTTP {
 		log.Printf("Response: %+v", response)
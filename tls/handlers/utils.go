@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jmpsec/osctrl/configs"
 	"github.com/jmpsec/osctrl/environments"
 	"github.com/jmpsec/osctrl/nodes"
 	"github.com/jmpsec/osctrl/types"
@@ -106,3 +107,32 @@ func uniq(duplicated []string) []string {
 	}
 	return result
 }
+
+// Helper to get the configuration for a node, composed with packs and overlays if available
+// Templates are never served as they are, if composing fails the last good configuration is used
+func (h *HandlersTLS) nodeConfiguration(env environments.TLSEnvironment, nodeKey string) string {
+	if h.Configs == nil {
+		return configs.Fallback(env.Configuration)
+	}
+	node, err := h.Nodes.GetByKey(nodeKey)
+	if err != nil {
+		log.Printf("error getting node %v", err)
+		return configs.Fallback(env.Configuration)
+	}
+	served := configs.Fallback(env.Configuration)
+	effective, err := h.Configs.Effective(node)
+	if err != nil {
+		h.Inc(metricConfigErr)
+		log.Printf("error composing configuration for %s %v", node.UUID, err)
+		if last, ok := h.Configs.LastGood(node.UUID); ok {
+			served = last
+		}
+	} else {
+		served = effective.Configuration
+	}
+	// Drift is checked against what nodes were served and since when
+	if err := h.Configs.TrackServed(node, served); err != nil {
+		log.Printf("error tracking served configuration %v", err)
+	}
+	return served
+}
@@ -9,10 +9,12 @@ import (
 
 	"github.com/jmpsec/osctrl/backend"
 	"github.com/jmpsec/osctrl/carves"
+	"github.com/jmpsec/osctrl/configs"
 	"github.com/jmpsec/osctrl/environments"
 	"github.com/jmpsec/osctrl/logging"
 	"github.com/jmpsec/osctrl/metrics"
 	"github.com/jmpsec/osctrl/nodes"
+	"github.com/jmpsec/osctrl/packs"
 	"github.com/jmpsec/osctrl/queries"
 	"github.com/jmpsec/osctrl/settings"
 	"github.com/jmpsec/osctrl/tags"
@@ -47,6 +49,16 @@ const (
 	defaultRefresh int = 300
 	// Default accelerate interval in seconds
 	defaultAccelerate int = 300
+	// Default maximum number of rows stored from each node for a query
+	defaultQueryNodeMaxRows int = 50000
+	// Default maximum number of bytes stored from each node for a query
+	defaultQueryNodeMaxBytes int = 16 * 1024 * 1024
+	// Default maximum number of rows stored for a query
+	defaultQueryMaxRows int = 1000000
+	// Default maximum number of bytes stored for a query
+	defaultQueryMaxBytes int = 512 * 1024 * 1024
+	// Default number of rows stored together for query results
+	defaultQueryChunkRows int = 1000
 )
 
 var (
@@ -70,6 +82,8 @@ var (
 	loggerTLS   *logging.LoggerTLS
 	handlersTLS *thandlers.HandlersTLS
 	tagsmgr     *tags.TagManager
+	packsmgr    *packs.Packs
+	configsmgr  *configs.Configs
 )
 
 // Variables for flags
@@ -77,6 +91,7 @@ var (
 	versionFlag *bool
 	configFlag  *string
 	dbFlag      *string
+	carvesFlag  *string
 )
 
 // Valid values for auth and logging in configuration
@@ -125,6 +140,7 @@ func init() {
 	versionFlag = flag.Bool("v", false, "Displays the binary version.")
 	configFlag = flag.String("c", configurationFile, "Service configuration JSON file to use.")
 	dbFlag = flag.String("D", dbConfigurationFile, "DB configuration JSON file to use.")
+	carvesFlag = flag.String("K", "", "Master keys file to encrypt carves at rest. It can also be provided with "+carves.EnvCarvesKeys+".")
 	// Parse all flags
 	flag.Parse()
 	if *versionFlag {
@@ -176,9 +192,21 @@ func main() {
 	// Initialize tags
 	tagsmgr = tags.CreateTagManager(db)
 	// Initialize queries
-	queriesmgr = queries.CreateQueries(db)
+	queriesmgr = queries.CreateQueries(db, tagsmgr)
 	// Initialize carves
 	filecarves = carves.CreateFileCarves(db)
+	carvesKeys, err := carves.LoadKeyRing(*carvesFlag)
+	if err != nil {
+		log.Fatalf("Failed to load carves master keys - %v", err)
+	}
+	if carvesKeys != nil {
+		log.Printf("Carves encrypted at rest with master key %s", carvesKeys.Active)
+		filecarves.EnableEncryption(carvesKeys)
+	}
+	// Initialize packs
+	packsmgr = packs.CreatePacks(db)
+	// Initialize configurations
+	configsmgr = configs.CreateConfigs(db, envs, nodesmgr, packsmgr, tagsmgr)
 	// Initialize service settings
 	log.Println("Loading service settings")
 	if err := loadingSettings(settingsmgr); err != nil {
@@ -238,6 +266,7 @@ func main() {
 		thandlers.WithTags(tagsmgr),
 		thandlers.WithQueries(queriesmgr),
 		thandlers.WithCarves(filecarves),
+		thandlers.WithConfigs(configsmgr),
 		thandlers.WithSettings(settingsmgr),
 		thandlers.WithSettingsMap(&settingsmap),
 		thandlers.WithMetrics(tlsMetrics),
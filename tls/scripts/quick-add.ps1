@@ -30,10 +30,8 @@ $osqueryTempMSI = "C:\Windows\Temp\osquery-4.4.0.msi"
 $serviceName = "osqueryd"
 $serviceDescription = "osquery daemon service"
 $osqueryFlags = @"
-{{ .Environment.Flags }}
+{{ index .Flags "windows" }}
 "@
-$osqueryFlags = $osqueryFlags -replace "__SECRET_FILE__", $secretFile
-$osqueryFlags = $osqueryFlags -replace "__CERT_FILE__", $certFile
 $osqueryCertificate = @"
 {{ .Environment.Certificate }}
 "@
@@ -148,9 +148,21 @@ prepareSecret() {
 
 prepareFlags() {
   log "Preparing osquery flags"
-  sudo sh -c "cat <<EOF | sed -e 's@__SECRET_FILE__@$_SECRET_FILE@g' | sed 's@__CERT_FILE__@$_CERT@g' > $_FLAGS
-{{ .Environment.Flags }}
+  if [ "$OS" = "linux" ]; then
+    sudo sh -c "cat <<EOF > $_FLAGS
+{{ index .Flags "linux" }}
+EOF"
+  fi
+  if [ "$OS" = "darwin" ]; then
+    sudo sh -c "cat <<EOF > $_FLAGS
+{{ index .Flags "darwin" }}
 EOF"
+  fi
+  if [ "$OS" = "freebsd" ]; then
+    sudo sh -c "cat <<EOF > $_FLAGS
+{{ index .Flags "freebsd" }}
+EOF"
+  fi
 }
 
 prepareCert() {
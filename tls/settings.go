@@ -61,6 +61,36 @@ func loadingSettings(mgr *settings.Settings) error {
 			return fmt.Errorf("Failed to add %s to configuration: %v", settings.RefreshSettings, err)
 		}
 	}
+	// Check if service settings for maximum rows from each node is ready
+	if !mgr.IsValue(settings.ServiceTLS, settings.QueryNodeMaxRows) {
+		if err := mgr.NewIntegerValue(settings.ServiceTLS, settings.QueryNodeMaxRows, int64(defaultQueryNodeMaxRows)); err != nil {
+			return fmt.Errorf("Failed to add %s to configuration: %v", settings.QueryNodeMaxRows, err)
+		}
+	}
+	// Check if service settings for maximum bytes from each node is ready
+	if !mgr.IsValue(settings.ServiceTLS, settings.QueryNodeMaxBytes) {
+		if err := mgr.NewIntegerValue(settings.ServiceTLS, settings.QueryNodeMaxBytes, int64(defaultQueryNodeMaxBytes)); err != nil {
+			return fmt.Errorf("Failed to add %s to configuration: %v", settings.QueryNodeMaxBytes, err)
+		}
+	}
+	// Check if service settings for maximum rows for each query is ready
+	if !mgr.IsValue(settings.ServiceTLS, settings.QueryMaxRows) {
+		if err := mgr.NewIntegerValue(settings.ServiceTLS, settings.QueryMaxRows, int64(defaultQueryMaxRows)); err != nil {
+			return fmt.Errorf("Failed to add %s to configuration: %v", settings.QueryMaxRows, err)
+		}
+	}
+	// Check if service settings for maximum bytes for each query is ready
+	if !mgr.IsValue(settings.ServiceTLS, settings.QueryMaxBytes) {
+		if err := mgr.NewIntegerValue(settings.ServiceTLS, settings.QueryMaxBytes, int64(defaultQueryMaxBytes)); err != nil {
+			return fmt.Errorf("Failed to add %s to configuration: %v", settings.QueryMaxBytes, err)
+		}
+	}
+	// Check if service settings for rows stored together for query results is ready
+	if !mgr.IsValue(settings.ServiceTLS, settings.QueryChunkRows) {
+		if err := mgr.NewIntegerValue(settings.ServiceTLS, settings.QueryChunkRows, int64(defaultQueryChunkRows)); err != nil {
+			return fmt.Errorf("Failed to add %s to configuration: %v", settings.QueryChunkRows, err)
+		}
+	}
 	// Write JSON config to settings
 	logging := strings.Join(tlsConfig.Logging, ",")
 	if err := mgr.SetAllJSON(settings.ServiceTLS, tlsConfig.Listener, tlsConfig.Port, tlsConfig.Host, tlsConfig.Auth, logging); err != nil {
@@ -165,16 +165,18 @@ type QueryReadRequest GenericRequest
 
 // QueryReadResponse for on-demand queries from nodes
 type QueryReadResponse struct {
-	Queries     queries.QueryReadQueries `json:"queries"`
-	NodeInvalid bool                     `json:"node_invalid"`
+	Queries     queries.QueryReadQueries   `json:"queries"`
+	Discovery   queries.QueryReadDiscovery `json:"discovery,omitempty"`
+	NodeInvalid bool                       `json:"node_invalid"`
 }
 
 // AcceleratedQueryReadResponse for accelerated on-demand queries from nodes
 // https://github.com/osquery/osquery/blob/master/osquery/distributed/distributed.cpp#L219-L231
 type AcceleratedQueryReadResponse struct {
-	Queries     queries.QueryReadQueries `json:"queries"`
-	NodeInvalid bool                     `json:"node_invalid"`
-	Accelerate  int                      `json:"accelerate"`
+	Queries     queries.QueryReadQueries   `json:"queries"`
+	Discovery   queries.QueryReadDiscovery `json:"discovery,omitempty"`
+	NodeInvalid bool                       `json:"node_invalid"`
+	Accelerate  int                        `json:"accelerate"`
 }
 
 // QueryWriteQueries to hold the on-demand queries results
@@ -183,10 +185,28 @@ type QueryWriteQueries map[string]json.RawMessage
 // QueryWriteStatuses to hold the on-demand queries statuses
 type QueryWriteStatuses map[string]int
 
+// QueryWriteMessages to hold the on-demand queries error messages
+type QueryWriteMessages map[string]string
+
+// QueryWriteStat to hold the stats of an on-demand query execution, times in milliseconds
+// and memory in bytes. Older osquery versions send the wall time in seconds
+type QueryWriteStat struct {
+	WallTime   int64 `json:"wall_time"`
+	WallTimeMs int64 `json:"wall_time_ms"`
+	UserTime   int64 `json:"user_time"`
+	SystemTime int64 `json:"system_time"`
+	Memory     int64 `json:"memory"`
+}
+
+// QueryWriteStats to hold the on-demand queries execution stats
+type QueryWriteStats map[string]QueryWriteStat
+
 // QueryWriteRequest to receive on-demand queries results
 type QueryWriteRequest struct {
 	Queries  QueryWriteQueries  `json:"queries"`
 	Statuses QueryWriteStatuses `json:"statuses"`
+	Messages QueryWriteMessages `json:"messages"`
+	Stats    QueryWriteStats    `json:"stats"`
 	NodeKey  string             `json:"node_key"`
 }
 
@@ -195,9 +215,13 @@ type QueryWriteResponse GenericResponse
 
 // QueryWriteData to store result of on-demand queries
 type QueryWriteData struct {
-	Name   string          `json:"name"`
-	Result json.RawMessage `json:"result"`
-	Status int             `json:"status"`
+	Name      string          `json:"name"`
+	Result    json.RawMessage `json:"result"`
+	Status    int             `json:"status"`
+	Truncated bool            `json:"truncated,omitempty"`
+	TotalRows int             `json:"total_rows,omitempty"`
+	Chunk     int             `json:"chunk,omitempty"`
+	Chunks    int             `json:"chunks,omitempty"`
 }
 
 // CarveInitRequest received to begin a carve
@@ -214,6 +238,7 @@ type CarveInitRequest struct {
 type CarveInitResponse struct {
 	Success   bool   `json:"success"`
 	SessionID string `json:"session_id"`
+	Error     string `json:"error,omitempty"`
 }
 
 // CarveBlockRequest received to begin a carve
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"sync"
+)
+
+// BoundedCache - Cache safe for concurrent use, emptied when it is full so it never grows over size
+type BoundedCache struct {
+	mutex   sync.RWMutex
+	size    int
+	entries map[string]interface{}
+}
+
+// NewBoundedCache - Helper to create a cache that keeps up to size entries
+func NewBoundedCache(size int) *BoundedCache {
+	return &BoundedCache{size: size, entries: make(map[string]interface{})}
+}
+
+// Get - Helper to get a value from the cache
+func (c *BoundedCache) Get(key string) (interface{}, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	value, ok := c.entries[key]
+	return value, ok
+}
+
+// Set - Helper to keep a value in the cache, emptying it first if it is full
+func (c *BoundedCache) Set(key string, value interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		c.entries = make(map[string]interface{})
+	}
+	c.entries[key] = value
+}
+
+// Len - Helper to get the number of entries in the cache
+func (c *BoundedCache) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.entries)
+}
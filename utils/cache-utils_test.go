@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoundedCache(t *testing.T) {
+	c := NewBoundedCache(10)
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	value, ok := c.Get("4")
+	assert.True(t, ok)
+	assert.Equal(t, 4, value)
+	// Existing keys are replaced without emptying the cache
+	c.Set("4", 40)
+	assert.Equal(t, 10, c.Len())
+	c.Set("full", true)
+	assert.Equal(t, 1, c.Len())
+	_, ok = c.Get("4")
+	assert.False(t, ok)
+}
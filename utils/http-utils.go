@@ -24,6 +24,9 @@ const TextPlain string = "text/plain"
 // TextPlainUTF8 for Content-Type headers, UTF charset
 const TextPlainUTF8 string = TextPlain + "; charset=UTF-8"
 
+// EventStream for Content-Type headers of Server-Sent Events
+const EventStream string = "text/event-stream"
+
 // ContentType for header key
 const ContentType string = "Content-Type"
 
@@ -120,3 +123,45 @@ func HTTPResponse(w http.ResponseWriter, cType string, code int, data interface{
 	w.WriteHeader(code)
 	_, _ = w.Write(content)
 }
+
+// SSEWriter - Helper to send Server-Sent Events, each event is flushed to the client
+type SSEWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+// NewSSEWriter - Helper to start a response of Server-Sent Events
+func NewSSEWriter(w http.ResponseWriter) (*SSEWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming is not supported")
+	}
+	w.Header().Set(ContentType, EventStream)
+	w.Header().Set("Cache-Control", "no-cache")
+	// Proxies like nginx buffer responses unless told otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &SSEWriter{w: w, flusher: flusher}, nil
+}
+
+// Send - Helper to send one event with the data serialized as JSON, the id is used by clients to resume
+func (s *SSEWriter) Send(id, event string, data interface{}) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", content)
+	if _, err := io.WriteString(s.w, b.String()); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
@@ -40,6 +40,17 @@ func TestHTTPResponse(t *testing.T) {
 	})
 }
 
+func TestSSEWriter(t *testing.T) {
+	rr := httptest.NewRecorder()
+	sse, err := NewSSEWriter(rr)
+	assert.NoError(t, err)
+	assert.Equal(t, EventStream, rr.Header().Get(ContentType))
+	assert.NoError(t, sse.Send("7", "progress", map[string]int{"answered": 1}))
+	assert.NoError(t, sse.Send("", "", "done"))
+	assert.Equal(t, "id: 7\nevent: progress\ndata: {\"answered\":1}\n\ndata: \"done\"\n\n", rr.Body.String())
+	assert.True(t, rr.Flushed)
+}
+
 func serverMock() *httptest.Server {
 	handler := http.NewServeMux()
 	handler.HandleFunc("/server/testing", testingMock)
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"fmt"
+)
+
+// BytesSize - Helper to format a number of bytes with the largest unit that fits
+func BytesSize(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
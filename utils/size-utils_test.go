@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBytesSize(t *testing.T) {
+	assert := assert.New(t)
+	var tests = []struct {
+		input    int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KB"},
+		{16 * 1024 * 1024, "16.0 MB"},
+		{3 * 1024 * 1024 * 1024, "3.0 GB"},
+	}
+	for _, test := range tests {
+		assert.Equal(test.expected, BytesSize(test.input))
+	}
+}
@@ -93,3 +93,8 @@ func InFutureTime(t time.Time) string {
 	}
 	return "Expires in " + StringifyTime(seconds)
 }
+
+// MillisecondsDuration - Helper to format a number of milliseconds as a duration
+func MillisecondsDuration(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).String()
+}
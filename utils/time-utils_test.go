@@ -117,3 +117,19 @@ func TestInFutureTime(t *testing.T) {
 		assert.Equal(test.expected, InFutureTime(test.input))
 	}
 }
+
+func TestMillisecondsDuration(t *testing.T) {
+	assert := assert.New(t)
+	var tests = []struct {
+		input    int64
+		expected string
+	}{
+		{0, "0s"},
+		{850, "850ms"},
+		{1500, "1.5s"},
+		{125000, "2m5s"},
+	}
+	for _, test := range tests {
+		assert.Equal(test.expected, MillisecondsDuration(test.input))
+	}
+}